@@ -0,0 +1,124 @@
+// bigoquiz-import converts flashcards, exported from Anki, Quizlet, or a spreadsheet,
+// into a quiz JSON file, for the quizzes directory.
+//
+// For instance:
+//
+//	$ go run ./cmd/bigoquiz-import -format=anki -title="Spanish" -o quizzes/spanish.json spanish.txt
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes/flashcards"
+)
+
+// formatFromFilename guesses the format from the file extension.
+func formatFromFilename(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return flashcards.FORMAT_CSV
+	case ".tsv":
+		return flashcards.FORMAT_TSV
+	case ".txt":
+		return flashcards.FORMAT_ANKI
+	default:
+		return ""
+	}
+}
+
+func filenameWithoutExtension(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func main() {
+	format := flag.String("format", "", fmt.Sprintf("The input format: %v, %v, or %v. By default, this is guessed from the file extension.", flashcards.FORMAT_ANKI, flashcards.FORMAT_CSV, flashcards.FORMAT_TSV))
+	id := flag.String("id", "", "The quiz ID. By default, this is the output filename, without its extension.")
+	title := flag.String("title", "", "The quiz title. By default, this is the Anki top-level deck name, or the quiz ID.")
+	andReverse := flag.Bool("and-reverse", false, "Generate a reverse section for every section.")
+	output := flag.String("o", "", "The output quiz JSON file. By default, the quiz is written to stdout.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] input-file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	inputFilename := flag.Arg(0)
+
+	if *format == "" {
+		*format = formatFromFilename(inputFilename)
+	}
+
+	if !flashcards.IsValidFormat(*format) {
+		log.Fatalf("Unknown or missing format: %q", *format)
+	}
+
+	if *id == "" {
+		if *output != "" {
+			*id = filenameWithoutExtension(*output)
+		} else {
+			*id = filenameWithoutExtension(inputFilename)
+		}
+	}
+
+	input, err := os.Open(inputFilename)
+	if err != nil {
+		log.Fatalf("Open() failed: %v", err)
+	}
+	defer input.Close()
+
+	deckName, cards, err := flashcards.ReadCards(input, *format)
+	if err != nil {
+		log.Fatalf("ReadCards() failed: %v", err)
+	}
+
+	if len(cards) == 0 {
+		log.Fatalf("No cards found in %v", inputFilename)
+	}
+
+	if *title == "" {
+		*title = deckName
+	}
+
+	if *title == "" {
+		*title = *id
+	}
+
+	quiz := flashcards.BuildQuiz(*id, *title, cards, *andReverse)
+
+	data, err := json.MarshalIndent(quiz, "", "  ")
+	if err != nil {
+		log.Fatalf("MarshalIndent() failed: %v", err)
+	}
+
+	data = append(data, '\n')
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Create() failed: %v", err)
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	if _, err := w.Write(data); err != nil {
+		log.Fatalf("Write() failed: %v", err)
+	}
+
+	log.Printf("Wrote quiz %q with %v sections, from %v cards.", *id, len(quiz.Sections), len(cards))
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+)
+
+type command struct {
+	// Such as "user lookup".
+	name string
+
+	description string
+
+	run func(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"user lookup", "Print the users found by -email, -google-id, -github-id, or -facebook-id, as JSON.", runUserLookup},
+	{"user delete", "Delete the -user, and all their data. This needs -yes.", runUserDelete},
+	{"stats dump", "Print the -user's stats, for all quizzes or just the -quiz, as JSON.", runStatsDump},
+	{"stats reset", "Delete the -user's stats for the -quiz. This needs -yes.", runStatsReset},
+	{"stats recount", "Recompute the -user's counts of questions answered, and answered correctly, from their question histories, for all quizzes or just the -quiz. See -dry-run.", runStatsRecount},
+	{"stats migrate", "Move the stats for renamed sections and questions to their new IDs, via the quizzes' idMigrations, for all users or just the -user. See -dry-run.", runStatsMigrate},
+	{"stats orphans", "Print the stats whose quizzes, sections, or questions no longer exist, for all users or just the -user, as JSON.", runStatsOrphans},
+}
+
+// findCommand returns the command named by the first two arguments, and the remaining arguments.
+func findCommand(args []string) (*command, []string, bool) {
+	if len(args) < 2 {
+		return nil, nil, false
+	}
+
+	name := args[0] + " " + args[1]
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i], args[2:], true
+		}
+	}
+
+	return nil, nil, false
+}
+
+var errNotConfirmed = errors.New("this cannot be undone, so add -yes to confirm")
+
+// The login providers whose IDs may be used to find users, each with a -<provider>-id flag.
+var lookupLoginProviders = []string{config.LOGIN_PROVIDER_GOOGLE, config.LOGIN_PROVIDER_GITHUB, config.LOGIN_PROVIDER_FACEBOOK}
+
+type userLookupResult struct {
+	UserId  string              `json:"userId"`
+	Profile *domainuser.Profile `json:"profile"`
+}
+
+func runUserLookup(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("user lookup", flag.ContinueOnError)
+	email := flags.String("email", "", "The user's email address.")
+	loginIds := make([]*string, len(lookupLoginProviders))
+	for i, provider := range lookupLoginProviders {
+		loginIds[i] = flags.String(provider+"-id", "", fmt.Sprintf("The user's %v ID.", provider))
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NFlag() != 1 {
+		return fmt.Errorf("specify one of -email, or -<provider>-id")
+	}
+
+	var userIds []string
+	if len(*email) != 0 {
+		var err error
+		userIds, err = repo.GetUserIdsByEmail(c, *email)
+		if err != nil {
+			return fmt.Errorf("GetUserIdsByEmail() failed: %v", err)
+		}
+	}
+
+	for i, provider := range lookupLoginProviders {
+		if len(*loginIds[i]) == 0 {
+			continue
+		}
+
+		userId, err := repo.GetUserIdByLoginId(c, provider, *loginIds[i])
+		if err != nil {
+			return fmt.Errorf("GetUserIdByLoginId() failed: %v", err)
+		}
+
+		if len(userId) != 0 {
+			userIds = append(userIds, userId)
+		}
+	}
+
+	results := make([]userLookupResult, 0, len(userIds))
+	for _, userId := range userIds {
+		profile, err := repo.GetUserProfileById(c, userId)
+		if err != nil {
+			return fmt.Errorf("GetUserProfileById() failed: %v", err)
+		}
+
+		results = append(results, userLookupResult{UserId: userId, Profile: profile})
+	}
+
+	return writeJson(out, results)
+}
+
+func runUserDelete(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	userId := flags.String("user", "", "The user ID, as found by user lookup.")
+	yes := flags.Bool("yes", false, "Really delete the user.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*userId) == 0 {
+		return fmt.Errorf("-user is required")
+	}
+
+	profile, err := repo.GetUserProfileById(c, *userId)
+	if err != nil {
+		return fmt.Errorf("GetUserProfileById() failed: %v", err)
+	}
+
+	if profile == nil {
+		return fmt.Errorf("there is no user with the ID: %v", *userId)
+	}
+
+	if !*yes {
+		return errNotConfirmed
+	}
+
+	if err := repo.DeleteUser(c, *userId); err != nil {
+		return fmt.Errorf("DeleteUser() failed: %v", err)
+	}
+
+	fmt.Fprintf(out, "Deleted the user %v (%v)\n", *userId, profile.Email)
+	return nil
+}
+
+// getStatsBySection returns the user's stats, with their question histories, by quiz ID and then section ID,
+// for just the quiz, or for all quizzes if quizId is empty.
+func getStatsBySection(c context.Context, repo db.UserDataRepository, userId string, quizId string) (map[string]map[string]*domainuser.Stats, error) {
+	quizIds := []string{quizId}
+	if len(quizId) == 0 {
+		// These are combined for each quiz, without the question histories.
+		statsByQuiz, err := repo.GetUserStats(c, userId)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserStats() failed: %v", err)
+		}
+
+		quizIds = sortedKeys(statsByQuiz)
+	}
+
+	result := make(map[string]map[string]*domainuser.Stats, len(quizIds))
+	for _, quizId := range quizIds {
+		statsBySection, err := repo.GetUserStatsForQuiz(c, userId, quizId)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+		}
+
+		result[quizId] = statsBySection
+	}
+
+	return result, nil
+}
+
+func runStatsDump(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats dump", flag.ContinueOnError)
+	userId := flags.String("user", "", "The user ID, as found by user lookup.")
+	quizId := flags.String("quiz", "", "The quiz ID. By default, the stats for all quizzes are printed.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*userId) == 0 {
+		return fmt.Errorf("-user is required")
+	}
+
+	stats, err := getStatsBySection(c, repo, *userId, *quizId)
+	if err != nil {
+		return err
+	}
+
+	return writeJson(out, stats)
+}
+
+func runStatsReset(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats reset", flag.ContinueOnError)
+	userId := flags.String("user", "", "The user ID, as found by user lookup.")
+	quizId := flags.String("quiz", "", "The quiz ID.")
+	yes := flags.Bool("yes", false, "Really delete the stats.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*userId) == 0 || len(*quizId) == 0 {
+		return fmt.Errorf("-user and -quiz are required")
+	}
+
+	if !*yes {
+		return errNotConfirmed
+	}
+
+	if err := repo.DeleteUserStatsForQuiz(c, *userId, *quizId); err != nil {
+		return fmt.Errorf("DeleteUserStatsForQuiz() failed: %v", err)
+	}
+
+	fmt.Fprintf(out, "Deleted the stats for the quiz %v\n", *quizId)
+	return nil
+}
+
+func runStatsRecount(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats recount", flag.ContinueOnError)
+	userId := flags.String("user", "", "The user ID, as found by user lookup.")
+	quizId := flags.String("quiz", "", "The quiz ID. By default, the stats for all quizzes are recounted.")
+	dryRun := flags.Bool("dry-run", false, "Print the changes, without storing them.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*userId) == 0 {
+		return fmt.Errorf("-user is required")
+	}
+
+	stats, err := getStatsBySection(c, repo, *userId, *quizId)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, quizId := range sortedKeys(stats) {
+		for _, sectionId := range sortedKeys(stats[quizId]) {
+			before := stats[quizId][sectionId]
+			recounted := *before
+			if !recounted.RecountQuestions() {
+				continue
+			}
+
+			changed++
+			fmt.Fprintf(out, "%v/%v: answered once: %v -> %v, correct once: %v -> %v\n", quizId, sectionId,
+				before.CountQuestionsAnsweredOnce, recounted.CountQuestionsAnsweredOnce,
+				before.CountQuestionsCorrectOnce, recounted.CountQuestionsCorrectOnce)
+
+			if *dryRun {
+				continue
+			}
+
+			// Recount again, in the transaction, in case the user has answered since.
+			_, err := repo.UpdateUserStatsForSection(c, *userId, quizId, sectionId, func(stats *domainuser.Stats) error {
+				stats.RecountQuestions()
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("UpdateUserStatsForSection() failed: %v", err)
+			}
+		}
+	}
+
+	if *dryRun {
+		fmt.Fprintf(out, "%v sections would be recounted\n", changed)
+	} else {
+		fmt.Fprintf(out, "%v sections recounted\n", changed)
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func writeJson(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("json Encode() failed: %v", err)
+	}
+
+	return nil
+}
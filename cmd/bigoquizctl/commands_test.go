@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUserDataRepository implements only the methods that the commands call, for one user.
+type fakeUserDataRepository struct {
+	db.UserDataRepository
+
+	userId  string
+	profile *domainuser.Profile
+
+	// By quiz ID, and then by section ID.
+	stats map[string]map[string]*domainuser.Stats
+
+	deleted bool
+}
+
+func (db *fakeUserDataRepository) GetUserIdsByEmail(c context.Context, email string) ([]string, error) {
+	if email != db.profile.Email {
+		return nil, nil
+	}
+
+	return []string{db.userId}, nil
+}
+
+func (db *fakeUserDataRepository) GetUserIdByLoginId(c context.Context, provider string, loginId string) (string, error) {
+	if provider != config.LOGIN_PROVIDER_GITHUB || loginId != "1234" {
+		return "", nil
+	}
+
+	return db.userId, nil
+}
+
+func (db *fakeUserDataRepository) GetUserProfileById(c context.Context, strUserId string) (*domainuser.Profile, error) {
+	if strUserId != db.userId || db.deleted {
+		return nil, nil
+	}
+
+	return db.profile, nil
+}
+
+func (db *fakeUserDataRepository) DeleteUser(c context.Context, strUserId string) error {
+	db.deleted = true
+	return nil
+}
+
+func (db *fakeUserDataRepository) GetUserStats(c context.Context, strUserId string) (map[string]*domainuser.Stats, error) {
+	result := make(map[string]*domainuser.Stats)
+	for quizId := range db.stats {
+		result[quizId] = &domainuser.Stats{QuizId: quizId}
+	}
+
+	return result, nil
+}
+
+func (db *fakeUserDataRepository) GetUserStatsForQuiz(c context.Context, strUserId string, quizId string) (map[string]*domainuser.Stats, error) {
+	result := make(map[string]*domainuser.Stats)
+	for sectionId, stats := range db.stats[quizId] {
+		// A copy, like the real repository.
+		stats := *stats
+		stats.QuestionHistories = slices.Clone(stats.QuestionHistories)
+		result[sectionId] = &stats
+	}
+
+	return result, nil
+}
+
+func (db *fakeUserDataRepository) UpdateUserStatsForSections(c context.Context, strUserId string, quizId string, sectionIds []string, update func(statsBySection map[string]*domainuser.Stats) error) error {
+	all, _ := db.GetUserStatsForQuiz(c, strUserId, quizId)
+
+	statsBySection := make(map[string]*domainuser.Stats)
+	for _, sectionId := range sectionIds {
+		statsBySection[sectionId] = all[sectionId]
+		if statsBySection[sectionId] == nil {
+			statsBySection[sectionId] = &domainuser.Stats{QuizId: quizId, SectionId: sectionId}
+		}
+	}
+
+	if err := update(statsBySection); err != nil {
+		return err
+	}
+
+	for _, sectionId := range sectionIds {
+		if stats := statsBySection[sectionId]; stats != nil {
+			db.stats[quizId][sectionId] = stats
+		} else {
+			delete(db.stats[quizId], sectionId)
+		}
+	}
+
+	return nil
+}
+
+func (db *fakeUserDataRepository) GetUserIds(c context.Context) ([]string, error) {
+	return []string{db.userId}, nil
+}
+
+func (db *fakeUserDataRepository) UpdateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, update func(stats *domainuser.Stats) error) (*domainuser.Stats, error) {
+	stats := db.stats[quizId][sectionId]
+	if err := update(stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (db *fakeUserDataRepository) DeleteUserStatsForQuiz(c context.Context, strUserId string, quizId string) error {
+	delete(db.stats, quizId)
+	return nil
+}
+
+func newFakeUserDataRepository() *fakeUserDataRepository {
+	correct := domainuser.Stats{QuizId: "bigo", SectionId: "sorting"}
+	correct.UpdateStatsForAnswerCorrectness("quicksort", true)
+
+	corrupted := domainuser.Stats{QuizId: "bigo", SectionId: "trees"}
+	corrupted.UpdateStatsForAnswerCorrectness("avl", true)
+	corrupted.UpdateStatsForAnswerCorrectness("red-black", false)
+	corrupted.CountQuestionsAnsweredOnce = 5
+	corrupted.CountQuestionsCorrectOnce = 4
+
+	return &fakeUserDataRepository{
+		userId:  "some-user",
+		profile: &domainuser.Profile{Name: "Example McExample", Email: "example@example.com"},
+		stats: map[string]map[string]*domainuser.Stats{
+			"bigo": {"sorting": &correct, "trees": &corrupted},
+		},
+	}
+}
+
+func runCommand(t *testing.T, repo db.UserDataRepository, args ...string) (string, error) {
+	command, args, ok := findCommand(args)
+	assert.True(t, ok)
+
+	var out bytes.Buffer
+	err := command.run(context.Background(), repo, args, &out)
+	return out.String(), err
+}
+
+func TestFindCommand(t *testing.T) {
+	command, args, ok := findCommand([]string{"stats", "dump", "-user=x"})
+	assert.True(t, ok)
+	assert.Equal(t, "stats dump", command.name)
+	assert.Equal(t, []string{"-user=x"}, args)
+
+	_, _, ok = findCommand([]string{"stats"})
+	assert.False(t, ok)
+
+	_, _, ok = findCommand([]string{"stats", "frobnicate"})
+	assert.False(t, ok)
+}
+
+func TestUserLookup(t *testing.T) {
+	repo := newFakeUserDataRepository()
+
+	for _, args := range [][]string{{"-email=example@example.com"}, {"-github-id=1234"}} {
+		out, err := runCommand(t, repo, append([]string{"user", "lookup"}, args...)...)
+		assert.Nil(t, err)
+
+		var results []userLookupResult
+		err = json.Unmarshal([]byte(out), &results)
+		assert.Nil(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "some-user", results[0].UserId)
+		assert.Equal(t, "Example McExample", results[0].Profile.Name)
+	}
+
+	out, err := runCommand(t, repo, "user", "lookup", "-google-id=nobody")
+	assert.Nil(t, err)
+	assert.JSONEq(t, "[]", out)
+
+	_, err = runCommand(t, repo, "user", "lookup")
+	assert.NotNil(t, err)
+
+	_, err = runCommand(t, repo, "user", "lookup", "-email=example@example.com", "-github-id=1234")
+	assert.NotNil(t, err)
+}
+
+func TestUserDelete(t *testing.T) {
+	repo := newFakeUserDataRepository()
+
+	_, err := runCommand(t, repo, "user", "delete", "-user=some-user")
+	assert.Equal(t, errNotConfirmed, err)
+	assert.False(t, repo.deleted)
+
+	_, err = runCommand(t, repo, "user", "delete", "-user=other-user", "-yes")
+	assert.NotNil(t, err)
+	assert.False(t, repo.deleted)
+
+	out, err := runCommand(t, repo, "user", "delete", "-user=some-user", "-yes")
+	assert.Nil(t, err)
+	assert.True(t, repo.deleted)
+	assert.Contains(t, out, "example@example.com")
+}
+
+func TestStatsDump(t *testing.T) {
+	repo := newFakeUserDataRepository()
+
+	out, err := runCommand(t, repo, "stats", "dump", "-user=some-user")
+	assert.Nil(t, err)
+
+	var stats map[string]map[string]*domainuser.Stats
+	err = json.Unmarshal([]byte(out), &stats)
+	assert.Nil(t, err)
+	assert.Len(t, stats["bigo"], 2)
+	assert.Len(t, stats["bigo"]["trees"].QuestionHistories, 2)
+
+	_, err = runCommand(t, repo, "stats", "dump")
+	assert.NotNil(t, err)
+}
+
+func TestStatsReset(t *testing.T) {
+	repo := newFakeUserDataRepository()
+
+	_, err := runCommand(t, repo, "stats", "reset", "-user=some-user", "-quiz=bigo")
+	assert.Equal(t, errNotConfirmed, err)
+	assert.Contains(t, repo.stats, "bigo")
+
+	_, err = runCommand(t, repo, "stats", "reset", "-user=some-user", "-quiz=bigo", "-yes")
+	assert.Nil(t, err)
+	assert.NotContains(t, repo.stats, "bigo")
+}
+
+func TestStatsRecount(t *testing.T) {
+	repo := newFakeUserDataRepository()
+
+	out, err := runCommand(t, repo, "stats", "recount", "-user=some-user", "-dry-run")
+	assert.Nil(t, err)
+	assert.Equal(t, "bigo/trees: answered once: 5 -> 2, correct once: 4 -> 1\n1 sections would be recounted\n", out)
+	assert.Equal(t, 5, repo.stats["bigo"]["trees"].CountQuestionsAnsweredOnce)
+
+	out, err = runCommand(t, repo, "stats", "recount", "-user=some-user", "-quiz=bigo")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "1 sections recounted")
+	assert.Equal(t, 2, repo.stats["bigo"]["trees"].CountQuestionsAnsweredOnce)
+	assert.Equal(t, 1, repo.stats["bigo"]["trees"].CountQuestionsCorrectOnce)
+
+	// Nothing is left to recount.
+	out, err = runCommand(t, repo, "stats", "recount", "-user=some-user")
+	assert.Nil(t, err)
+	assert.Equal(t, "0 sections recounted\n", out)
+}
@@ -0,0 +1,74 @@
+// bigoquizctl administers the users and their stats, via the UserDataRepository,
+// instead of via the Datastore console.
+//
+// For instance, with the datastore emulator:
+//
+//	$ export DATASTORE_EMULATOR_HOST="localhost:8081"
+//	$ go run ./cmd/bigoquizctl user lookup -email=someone@example.com
+//	$ go run ./cmd/bigoquizctl stats recount -user=SOME-USER-ID -dry-run
+//	$ go run ./cmd/bigoquizctl stats migrate -dry-run
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+)
+
+// defaultProjectId returns the project from the same environment variable as the server, or the server's default.
+func defaultProjectId() string {
+	if projectId, ok := os.LookupEnv(config.EnvVarName("datastore-project-id")); ok && len(projectId) != 0 {
+		return projectId
+	}
+
+	return config.Defaults(config.ENV_PROD).DatastoreProjectId
+}
+
+// defaultQuizzesDir returns the directory from the same environment variable as the server, or the server's default.
+func defaultQuizzesDir() string {
+	if quizzesDir, ok := os.LookupEnv(config.EnvVarName("quizzes-dir")); ok && len(quizzesDir) != 0 {
+		return quizzesDir
+	}
+
+	return config.Defaults(config.ENV_PROD).QuizzesDir
+}
+
+func main() {
+	projectId := flag.String("project", defaultProjectId(), fmt.Sprintf("The Google Cloud project whose Datastore has the users' data. Default: %v, or the server's default", config.EnvVarName("datastore-project-id")))
+	flag.Usage = func() {
+		output := flag.CommandLine.Output()
+		fmt.Fprintf(output, "Usage: %v [flags] command [command flags]\n\nCommands:\n", os.Args[0])
+		for _, command := range commands {
+			fmt.Fprintf(output, "  %v\n    \t%v\n", command.name, command.description)
+		}
+
+		fmt.Fprintf(output, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, args, ok := findCommand(flag.Args())
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	repo, err := db.NewUserDataRepository(*projectId)
+	if err != nil {
+		log.Fatalf("NewUserDataRepository() failed: %v", err)
+	}
+
+	err = command.run(context.Background(), repo, args, os.Stdout)
+	repo.Close()
+
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		log.Fatalf("%v failed: %v", command.name, err)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	domainquiz "github.com/murraycu/go-bigoquiz-server/domain/quiz"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes"
+)
+
+func loadQuizzes(quizzesDir string) (quizzes.MapQuizzes, error) {
+	repo, err := quizzes.NewQuizzesRepository(quizzesDir)
+	if err != nil {
+		return nil, fmt.Errorf("NewQuizzesRepository() failed: %v", err)
+	}
+
+	result, err := repo.LoadQuizzes()
+	if err != nil {
+		return nil, fmt.Errorf("LoadQuizzes() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+// getUserIds returns just the user ID, or all the users' IDs if userId is empty.
+func getUserIds(c context.Context, repo db.UserDataRepository, userId string) ([]string, error) {
+	if len(userId) != 0 {
+		return []string{userId}, nil
+	}
+
+	result, err := repo.GetUserIds(c)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserIds() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+// migrateQuizStats moves the user's stats for the quiz's renamed sections and questions, via the quiz's IdMigrations,
+// to the stats for the sections that now have those questions, changing statsBySection.
+// The stats for a section that no longer exists are removed from statsBySection, if nothing is left in them.
+// This returns a description of each change, and the IDs of the sections whose stats changed.
+func migrateQuizStats(q *domainquiz.Quiz, statsBySection map[string]*domainuser.Stats) ([]string, map[string]bool) {
+	sectionIdsByQuestionId := q.GetSectionIdsByQuestionId()
+
+	var changes []string
+	changed := make(map[string]bool)
+
+	getStats := func(sectionId string) *domainuser.Stats {
+		stats := statsBySection[sectionId]
+		if stats == nil {
+			stats = &domainuser.Stats{QuizId: q.Id, SectionId: sectionId}
+			statsBySection[sectionId] = stats
+		}
+
+		return stats
+	}
+
+	for _, sectionId := range sortedKeys(statsBySection) {
+		stats := statsBySection[sectionId]
+		if stats == nil || len(sectionId) == 0 {
+			continue
+		}
+
+		if count := stats.RenameQuestions(q.IdMigrations.CurrentQuestionId); count != 0 {
+			changed[sectionId] = true
+			changes = append(changes, fmt.Sprintf("%v: renamed %v question histories", sectionId, count))
+		}
+
+		// Only move all the stats if the section itself has been renamed.
+		sectionExists := q.GetSection(sectionId) != nil
+		newSectionId := q.IdMigrations.CurrentSectionId(sectionId)
+		if sectionExists || q.GetSection(newSectionId) == nil {
+			newSectionId = ""
+		}
+
+		// Questions that are now in other sections:
+		moves := make(map[string][]string)
+		for _, qh := range stats.QuestionHistories {
+			otherSectionId, ok := sectionIdsByQuestionId[qh.QuestionId]
+			if ok && otherSectionId != sectionId && otherSectionId != newSectionId {
+				moves[otherSectionId] = append(moves[otherSectionId], qh.QuestionId)
+			}
+		}
+
+		for _, otherSectionId := range sortedKeys(moves) {
+			getStats(otherSectionId).Merge(stats.TakeQuestions(moves[otherSectionId]))
+			changed[sectionId] = true
+			changed[otherSectionId] = true
+			changes = append(changes, fmt.Sprintf("%v -> %v: moved %v question histories", sectionId, otherSectionId, len(moves[otherSectionId])))
+		}
+
+		if len(newSectionId) != 0 {
+			// This includes the answers that are not in the question histories, and any orphaned question histories.
+			getStats(newSectionId).Merge(stats)
+			delete(statsBySection, sectionId)
+			changed[sectionId] = true
+			changed[newSectionId] = true
+			changes = append(changes, fmt.Sprintf("%v -> %v: moved the stats, with %v question histories", sectionId, newSectionId, len(stats.QuestionHistories)))
+		} else if !sectionExists && len(moves) != 0 && len(stats.QuestionHistories) == 0 {
+			delete(statsBySection, sectionId)
+			changes = append(changes, fmt.Sprintf("%v: deleted the stats, which are now empty", sectionId))
+		}
+	}
+
+	return changes, changed
+}
+
+var errStatsChangedDuringMigration = errors.New("the stats changed while migrating them, so try again")
+
+// migrateUserStatsForQuiz migrates the user's stats for the quiz in one transaction,
+// so the migration can safely be tried again if it fails.
+// This returns a description of each change.
+func migrateUserStatsForQuiz(c context.Context, repo db.UserDataRepository, userId string, q *domainquiz.Quiz, dryRun bool) ([]string, error) {
+	statsBySection, err := repo.GetUserStatsForQuiz(c, userId, q.Id)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+	}
+
+	changes, changed := migrateQuizStats(q, statsBySection)
+	if len(changes) == 0 || dryRun {
+		return changes, nil
+	}
+
+	err = repo.UpdateUserStatsForSections(c, userId, q.Id, sortedKeys(changed), func(statsBySection map[string]*domainuser.Stats) error {
+		_, changedNow := migrateQuizStats(q, statsBySection)
+		for sectionId := range changedNow {
+			// UpdateUserStatsForSections() would not store the stats for other sections.
+			if !changed[sectionId] {
+				return errStatsChangedDuringMigration
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("UpdateUserStatsForSections() failed: %v", err)
+	}
+
+	return changes, nil
+}
+
+func runStatsMigrate(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats migrate", flag.ContinueOnError)
+	quizzesDir := flags.String("quizzes-dir", defaultQuizzesDir(), "The directory with the quiz JSON files, with their idMigrations.")
+	userId := flags.String("user", "", "The user ID, as found by user lookup. By default, all users' stats are migrated.")
+	quizId := flags.String("quiz", "", "The quiz ID. By default, the stats for all quizzes with idMigrations are migrated.")
+	dryRun := flags.Bool("dry-run", false, "Print the changes, without storing them.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	quizzes, err := loadQuizzes(*quizzesDir)
+	if err != nil {
+		return err
+	}
+
+	if len(*quizId) != 0 && quizzes[*quizId] == nil {
+		return fmt.Errorf("there is no quiz with the ID: %v", *quizId)
+	}
+
+	userIds, err := getUserIds(c, repo, *userId)
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, userId := range userIds {
+		userChanged := false
+		for _, id := range sortedKeys(quizzes) {
+			q := quizzes[id]
+			if (len(*quizId) != 0 && id != *quizId) || q.IdMigrations.IsEmpty() {
+				continue
+			}
+
+			changes, err := migrateUserStatsForQuiz(c, repo, userId, q, *dryRun)
+			if err != nil {
+				return fmt.Errorf("migrateUserStatsForQuiz() failed for user %v and quiz %v: %v", userId, id, err)
+			}
+
+			for _, change := range changes {
+				fmt.Fprintf(out, "%v %v/%v\n", userId, id, change)
+			}
+
+			userChanged = userChanged || len(changes) != 0
+		}
+
+		if userChanged {
+			migrated++
+		}
+	}
+
+	if *dryRun {
+		fmt.Fprintf(out, "%v users' stats would be migrated\n", migrated)
+	} else {
+		fmt.Fprintf(out, "%v users' stats migrated\n", migrated)
+	}
+
+	return nil
+}
+
+// The IDs that orphanedStats may be missing.
+const (
+	MISSING_QUIZ      = "quiz"
+	MISSING_SECTION   = "section"
+	MISSING_QUESTIONS = "questions"
+)
+
+// orphanedStats are stats whose quiz, section, or questions are not in the quizzes,
+// so the user's progress for them is not shown.
+type orphanedStats struct {
+	UserId    string `json:"userId"`
+	QuizId    string `json:"quizId"`
+	SectionId string `json:"sectionId,omitempty"`
+
+	// One of the MISSING_* constants.
+	Missing string `json:"missing"`
+
+	// The question IDs, for MISSING_QUESTIONS.
+	QuestionIds []string `json:"questionIds,omitempty"`
+
+	// Whether the quiz's idMigrations have new IDs for the missing IDs, so stats migrate would fix this.
+	Migratable bool `json:"migratable"`
+}
+
+// findOrphanedStats returns the orphaned stats for the user's stats for the quiz.
+// q is nil if the quiz no longer exists.
+func findOrphanedStats(userId string, quizId string, q *domainquiz.Quiz, statsBySection map[string]*domainuser.Stats) []orphanedStats {
+	if q == nil {
+		return []orphanedStats{{UserId: userId, QuizId: quizId, Missing: MISSING_QUIZ}}
+	}
+
+	sectionIdsByQuestionId := q.GetSectionIdsByQuestionId()
+
+	var result []orphanedStats
+	for _, sectionId := range sortedKeys(statsBySection) {
+		if q.GetSection(sectionId) == nil {
+			result = append(result, orphanedStats{
+				UserId:     userId,
+				QuizId:     quizId,
+				SectionId:  sectionId,
+				Missing:    MISSING_SECTION,
+				Migratable: q.GetSection(q.IdMigrations.CurrentSectionId(sectionId)) != nil,
+			})
+			continue
+		}
+
+		orphan := orphanedStats{
+			UserId:     userId,
+			QuizId:     quizId,
+			SectionId:  sectionId,
+			Missing:    MISSING_QUESTIONS,
+			Migratable: true,
+		}
+
+		for _, qh := range statsBySection[sectionId].QuestionHistories {
+			if _, ok := sectionIdsByQuestionId[qh.QuestionId]; ok {
+				continue
+			}
+
+			orphan.QuestionIds = append(orphan.QuestionIds, qh.QuestionId)
+
+			_, ok := sectionIdsByQuestionId[q.IdMigrations.CurrentQuestionId(qh.QuestionId)]
+			orphan.Migratable = orphan.Migratable && ok
+		}
+
+		if len(orphan.QuestionIds) != 0 {
+			result = append(result, orphan)
+		}
+	}
+
+	return result
+}
+
+func runStatsOrphans(c context.Context, repo db.UserDataRepository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats orphans", flag.ContinueOnError)
+	quizzesDir := flags.String("quizzes-dir", defaultQuizzesDir(), "The directory with the quiz JSON files.")
+	userId := flags.String("user", "", "The user ID, as found by user lookup. By default, all users' stats are checked.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	quizzes, err := loadQuizzes(*quizzesDir)
+	if err != nil {
+		return err
+	}
+
+	userIds, err := getUserIds(c, repo, *userId)
+	if err != nil {
+		return err
+	}
+
+	results := make([]orphanedStats, 0)
+	for _, userId := range userIds {
+		statsByQuiz, err := repo.GetUserStats(c, userId)
+		if err != nil {
+			return fmt.Errorf("GetUserStats() failed: %v", err)
+		}
+
+		for _, quizId := range sortedKeys(statsByQuiz) {
+			q := quizzes[quizId]
+
+			var statsBySection map[string]*domainuser.Stats
+			if q != nil {
+				statsBySection, err = repo.GetUserStatsForQuiz(c, userId, quizId)
+				if err != nil {
+					return fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+				}
+			}
+
+			results = append(results, findOrphanedStats(userId, quizId, q, statsBySection)...)
+		}
+	}
+
+	return writeJson(out, results)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+const TEST_QUIZZES_DIR = "-quizzes-dir=testdata/quizzes"
+
+// newFakeUserDataRepositoryWithRenamedIds has stats for the old IDs in testdata/quizzes/bigo.json.
+func newFakeUserDataRepositoryWithRenamedIds() *fakeUserDataRepository {
+	repo := newFakeUserDataRepository()
+
+	// A renamed section, with a question that is now in another section.
+	oldSorting := domainuser.Stats{QuizId: "bigo", SectionId: "old-sorting"}
+	oldSorting.UpdateStatsForAnswerCorrectness("quicksort", true)
+	oldSorting.UpdateStatsForAnswerCorrectness("mergesort", false)
+	oldSorting.UpdateStatsForAnswerCorrectness("red-black", true)
+
+	// A renamed question, and an orphaned question.
+	trees := repo.stats["bigo"]["trees"]
+	trees.UpdateStatsForAnswerCorrectness("old-avl", false)
+	trees.UpdateStatsForAnswerCorrectness("splay", true)
+	trees.RecountQuestions()
+
+	// A removed section, and a removed quiz.
+	removed := domainuser.Stats{QuizId: "bigo", SectionId: "heaps"}
+	removed.UpdateStatsForAnswerCorrectness("binary-heap", true)
+
+	repo.stats["bigo"]["old-sorting"] = &oldSorting
+	repo.stats["bigo"]["heaps"] = &removed
+	repo.stats["removed-quiz"] = map[string]*domainuser.Stats{
+		"some-section": {QuizId: "removed-quiz", SectionId: "some-section"},
+	}
+
+	return repo
+}
+
+func TestStatsMigrate(t *testing.T) {
+	repo := newFakeUserDataRepositoryWithRenamedIds()
+
+	out, err := runCommand(t, repo, "stats", "migrate", TEST_QUIZZES_DIR, "-dry-run")
+	assert.Nil(t, err)
+	assert.Equal(t, `some-user bigo/old-sorting -> trees: moved 1 question histories
+some-user bigo/old-sorting -> sorting: moved the stats, with 2 question histories
+some-user bigo/trees: renamed 1 question histories
+1 users' stats would be migrated
+`, out)
+	assert.Contains(t, repo.stats["bigo"], "old-sorting")
+
+	out, err = runCommand(t, repo, "stats", "migrate", TEST_QUIZZES_DIR, "-user=some-user")
+	assert.Nil(t, err)
+	assert.Contains(t, out, "1 users' stats migrated")
+
+	stats := repo.stats["bigo"]
+	assert.NotContains(t, stats, "old-sorting")
+
+	// The quicksort history is merged with the existing one.
+	assert.Equal(t, 3, stats["sorting"].Answered)
+	assert.Equal(t, 2, stats["sorting"].CountQuestionsAnsweredOnce)
+	assert.Equal(t, 1, stats["sorting"].CountQuestionsCorrectOnce)
+
+	trees := stats["trees"]
+	assert.True(t, trees.GetQuestionWasAnswered("red-black"))
+	assert.False(t, trees.GetQuestionWasAnswered("old-avl"))
+	assert.Equal(t, 0, trees.GetQuestionCountAnsweredWrong("avl"))
+	assert.Equal(t, domainuser.MasteryLevelLearning, trees.GetQuestionMasteryLevel("avl"))
+	assert.Equal(t, 3, trees.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 5, trees.Answered)
+
+	// The orphans are not changed.
+	assert.True(t, trees.GetQuestionWasAnswered("splay"))
+	assert.Contains(t, stats, "heaps")
+
+	// Nothing is left to migrate.
+	out, err = runCommand(t, repo, "stats", "migrate", TEST_QUIZZES_DIR)
+	assert.Nil(t, err)
+	assert.Equal(t, "0 users' stats migrated\n", out)
+
+	_, err = runCommand(t, repo, "stats", "migrate", TEST_QUIZZES_DIR, "-quiz=nonsense")
+	assert.NotNil(t, err)
+}
+
+func TestStatsOrphans(t *testing.T) {
+	repo := newFakeUserDataRepositoryWithRenamedIds()
+
+	out, err := runCommand(t, repo, "stats", "orphans", TEST_QUIZZES_DIR)
+	assert.Nil(t, err)
+
+	var orphans []orphanedStats
+	err = json.Unmarshal([]byte(out), &orphans)
+	assert.Nil(t, err)
+	assert.Equal(t, []orphanedStats{
+		{UserId: "some-user", QuizId: "bigo", SectionId: "heaps", Missing: MISSING_SECTION},
+		{UserId: "some-user", QuizId: "bigo", SectionId: "old-sorting", Missing: MISSING_SECTION, Migratable: true},
+		{UserId: "some-user", QuizId: "bigo", SectionId: "trees", Missing: MISSING_QUESTIONS, QuestionIds: []string{"old-avl", "splay"}},
+		{UserId: "some-user", QuizId: "removed-quiz", Missing: MISSING_QUIZ},
+	}, orphans)
+
+	_, err = runCommand(t, repo, "stats", "migrate", TEST_QUIZZES_DIR)
+	assert.Nil(t, err)
+
+	out, err = runCommand(t, repo, "stats", "orphans", TEST_QUIZZES_DIR, "-user=some-user")
+	assert.Nil(t, err)
+
+	orphans = nil
+	err = json.Unmarshal([]byte(out), &orphans)
+	assert.Nil(t, err)
+	assert.Equal(t, []orphanedStats{
+		{UserId: "some-user", QuizId: "bigo", SectionId: "heaps", Missing: MISSING_SECTION},
+		{UserId: "some-user", QuizId: "bigo", SectionId: "trees", Missing: MISSING_QUESTIONS, QuestionIds: []string{"splay"}},
+		{UserId: "some-user", QuizId: "removed-quiz", Missing: MISSING_QUIZ},
+	}, orphans)
+}
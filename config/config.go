@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"slices"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/facebook"
@@ -17,13 +18,24 @@ const (
 	PART_URL_LOGIN_CALLBACK_GITHUB   = "callback-github"
 	PART_URL_LOGIN_CALLBACK_FACEBOOK = "callback-facebook"
 
+	// The names of the login providers, for login-providers.
+	LOGIN_PROVIDER_GOOGLE   = "google"
+	LOGIN_PROVIDER_GITHUB   = "github"
+	LOGIN_PROVIDER_FACEBOOK = "facebook"
+
+	// The environments, which choose the defaults.
+	ENV_PROD  = "prod"
+	ENV_LOCAL = "local"
+
 	// This file contains other secrets, such as the keys for the encrypted cookie store.
 	// The file format is like so:
 	//
 	// {
 	//   "cookie-store-key": "something-secret"
 	// }
-	configFilename = "config.json"
+	//
+	// See config.json.example.
+	DEFAULT_FILENAME = "config.json"
 
 	// See https://developers.google.com/+/web/api/rest/oauth#profile
 	googleCredentialsScopeProfile = "profile"
@@ -46,40 +58,222 @@ const (
 )
 
 /** Get general configuration.
- * See configFilename.
+ * See DEFAULT_FILENAME, and Load(), for the layers: defaults, the file, environment variables, and flags.
  */
 type Config struct {
-	CookieKey string
+	// The environment, such as ENV_PROD, which chooses the defaults.
+	// This is chosen by the -env flag, or the BIGOQUIZ_ENV environment variable, not by the file.
+	Env string `json:"env"`
+
+	// The port to listen on.
+	Port string `json:"port"`
+
+	// The directory with the quiz JSON files.
+	QuizzesDir string `json:"quizzes-dir"`
+
+	// The Google Cloud project whose Datastore has the users' data.
+	DatastoreProjectId string `json:"datastore-project-id"`
+
+	// The directory with the login providers' *_credentials_secret.json files.
+	OAuth2CredentialsDir string `json:"oauth2-credentials-dir"`
+
+	// The login providers that users may log in with, such as LOGIN_PROVIDER_GOOGLE.
+	LoginProviders []string `json:"login-providers"`
+
+	// The secret key for the session cookies.
+	CookieKey string `json:"cookie-store-key"`
+
+	Cookie Cookie `json:"cookie"`
+
+	// The frontend's URL. This has a default value based on the environment.
+	BaseUrl string `json:"base-url"`
+
+	// This server's URL. This has a default value based on the environment.
+	BaseApiUrl string `json:"base-api-url"`
+
+	// The origins whose Javascript may call the API, with the user's cookies.
+	// If this is not specified, it is just BaseUrl.
+	CorsAllowedOrigins []string `json:"cors-allowed-origins"`
+
+	// The email addresses of users who may use the admin API, such as the question statistics.
+	AdminEmails []string `json:"admin-emails"`
+
+	// The bearer token that Prometheus must send to read /metrics.
+	// The metrics are not served if this is empty.
+	MetricsToken string `json:"metrics-token"`
 
-	// BaseUrl will have a value based on the --env flag, unless it is specified here.
-	BaseUrl string
+	// The base64 Ed25519 private key seed, of 32 bytes, that signs the completion certificates.
+	// Certificates are not issued if this is empty.
+	CertificateSigningKey string `json:"certificate-signing-key"`
 
-	// BaseApiUrl will have a value based on the --env flag, unless it is specified here.
-	BaseApiUrl string
+	// The base64 Ed25519 public keys of previous signing keys,
+	// so the certificates that they signed can still be verified after the key is changed.
+	CertificatePreviousPublicKeys []string `json:"certificate-previous-public-keys"`
+
+	// Where the tracing spans are exported: "stdout", or "" (the default) to not trace.
+	// See the tracing package's EXPORTER_* constants.
+	TracingExporter string `json:"tracing-exporter"`
+
+	// The ratio, from 0 to 1, of the traces to sample, unless the caller has already decided.
+	// If this is not specified, all traces are sampled.
+	TracingSampleRatio *float64 `json:"tracing-sample-ratio"`
+
+	// How often clients may call the expensive endpoints.
+	// Any limits that are not specified have default values.
+	RateLimits RateLimits `json:"rate-limits"`
+
+	// The endpoints, such as a team chat or an LMS, that are sent learning events.
+	// These may only be set in the file.
+	Webhooks []Webhook `json:"webhooks"`
+
+	// Whether the messages of server errors are sent to clients, instead of a generic message.
+	// This is only true for the local environment.
+	ShowInternalErrors bool `json:"-"`
 }
 
-func GenerateConfig(env string) (*Config, error) {
-	b, err := ioutil.ReadFile(configFilename)
-	if err != nil {
-		// log.Errorf("Unable to read config file (%s): %v", configFilename, err)
-		return nil, err
+// Cookie is the session cookie's settings.
+type Cookie struct {
+	// The domain that the cookie is sent to. If this is empty, it is only sent to this server's host.
+	Domain string `json:"domain,omitempty"`
+
+	// Whether the cookie is only sent via HTTPS. If this is not specified, it is true.
+	Secure *bool `json:"secure,omitempty"`
+
+	// "lax", "strict", or "none". If this is not specified, it is "lax".
+	SameSite string `json:"same-site,omitempty"`
+
+	// How long the cookie lasts, in seconds. If this is 0, it is 30 days.
+	MaxAgeSeconds int `json:"max-age-seconds,omitempty"`
+}
+
+// The values of Cookie.SameSite.
+const (
+	COOKIE_SAME_SITE_LAX    = "lax"
+	COOKIE_SAME_SITE_STRICT = "strict"
+	COOKIE_SAME_SITE_NONE   = "none"
+)
+
+// IsSecure returns Secure, or true if it is not specified.
+func (self *Cookie) IsSecure() bool {
+	return self.Secure == nil || *self.Secure
+}
+
+// IsLoginProviderEnabled returns whether users may log in with the provider, such as LOGIN_PROVIDER_GOOGLE.
+func (self *Config) IsLoginProviderEnabled(provider string) bool {
+	return slices.Contains(self.LoginProviders, provider)
+}
+
+// Webhook is an endpoint that is sent the events that it subscribes to, in signed POST requests.
+type Webhook struct {
+	// Identifies the webhook in the delivery log.
+	// If this changes, any deliveries that are still being retried for the old ID fail.
+	Id string `json:"id"`
+
+	// An https URL, or an http URL for the local environment.
+	Url string `json:"url"`
+
+	// The key for the HMAC-SHA256 signature of each delivery.
+	Secret string `json:"secret"`
+
+	// The events, such as "section.mastered". If this is empty, all the events are sent.
+	Events []string `json:"events,omitempty"`
+}
+
+// IsSubscribed returns whether the webhook is sent the event.
+func (self *Webhook) IsSubscribed(event string) bool {
+	return len(self.Events) == 0 || slices.Contains(self.Events, event)
+}
+
+// RateLimit is a token bucket's average rate and size.
+// A limit with a PerMinute or Burst of 0 does not limit anything.
+type RateLimit struct {
+	PerMinute float64 `json:"per-minute"`
+	Burst     int     `json:"burst"`
+}
+
+type RateLimits struct {
+	// Answer submissions, by the client's IP address and by the logged-in user.
+	// Each submission reads and writes the datastore.
+	AnswersPerIp   *RateLimit `json:"answers-per-ip"`
+	AnswersPerUser *RateLimit `json:"answers-per-user"`
+
+	// Starting a login, by the client's IP address.
+	// Each login stores an OAuth state in the datastore.
+	LoginsPerIp *RateLimit `json:"logins-per-ip"`
+
+	// Joining a group with an invite code, by the client's IP address and by the logged-in user.
+	// This makes it slow to guess the invite codes.
+	JoinsPerIp   *RateLimit `json:"joins-per-ip"`
+	JoinsPerUser *RateLimit `json:"joins-per-user"`
+
+	// The header that the platform sets to the client's IP address, replacing any header sent by the client.
+	// If the request does not have it, the connection's address is used.
+	// If this is not specified, it is X-Appengine-User-Ip, except for the local environment.
+	ClientIpHeader string `json:"client-ip-header"`
+}
+
+// The default rate limits, which a person answering quickly, in several tabs, should not reach.
+// The per-IP limits allow for several users behind one NAT address, such as a classroom.
+var (
+	defaultAnswersPerIp   = RateLimit{PerMinute: 300, Burst: 60}
+	defaultAnswersPerUser = RateLimit{PerMinute: 60, Burst: 20}
+	defaultLoginsPerIp    = RateLimit{PerMinute: 10, Burst: 10}
+	defaultJoinsPerIp     = RateLimit{PerMinute: 10, Burst: 40}
+	defaultJoinsPerUser   = RateLimit{PerMinute: 1, Burst: 5}
+)
+
+const defaultClientIpHeader = "X-Appengine-User-Ip"
+
+// setDefaults sets the limits that are not specified to their default values.
+func (self *RateLimits) setDefaults(env string) {
+	setDefault := func(limit **RateLimit, defaultLimit RateLimit) {
+		if *limit == nil {
+			*limit = &defaultLimit
+		}
 	}
 
-	var result Config
-	err = json.Unmarshal(b, &result)
-	if err != nil {
-		return nil, fmt.Errorf("json.Unmarshal failed: %v", err)
+	setDefault(&self.AnswersPerIp, defaultAnswersPerIp)
+	setDefault(&self.AnswersPerUser, defaultAnswersPerUser)
+	setDefault(&self.LoginsPerIp, defaultLoginsPerIp)
+	setDefault(&self.JoinsPerIp, defaultJoinsPerIp)
+	setDefault(&self.JoinsPerUser, defaultJoinsPerUser)
+
+	if len(self.ClientIpHeader) == 0 && env != ENV_LOCAL {
+		self.ClientIpHeader = defaultClientIpHeader
+	}
+}
+
+// Defaults returns the default configuration for the environment, before loading the file.
+// It has no cookie key, which must be in the file, or in an environment variable.
+func Defaults(env string) *Config {
+	result := &Config{
+		Env:                  env,
+		Port:                 "8080",
+		QuizzesDir:           "quizzes",
+		DatastoreProjectId:   "bigoquiz",
+		OAuth2CredentialsDir: "config_oauth2",
+		LoginProviders:       []string{LOGIN_PROVIDER_GOOGLE, LOGIN_PROVIDER_GITHUB, LOGIN_PROVIDER_FACEBOOK},
 	}
 
-	if env == "local" {
+	if env == ENV_LOCAL {
 		result.BaseUrl = "http://localhost:4200"
 		result.BaseApiUrl = "http://localhost:8080"
+		result.ShowInternalErrors = true
 	} else {
 		result.BaseUrl = "https://bigoquiz.com"
 		result.BaseApiUrl = "https://api.bigoquiz.com"
 	}
 
-	return &result, nil
+	return result
+}
+
+// setDerivedDefaults sets the defaults that depend on other settings, after loading all the layers.
+func (self *Config) setDerivedDefaults() {
+	if len(self.CorsAllowedOrigins) == 0 {
+		self.CorsAllowedOrigins = []string{self.BaseUrl}
+	}
+
+	self.RateLimits.setDefaults(self.Env)
 }
 
 /** Get an oauth2 Config object based on the secret .json file,
@@ -99,9 +293,9 @@ func GenerateConfig(env string) (*Config, error) {
  * and https://github.com/golang/oauth2/blob/master/facebook/facebook.go
  * for clues.
  */
-func addSecretsToOAuthConfig(credentialsFilenamePrefix string, config oauth2.Config) (*oauth2.Config, error) {
+func addSecretsToOAuthConfig(credentialsDir string, credentialsFilenamePrefix string, config oauth2.Config) (*oauth2.Config, error) {
 	credentialsFilename := fmt.Sprintf("%s_credentials_secret.json", credentialsFilenamePrefix)
-	path := filepath.Join("config_oauth2", credentialsFilename)
+	path := filepath.Join(credentialsDir, credentialsFilename)
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read client secret file (%s): %v", credentialsFilename, err)
@@ -136,7 +330,7 @@ func GenerateGoogleOAuthConfig(conf *Config) (*oauth2.Config, error) {
 		Scopes:       []string{googleCredentialsScopeProfile, googleCredentialsScopeEmail},
 	}
 
-	result, err := addSecretsToOAuthConfig("google", config)
+	result, err := addSecretsToOAuthConfig(conf.OAuth2CredentialsDir, LOGIN_PROVIDER_GOOGLE, config)
 	if err != nil {
 		return nil, fmt.Errorf("addSecretsToOAuthConfig() failed: %v", err)
 	}
@@ -160,7 +354,7 @@ func GenerateGitHubOAuthConfig(conf *Config) (*oauth2.Config, error) {
 		Scopes:       []string{githubCredentialsScopeUser, githubCredentialsScopeEmail},
 	}
 
-	return addSecretsToOAuthConfig("github", config)
+	return addSecretsToOAuthConfig(conf.OAuth2CredentialsDir, LOGIN_PROVIDER_GITHUB, config)
 }
 
 /** Get an oauth2 Config object based on the secret .json file.
@@ -175,5 +369,5 @@ func GenerateFacebookOAuthConfig(conf *Config) (*oauth2.Config, error) {
 		Scopes:       []string{facebookCredentialsScopePublicProfile, facebookCredentialsScopeEmail},
 	}
 
-	return addSecretsToOAuthConfig("facebook", config)
+	return addSecretsToOAuthConfig(conf.OAuth2CredentialsDir, LOGIN_PROVIDER_FACEBOOK, config)
 }
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCookieKey = "0123456789abcdef0123456789abcdef"
+
+func writeConfigFile(t *testing.T, contents string) string {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(filename, []byte(contents), 0600)
+	assert.Nil(t, err)
+
+	return filename
+}
+
+func lookupEnvFromMap(env map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	conf, err := Load(ENV_LOCAL, Sources{})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:4200", conf.BaseUrl)
+	assert.Equal(t, []string{"http://localhost:4200"}, conf.CorsAllowedOrigins)
+	assert.Equal(t, "quizzes", conf.QuizzesDir)
+	assert.Equal(t, "bigoquiz", conf.DatastoreProjectId)
+	assert.Equal(t, "8080", conf.Port)
+	assert.True(t, conf.ShowInternalErrors)
+	assert.True(t, conf.Cookie.IsSecure())
+	assert.Empty(t, conf.RateLimits.ClientIpHeader)
+	assert.True(t, conf.IsLoginProviderEnabled(LOGIN_PROVIDER_GITHUB))
+
+	conf, err = Load(ENV_PROD, Sources{})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://bigoquiz.com", conf.BaseUrl)
+	assert.False(t, conf.ShowInternalErrors)
+	assert.Equal(t, defaultClientIpHeader, conf.RateLimits.ClientIpHeader)
+	assert.Equal(t, &defaultAnswersPerIp, conf.RateLimits.AnswersPerIp)
+	assert.Equal(t, &defaultJoinsPerUser, conf.RateLimits.JoinsPerUser)
+}
+
+func TestLoadLayers(t *testing.T) {
+	filename := writeConfigFile(t, `{
+  "cookie-store-key": "from-file",
+  "quizzes-dir": "file-quizzes",
+  "datastore-project-id": "file-project",
+  "login-providers": ["google"],
+  "cookie": {"secure": false, "same-site": "strict"},
+  "rate-limits": {"answers-per-ip": {"per-minute": 1, "burst": 2}}
+}`)
+
+	env := map[string]string{
+		"PORT":                          "9000",
+		"BIGOQUIZ_QUIZZES_DIR":          "env-quizzes",
+		"BIGOQUIZ_DATASTORE_PROJECT_ID": "env-project",
+		"BIGOQUIZ_ADMIN_EMAILS":         "a@example.com, b@example.com",
+	}
+
+	conf, err := Load(ENV_PROD, Sources{
+		Filename:  filename,
+		LookupEnv: lookupEnvFromMap(env),
+		Overrides: map[string]string{"datastore-project-id": "flag-project"},
+	})
+	assert.Nil(t, err)
+
+	// The file overrides the defaults.
+	assert.Equal(t, "from-file", conf.CookieKey)
+	assert.Equal(t, []string{LOGIN_PROVIDER_GOOGLE}, conf.LoginProviders)
+	assert.False(t, conf.IsLoginProviderEnabled(LOGIN_PROVIDER_GITHUB))
+	assert.False(t, conf.Cookie.IsSecure())
+	assert.Equal(t, COOKIE_SAME_SITE_STRICT, conf.Cookie.SameSite)
+	assert.Equal(t, &RateLimit{PerMinute: 1, Burst: 2}, conf.RateLimits.AnswersPerIp)
+	assert.Equal(t, &defaultAnswersPerUser, conf.RateLimits.AnswersPerUser)
+
+	// The environment variables override the file.
+	assert.Equal(t, "9000", conf.Port)
+	assert.Equal(t, "env-quizzes", conf.QuizzesDir)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, conf.AdminEmails)
+
+	// The flags override the environment variables.
+	assert.Equal(t, "flag-project", conf.DatastoreProjectId)
+
+	// BIGOQUIZ_PORT overrides the platform's PORT.
+	env["BIGOQUIZ_PORT"] = "9001"
+	conf, err = Load(ENV_PROD, Sources{LookupEnv: lookupEnvFromMap(env)})
+	assert.Nil(t, err)
+	assert.Equal(t, "9001", conf.Port)
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	_, err := Load(ENV_PROD, Sources{Filename: writeConfigFile(t, `{"cookie-key": "misspelt"}`)})
+	assert.ErrorContains(t, err, "cookie-key")
+
+	_, err = Load(ENV_PROD, Sources{Filename: writeConfigFile(t, `{"env": "local"}`)})
+	assert.ErrorContains(t, err, "env may only be chosen")
+
+	_, err = Load(ENV_PROD, Sources{Filename: writeConfigFile(t, `{`)})
+	assert.NotNil(t, err)
+
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	_, err = Load(ENV_PROD, Sources{Filename: missing})
+	assert.NotNil(t, err)
+
+	_, err = Load(ENV_PROD, Sources{Filename: missing, FilenameOptional: true})
+	assert.Nil(t, err)
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	_, err := Load(ENV_PROD, Sources{LookupEnv: lookupEnvFromMap(map[string]string{"BIGOQUIZ_COOKIE_SECURE": "maybe"})})
+	assert.ErrorContains(t, err, "BIGOQUIZ_COOKIE_SECURE")
+
+	_, err = Load(ENV_PROD, Sources{Overrides: map[string]string{"tracing-sample-ratio": "half"}})
+	assert.ErrorContains(t, err, "-tracing-sample-ratio")
+}
+
+func TestFlags(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(flagSet, lookupEnvFromMap(map[string]string{"BIGOQUIZ_ENV": ENV_LOCAL}))
+
+	err := flagSet.Parse([]string{"-quizzes-dir=flag-quizzes", "-cookie-secure=false"})
+	assert.Nil(t, err)
+	assert.Equal(t, ENV_LOCAL, flags.Env())
+
+	sources := flags.Sources()
+	assert.Equal(t, DEFAULT_FILENAME, sources.Filename)
+	assert.True(t, sources.FilenameOptional)
+
+	// Only the flags that were set.
+	assert.Equal(t, map[string]string{"quizzes-dir": "flag-quizzes", "cookie-secure": "false"}, sources.Overrides)
+
+	flagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags = RegisterFlags(flagSet, lookupEnvFromMap(nil))
+	err = flagSet.Parse([]string{"-env=local", "-config=other.json"})
+	assert.Nil(t, err)
+	assert.Equal(t, ENV_LOCAL, flags.Env())
+	assert.Equal(t, "other.json", flags.Sources().Filename)
+	assert.False(t, flags.Sources().FilenameOptional)
+}
+
+func validConfig(t *testing.T) *Config {
+	conf, err := Load(ENV_PROD, Sources{})
+	assert.Nil(t, err)
+
+	conf.CookieKey = testCookieKey
+	return conf
+}
+
+func TestValidate(t *testing.T) {
+	conf := validConfig(t)
+	assert.Nil(t, conf.Validate())
+
+	conf.Env = "staging"
+	conf.Port = "http"
+	conf.CookieKey = "short"
+	conf.LoginProviders = []string{LOGIN_PROVIDER_GOOGLE, "myspace", LOGIN_PROVIDER_GOOGLE}
+	conf.CorsAllowedOrigins = []string{"*", "https://bigoquiz.com/quiz"}
+	conf.AdminEmails = []string{"not-an-email"}
+	secure := false
+	conf.Cookie = Cookie{Secure: &secure, SameSite: COOKIE_SAME_SITE_NONE}
+	ratio := 2.0
+	conf.TracingSampleRatio = &ratio
+	conf.CertificateSigningKey = "c2hvcnQ="
+	conf.CertificatePreviousPublicKeys = []string{"not base64"}
+	conf.Webhooks = []Webhook{
+		{Id: "chat", Url: "https://chat.example.com/hooks/bigoquiz", Secret: strings.Repeat("s", 32), Events: []string{"quiz.completed"}},
+		{Id: "chat", Url: "http://lms.example.com/bigoquiz", Secret: "short", Events: []string{"quiz.started", "quiz.completed", "quiz.completed"}},
+	}
+
+	err := conf.Validate()
+	var validationError *ValidationError
+	assert.ErrorAs(t, err, &validationError)
+	assert.Equal(t, []string{
+		`env: "staging" is not one of [prod local]`,
+		`port: "http" is not a port number`,
+		`login-providers: "myspace" is not one of [google github facebook]`,
+		`login-providers: "google" is listed more than once`,
+		`cookie-store-key: must be at least 32 characters long. See "Changing the cookie key" in README.md`,
+		`cookie.same-site: "none" requires cookie.secure`,
+		`cors-allowed-origins: "*" is not an http or https URL`,
+		`cors-allowed-origins: "https://bigoquiz.com/quiz" must not have a path, query, or user`,
+		`admin-emails: "not-an-email" is not an email address`,
+		`certificate-signing-key: must be 32 bytes, base64-encoded`,
+		`certificate-previous-public-keys: "not base64" must be 32 bytes, base64-encoded`,
+		`tracing-sample-ratio: 2 is not between 0 and 1`,
+		`webhooks[1].id: "chat" is used more than once`,
+		`webhooks[1].url: "http://lms.example.com/bigoquiz" is not an https URL`,
+		`webhooks[1].secret: must be at least 32 characters long`,
+		`webhooks[1].events: "quiz.started" is not one of [section.mastered quiz.completed streak.broken user.created]`,
+		`webhooks[1].events: "quiz.completed" is listed more than once`,
+	}, validationError.Problems)
+}
+
+func TestValidateExampleCookieKey(t *testing.T) {
+	conf := validConfig(t)
+	conf.CookieKey = exampleCookieKey
+	assert.ErrorContains(t, conf.Validate(), "cookie-store-key: must be set")
+}
+
+func TestRedacted(t *testing.T) {
+	conf := validConfig(t)
+	conf.MetricsToken = "some-token"
+	conf.CertificateSigningKey = "some-signing-key"
+	conf.Webhooks = []Webhook{{Id: "chat", Url: "https://chat.example.com/hooks/bigoquiz", Secret: "some-webhook-secret"}}
+
+	var b bytes.Buffer
+	err := conf.PrintRedacted(&b)
+	assert.Nil(t, err)
+	assert.NotContains(t, b.String(), testCookieKey)
+	assert.NotContains(t, b.String(), "some-token")
+	assert.NotContains(t, b.String(), "some-signing-key")
+	assert.NotContains(t, b.String(), "some-webhook-secret")
+	assert.Contains(t, b.String(), "https://chat.example.com/hooks/bigoquiz")
+
+	var printed map[string]interface{}
+	err = json.Unmarshal(b.Bytes(), &printed)
+	assert.Nil(t, err)
+	assert.Equal(t, REDACTED, printed["cookie-store-key"])
+	assert.Equal(t, REDACTED, printed["metrics-token"])
+	assert.Equal(t, REDACTED, printed["certificate-signing-key"])
+	assert.Equal(t, "quizzes", printed["quizzes-dir"])
+
+	// The original is unchanged.
+	assert.Equal(t, testCookieKey, conf.CookieKey)
+	assert.Equal(t, "some-webhook-secret", conf.Webhooks[0].Secret)
+
+	// Empty secrets stay empty, so it is clear that they are not set.
+	conf.MetricsToken = ""
+	assert.Empty(t, conf.Redacted().MetricsToken)
+}
+
+func TestValidateWebhookUrlLocal(t *testing.T) {
+	conf, err := Load(ENV_LOCAL, Sources{})
+	assert.Nil(t, err)
+
+	conf.CookieKey = testCookieKey
+	conf.Webhooks = []Webhook{{Id: "receiver", Url: "http://localhost:9000/hook", Secret: strings.Repeat("s", 32)}}
+	assert.Nil(t, conf.Validate())
+
+	conf.Webhooks[0].Url = "localhost:9000/hook"
+	assert.ErrorContains(t, conf.Validate(), `webhooks[0].url: "localhost:9000/hook" is not an http or https URL`)
+}
+
+func TestWebhookIsSubscribed(t *testing.T) {
+	webhook := Webhook{Id: "chat"}
+	assert.True(t, webhook.IsSubscribed("quiz.completed"))
+
+	webhook.Events = []string{"section.mastered"}
+	assert.True(t, webhook.IsSubscribed("section.mastered"))
+	assert.False(t, webhook.IsSubscribed("quiz.completed"))
+}
@@ -0,0 +1,335 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The prefix of the environment variables for the settings,
+// such as BIGOQUIZ_QUIZZES_DIR for quizzes-dir.
+const ENV_VAR_PREFIX = "BIGOQUIZ_"
+
+const (
+	envVarEnv    = ENV_VAR_PREFIX + "ENV"
+	envVarConfig = ENV_VAR_PREFIX + "CONFIG"
+
+	// Set by App Engine, and Cloud Run, but overridden by BIGOQUIZ_PORT.
+	envVarPlatformPort = "PORT"
+)
+
+// setting is a configuration value that may be set by an environment variable or a flag,
+// overriding the file. The rate limits, and the webhooks, may only be set in the file.
+type setting struct {
+	// The flag name, such as quizzes-dir, which is also the key in the file,
+	// except for the cookie's settings, and client-ip-header, which are nested in the file.
+	name string
+
+	description string
+
+	set func(conf *Config, value string) error
+}
+
+func stringSetting(name string, description string, field func(conf *Config) *string) setting {
+	return setting{
+		name:        name,
+		description: description,
+		set: func(conf *Config, value string) error {
+			*field(conf) = value
+			return nil
+		},
+	}
+}
+
+// listSetting is for a comma-separated list, such as a@example.com,b@example.com.
+func listSetting(name string, description string, field func(conf *Config) *[]string) setting {
+	return setting{
+		name:        name,
+		description: description + " (comma-separated)",
+		set: func(conf *Config, value string) error {
+			var list []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); len(item) != 0 {
+					list = append(list, item)
+				}
+			}
+
+			*field(conf) = list
+			return nil
+		},
+	}
+}
+
+var settings = []setting{
+	stringSetting("port", "The port to listen on", func(conf *Config) *string { return &conf.Port }),
+	stringSetting("quizzes-dir", "The directory with the quiz JSON files", func(conf *Config) *string { return &conf.QuizzesDir }),
+	stringSetting("datastore-project-id", "The Google Cloud project whose Datastore has the users' data", func(conf *Config) *string { return &conf.DatastoreProjectId }),
+	stringSetting("oauth2-credentials-dir", "The directory with the login providers' credentials files", func(conf *Config) *string { return &conf.OAuth2CredentialsDir }),
+	listSetting("login-providers", "The login providers: google, github, facebook", func(conf *Config) *[]string { return &conf.LoginProviders }),
+	stringSetting("cookie-store-key", "The secret key for the session cookies", func(conf *Config) *string { return &conf.CookieKey }),
+	stringSetting("cookie-domain", "The session cookie's domain", func(conf *Config) *string { return &conf.Cookie.Domain }),
+	{
+		name:        "cookie-secure",
+		description: "Whether the session cookie is only sent via HTTPS",
+		set: func(conf *Config, value string) error {
+			secure, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("not a boolean: %q", value)
+			}
+
+			conf.Cookie.Secure = &secure
+			return nil
+		},
+	},
+	stringSetting("cookie-same-site", "The session cookie's SameSite: lax, strict, or none", func(conf *Config) *string { return &conf.Cookie.SameSite }),
+	{
+		name:        "cookie-max-age-seconds",
+		description: "How long the session cookie lasts, in seconds",
+		set: func(conf *Config, value string) error {
+			maxAge, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("not an integer: %q", value)
+			}
+
+			conf.Cookie.MaxAgeSeconds = maxAge
+			return nil
+		},
+	},
+	stringSetting("base-url", "The frontend's URL", func(conf *Config) *string { return &conf.BaseUrl }),
+	stringSetting("base-api-url", "This server's URL", func(conf *Config) *string { return &conf.BaseApiUrl }),
+	listSetting("cors-allowed-origins", "The origins whose Javascript may call the API", func(conf *Config) *[]string { return &conf.CorsAllowedOrigins }),
+	listSetting("admin-emails", "The email addresses of the admin users", func(conf *Config) *[]string { return &conf.AdminEmails }),
+	stringSetting("metrics-token", "The bearer token for /metrics", func(conf *Config) *string { return &conf.MetricsToken }),
+	stringSetting("certificate-signing-key", "The base64 Ed25519 private key seed that signs the completion certificates", func(conf *Config) *string { return &conf.CertificateSigningKey }),
+	listSetting("certificate-previous-public-keys", "The base64 Ed25519 public keys of previous certificate signing keys", func(conf *Config) *[]string { return &conf.CertificatePreviousPublicKeys }),
+	stringSetting("tracing-exporter", "Where the tracing spans are exported: stdout, or empty to not trace", func(conf *Config) *string { return &conf.TracingExporter }),
+	{
+		name:        "tracing-sample-ratio",
+		description: "The ratio, from 0 to 1, of the traces to sample",
+		set: func(conf *Config, value string) error {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("not a number: %q", value)
+			}
+
+			conf.TracingSampleRatio = &ratio
+			return nil
+		},
+	},
+	stringSetting("client-ip-header", "The header with the client's IP address, for the rate limits", func(conf *Config) *string { return &conf.RateLimits.ClientIpHeader }),
+}
+
+// EnvVarName returns the environment variable for the setting, such as BIGOQUIZ_QUIZZES_DIR for quizzes-dir.
+func EnvVarName(name string) string {
+	return ENV_VAR_PREFIX + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Sources are the layers of the configuration, after the Defaults() for the environment,
+// from the lowest priority to the highest.
+type Sources struct {
+	// The JSON file. If this is empty, no file is read.
+	Filename string
+
+	// Whether it is OK for the file not to exist.
+	FilenameOptional bool
+
+	// Looks up an environment variable, like os.LookupEnv(). If this is nil, no environment variables are used.
+	LookupEnv func(key string) (string, bool)
+
+	// Settings from the command-line flags, by name, such as quizzes-dir.
+	Overrides map[string]string
+}
+
+// Load returns the configuration for the environment, from the defaults and then the sources.
+// It does not validate the configuration. See Validate().
+func Load(env string, sources Sources) (*Config, error) {
+	result := Defaults(env)
+
+	if len(sources.Filename) != 0 {
+		b, err := os.ReadFile(sources.Filename)
+		if err != nil && !(errors.Is(err, os.ErrNotExist) && sources.FilenameOptional) {
+			return nil, fmt.Errorf("unable to read config file (%s): %v", sources.Filename, err)
+		}
+
+		if err == nil {
+			if err := result.loadJson(b); err != nil {
+				return nil, fmt.Errorf("config file (%s): %v", sources.Filename, err)
+			}
+		}
+	}
+
+	if sources.LookupEnv != nil {
+		if err := result.loadEnv(sources.LookupEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := sources.Overrides[s.name]; ok {
+			if err := s.set(result, value); err != nil {
+				return nil, fmt.Errorf("flag -%v: %v", s.name, err)
+			}
+		}
+	}
+
+	result.setDerivedDefaults()
+
+	return result, nil
+}
+
+// loadJson overrides the settings that the JSON specifies.
+// Unknown keys are an error, so misspelt settings are not silently ignored.
+func (self *Config) loadJson(b []byte) error {
+	env := self.Env
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(self); err != nil {
+		return fmt.Errorf("json Decode() failed: %v", err)
+	}
+
+	if self.Env != env {
+		return fmt.Errorf("env may only be chosen by the -env flag or %v", envVarEnv)
+	}
+
+	return nil
+}
+
+func (self *Config) loadEnv(lookupEnv func(key string) (string, bool)) error {
+	if port, ok := lookupEnv(envVarPlatformPort); ok && len(port) != 0 {
+		self.Port = port
+	}
+
+	for _, s := range settings {
+		key := EnvVarName(s.name)
+		if value, ok := lookupEnv(key); ok {
+			if err := s.set(self, value); err != nil {
+				return fmt.Errorf("environment variable %v: %v", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flags are the command-line flags for the environment, the file, and each setting.
+type Flags struct {
+	flagSet *flag.FlagSet
+
+	env      *string
+	filename *string
+	values   map[string]*string
+
+	lookupEnv func(key string) (string, bool)
+}
+
+// RegisterFlags registers the flags with the flag set. lookupEnv is usually os.LookupEnv.
+func RegisterFlags(flagSet *flag.FlagSet, lookupEnv func(key string) (string, bool)) *Flags {
+	result := &Flags{
+		flagSet:   flagSet,
+		values:    make(map[string]*string, len(settings)),
+		lookupEnv: lookupEnv,
+	}
+
+	result.env = flagSet.String("env", "", fmt.Sprintf("Environment to run in: %v or %v. Default: %v, or %v", ENV_PROD, ENV_LOCAL, envVarEnv, ENV_PROD))
+	result.filename = flagSet.String("config", "", fmt.Sprintf("The config file. Default: %v, or %v, if it exists", envVarConfig, DEFAULT_FILENAME))
+
+	for _, s := range settings {
+		result.values[s.name] = flagSet.String(s.name, "", fmt.Sprintf("%v. Overrides %v and the config file", s.description, EnvVarName(s.name)))
+	}
+
+	return result
+}
+
+// Env returns the environment chosen by the -env flag, or BIGOQUIZ_ENV, or ENV_PROD.
+// This should be called after the flags have been parsed.
+func (self *Flags) Env() string {
+	if len(*self.env) != 0 {
+		return *self.env
+	}
+
+	if env, ok := self.lookupEnv(envVarEnv); ok && len(env) != 0 {
+		return env
+	}
+
+	return ENV_PROD
+}
+
+// Sources returns the file, the environment variables, and the flags that were set.
+// This should be called after the flags have been parsed.
+func (self *Flags) Sources() Sources {
+	result := Sources{
+		Filename:  *self.filename,
+		LookupEnv: self.lookupEnv,
+		Overrides: make(map[string]string),
+	}
+
+	if len(result.Filename) == 0 {
+		if filename, ok := self.lookupEnv(envVarConfig); ok && len(filename) != 0 {
+			result.Filename = filename
+		} else {
+			result.Filename = DEFAULT_FILENAME
+			result.FilenameOptional = true
+		}
+	}
+
+	// Only the flags that were set, so empty flags do not override the other layers.
+	self.flagSet.Visit(func(f *flag.Flag) {
+		if value, ok := self.values[f.Name]; ok {
+			result.Overrides[f.Name] = *value
+		}
+	})
+
+	return result
+}
+
+// Load loads the configuration for Env() from Sources().
+func (self *Flags) Load() (*Config, error) {
+	return Load(self.Env(), self.Sources())
+}
+
+// Redacted returns a copy of the configuration, with the secrets replaced, so it can be logged or printed.
+// The login providers' secrets are not in the Config.
+func (self *Config) Redacted() *Config {
+	result := *self
+
+	redact := func(value *string) {
+		if len(*value) != 0 {
+			*value = REDACTED
+		}
+	}
+
+	redact(&result.CookieKey)
+	redact(&result.MetricsToken)
+	redact(&result.CertificateSigningKey)
+
+	// A copy, so the original's secrets are unchanged.
+	result.Webhooks = slices.Clone(self.Webhooks)
+	for i := range result.Webhooks {
+		redact(&result.Webhooks[i].Secret)
+	}
+
+	return &result
+}
+
+// REDACTED replaces the secrets in Redacted().
+const REDACTED = "<redacted>"
+
+// PrintRedacted writes the Redacted() configuration as JSON.
+func (self *Config) PrintRedacted(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(self.Redacted()); err != nil {
+		return fmt.Errorf("json Encode() failed: %v", err)
+	}
+
+	return nil
+}
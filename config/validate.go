@@ -0,0 +1,215 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+)
+
+// The minimum length of the cookie key, which gorilla/securecookie uses for the HMAC.
+// It recommends 32 or 64 bytes.
+const MIN_COOKIE_KEY_LENGTH = 32
+
+// The minimum length of each webhook's secret, for its HMAC.
+const MIN_WEBHOOK_SECRET_LENGTH = 32
+
+// The placeholder in config.json.example.
+const exampleCookieKey = "REPLACE_THIS_WITH_AT_LEAST_32_RANDOM_CHARACTERS"
+
+var allowedEnvs = []string{ENV_PROD, ENV_LOCAL}
+
+var allowedLoginProviders = []string{LOGIN_PROVIDER_GOOGLE, LOGIN_PROVIDER_GITHUB, LOGIN_PROVIDER_FACEBOOK}
+
+var allowedCookieSameSites = []string{"", COOKIE_SAME_SITE_LAX, COOKIE_SAME_SITE_STRICT, COOKIE_SAME_SITE_NONE}
+
+// ValidationError describes every invalid setting, each as "name: problem".
+type ValidationError struct {
+	Problems []string
+}
+
+func (self *ValidationError) Error() string {
+	return strings.Join(self.Problems, "; ")
+}
+
+// Validate returns a *ValidationError describing every invalid setting, or nil if they are all valid.
+// The tracing exporter is checked by tracing.Setup().
+func (self *Config) Validate() error {
+	var problems []string
+	invalid := func(name string, format string, a ...interface{}) {
+		problems = append(problems, name+": "+fmt.Sprintf(format, a...))
+	}
+
+	if !slices.Contains(allowedEnvs, self.Env) {
+		invalid("env", "%q is not one of %v", self.Env, allowedEnvs)
+	}
+
+	if port, err := strconv.Atoi(self.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port", "%q is not a port number", self.Port)
+	}
+
+	if len(self.QuizzesDir) == 0 {
+		invalid("quizzes-dir", "must not be empty")
+	}
+
+	if len(self.DatastoreProjectId) == 0 {
+		invalid("datastore-project-id", "must not be empty")
+	}
+
+	if len(self.LoginProviders) != 0 && len(self.OAuth2CredentialsDir) == 0 {
+		invalid("oauth2-credentials-dir", "must not be empty if there are login-providers")
+	}
+
+	for i, provider := range self.LoginProviders {
+		if !slices.Contains(allowedLoginProviders, provider) {
+			invalid("login-providers", "%q is not one of %v", provider, allowedLoginProviders)
+		} else if slices.Index(self.LoginProviders, provider) != i {
+			invalid("login-providers", "%q is listed more than once", provider)
+		}
+	}
+
+	if len(self.CookieKey) == 0 || self.CookieKey == exampleCookieKey {
+		invalid("cookie-store-key", "must be set")
+	} else if len(self.CookieKey) < MIN_COOKIE_KEY_LENGTH {
+		invalid("cookie-store-key", "must be at least %v characters long. See \"Changing the cookie key\" in README.md", MIN_COOKIE_KEY_LENGTH)
+	}
+
+	if !slices.Contains(allowedCookieSameSites, self.Cookie.SameSite) {
+		invalid("cookie.same-site", "%q is not one of %v", self.Cookie.SameSite, allowedCookieSameSites[1:])
+	} else if self.Cookie.SameSite == COOKIE_SAME_SITE_NONE && !self.Cookie.IsSecure() {
+		// Browsers reject SameSite=None cookies that are not Secure.
+		invalid("cookie.same-site", "%q requires cookie.secure", self.Cookie.SameSite)
+	}
+
+	if self.Cookie.MaxAgeSeconds < 0 {
+		invalid("cookie.max-age-seconds", "must not be negative")
+	}
+
+	if err := validateOrigin(self.BaseUrl); err != nil {
+		invalid("base-url", "%v", err)
+	}
+
+	if err := validateOrigin(self.BaseApiUrl); err != nil {
+		invalid("base-api-url", "%v", err)
+	}
+
+	if len(self.CorsAllowedOrigins) == 0 {
+		invalid("cors-allowed-origins", "must not be empty")
+	}
+
+	for _, origin := range self.CorsAllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			invalid("cors-allowed-origins", "%v", err)
+		}
+	}
+
+	for _, email := range self.AdminEmails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			invalid("admin-emails", "%q is not an email address", email)
+		}
+	}
+
+	if len(self.CertificateSigningKey) != 0 {
+		if key, err := base64.StdEncoding.DecodeString(self.CertificateSigningKey); err != nil || len(key) != ed25519.SeedSize {
+			invalid("certificate-signing-key", "must be %v bytes, base64-encoded", ed25519.SeedSize)
+		}
+	}
+
+	for _, publicKey := range self.CertificatePreviousPublicKeys {
+		if key, err := base64.StdEncoding.DecodeString(publicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			invalid("certificate-previous-public-keys", "%q must be %v bytes, base64-encoded", publicKey, ed25519.PublicKeySize)
+		}
+	}
+
+	if ratio := self.TracingSampleRatio; ratio != nil && (*ratio < 0 || *ratio > 1) {
+		invalid("tracing-sample-ratio", "%v is not between 0 and 1", *ratio)
+	}
+
+	validateRateLimit := func(name string, limit *RateLimit) {
+		if limit != nil && (limit.PerMinute < 0 || limit.Burst < 0) {
+			invalid(name, "must not be negative")
+		}
+	}
+
+	validateRateLimit("rate-limits.answers-per-ip", self.RateLimits.AnswersPerIp)
+	validateRateLimit("rate-limits.answers-per-user", self.RateLimits.AnswersPerUser)
+	validateRateLimit("rate-limits.logins-per-ip", self.RateLimits.LoginsPerIp)
+	validateRateLimit("rate-limits.joins-per-ip", self.RateLimits.JoinsPerIp)
+	validateRateLimit("rate-limits.joins-per-user", self.RateLimits.JoinsPerUser)
+
+	for i, webhook := range self.Webhooks {
+		name := fmt.Sprintf("webhooks[%v]", i)
+		if len(webhook.Id) == 0 {
+			invalid(name+".id", "must not be empty")
+		} else if slices.IndexFunc(self.Webhooks, func(other Webhook) bool { return other.Id == webhook.Id }) != i {
+			invalid(name+".id", "%q is used more than once", webhook.Id)
+		}
+
+		if err := validateWebhookUrl(webhook.Url, self.Env == ENV_LOCAL); err != nil {
+			invalid(name+".url", "%v", err)
+		}
+
+		if len(webhook.Secret) < MIN_WEBHOOK_SECRET_LENGTH {
+			invalid(name+".secret", "must be at least %v characters long", MIN_WEBHOOK_SECRET_LENGTH)
+		}
+
+		for j, event := range webhook.Events {
+			if !domainwebhook.IsKnownEvent(event) {
+				invalid(name+".events", "%q is not one of %v", event, domainwebhook.Events)
+			} else if slices.Index(webhook.Events, event) != j {
+				invalid(name+".events", "%q is listed more than once", event)
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// validateWebhookUrl returns an error if the URL is not an absolute https URL,
+// or an http URL if allowHttp is true, so the deliveries' contents are not sent in plain text.
+func validateWebhookUrl(webhookUrl string, allowHttp bool) error {
+	u, err := url.Parse(webhookUrl)
+	if err != nil {
+		return fmt.Errorf("%q is not a URL: %v", webhookUrl, err)
+	}
+
+	if len(u.Host) == 0 || !(u.Scheme == "https" || (allowHttp && u.Scheme == "http")) {
+		if allowHttp {
+			return fmt.Errorf("%q is not an http or https URL", webhookUrl)
+		}
+
+		return fmt.Errorf("%q is not an https URL", webhookUrl)
+	}
+
+	return nil
+}
+
+// validateOrigin returns an error if the URL is not just a scheme and host, such as https://bigoquiz.com,
+// as used for CORS, and as the start of the URLs for redirects, without a trailing slash.
+// In particular, "*" is not allowed, because the API allows credentials.
+func validateOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("%q is not a URL: %v", origin, err)
+	}
+
+	if (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+		return fmt.Errorf("%q is not an http or https URL", origin)
+	}
+
+	if len(u.Path) != 0 || len(u.RawQuery) != 0 || len(u.Fragment) != 0 || u.User != nil {
+		return fmt.Errorf("%q must not have a path, query, or user", origin)
+	}
+
+	return nil
+}
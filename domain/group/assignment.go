@@ -0,0 +1,118 @@
+package group
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/murraycu/go-bigoquiz-server/domain/user"
+)
+
+// The maximum number of assignments in a group,
+// because each learner's assignments are listed, with their progress, all at once.
+const MaxAssignments = 100
+
+// The statuses of an AssignmentProgress.
+const (
+	ASSIGNMENT_STATUS_NOT_STARTED = "not-started"
+	ASSIGNMENT_STATUS_IN_PROGRESS = "in-progress"
+	ASSIGNMENT_STATUS_COMPLETE    = "complete"
+	ASSIGNMENT_STATUS_OVERDUE     = "overdue"
+)
+
+// Assignment asks the group's members, apart from its owner, who is the instructor,
+// to answer some proportion of the questions of a quiz, or of some of its sections, correctly at least once,
+// by the due date.
+type Assignment struct {
+	Id      string
+	GroupId string
+
+	QuizId string
+
+	// The sections, or empty for the whole quiz.
+	SectionIds []string
+
+	Due time.Time
+
+	// The proportion, from 0 to 1, of the questions to answer correctly at least once.
+	TargetCorrectOnce float64
+
+	Created time.Time
+}
+
+// AssignmentProgress is a learner's progress towards an assignment's target.
+type AssignmentProgress struct {
+	CountQuestions            int
+	CountQuestionsCorrectOnce int
+
+	// Any of the ASSIGNMENT_STATUS_* constants.
+	Status string
+}
+
+// NewAssignment returns an assignment with a random ID.
+func NewAssignment(groupId string, quizId string, sectionIds []string, due time.Time, targetCorrectOnce float64, now time.Time) (*Assignment, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	return &Assignment{
+		Id:                hex.EncodeToString(idBytes),
+		GroupId:           groupId,
+		QuizId:            quizId,
+		SectionIds:        sectionIds,
+		Due:               due,
+		TargetCorrectOnce: targetCorrectOnce,
+		Created:           now,
+	}, nil
+}
+
+// IsValidTarget returns true if the target is a proportion greater than 0, and at most 1.
+func IsValidTarget(targetCorrectOnce float64) bool {
+	return targetCorrectOnce > 0 && targetCorrectOnce <= 1
+}
+
+// Progress returns the learner's progress, from their stats for the assignment's quiz, by section ID.
+// sectionQuestionCounts has the number of questions in each of the sections that the assignment covers.
+// countCorrectOnce returns how many of the section's current questions the learner has answered correctly
+// at least once, because the stats' CountQuestionsCorrectOnce still counts questions that have been removed.
+func (self *Assignment) Progress(statsBySection map[string]*user.Stats, sectionQuestionCounts map[string]int, countCorrectOnce func(sectionId string, stats *user.Stats) int, now time.Time) *AssignmentProgress {
+	result := &AssignmentProgress{}
+
+	answered := 0
+	for sectionId, countQuestions := range sectionQuestionCounts {
+		result.CountQuestions += countQuestions
+
+		stats := statsBySection[sectionId]
+		if stats == nil {
+			continue
+		}
+
+		answered += stats.Answered
+		result.CountQuestionsCorrectOnce += countCorrectOnce(sectionId, stats)
+	}
+
+	switch {
+	case result.CountQuestions != 0 && result.CorrectOnceRate() >= self.TargetCorrectOnce:
+		result.Status = ASSIGNMENT_STATUS_COMPLETE
+	case now.After(self.Due):
+		result.Status = ASSIGNMENT_STATUS_OVERDUE
+	case answered == 0:
+		result.Status = ASSIGNMENT_STATUS_NOT_STARTED
+	default:
+		result.Status = ASSIGNMENT_STATUS_IN_PROGRESS
+	}
+
+	return result
+}
+
+// CorrectOnceRate returns the proportion, from 0 to 1, of the questions that the learner
+// has answered correctly at least once.
+func (self *AssignmentProgress) CorrectOnceRate() float64 {
+	if self.CountQuestions == 0 {
+		return 0
+	}
+
+	return float64(self.CountQuestionsCorrectOnce) / float64(self.CountQuestions)
+}
@@ -0,0 +1,77 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignmentProgress(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assignment, err := NewAssignment("some-group", "bigo", []string{"sorting", "graphs"}, now.Add(24*time.Hour), 0.8, now)
+	assert.Nil(t, err)
+	assert.Len(t, assignment.Id, 32)
+
+	counts := map[string]int{"sorting": 6, "graphs": 4}
+
+	// Like the quiz, in which "removed" is no longer in the section.
+	countCorrectOnce := func(sectionId string, stats *user.Stats) int {
+		result := 0
+		for _, qh := range stats.QuestionHistories {
+			if qh.AnsweredCorrectlyOnce && qh.QuestionId != "removed" {
+				result++
+			}
+		}
+
+		return result
+	}
+
+	answerCorrectly := func(sectionId string, questionIds ...string) *user.Stats {
+		stats := &user.Stats{SectionId: sectionId}
+		for _, questionId := range questionIds {
+			stats.UpdateStatsForAnswerCorrectness(questionId, true)
+		}
+
+		return stats
+	}
+
+	progress := assignment.Progress(nil, counts, countCorrectOnce, now)
+	assert.Equal(t, 10, progress.CountQuestions)
+	assert.Zero(t, progress.CountQuestionsCorrectOnce)
+	assert.Equal(t, ASSIGNMENT_STATUS_NOT_STARTED, progress.Status)
+
+	statsBySection := map[string]*user.Stats{
+		"sorting": answerCorrectly("sorting", "a", "b", "c", "d", "e"),
+
+		// Not part of the assignment.
+		"trees": answerCorrectly("trees", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o"),
+	}
+
+	progress = assignment.Progress(statsBySection, counts, countCorrectOnce, now)
+	assert.Equal(t, 5, progress.CountQuestionsCorrectOnce)
+	assert.InDelta(t, 0.5, progress.CorrectOnceRate(), 0.001)
+	assert.Equal(t, ASSIGNMENT_STATUS_IN_PROGRESS, progress.Status)
+
+	progress = assignment.Progress(statsBySection, counts, countCorrectOnce, now.Add(48*time.Hour))
+	assert.Equal(t, ASSIGNMENT_STATUS_OVERDUE, progress.Status)
+
+	// Removed questions, still counted in the stats, do not count.
+	statsBySection["graphs"] = answerCorrectly("graphs", "p", "q", "removed")
+	progress = assignment.Progress(statsBySection, counts, countCorrectOnce, now.Add(48*time.Hour))
+	assert.Equal(t, 7, progress.CountQuestionsCorrectOnce)
+	assert.Equal(t, ASSIGNMENT_STATUS_OVERDUE, progress.Status)
+
+	statsBySection["graphs"] = answerCorrectly("graphs", "p", "q", "r", "removed")
+	progress = assignment.Progress(statsBySection, counts, countCorrectOnce, now.Add(48*time.Hour))
+	assert.Equal(t, 8, progress.CountQuestionsCorrectOnce)
+	assert.Equal(t, ASSIGNMENT_STATUS_COMPLETE, progress.Status)
+}
+
+func TestIsValidTarget(t *testing.T) {
+	assert.True(t, IsValidTarget(0.8))
+	assert.True(t, IsValidTarget(1))
+	assert.False(t, IsValidTarget(0))
+	assert.False(t, IsValidTarget(1.5))
+}
@@ -0,0 +1,112 @@
+package group
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The maximum length of a group's name.
+const MaxNameLength = 100
+
+// The maximum number of members in a group,
+// because the progress reads the stats of every member.
+const MaxMembers = 100
+
+// The characters of the invite codes, without those that are easily confused, such as 0 and O.
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 8
+
+// Group is some users who study together.
+// Users join with the invite code, and only see each other's progress if they choose to share it.
+type Group struct {
+	Id   string
+	Name string
+
+	// The user who created the group.
+	OwnerUserId string
+
+	InviteCode string
+
+	Created time.Time
+}
+
+// Membership is a user's membership of a group.
+type Membership struct {
+	GroupId string
+	UserId  string
+
+	// The user's name when they joined, to show to the other members.
+	UserName string
+
+	// Whether the user has chosen to include their stats in the group's progress,
+	// and to be counted in the totals of the assignment reports.
+	// The other members only see totals, not which member answered what.
+	// This is false until the user opts in.
+	SharesProgress bool
+
+	// Whether the user has chosen to let the group's owner see their own progress
+	// on each assignment, by name. This is separate from SharesProgress,
+	// and is false until the user opts in.
+	SharesWithInstructor bool
+
+	Joined time.Time
+}
+
+// NewGroup returns a group with a random ID and invite code.
+func NewGroup(name string, ownerUserId string, now time.Time) (*Group, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	inviteCode, err := NewInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("NewInviteCode() failed: %v", err)
+	}
+
+	return &Group{
+		Id:          hex.EncodeToString(idBytes),
+		Name:        name,
+		OwnerUserId: ownerUserId,
+		InviteCode:  inviteCode,
+		Created:     now,
+	}, nil
+}
+
+// NewInviteCode returns a random code, which is short enough to read out to the other members.
+func NewInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	// The alphabet has 32 characters, so this is not biased.
+	var result strings.Builder
+	for _, c := range b {
+		result.WriteByte(inviteCodeAlphabet[int(c)%len(inviteCodeAlphabet)])
+	}
+
+	return result.String(), nil
+}
+
+// NormalizeInviteCode returns the invite code as NewInviteCode() would return it,
+// so users may type it in lower case, or with spaces or dashes.
+func NormalizeInviteCode(inviteCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(inviteCode))
+}
+
+// NormalizeName returns the trimmed name, and whether it is valid.
+func NormalizeName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, len(name) != 0 && len([]rune(name)) <= MaxNameLength
+}
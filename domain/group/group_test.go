@@ -0,0 +1,40 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGroup(t *testing.T) {
+	now := time.Now()
+	group, err := NewGroup("Some Team", "some-user", now)
+	assert.Nil(t, err)
+	assert.Len(t, group.Id, 32)
+	assert.Equal(t, "Some Team", group.Name)
+	assert.Equal(t, "some-user", group.OwnerUserId)
+	assert.Len(t, group.InviteCode, inviteCodeLength)
+	assert.Equal(t, group.InviteCode, NormalizeInviteCode(group.InviteCode))
+
+	other, err := NewGroup("Some Team", "some-user", now)
+	assert.Nil(t, err)
+	assert.NotEqual(t, group.Id, other.Id)
+}
+
+func TestNormalizeInviteCode(t *testing.T) {
+	assert.Equal(t, "ABCD2345", NormalizeInviteCode("abcd-2345"))
+	assert.Equal(t, "ABCD2345", NormalizeInviteCode(" ABCD 2345 "))
+}
+
+func TestNormalizeName(t *testing.T) {
+	name, ok := NormalizeName("  Some Team ")
+	assert.True(t, ok)
+	assert.Equal(t, "Some Team", name)
+
+	_, ok = NormalizeName("   ")
+	assert.False(t, ok)
+
+	_, ok = NormalizeName(string(make([]rune, MaxNameLength+1)))
+	assert.False(t, ok)
+}
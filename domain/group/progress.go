@@ -0,0 +1,84 @@
+package group
+
+import "github.com/murraycu/go-bigoquiz-server/domain/user"
+
+// Progress is the total of the stats, for one quiz, of the group's members who share their progress.
+// It does not say which member answered what.
+type Progress struct {
+	QuizId string
+
+	// The members whose stats are included, even if they have not answered anything.
+	CountMembers int
+
+	// By section ID.
+	Sections map[string]*SectionProgress
+}
+
+// SectionProgress is the total of the members' stats for one section.
+type SectionProgress struct {
+	SectionId string
+
+	// How many of the members have answered any of the section's questions.
+	CountMembersStarted int
+
+	Answered int
+	Correct  int
+
+	CountQuestionsCorrectOnce int
+	CountQuestionsMastered    int
+}
+
+func NewProgress(quizId string) *Progress {
+	return &Progress{
+		QuizId:   quizId,
+		Sections: make(map[string]*SectionProgress),
+	}
+}
+
+// AddMember adds one member's stats for the quiz, by section ID.
+func (self *Progress) AddMember(statsBySection map[string]*user.Stats) {
+	self.CountMembers++
+
+	for sectionId, stats := range statsBySection {
+		if stats == nil || stats.Answered == 0 {
+			continue
+		}
+
+		section := self.getOrAddSection(sectionId)
+		section.CountMembersStarted++
+		section.Answered += stats.Answered
+		section.Correct += stats.Correct
+		section.CountQuestionsCorrectOnce += stats.CountQuestionsCorrectOnce
+		section.CountQuestionsMastered += stats.CountQuestionsMastered
+	}
+}
+
+func (self *Progress) getOrAddSection(sectionId string) *SectionProgress {
+	section, ok := self.Sections[sectionId]
+	if !ok {
+		section = &SectionProgress{SectionId: sectionId}
+		self.Sections[sectionId] = section
+	}
+
+	return section
+}
+
+// CorrectRate returns the proportion of the answers that were correct, or 0 if there are none.
+func (self *SectionProgress) CorrectRate() float64 {
+	if self.Answered == 0 {
+		return 0
+	}
+
+	return float64(self.Correct) / float64(self.Answered)
+}
+
+// CompletionRate returns the proportion of the section's questions that the members have answered correctly at least once,
+// on average, from 0 to 1. Members who have not started the section count as 0.
+func (self *SectionProgress) CompletionRate(countMembers int, countQuestions int) float64 {
+	if countMembers == 0 || countQuestions == 0 {
+		return 0
+	}
+
+	// The stats may still count questions that have since been removed from the section.
+	return min(1, float64(self.CountQuestionsCorrectOnce)/float64(countMembers*countQuestions))
+}
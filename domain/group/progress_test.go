@@ -0,0 +1,47 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressAddMember(t *testing.T) {
+	progress := NewProgress("bigo")
+
+	progress.AddMember(map[string]*user.Stats{
+		"sorting": {SectionId: "sorting", Answered: 10, Correct: 5, CountQuestionsCorrectOnce: 4, CountQuestionsMastered: 1},
+		"graphs":  {SectionId: "graphs", Answered: 2, Correct: 2, CountQuestionsCorrectOnce: 2},
+	})
+	progress.AddMember(map[string]*user.Stats{
+		"sorting": {SectionId: "sorting", Answered: 10, Correct: 10, CountQuestionsCorrectOnce: 6, CountQuestionsMastered: 3},
+	})
+
+	// A member who has not answered anything.
+	progress.AddMember(nil)
+
+	assert.Equal(t, 3, progress.CountMembers)
+	assert.Len(t, progress.Sections, 2)
+
+	sorting := progress.Sections["sorting"]
+	assert.Equal(t, 2, sorting.CountMembersStarted)
+	assert.Equal(t, 20, sorting.Answered)
+	assert.Equal(t, 15, sorting.Correct)
+	assert.Equal(t, 10, sorting.CountQuestionsCorrectOnce)
+	assert.Equal(t, 4, sorting.CountQuestionsMastered)
+	assert.InDelta(t, 0.75, sorting.CorrectRate(), 0.001)
+
+	// 10 of the 3 members' 3 * 10 questions.
+	assert.InDelta(t, 1.0/3, sorting.CompletionRate(progress.CountMembers, 10), 0.001)
+
+	graphs := progress.Sections["graphs"]
+	assert.Equal(t, 1, graphs.CountMembersStarted)
+	assert.InDelta(t, 1.0, graphs.CorrectRate(), 0.001)
+
+	// Removed questions are still counted in the stats.
+	assert.InDelta(t, 1.0, graphs.CompletionRate(1, 1), 0.001)
+
+	assert.Zero(t, (&SectionProgress{}).CorrectRate())
+	assert.Zero(t, (&SectionProgress{}).CompletionRate(0, 10))
+}
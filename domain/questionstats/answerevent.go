@@ -0,0 +1,49 @@
+package questionstats
+
+import "time"
+
+// The maximum length of AnswerEvent.Answer, so users cannot fill the datastore with long answers.
+const MaxAnswerLength = 200
+
+// AnswerEvent is one submitted answer, from any user, without identifying the user.
+type AnswerEvent struct {
+	QuizId     string
+	QuestionId string
+
+	Correct bool
+
+	// The user chose "I don't know" instead of answering.
+	DontKnow bool
+
+	// The submitted answer. This is only set for wrong answers.
+	Answer string
+
+	Time time.Time
+}
+
+// NewAnswerEvent creates an AnswerEvent, truncating the answer if necessary,
+// and only keeping it if it is wrong.
+func NewAnswerEvent(quizId string, questionId string, answer string, correct bool, dontKnow bool, t time.Time) *AnswerEvent {
+	result := &AnswerEvent{
+		QuizId:     quizId,
+		QuestionId: questionId,
+		Correct:    correct,
+		DontKnow:   dontKnow,
+		Time:       t,
+	}
+
+	if !correct && !dontKnow {
+		result.Answer = truncateAnswer(answer)
+	}
+
+	return result
+}
+
+func truncateAnswer(answer string) string {
+	runes := []rune(answer)
+	if len(runes) <= MaxAnswerLength {
+		return answer
+	}
+
+	return string(runes[:MaxAnswerLength])
+}
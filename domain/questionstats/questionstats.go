@@ -0,0 +1,126 @@
+package questionstats
+
+import "sort"
+
+const (
+	// The maximum number of distinct wrong answers to remember for each question.
+	// When there are more, the least common ones are forgotten.
+	MaxWrongAnswers = 20
+
+	// The difficulty of a question that nobody has answered yet.
+	DefaultDifficulty = 0.5
+
+	// How many imaginary answers, at DefaultDifficulty, to combine with the real answers,
+	// so that a question's difficulty does not jump to 0 or 1 after only a few answers.
+	difficultyPriorWeight = 5
+)
+
+// WrongAnswer is a wrong answer and the number of times that it was submitted.
+type WrongAnswer struct {
+	Answer string
+	Count  int
+}
+
+// QuestionStats is the aggregate of all users' answers to one question.
+type QuestionStats struct {
+	QuizId     string
+	QuestionId string
+
+	Answered int
+	Correct  int
+	DontKnow int
+
+	// The most common wrong answers, most common first.
+	WrongAnswers []WrongAnswer
+}
+
+// Add adds the AnswerEvent's answer to the counts.
+func (self *QuestionStats) Add(event *AnswerEvent) {
+	self.Answered += 1
+
+	if event.Correct {
+		self.Correct += 1
+		return
+	}
+
+	if event.DontKnow {
+		self.DontKnow += 1
+		return
+	}
+
+	if len(event.Answer) != 0 {
+		self.addWrongAnswer(event.Answer, 1)
+	}
+}
+
+// Merge adds the counts from other, such as stats for some more recent answers.
+func (self *QuestionStats) Merge(other *QuestionStats) {
+	self.Answered += other.Answered
+	self.Correct += other.Correct
+	self.DontKnow += other.DontKnow
+
+	for _, wrongAnswer := range other.WrongAnswers {
+		self.addWrongAnswer(wrongAnswer.Answer, wrongAnswer.Count)
+	}
+}
+
+func (self *QuestionStats) addWrongAnswer(answer string, count int) {
+	found := false
+	for i := range self.WrongAnswers {
+		if self.WrongAnswers[i].Answer == answer {
+			self.WrongAnswers[i].Count += count
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		self.WrongAnswers = append(self.WrongAnswers, WrongAnswer{Answer: answer, Count: count})
+	}
+
+	// Keep them in order, and keep the most common ones.
+	// SliceStable keeps older answers ahead of newer answers with the same count.
+	sort.SliceStable(self.WrongAnswers, func(i, j int) bool {
+		return self.WrongAnswers[i].Count > self.WrongAnswers[j].Count
+	})
+
+	if len(self.WrongAnswers) > MaxWrongAnswers {
+		self.WrongAnswers = self.WrongAnswers[:MaxWrongAnswers]
+	}
+}
+
+// GetWrong returns the number of wrong answers, including "I don't know" answers.
+func (self *QuestionStats) GetWrong() int {
+	return self.Answered - self.Correct
+}
+
+// GetCorrectRate returns the proportion, from 0 to 1, of answers that were correct,
+// or 0 if there are no answers yet.
+func (self *QuestionStats) GetCorrectRate() float64 {
+	if self.Answered == 0 {
+		return 0
+	}
+
+	return float64(self.Correct) / float64(self.Answered)
+}
+
+// GetDifficulty returns an estimate, from 0 (easy) to 1 (hard), of how hard the question is.
+// This is the proportion of wrong answers, moved towards DefaultDifficulty when there are few answers.
+// This may be called on a nil QuestionStats.
+func (self *QuestionStats) GetDifficulty() float64 {
+	if self == nil {
+		return DefaultDifficulty
+	}
+
+	return (float64(self.GetWrong()) + DefaultDifficulty*difficultyPriorWeight) /
+		(float64(self.Answered) + difficultyPriorWeight)
+}
+
+// GetMostCommonWrongAnswers returns up to count of the most common wrong answers.
+func (self *QuestionStats) GetMostCommonWrongAnswers(count int) []WrongAnswer {
+	if count < len(self.WrongAnswers) {
+		return self.WrongAnswers[:count]
+	}
+
+	return self.WrongAnswers
+}
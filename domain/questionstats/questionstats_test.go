@@ -0,0 +1,110 @@
+package questionstats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	TEST_QUIZ_ID     = "test-quiz-id"
+	TEST_QUESTION_ID = "test-question-id"
+)
+
+func testAnswerEvent(answer string, correct bool) *AnswerEvent {
+	return NewAnswerEvent(TEST_QUIZ_ID, TEST_QUESTION_ID, answer, correct, false, time.Now())
+}
+
+func TestNewAnswerEventOnlyKeepsWrongAnswers(t *testing.T) {
+	event := testAnswerEvent("right", true)
+	assert.Empty(t, event.Answer)
+
+	event = NewAnswerEvent(TEST_QUIZ_ID, TEST_QUESTION_ID, "", false, true, time.Now())
+	assert.Empty(t, event.Answer)
+	assert.True(t, event.DontKnow)
+
+	event = testAnswerEvent("wrong", false)
+	assert.Equal(t, "wrong", event.Answer)
+
+	event = testAnswerEvent(strings.Repeat("x", MaxAnswerLength+10), false)
+	assert.Len(t, event.Answer, MaxAnswerLength)
+}
+
+func TestQuestionStatsAdd(t *testing.T) {
+	var stats QuestionStats
+
+	stats.Add(testAnswerEvent("right", true))
+	stats.Add(testAnswerEvent("wrong1", false))
+	stats.Add(testAnswerEvent("wrong2", false))
+	stats.Add(testAnswerEvent("wrong2", false))
+	stats.Add(NewAnswerEvent(TEST_QUIZ_ID, TEST_QUESTION_ID, "", false, true, time.Now()))
+
+	assert.Equal(t, 5, stats.Answered)
+	assert.Equal(t, 1, stats.Correct)
+	assert.Equal(t, 1, stats.DontKnow)
+	assert.Equal(t, 4, stats.GetWrong())
+	assert.InDelta(t, 0.2, stats.GetCorrectRate(), 0.0001)
+
+	assert.Equal(t, []WrongAnswer{
+		{Answer: "wrong2", Count: 2},
+		{Answer: "wrong1", Count: 1},
+	}, stats.WrongAnswers)
+
+	assert.Equal(t, []WrongAnswer{{Answer: "wrong2", Count: 2}}, stats.GetMostCommonWrongAnswers(1))
+}
+
+func TestQuestionStatsWrongAnswersAreLimited(t *testing.T) {
+	var stats QuestionStats
+
+	stats.Add(testAnswerEvent("common", false))
+	stats.Add(testAnswerEvent("common", false))
+
+	for i := 0; i < MaxWrongAnswers*2; i++ {
+		stats.Add(testAnswerEvent(strings.Repeat("x", i+1), false))
+	}
+
+	assert.Len(t, stats.WrongAnswers, MaxWrongAnswers)
+	assert.Equal(t, "common", stats.WrongAnswers[0].Answer)
+}
+
+func TestQuestionStatsDifficulty(t *testing.T) {
+	var nilStats *QuestionStats
+	assert.Equal(t, DefaultDifficulty, nilStats.GetDifficulty())
+
+	var stats QuestionStats
+	assert.Equal(t, DefaultDifficulty, stats.GetDifficulty())
+
+	var easy QuestionStats
+	var hard QuestionStats
+	for i := 0; i < 20; i++ {
+		easy.Add(testAnswerEvent("right", true))
+		hard.Add(testAnswerEvent("wrong", false))
+	}
+
+	assert.Less(t, easy.GetDifficulty(), DefaultDifficulty)
+	assert.Greater(t, hard.GetDifficulty(), DefaultDifficulty)
+	assert.Greater(t, easy.GetDifficulty(), 0.0)
+	assert.Less(t, hard.GetDifficulty(), 1.0)
+}
+
+func TestQuestionStatsMerge(t *testing.T) {
+	var stats QuestionStats
+	stats.Add(testAnswerEvent("right", true))
+	stats.Add(testAnswerEvent("wrong1", false))
+
+	var newer QuestionStats
+	newer.Add(testAnswerEvent("wrong2", false))
+	newer.Add(testAnswerEvent("wrong2", false))
+	newer.Add(testAnswerEvent("wrong1", false))
+
+	stats.Merge(&newer)
+
+	assert.Equal(t, 5, stats.Answered)
+	assert.Equal(t, 1, stats.Correct)
+	assert.ElementsMatch(t, []WrongAnswer{
+		{Answer: "wrong1", Count: 2},
+		{Answer: "wrong2", Count: 2},
+	}, stats.WrongAnswers)
+}
@@ -0,0 +1,59 @@
+package quiz
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+)
+
+// The number of hex digits in the hashes, which only need to identify a quiz's versions.
+const contentHashLength = 16
+
+func writeText(w io.Writer, text *Text) {
+	// Quoted, so the parts cannot run into each other.
+	io.WriteString(w, strconv.Quote(text.Text))
+	io.WriteString(w, strconv.FormatBool(text.IsHtml))
+}
+
+func sumToHash(sum []byte) string {
+	return hex.EncodeToString(sum)[:contentHashLength]
+}
+
+// computeContentHash returns a hash of the question's text and answer,
+// which changes when either of them changes, but not when only the tags or link change.
+func (self *QuestionAndAnswer) computeContentHash() string {
+	h := sha256.New()
+	writeText(h, &self.Text)
+	writeText(h, &self.Answer)
+	return sumToHash(h.Sum(nil))
+}
+
+// SetContentVersions sets the ContentHash of each question,
+// and the Version, from the questions' hashes, unless the quiz has an explicit version.
+func (self *Quiz) SetContentVersions() {
+	h := sha256.New()
+
+	setHashes := func(questions []*QuestionAndAnswer) {
+		for _, qa := range questions {
+			qa.ContentHash = qa.computeContentHash()
+			io.WriteString(h, strconv.Quote(qa.Id))
+			io.WriteString(h, qa.ContentHash)
+		}
+	}
+
+	setHashes(self.Questions)
+	for _, section := range self.Sections {
+		io.WriteString(h, strconv.Quote(section.Id))
+		setHashes(section.Questions)
+
+		for _, subSection := range section.SubSections {
+			io.WriteString(h, strconv.Quote(subSection.Id))
+			setHashes(subSection.Questions)
+		}
+	}
+
+	if len(self.Version) == 0 {
+		self.Version = sumToHash(h.Sum(nil))
+	}
+}
@@ -0,0 +1,58 @@
+package quiz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newContentVersionTestQuiz() *Quiz {
+	section := &Section{
+		Questions: []*QuestionAndAnswer{
+			{Question: Question{Id: "q1", Text: Text{Text: "Quicksort"}}, Answer: Text{Text: "O(n log n)"}},
+			{Question: Question{Id: "q2", Text: Text{Text: "Bubble sort"}}, Answer: Text{Text: "O(n^2)"}},
+		},
+	}
+	section.Id = "sorting"
+
+	return &Quiz{Sections: []*Section{section}}
+}
+
+func TestQuizSetContentVersions(t *testing.T) {
+	q := newContentVersionTestQuiz()
+	q.SetContentVersions()
+	assert.Len(t, q.Version, contentHashLength)
+
+	q1 := q.Sections[0].Questions[0]
+	q2 := q.Sections[0].Questions[1]
+	assert.Len(t, q1.ContentHash, contentHashLength)
+	assert.NotEqual(t, q1.ContentHash, q2.ContentHash)
+
+	// The same content has the same versions.
+	same := newContentVersionTestQuiz()
+	same.SetContentVersions()
+	assert.Equal(t, q.Version, same.Version)
+	assert.Equal(t, q1.ContentHash, same.Sections[0].Questions[0].ContentHash)
+
+	// Changing an answer changes only that question's hash, and the quiz's version.
+	changed := newContentVersionTestQuiz()
+	changed.Sections[0].Questions[1].Answer.Text = "O(n^2), or O(n) if already sorted"
+	changed.Sections[0].Questions[1].Tags = []string{"some-tag"}
+	changed.SetContentVersions()
+	assert.NotEqual(t, q.Version, changed.Version)
+	assert.Equal(t, q1.ContentHash, changed.Sections[0].Questions[0].ContentHash)
+	assert.NotEqual(t, q2.ContentHash, changed.Sections[0].Questions[1].ContentHash)
+
+	// Changing only the tags does not change the question's hash.
+	tagged := newContentVersionTestQuiz()
+	tagged.Sections[0].Questions[1].Tags = []string{"some-tag"}
+	tagged.SetContentVersions()
+	assert.Equal(t, q.Version, tagged.Version)
+
+	// An explicit version is kept.
+	explicit := newContentVersionTestQuiz()
+	explicit.Version = "3"
+	explicit.SetContentVersions()
+	assert.Equal(t, "3", explicit.Version)
+	assert.Equal(t, q1.ContentHash, explicit.Sections[0].Questions[0].ContentHash)
+}
@@ -0,0 +1,38 @@
+package quiz
+
+// IdMigrations maps the old IDs of sections and questions, from earlier versions of the quiz,
+// to their new IDs, so the users' stats for the old IDs can be moved to the new IDs.
+type IdMigrations struct {
+	Sections  map[string]string
+	Questions map[string]string
+}
+
+// IsEmpty returns whether no IDs have been renamed.
+func (self *IdMigrations) IsEmpty() bool {
+	return len(self.Sections) == 0 && len(self.Questions) == 0
+}
+
+// CurrentSectionId returns the section's current ID,
+// following renames of renamed IDs, or the ID itself if it was not renamed.
+func (self *IdMigrations) CurrentSectionId(sectionId string) string {
+	return currentId(self.Sections, sectionId)
+}
+
+// CurrentQuestionId returns the question's current ID. See CurrentSectionId().
+func (self *IdMigrations) CurrentQuestionId(questionId string) string {
+	return currentId(self.Questions, questionId)
+}
+
+func currentId(newIds map[string]string, id string) string {
+	// Stop after as many steps as there are IDs, in case of a cycle.
+	for i := 0; i < len(newIds); i++ {
+		newId, ok := newIds[id]
+		if !ok || newId == id {
+			break
+		}
+
+		id = newId
+	}
+
+	return id
+}
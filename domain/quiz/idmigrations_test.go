@@ -0,0 +1,61 @@
+package quiz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdMigrationsCurrentId(t *testing.T) {
+	migrations := IdMigrations{
+		Sections: map[string]string{
+			"a": "b",
+			"b": "c",
+			"x": "y",
+			"y": "x",
+		},
+	}
+
+	assert.Equal(t, "c", migrations.CurrentSectionId("a"))
+	assert.Equal(t, "c", migrations.CurrentSectionId("b"))
+	assert.Equal(t, "c", migrations.CurrentSectionId("c"))
+	assert.Equal(t, "other", migrations.CurrentSectionId("other"))
+
+	// A cycle does not loop forever.
+	assert.Contains(t, []string{"x", "y"}, migrations.CurrentSectionId("x"))
+
+	// Nothing has been renamed.
+	assert.Equal(t, "some-question", migrations.CurrentQuestionId("some-question"))
+	assert.False(t, migrations.IsEmpty())
+	assert.True(t, (&IdMigrations{}).IsEmpty())
+}
+
+func TestQuizCheckIdMigrations(t *testing.T) {
+	newQuiz := func(migrations IdMigrations) *Quiz {
+		section := &Section{
+			Questions:   []*QuestionAndAnswer{{Question: Question{Id: "q1"}}},
+			SubSections: []*SubSection{{Questions: []*QuestionAndAnswer{{Question: Question{Id: "q2"}}}}},
+		}
+		section.Id = "s1"
+
+		return &Quiz{Sections: []*Section{section}, IdMigrations: migrations}
+	}
+
+	q := newQuiz(IdMigrations{
+		Sections:  map[string]string{"old-s1": "s1", "reverse-old-s1": "reverse-s1"},
+		Questions: map[string]string{"old-q1": "q1", "older-q2": "old-q2", "old-q2": "q2"},
+	})
+	assert.Nil(t, q.CheckIdMigrations())
+	assert.Equal(t, map[string]string{"q1": "s1", "q2": "s1"}, q.GetSectionIdsByQuestionId())
+
+	// A misspelt new ID.
+	q = newQuiz(IdMigrations{Sections: map[string]string{"old-s1": "s-1"}})
+	assert.NotNil(t, q.CheckIdMigrations())
+
+	q = newQuiz(IdMigrations{Questions: map[string]string{"old-q1": "q-1"}})
+	assert.NotNil(t, q.CheckIdMigrations())
+
+	// An old ID that is still used.
+	q = newQuiz(IdMigrations{Questions: map[string]string{"q1": "q2"}})
+	assert.NotNil(t, q.CheckIdMigrations())
+}
@@ -8,5 +8,7 @@ type Question struct {
 
 	Text Text
 
+	Tags []string
+
 	QuizUsesMathML bool
 }
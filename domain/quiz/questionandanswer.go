@@ -3,11 +3,15 @@ package quiz
 type QuestionAndAnswer struct {
 	Question
 	Answer Text
+
+	// A hash of the Text and Answer, so we can tell when they have changed. See Quiz.SetContentVersions().
+	ContentHash string
 }
 
 func (self *QuestionAndAnswer) createReverse() *QuestionAndAnswer {
 	var result QuestionAndAnswer
 	result.Id = "reverse-" + self.Id
+	result.Tags = self.Tags
 	result.Text = self.Answer
 	result.Answer = self.Text
 	result.Answer.IsHtml = false
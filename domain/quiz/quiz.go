@@ -1,14 +1,88 @@
 package quiz
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Quiz struct {
 	HasIdAndTitle
 	IsPrivate bool
 
+	// The version of the content, so we can tell when the quiz has changed.
+	// This is the quiz's explicit version number, if it has one, or a hash of its questions and answers.
+	Version string
+
 	Sections  []*Section
 	Questions []*QuestionAndAnswer
 
 	UsesMathML bool
 
+	Tags []string
+
+	// The IDs of sections and questions that have been renamed.
+	IdMigrations IdMigrations
+
 	// TODO: We only need this until we have called setQuestionsChoicesFromAnswers().
 	AnswersAsChoices bool
 }
+
+// GetSection returns the section with the ID, or nil if there is none.
+func (self *Quiz) GetSection(sectionId string) *Section {
+	for _, section := range self.Sections {
+		if section.Id == sectionId {
+			return section
+		}
+	}
+
+	return nil
+}
+
+// GetSectionIdsByQuestionId returns the ID of each question's section.
+func (self *Quiz) GetSectionIdsByQuestionId() map[string]string {
+	result := make(map[string]string)
+	for _, section := range self.Sections {
+		for _, qa := range section.Questions {
+			result[qa.Id] = section.Id
+		}
+
+		for _, subSection := range section.SubSections {
+			for _, qa := range subSection.Questions {
+				result[qa.Id] = section.Id
+			}
+		}
+	}
+
+	return result
+}
+
+// CheckIdMigrations returns an error if an old ID is still used, or if a new ID is not in the quiz,
+// such as when it has been misspelt.
+func (self *Quiz) CheckIdMigrations() error {
+	sectionIdsByQuestionId := self.GetSectionIdsByQuestionId()
+
+	for oldId := range self.IdMigrations.Sections {
+		if self.GetSection(oldId) != nil {
+			return fmt.Errorf("the renamed section ID is still used: %v", oldId)
+		}
+
+		// Reverse sections are only renamed if they exist.
+		newId := self.IdMigrations.CurrentSectionId(oldId)
+		if self.GetSection(newId) == nil && !strings.HasPrefix(oldId, "reverse-") {
+			return fmt.Errorf("the section ID %v is renamed to an unknown section ID: %v", oldId, newId)
+		}
+	}
+
+	for oldId := range self.IdMigrations.Questions {
+		if _, ok := sectionIdsByQuestionId[oldId]; ok {
+			return fmt.Errorf("the renamed question ID is still used: %v", oldId)
+		}
+
+		newId := self.IdMigrations.CurrentQuestionId(oldId)
+		if _, ok := sectionIdsByQuestionId[newId]; !ok && !strings.HasPrefix(oldId, "reverse-") {
+			return fmt.Errorf("the question ID %v is renamed to an unknown question ID: %v", oldId, newId)
+		}
+	}
+
+	return nil
+}
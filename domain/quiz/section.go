@@ -7,6 +7,11 @@ type Section struct {
 
 	DefaultChoices []*Text
 
+	Tags []string
+
+	// The ID of the section that this section was generated from, if any.
+	ReverseOf string
+
 	// TODO: We only need this until we have called setQuestionsChoicesFromAnswers().
 	AnswersAsChoices bool
 }
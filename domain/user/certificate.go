@@ -0,0 +1,84 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Certificate shows that the user answered every question of a quiz, or of one of its sections,
+// correctly at least once. It is signed, so anyone can check that this server issued it.
+type Certificate struct {
+	// A random ID, which the user can share, to let others verify the certificate.
+	Id string
+
+	// The user's ID is not public, and is not signed, but the user's name is.
+	UserId   string
+	UserName string
+
+	QuizId    string
+	QuizTitle string
+
+	// The section, or empty if the certificate is for the whole quiz.
+	SectionId    string
+	SectionTitle string
+
+	// The version of the quiz that the user completed.
+	QuizVersion string
+
+	// How many questions the user answered correctly.
+	CountQuestions int
+
+	Issued time.Time
+
+	// Identifies the key that signed the certificate.
+	KeyId string
+
+	// The signature of SignedData().
+	Signature []byte
+}
+
+// IsForSection returns true if the certificate is for one section, rather than for the whole quiz.
+func (self *Certificate) IsForSection() bool {
+	return len(self.SectionId) != 0
+}
+
+// certificateSignedData is the JSON that is signed.
+// The fields must not change, or existing certificates could no longer be verified.
+type certificateSignedData struct {
+	Id             string `json:"id"`
+	UserName       string `json:"userName"`
+	QuizId         string `json:"quizId"`
+	QuizTitle      string `json:"quizTitle"`
+	SectionId      string `json:"sectionId,omitempty"`
+	SectionTitle   string `json:"sectionTitle,omitempty"`
+	QuizVersion    string `json:"quizVersion"`
+	CountQuestions int    `json:"countQuestions"`
+	Issued         string `json:"issued"`
+	KeyId          string `json:"keyId"`
+}
+
+// SignedData returns the bytes that the Signature signs: JSON of the public fields,
+// with Issued in RFC 3339 format, in UTC, to the second.
+// Anyone with these bytes, the signature, and the public key can verify the certificate.
+func (self *Certificate) SignedData() ([]byte, error) {
+	data := certificateSignedData{
+		Id:             self.Id,
+		UserName:       self.UserName,
+		QuizId:         self.QuizId,
+		QuizTitle:      self.QuizTitle,
+		SectionId:      self.SectionId,
+		SectionTitle:   self.SectionTitle,
+		QuizVersion:    self.QuizVersion,
+		CountQuestions: self.CountQuestions,
+		Issued:         self.Issued.UTC().Format(time.RFC3339),
+		KeyId:          self.KeyId,
+	}
+
+	result, err := json.Marshal(&data)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal() failed: %v", err)
+	}
+
+	return result, nil
+}
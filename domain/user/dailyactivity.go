@@ -0,0 +1,29 @@
+package user
+
+// The format of DailyActivity.Date.
+const DailyActivityDateLayout = "2006-01-02"
+
+// DailyActivity is the aggregate of the user's answers, in all quizzes, on one day.
+type DailyActivity struct {
+	// The day, in the user's time zone, in DailyActivityDateLayout format.
+	Date string
+
+	Answered int
+	Correct  int
+
+	// The number of questions answered correctly for the first time.
+	Learned int
+}
+
+// Add adds the counts from one answer.
+func (self *DailyActivity) Add(answerIsCorrect bool, learned bool) {
+	self.Answered += 1
+
+	if answerIsCorrect {
+		self.Correct += 1
+	}
+
+	if learned {
+		self.Learned += 1
+	}
+}
@@ -0,0 +1,36 @@
+package user
+
+// Possible values of DailyGoal.Type.
+const (
+	// The goal is a number of answers, whether correct or not.
+	DailyGoalTypeAnswered = "answered"
+
+	// The goal is a number of questions answered correctly for the first time.
+	DailyGoalTypeLearned = "learned"
+)
+
+// DailyGoal is the amount of practice that the user would like to do each day.
+// A zero Target means that any practice at all meets the goal.
+type DailyGoal struct {
+	Type   string
+	Target int
+}
+
+func IsValidDailyGoalType(goalType string) bool {
+	return goalType == DailyGoalTypeAnswered || goalType == DailyGoalTypeLearned
+}
+
+// IsMet returns true if the activity meets the goal.
+// activity may be nil.
+func (self *DailyGoal) IsMet(activity *DailyActivity) bool {
+	if activity == nil || activity.Answered == 0 {
+		return false
+	}
+
+	switch self.Type {
+	case DailyGoalTypeLearned:
+		return activity.Learned >= self.Target
+	default:
+		return activity.Answered >= self.Target
+	}
+}
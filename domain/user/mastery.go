@@ -0,0 +1,113 @@
+package user
+
+// The mastery estimate uses Bayesian Knowledge Tracing (BKT):
+// https://en.wikipedia.org/wiki/Bayesian_knowledge_tracing
+// The Mastery is the estimated probability that the user knows the answer.
+const (
+	// The probability that the user knows the answer before ever answering the question.
+	masteryPriorKnown = 0.1
+
+	// The probability that the user learns the answer after each attempt,
+	// for instance by seeing the correct answer after a wrong answer.
+	masteryLearn = 0.15
+
+	// The probability that the user answers wrongly even though they know the answer.
+	masterySlip = 0.1
+
+	// The probability that the user answers correctly even though they don't know the answer,
+	// for instance by choosing from the multiple choices.
+	masteryGuess = 0.2
+
+	// The highest Mastery, so a wrong answer can always take a question out of the mastered level,
+	// instead of the estimate getting stuck close to 1 after many correct answers.
+	masteryMax = 0.99
+
+	// The Mastery at which we consider a question to be mastered.
+	MasteryThreshold = 0.95
+)
+
+// Possible results of QuestionHistory.GetMasteryLevel().
+const (
+	MasteryLevelNew      = "new"
+	MasteryLevelLearning = "learning"
+	MasteryLevelMastered = "mastered"
+)
+
+// updateMastery returns the new estimate, after one more answer.
+func updateMastery(mastery float64, answerIsCorrect bool) float64 {
+	// The probability that the user knew the answer, given the answer they gave:
+	var known float64
+	if answerIsCorrect {
+		known = mastery * (1 - masterySlip) /
+			(mastery*(1-masterySlip) + (1-mastery)*masteryGuess)
+	} else {
+		known = mastery * masterySlip /
+			(mastery*masterySlip + (1-mastery)*(1-masteryGuess))
+	}
+
+	// The user might have learned the answer from this attempt:
+	return min(known+(1-known)*masteryLearn, masteryMax)
+}
+
+// GetMastery returns the estimated probability that the user knows the answer.
+//
+// QuestionHistories stored before we estimated mastery have no Mastery,
+// so we then estimate it from the other counts.
+func (self *QuestionHistory) GetMastery() float64 {
+	if self.Mastery > 0 {
+		return self.Mastery
+	}
+
+	result := masteryPriorKnown
+
+	if self.AnsweredCorrectlyOnce {
+		result = updateMastery(result, true)
+	}
+
+	// CountAnsweredWrong is the number of wrong answers minus the number of correct answers.
+	for i := 0; i < self.CountAnsweredWrong; i++ {
+		result = updateMastery(result, false)
+	}
+
+	for i := 0; i < -self.CountAnsweredWrong; i++ {
+		result = updateMastery(result, true)
+	}
+
+	return result
+}
+
+func (self *QuestionHistory) IsMastered() bool {
+	return self.GetMastery() >= MasteryThreshold
+}
+
+// GetMasteryLevel returns MasteryLevelNew, MasteryLevelLearning, or MasteryLevelMastered.
+// qh may be nil, meaning that the question has never been answered.
+func GetMasteryLevel(qh *QuestionHistory) string {
+	if qh == nil {
+		return MasteryLevelNew
+	}
+
+	if qh.IsMastered() {
+		return MasteryLevelMastered
+	}
+
+	return MasteryLevelLearning
+}
+
+// UpdateMasteryCounts recalculates the mastery aggregates from the QuestionHistories.
+// Stats that were stored before we had these aggregates do not have them,
+// so the repository also calls this when reading stats.
+func (self *Stats) UpdateMasteryCounts() {
+	self.CountQuestionsMastered = 0
+	self.MasterySum = 0
+
+	for i := range self.QuestionHistories {
+		qh := &self.QuestionHistories[i]
+
+		self.MasterySum += qh.GetMastery()
+
+		if qh.IsMastered() {
+			self.CountQuestionsMastered++
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGetQuestionHistory(t *testing.T, stats *Stats) *QuestionHistory {
+	qh, ok := stats.getQuestionHistoryForQuestionId(TEST_QUESTION_ID)
+	assert.True(t, ok)
+	return qh
+}
+
+func TestMasteryIncreasesWithCorrectAnswers(t *testing.T) {
+	var stats Stats
+
+	assert.Equal(t, MasteryLevelNew, stats.GetQuestionMasteryLevel(TEST_QUESTION_ID))
+
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	qh := testGetQuestionHistory(t, &stats)
+	assert.NotNil(t, qh)
+	first := qh.GetMastery()
+	assert.Greater(t, first, masteryPriorKnown)
+	assert.Equal(t, MasteryLevelLearning, GetMasteryLevel(qh))
+
+	for i := 0; i < 5; i++ {
+		stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	}
+
+	qh = testGetQuestionHistory(t, &stats)
+	assert.Greater(t, qh.GetMastery(), first)
+	assert.Equal(t, MasteryLevelMastered, GetMasteryLevel(qh))
+	assert.Equal(t, 1, stats.CountQuestionsMastered)
+	assert.InDelta(t, qh.GetMastery(), stats.MasterySum, 0.0001)
+}
+
+func TestMasteryDecreasesWithWrongAnswer(t *testing.T) {
+	var stats Stats
+
+	for i := 0; i < 6; i++ {
+		stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	}
+
+	assert.Equal(t, 1, stats.CountQuestionsMastered)
+	before := testGetQuestionHistory(t, &stats).GetMastery()
+
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, false)
+
+	qh := testGetQuestionHistory(t, &stats)
+	assert.Less(t, qh.GetMastery(), before)
+	assert.Equal(t, MasteryLevelLearning, GetMasteryLevel(qh))
+	assert.Equal(t, 0, stats.CountQuestionsMastered)
+}
+
+func TestMasteryEstimatedForLegacyHistory(t *testing.T) {
+	qh := QuestionHistory{
+		QuestionId:            TEST_QUESTION_ID,
+		AnsweredCorrectlyOnce: true,
+		CountAnsweredWrong:    -5,
+	}
+
+	// This should be the same as if the Mastery had been updated for each answer.
+	var stats Stats
+	for i := 0; i < 6; i++ {
+		stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	}
+
+	expected := testGetQuestionHistory(t, &stats).GetMastery()
+	assert.InDelta(t, expected, qh.GetMastery(), 0.0001)
+}
@@ -13,4 +13,9 @@ type Profile struct {
 
 	FacebookLinked     bool
 	FacebookProfileUrl string
+
+	// An IANA time zone name, such as "Europe/Berlin", used to decide when each day starts.
+	TimeZone string
+
+	DailyGoal DailyGoal
 }
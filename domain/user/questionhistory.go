@@ -8,4 +8,92 @@ type QuestionHistory struct {
 	//Decrements once for each time the user answers it correctly.
 	//Increments once for each time the user answers it wrongly.
 	CountAnsweredWrong int
+
+	// The estimated probability that the user knows the answer.
+	// This is 0 if it has not been estimated yet. See GetMastery().
+	Mastery float64
+
+	// The number of answers, and correct answers, to this question.
+	// These are 0 for histories stored before we counted them. See GetCountAnswered().
+	CountAnswered int
+	CountCorrect  int
+
+	// The quiz's version, and the hash of the question's text and answer, when the question was last answered.
+	// These are empty for histories stored before we recorded them. See ContentChanged().
+	QuizVersion string
+	ContentHash string
+}
+
+// SetContentVersion records the quiz's version, and the question's hash, for the latest answer.
+// contentHash may be empty if it is not known, such as for an answer to an older version of the quiz.
+func (self *QuestionHistory) SetContentVersion(quizVersion string, contentHash string) {
+	self.QuizVersion = quizVersion
+	self.ContentHash = contentHash
+}
+
+// ContentChanged returns true if the question's text or answer has changed since it was last answered,
+// so the user should be asked it again.
+// If we don't have the question's hash from then, we assume that it changed if the quiz's version changed.
+func (self *QuestionHistory) ContentChanged(quizVersion string, contentHash string) bool {
+	if len(self.ContentHash) != 0 {
+		return len(contentHash) != 0 && self.ContentHash != contentHash
+	}
+
+	// Histories stored before we recorded the versions have no version.
+	return len(self.QuizVersion) != 0 && self.QuizVersion != quizVersion
+}
+
+// GetCountAnswered returns the number of times that the question was answered.
+//
+// QuestionHistories stored before we counted answers have no CountAnswered,
+// so we then estimate the smallest count that matches the other fields.
+func (self *QuestionHistory) GetCountAnswered() int {
+	if self.CountAnswered > 0 {
+		return self.CountAnswered
+	}
+
+	if self.CountAnsweredWrong < 0 {
+		// At least this many correct answers, and maybe no wrong answers.
+		return -self.CountAnsweredWrong
+	}
+
+	// This many more wrong answers than correct answers.
+	return self.CountAnsweredWrong + 2*self.GetCountCorrect()
+}
+
+// GetCountCorrect returns the number of times that the question was answered correctly.
+// See GetCountAnswered().
+func (self *QuestionHistory) GetCountCorrect() int {
+	if self.CountAnswered > 0 {
+		return self.CountCorrect
+	}
+
+	if self.CountAnsweredWrong < 0 {
+		return -self.CountAnsweredWrong
+	}
+
+	if self.AnsweredCorrectlyOnce {
+		return 1
+	}
+
+	return 0
+}
+
+// Merge adds the other QuestionHistory's answers to this one, for the same question.
+// The Mastery is the higher of the two estimates, because we cannot know the order of the answers.
+func (self *QuestionHistory) Merge(other *QuestionHistory) {
+	countAnswered := self.GetCountAnswered() + other.GetCountAnswered()
+	countCorrect := self.GetCountCorrect() + other.GetCountCorrect()
+	mastery := max(self.GetMastery(), other.GetMastery())
+
+	self.AnsweredCorrectlyOnce = self.AnsweredCorrectlyOnce || other.AnsweredCorrectlyOnce
+	self.CountAnsweredWrong += other.CountAnsweredWrong
+	self.CountAnswered = countAnswered
+	self.CountCorrect = countCorrect
+	self.Mastery = mastery
+
+	// We cannot know which was answered last, so prefer a known version.
+	if len(self.QuizVersion) == 0 {
+		self.SetContentVersion(other.QuizVersion, other.ContentHash)
+	}
 }
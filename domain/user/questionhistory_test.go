@@ -0,0 +1,39 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuestionHistoryContentChanged(t *testing.T) {
+	// Stored before we recorded the versions.
+	var qh QuestionHistory
+	assert.False(t, qh.ContentChanged("2", "some-hash"))
+
+	qh.SetContentVersion("1", "some-hash")
+	assert.False(t, qh.ContentChanged("1", "some-hash"))
+
+	// Only the question's hash matters, if we know it, so changes to other questions don't matter.
+	assert.False(t, qh.ContentChanged("2", "some-hash"))
+	assert.True(t, qh.ContentChanged("2", "some-other-hash"))
+
+	// Answered in an older version, without the question's hash, such as while offline.
+	qh.SetContentVersion("1", "")
+	assert.False(t, qh.ContentChanged("1", "some-hash"))
+	assert.True(t, qh.ContentChanged("2", "some-hash"))
+}
+
+func TestQuestionHistoryMergeKeepsContentVersion(t *testing.T) {
+	var qh QuestionHistory
+	qh.AdjustCount(true)
+
+	other := QuestionHistory{QuestionId: qh.QuestionId}
+	other.AdjustCount(false)
+	other.SetContentVersion("1", "some-hash")
+
+	qh.Merge(&other)
+	assert.Equal(t, "1", qh.QuizVersion)
+	assert.Equal(t, "some-hash", qh.ContentHash)
+	assert.Equal(t, 2, qh.GetCountAnswered())
+}
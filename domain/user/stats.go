@@ -11,6 +11,13 @@ type Stats struct {
 	CountQuestionsAnsweredOnce int
 	CountQuestionsCorrectOnce  int
 
+	// The number of questions whose Mastery is at least MasteryThreshold.
+	CountQuestionsMastered int
+
+	// The sum of the Mastery of all answered questions.
+	// Divide this by the number of questions to get the average Mastery.
+	MasterySum float64
+
 	QuestionHistories []QuestionHistory
 }
 
@@ -23,6 +30,38 @@ func (self *Stats) GetQuestionCountAnsweredWrong(questionId string) int {
 	return qh.CountAnsweredWrong
 }
 
+// GetQuestionMasteryLevel returns MasteryLevelNew, MasteryLevelLearning, or MasteryLevelMastered.
+func (self *Stats) GetQuestionMasteryLevel(questionId string) string {
+	qh, ok := self.getQuestionHistoryForQuestionId(questionId)
+	if !ok {
+		return MasteryLevelNew
+	}
+
+	return GetMasteryLevel(qh)
+}
+
+// GetQuestionContentChanged returns true if the question has changed since the user last answered it.
+// See QuestionHistory.ContentChanged().
+func (self *Stats) GetQuestionContentChanged(questionId string, quizVersion string, contentHash string) bool {
+	qh, ok := self.getQuestionHistoryForQuestionId(questionId)
+	if !ok {
+		return false
+	}
+
+	return qh.ContentChanged(quizVersion, contentHash)
+}
+
+// SetQuestionContentVersion records the version of the question that the user last answered.
+// This should be called after UpdateStatsForAnswerCorrectness(). See QuestionHistory.SetContentVersion().
+func (self *Stats) SetQuestionContentVersion(questionId string, quizVersion string, contentHash string) {
+	qh, ok := self.getQuestionHistoryForQuestionId(questionId)
+	if !ok {
+		return
+	}
+
+	qh.SetContentVersion(quizVersion, contentHash)
+}
+
 func (self *Stats) GetQuestionWasAnswered(questionId string) bool {
 	_, found := self.getQuestionHistoryForQuestionId(questionId)
 	return found
@@ -99,10 +138,22 @@ func (self *Stats) UpdateStatsForAnswerCorrectness(questionId string, answerIsCo
 	if !exists {
 		self.QuestionHistories = append(self.QuestionHistories, *questionHistory)
 	}
+
+	self.UpdateMasteryCounts()
 	//TODO? cacheIsInvalid = true;
 }
 
 func (self *QuestionHistory) AdjustCount(result bool) {
+	self.Mastery = updateMastery(self.GetMastery(), result)
+
+	// Start from the estimate if this history was stored before we counted answers.
+	countCorrect := self.GetCountCorrect()
+	self.CountAnswered = self.GetCountAnswered() + 1
+	self.CountCorrect = countCorrect
+	if result {
+		self.CountCorrect += 1
+	}
+
 	if result {
 		self.AnsweredCorrectlyOnce = true
 	}
@@ -113,3 +164,144 @@ func (self *QuestionHistory) AdjustCount(result bool) {
 		self.CountAnsweredWrong += 1
 	}
 }
+
+// ForgetQuestions removes the QuestionHistories for the questions,
+// and removes their answers from the other counts, as if the questions had never been answered.
+// This returns the number of QuestionHistories that were removed.
+func (self *Stats) ForgetQuestions(questionIds []string) int {
+	forget := make(map[string]bool, len(questionIds))
+	for _, questionId := range questionIds {
+		forget[questionId] = true
+	}
+
+	kept := make([]QuestionHistory, 0, len(self.QuestionHistories))
+	for _, qh := range self.QuestionHistories {
+		if !forget[qh.QuestionId] {
+			kept = append(kept, qh)
+			continue
+		}
+
+		self.Answered -= qh.GetCountAnswered()
+		self.Correct -= qh.GetCountCorrect()
+
+		self.CountQuestionsAnsweredOnce--
+		if qh.AnsweredCorrectlyOnce {
+			self.CountQuestionsCorrectOnce--
+		}
+	}
+
+	result := len(self.QuestionHistories) - len(kept)
+	self.QuestionHistories = kept
+
+	// Older stats might have counts that don't quite match their QuestionHistories,
+	// because answers were not counted per question, so avoid nonsense values.
+	if len(self.QuestionHistories) == 0 {
+		self.Answered = 0
+		self.Correct = 0
+		self.CountQuestionsAnsweredOnce = 0
+		self.CountQuestionsCorrectOnce = 0
+	}
+
+	self.Answered = max(self.Answered, 0)
+	self.Correct = min(max(self.Correct, 0), self.Answered)
+	self.CountQuestionsAnsweredOnce = max(self.CountQuestionsAnsweredOnce, 0)
+	self.CountQuestionsCorrectOnce = min(max(self.CountQuestionsCorrectOnce, 0), self.CountQuestionsAnsweredOnce)
+
+	self.UpdateMasteryCounts()
+
+	return result
+}
+
+// RecountQuestions sets CountQuestionsAnsweredOnce and CountQuestionsCorrectOnce,
+// and the mastery counts, from the QuestionHistories, in case they have become wrong.
+// This returns whether any of the counts changed.
+func (self *Stats) RecountQuestions() bool {
+	countCorrectOnce := 0
+	for _, qh := range self.QuestionHistories {
+		if qh.AnsweredCorrectlyOnce {
+			countCorrectOnce++
+		}
+	}
+
+	before := *self
+	self.CountQuestionsAnsweredOnce = len(self.QuestionHistories)
+	self.CountQuestionsCorrectOnce = countCorrectOnce
+	self.UpdateMasteryCounts()
+
+	return self.CountQuestionsAnsweredOnce != before.CountQuestionsAnsweredOnce ||
+		self.CountQuestionsCorrectOnce != before.CountQuestionsCorrectOnce ||
+		self.CountQuestionsMastered != before.CountQuestionsMastered ||
+		self.MasterySum != before.MasterySum
+}
+
+// TakeQuestions removes the QuestionHistories for the questions, with their answers, like ForgetQuestions(),
+// but returns them as new Stats for the same quiz and section, so they can be merged into other Stats.
+func (self *Stats) TakeQuestions(questionIds []string) *Stats {
+	take := make(map[string]bool, len(questionIds))
+	for _, questionId := range questionIds {
+		take[questionId] = true
+	}
+
+	result := &Stats{
+		QuizId:    self.QuizId,
+		SectionId: self.SectionId,
+	}
+
+	for _, qh := range self.QuestionHistories {
+		if take[qh.QuestionId] {
+			result.QuestionHistories = append(result.QuestionHistories, qh)
+			result.Answered += qh.GetCountAnswered()
+			result.Correct += qh.GetCountCorrect()
+		}
+	}
+
+	self.ForgetQuestions(questionIds)
+	result.RecountQuestions()
+
+	return result
+}
+
+// Merge adds the other Stats' answers and QuestionHistories to these Stats,
+// combining the QuestionHistories for the same question.
+// This keeps the QuizId and SectionId.
+func (self *Stats) Merge(other *Stats) {
+	self.Answered += other.Answered
+	self.Correct += other.Correct
+
+	for _, otherQh := range other.QuestionHistories {
+		if qh, ok := self.getQuestionHistoryForQuestionId(otherQh.QuestionId); ok {
+			qh.Merge(&otherQh)
+		} else {
+			self.QuestionHistories = append(self.QuestionHistories, otherQh)
+		}
+	}
+
+	self.RecountQuestions()
+}
+
+// RenameQuestions changes the QuestionIds of the QuestionHistories to the IDs returned by currentId(),
+// combining them if there is already a QuestionHistory with the new ID.
+// This returns the number of QuestionHistories that were renamed.
+func (self *Stats) RenameQuestions(currentId func(questionId string) string) int {
+	result := 0
+	histories := self.QuestionHistories
+	self.QuestionHistories = make([]QuestionHistory, 0, len(histories))
+	for _, qh := range histories {
+		if newId := currentId(qh.QuestionId); newId != qh.QuestionId {
+			qh.QuestionId = newId
+			result++
+		}
+
+		if existing, ok := self.getQuestionHistoryForQuestionId(qh.QuestionId); ok {
+			existing.Merge(&qh)
+		} else {
+			self.QuestionHistories = append(self.QuestionHistories, qh)
+		}
+	}
+
+	if result != 0 {
+		self.RecountQuestions()
+	}
+
+	return result
+}
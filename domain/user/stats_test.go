@@ -118,3 +118,183 @@ func TestStatsIncrementAnsweredCorrectOnce(t *testing.T) {
 	stats.UpdateStatsForAnswerCorrectness("some-question-4", true)
 	assert.Equal(t, 3, stats.CountQuestionsCorrectOnce)
 }
+
+func TestStatsCountAnsweredAndCorrectPerQuestion(t *testing.T) {
+	var stats Stats
+
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, false)
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+
+	qh, ok := stats.getQuestionHistoryForQuestionId(TEST_QUESTION_ID)
+	assert.True(t, ok)
+	assert.Equal(t, 3, qh.GetCountAnswered())
+	assert.Equal(t, 2, qh.GetCountCorrect())
+}
+
+func TestQuestionHistoryCountsEstimatedForLegacyHistory(t *testing.T) {
+	qh := QuestionHistory{
+		AnsweredCorrectlyOnce: true,
+		CountAnsweredWrong:    2,
+	}
+
+	// At least one correct answer, and 3 wrong answers:
+	assert.Equal(t, 4, qh.GetCountAnswered())
+	assert.Equal(t, 1, qh.GetCountCorrect())
+
+	qh = QuestionHistory{
+		AnsweredCorrectlyOnce: true,
+		CountAnsweredWrong:    -2,
+	}
+
+	assert.Equal(t, 2, qh.GetCountAnswered())
+	assert.Equal(t, 2, qh.GetCountCorrect())
+}
+
+func TestStatsForgetQuestions(t *testing.T) {
+	const otherQuestionId = "other-question-id"
+
+	var stats Stats
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, false)
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	stats.UpdateStatsForAnswerCorrectness(otherQuestionId, true)
+	stats.UpdateStatsForAnswerCorrectness(otherQuestionId, true)
+
+	// What the stats should look like after forgetting TEST_QUESTION_ID:
+	var expected Stats
+	expected.UpdateStatsForAnswerCorrectness(otherQuestionId, true)
+	expected.UpdateStatsForAnswerCorrectness(otherQuestionId, true)
+
+	count := stats.ForgetQuestions([]string{TEST_QUESTION_ID, "some-unanswered-question-id"})
+	assert.Equal(t, 1, count)
+
+	assert.Equal(t, expected, stats)
+	assert.False(t, stats.GetQuestionWasAnswered(TEST_QUESTION_ID))
+}
+
+func TestStatsForgetAllQuestions(t *testing.T) {
+	// Counts that don't match the histories, as could happen with older stats:
+	stats := Stats{
+		Answered:                   10,
+		Correct:                    5,
+		CountQuestionsAnsweredOnce: 3,
+		CountQuestionsCorrectOnce:  2,
+		QuestionHistories: []QuestionHistory{
+			{QuestionId: TEST_QUESTION_ID, AnsweredCorrectlyOnce: true, CountAnsweredWrong: -1},
+		},
+	}
+
+	count := stats.ForgetQuestions([]string{TEST_QUESTION_ID})
+	assert.Equal(t, 1, count)
+
+	assert.Equal(t, 0, stats.Answered)
+	assert.Equal(t, 0, stats.Correct)
+	assert.Equal(t, 0, stats.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 0, stats.CountQuestionsCorrectOnce)
+	assert.Empty(t, stats.QuestionHistories)
+}
+
+func TestStatsRecountQuestions(t *testing.T) {
+	var stats Stats
+	stats.UpdateStatsForAnswerCorrectness("a", true)
+	stats.UpdateStatsForAnswerCorrectness("b", false)
+	stats.UpdateStatsForAnswerCorrectness("c", false)
+	stats.UpdateStatsForAnswerCorrectness("c", true)
+
+	// The counts already match the histories.
+	assert.False(t, stats.RecountQuestions())
+	assert.Equal(t, 3, stats.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 2, stats.CountQuestionsCorrectOnce)
+
+	// Corrupted counters.
+	stats.CountQuestionsAnsweredOnce = 7
+	stats.CountQuestionsCorrectOnce = -1
+	assert.True(t, stats.RecountQuestions())
+	assert.Equal(t, 3, stats.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 2, stats.CountQuestionsCorrectOnce)
+
+	// The answers themselves cannot be recounted from the histories.
+	assert.Equal(t, 4, stats.Answered)
+}
+
+func TestStatsTakeQuestions(t *testing.T) {
+	const otherQuestionId = "other-question-id"
+
+	var stats Stats
+	stats.QuizId = "some-quiz"
+	stats.SectionId = "some-section"
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, false)
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	stats.UpdateStatsForAnswerCorrectness(otherQuestionId, true)
+
+	taken := stats.TakeQuestions([]string{TEST_QUESTION_ID})
+	assert.Equal(t, "some-quiz", taken.QuizId)
+	assert.Equal(t, "some-section", taken.SectionId)
+	assert.Equal(t, 2, taken.Answered)
+	assert.Equal(t, 1, taken.Correct)
+	assert.Equal(t, 1, taken.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 1, taken.CountQuestionsCorrectOnce)
+	assert.True(t, taken.GetQuestionWasAnswered(TEST_QUESTION_ID))
+	assert.False(t, taken.GetQuestionWasAnswered(otherQuestionId))
+
+	assert.Equal(t, 1, stats.Answered)
+	assert.Equal(t, 1, stats.Correct)
+	assert.False(t, stats.GetQuestionWasAnswered(TEST_QUESTION_ID))
+	assert.True(t, stats.GetQuestionWasAnswered(otherQuestionId))
+}
+
+func TestStatsMerge(t *testing.T) {
+	const otherQuestionId = "other-question-id"
+
+	var stats Stats
+	stats.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, false)
+
+	var other Stats
+	other.UpdateStatsForAnswerCorrectness(TEST_QUESTION_ID, true)
+	other.UpdateStatsForAnswerCorrectness(otherQuestionId, false)
+
+	stats.Merge(&other)
+	assert.Equal(t, 3, stats.Answered)
+	assert.Equal(t, 1, stats.Correct)
+	assert.Equal(t, 2, stats.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 1, stats.CountQuestionsCorrectOnce)
+
+	// The histories for the same question are combined.
+	assert.Len(t, stats.QuestionHistories, 2)
+	qh, ok := stats.getQuestionHistoryForQuestionId(TEST_QUESTION_ID)
+	assert.True(t, ok)
+	assert.Equal(t, 2, qh.GetCountAnswered())
+	assert.Equal(t, 1, qh.GetCountCorrect())
+	assert.Equal(t, 0, qh.CountAnsweredWrong)
+	assert.True(t, qh.AnsweredCorrectlyOnce)
+	assert.Equal(t, other.QuestionHistories[0].Mastery, qh.Mastery)
+}
+
+func TestStatsRenameQuestions(t *testing.T) {
+	var stats Stats
+	stats.UpdateStatsForAnswerCorrectness("old-a", true)
+	stats.UpdateStatsForAnswerCorrectness("old-b", false)
+	stats.UpdateStatsForAnswerCorrectness("b", true)
+	stats.UpdateStatsForAnswerCorrectness("c", false)
+
+	newIds := map[string]string{"old-a": "a", "old-b": "b"}
+	count := stats.RenameQuestions(func(questionId string) string {
+		if newId, ok := newIds[questionId]; ok {
+			return newId
+		}
+
+		return questionId
+	})
+	assert.Equal(t, 2, count)
+
+	assert.Equal(t, 4, stats.Answered)
+	assert.Equal(t, 3, stats.CountQuestionsAnsweredOnce)
+	assert.Equal(t, 2, stats.CountQuestionsCorrectOnce)
+	assert.False(t, stats.GetQuestionWasAnswered("old-a"))
+	assert.False(t, stats.GetQuestionWasAnswered("old-b"))
+	assert.Equal(t, 0, stats.GetQuestionCountAnsweredWrong("b"))
+	assert.Equal(t, 1, stats.GetQuestionCountAnsweredWrong("c"))
+
+	// Nothing else to rename.
+	assert.Equal(t, 0, stats.RenameQuestions(func(questionId string) string { return questionId }))
+}
@@ -0,0 +1,18 @@
+package user
+
+import "time"
+
+// StatsUndo is the user's stats for some sections of a quiz, from before they were reset,
+// so the reset can be undone until Expires.
+type StatsUndo struct {
+	QuizId string
+
+	// The stats, for each section, as they were before the reset.
+	Stats []*Stats
+
+	Expires time.Time
+}
+
+func (self *StatsUndo) IsExpired(now time.Time) bool {
+	return !now.Before(self.Expires)
+}
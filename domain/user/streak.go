@@ -0,0 +1,180 @@
+package user
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Streak describes the consecutive days on which the user met their daily goal.
+type Streak struct {
+	// The number of consecutive days, up to today, on which the goal was met.
+	// This doesn't count today until the goal has been met today,
+	// so the streak isn't broken until today is over.
+	Current int
+
+	Longest int
+
+	TodayGoalMet bool
+}
+
+// CalculateStreak calculates the current and longest streaks.
+// activities may be in any order.
+// today is the current day, in the user's time zone, in DailyActivityDateLayout format.
+func CalculateStreak(activities []*DailyActivity, goal DailyGoal, today string) (*Streak, error) {
+	todayTime, err := time.Parse(DailyActivityDateLayout, today)
+	if err != nil {
+		return nil, fmt.Errorf("time.Parse() failed for today: %v", err)
+	}
+
+	// Get the days on which the goal was met, in order:
+	var days []time.Time
+	for _, activity := range activities {
+		if !goal.IsMet(activity) {
+			continue
+		}
+
+		day, err := time.Parse(DailyActivityDateLayout, activity.Date)
+		if err != nil {
+			return nil, fmt.Errorf("time.Parse() failed for activity date: %v", err)
+		}
+
+		if day.After(todayTime) {
+			// This could happen if the user changed their time zone.
+			continue
+		}
+
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	var result Streak
+
+	length := 0
+	var previous time.Time
+	for _, day := range days {
+		if length != 0 && day.Equal(previous) {
+			continue
+		}
+
+		if length != 0 && day.Equal(nextDay(previous)) {
+			length += 1
+		} else {
+			length = 1
+		}
+
+		if length > result.Longest {
+			result.Longest = length
+		}
+
+		previous = day
+	}
+
+	if length != 0 {
+		result.TodayGoalMet = previous.Equal(todayTime)
+
+		if result.TodayGoalMet || nextDay(previous).Equal(todayTime) {
+			result.Current = length
+		}
+	}
+
+	return &result, nil
+}
+
+// BrokenStreakLength returns the length of the user's last streak,
+// if it has been broken and the user is answering today for the first time since then,
+// so the break is reported once, when the user returns. Otherwise it returns 0.
+// activities are from before today's first answer, in any order.
+// today is the current day, in the user's time zone, in DailyActivityDateLayout format.
+func BrokenStreakLength(activities []*DailyActivity, goal DailyGoal, today string) (int, error) {
+	todayTime, err := time.Parse(DailyActivityDateLayout, today)
+	if err != nil {
+		return 0, fmt.Errorf("time.Parse() failed for today: %v", err)
+	}
+
+	// The dates all have the same format, so we can compare them as strings.
+	var lastMet string
+	for _, activity := range activities {
+		if activity.Date >= today {
+			// The user has already answered today,
+			// or has changed their time zone.
+			return 0, nil
+		}
+
+		if goal.IsMet(activity) && activity.Date > lastMet {
+			lastMet = activity.Date
+		}
+	}
+
+	if len(lastMet) == 0 {
+		return 0, nil
+	}
+
+	lastMetTime, err := time.Parse(DailyActivityDateLayout, lastMet)
+	if err != nil {
+		return 0, fmt.Errorf("time.Parse() failed for activity date: %v", err)
+	}
+
+	// The streak was broken at the end of the day after lastMet.
+	brokenTime := nextDay(lastMetTime)
+	if !brokenTime.Before(todayTime) {
+		return 0, nil
+	}
+
+	broken := brokenTime.Format(DailyActivityDateLayout)
+	for _, activity := range activities {
+		if activity.Date > broken {
+			// The user has already answered since the streak was broken.
+			return 0, nil
+		}
+	}
+
+	streak, err := CalculateStreak(activities, goal, lastMet)
+	if err != nil {
+		return 0, fmt.Errorf("CalculateStreak() failed: %v", err)
+	}
+
+	return streak.Current, nil
+}
+
+// nextDay returns the following day.
+// The times are always UTC midnights, from time.Parse(), so this is not affected by daylight-saving changes.
+func nextDay(day time.Time) time.Time {
+	return day.AddDate(0, 0, 1)
+}
+
+// Today returns the current day in the time zone, in DailyActivityDateLayout format.
+// timeZone is an IANA time zone name, such as "Europe/Berlin". UTC is used if it is empty or invalid.
+func Today(now time.Time, timeZone string) string {
+	return now.In(LoadTimeZone(timeZone)).Format(DailyActivityDateLayout)
+}
+
+// The name that time.LoadLocation() accepts for the server's own time zone, which is not the user's.
+const localTimeZoneName = "Local"
+
+// IsValidTimeZone returns whether the time zone is empty, for UTC, or an IANA time zone name.
+func IsValidTimeZone(timeZone string) bool {
+	if timeZone == localTimeZoneName {
+		return false
+	}
+
+	_, err := time.LoadLocation(timeZone)
+	return err == nil
+}
+
+// LoadTimeZone returns the location for the IANA time zone name, or UTC if it is empty or invalid.
+func LoadTimeZone(timeZone string) *time.Location {
+	if len(timeZone) == 0 || timeZone == localTimeZoneName {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
@@ -0,0 +1,179 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testActivities(dates ...string) []*DailyActivity {
+	var result []*DailyActivity
+	for _, date := range dates {
+		result = append(result, &DailyActivity{
+			Date:     date,
+			Answered: 5,
+			Correct:  3,
+			Learned:  1,
+		})
+	}
+
+	return result
+}
+
+func TestCalculateStreakWithNoActivity(t *testing.T) {
+	streak, err := CalculateStreak(nil, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+	assert.NotNil(t, streak)
+
+	assert.Equal(t, 0, streak.Current)
+	assert.Equal(t, 0, streak.Longest)
+	assert.False(t, streak.TodayGoalMet)
+}
+
+func TestCalculateStreakIncludingToday(t *testing.T) {
+	// In reverse order, to check that the order doesn't matter.
+	activities := testActivities("2024-03-10", "2024-03-09", "2024-03-08", "2024-03-01", "2024-03-02")
+
+	streak, err := CalculateStreak(activities, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, streak.Current)
+	assert.Equal(t, 3, streak.Longest)
+	assert.True(t, streak.TodayGoalMet)
+}
+
+func TestCalculateStreakNotYetBrokenToday(t *testing.T) {
+	activities := testActivities("2024-03-08", "2024-03-09")
+
+	streak, err := CalculateStreak(activities, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, streak.Current)
+	assert.Equal(t, 2, streak.Longest)
+	assert.False(t, streak.TodayGoalMet)
+}
+
+func TestCalculateStreakBroken(t *testing.T) {
+	activities := testActivities("2024-02-27", "2024-02-28", "2024-02-29", "2024-03-01", "2024-03-08")
+
+	streak, err := CalculateStreak(activities, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, streak.Current)
+	assert.Equal(t, 4, streak.Longest)
+}
+
+func TestCalculateStreakWithGoalNotMet(t *testing.T) {
+	activities := testActivities("2024-03-08", "2024-03-09", "2024-03-10")
+	activities[1].Learned = 0
+
+	goal := DailyGoal{
+		Type:   DailyGoalTypeLearned,
+		Target: 1,
+	}
+
+	streak, err := CalculateStreak(activities, goal, "2024-03-10")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, streak.Current)
+	assert.Equal(t, 1, streak.Longest)
+	assert.True(t, streak.TodayGoalMet)
+}
+
+func TestCalculateStreakWithInvalidToday(t *testing.T) {
+	_, err := CalculateStreak(nil, DailyGoal{}, "not-a-date")
+	assert.NotNil(t, err)
+}
+
+func TestDailyGoalIsMet(t *testing.T) {
+	activity := &DailyActivity{
+		Answered: 10,
+		Correct:  8,
+		Learned:  2,
+	}
+
+	goalAnswered := DailyGoal{Type: DailyGoalTypeAnswered, Target: 10}
+	assert.True(t, goalAnswered.IsMet(activity))
+
+	goalAnswered.Target = 11
+	assert.False(t, goalAnswered.IsMet(activity))
+
+	goalLearned := DailyGoal{Type: DailyGoalTypeLearned, Target: 2}
+	assert.True(t, goalLearned.IsMet(activity))
+
+	goalLearned.Target = 3
+	assert.False(t, goalLearned.IsMet(activity))
+
+	assert.False(t, goalLearned.IsMet(nil))
+}
+
+func TestToday(t *testing.T) {
+	now := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "2024-03-10", Today(now, ""))
+	assert.Equal(t, "2024-03-10", Today(now, "not-a-time-zone"))
+	assert.Equal(t, "2024-03-11", Today(now, "Europe/Berlin"))
+	assert.Equal(t, "2024-03-10", Today(now, "America/New_York"))
+
+	// Not the server's time zone.
+	assert.Equal(t, "2024-03-10", Today(now, "Local"))
+}
+
+func TestIsValidTimeZone(t *testing.T) {
+	assert.True(t, IsValidTimeZone(""))
+	assert.True(t, IsValidTimeZone("Europe/Berlin"))
+	assert.False(t, IsValidTimeZone("not-a-time-zone"))
+	assert.False(t, IsValidTimeZone("Local"))
+}
+
+func TestBrokenStreakLength(t *testing.T) {
+	activities := testActivities("2024-03-01", "2024-03-02", "2024-03-03")
+
+	// The streak is not broken until the end of the following day.
+	length, err := BrokenStreakLength(activities, DailyGoal{}, "2024-03-04")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+
+	length, err = BrokenStreakLength(activities, DailyGoal{}, "2024-03-05")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, length)
+
+	length, err = BrokenStreakLength(activities, DailyGoal{}, "2024-03-20")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, length)
+
+	// Activity that doesn't meet the goal, on the day after the streak, is before the break.
+	activities = append(activities, &DailyActivity{Date: "2024-03-04", Answered: 2})
+	length, err = BrokenStreakLength(activities, DailyGoal{Target: 5}, "2024-03-05")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, length)
+
+	length, err = BrokenStreakLength(activities, DailyGoal{}, "2024-03-06")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, length)
+}
+
+func TestBrokenStreakLengthReportedOnce(t *testing.T) {
+	// The user has already answered today.
+	activities := testActivities("2024-03-01", "2024-03-02", "2024-03-10")
+	length, err := BrokenStreakLength(activities, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+
+	// The user has already answered since the streak was broken, without meeting their goal.
+	activities = testActivities("2024-03-01", "2024-03-02")
+	activities = append(activities, &DailyActivity{Date: "2024-03-08", Answered: 1})
+	length, err = BrokenStreakLength(activities, DailyGoal{Target: 5}, "2024-03-10")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+}
+
+func TestBrokenStreakLengthWithNoStreak(t *testing.T) {
+	length, err := BrokenStreakLength(nil, DailyGoal{}, "2024-03-10")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+
+	_, err = BrokenStreakLength(nil, DailyGoal{}, "March 10th")
+	assert.NotNil(t, err)
+}
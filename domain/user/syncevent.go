@@ -0,0 +1,51 @@
+package user
+
+import (
+	"strings"
+	"time"
+)
+
+// The maximum length of a client's ID for a SyncEvent.
+const MaxSyncEventIdLength = 100
+
+// How long a SyncEvent is kept, so the client may send the same answer again.
+// Answers that are older than this are rejected, so they cannot be added again after their SyncEvent is deleted.
+const SyncEventRetention = 30 * 24 * time.Hour
+
+// SyncEvent is an answer from the user's offline study,
+// identified by an ID chosen by the client,
+// so the answer is only added to the user's stats once, even if the client sends it again.
+type SyncEvent struct {
+	EventId string
+
+	QuizId     string
+	QuestionId string
+
+	// When the user answered.
+	Time time.Time
+
+	// When the answer was added to the user's stats.
+	Synced time.Time
+
+	// The day, in the user's time zone, in DailyActivityDateLayout format,
+	// on which to add the answer to the user's daily activity, or empty to not add it.
+	// This is not stored.
+	Date string
+
+	// Whether the answer was correct, for the daily activity. This is not stored.
+	Correct bool
+}
+
+// IsValidSyncEventId returns true if the ID can be used as a SyncEvent's EventId.
+func IsValidSyncEventId(eventId string) bool {
+	if len(eventId) == 0 || len(eventId) > MaxSyncEventIdLength {
+		return false
+	}
+
+	// The datastore reserves names like this.
+	if strings.HasPrefix(eventId, "__") && strings.HasSuffix(eventId, "__") {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,18 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidSyncEventId(t *testing.T) {
+	assert.True(t, IsValidSyncEventId("some-event-id"))
+	assert.True(t, IsValidSyncEventId("1b4e28ba-2fa1-11d2-883f-0016d3cca427"))
+	assert.True(t, IsValidSyncEventId(strings.Repeat("a", MaxSyncEventIdLength)))
+
+	assert.False(t, IsValidSyncEventId(""))
+	assert.False(t, IsValidSyncEventId(strings.Repeat("a", MaxSyncEventIdLength+1)))
+	assert.False(t, IsValidSyncEventId("__reserved__"))
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// The events that webhooks may subscribe to.
+const (
+	// The user has mastered all of a section's questions.
+	EVENT_SECTION_MASTERED = "section.mastered"
+
+	// The user has answered all of a quiz's questions correctly at least once.
+	EVENT_QUIZ_COMPLETED = "quiz.completed"
+
+	// The user has answered again after missing a day of their daily goal, ending their streak.
+	EVENT_STREAK_BROKEN = "streak.broken"
+
+	// The user has logged in for the first time.
+	EVENT_USER_CREATED = "user.created"
+)
+
+var Events = []string{EVENT_SECTION_MASTERED, EVENT_QUIZ_COMPLETED, EVENT_STREAK_BROKEN, EVENT_USER_CREATED}
+
+// IsKnownEvent returns whether the event is one of Events.
+func IsKnownEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// The statuses of a Delivery.
+const (
+	DELIVERY_STATUS_PENDING   = "pending"
+	DELIVERY_STATUS_DELIVERED = "delivered"
+	DELIVERY_STATUS_FAILED    = "failed"
+)
+
+// The maximum number of attempts at a delivery, after which it fails.
+// With the backoff, the last attempt is about 8.5 hours after the first.
+const MaxAttempts = 10
+
+const (
+	firstRetryDelay = time.Minute
+	maxRetryDelay   = 6 * time.Hour
+)
+
+// Delivery is one event, sent to one webhook, and retried until the webhook accepts it,
+// or until MaxAttempts.
+type Delivery struct {
+	Id        string
+	WebhookId string
+	Event     string
+
+	// The JSON body, which is the same for each attempt.
+	Payload []byte
+
+	Created time.Time
+
+	// Any of the DELIVERY_STATUS_* constants.
+	Status string
+
+	Attempts int
+
+	// When to try again, if the delivery is still pending.
+	NextAttempt time.Time
+
+	LastAttempt time.Time
+
+	// The webhook's HTTP status code, or 0 if there was no response.
+	LastStatusCode int
+
+	LastError string
+}
+
+// NewDelivery returns a pending delivery, with a random ID, to be attempted immediately.
+func NewDelivery(webhookId string, event string, payload []byte, now time.Time) (*Delivery, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	return &Delivery{
+		Id:          hex.EncodeToString(idBytes),
+		WebhookId:   webhookId,
+		Event:       event,
+		Payload:     payload,
+		Created:     now,
+		Status:      DELIVERY_STATUS_PENDING,
+		NextAttempt: now,
+	}, nil
+}
+
+// IsDue returns whether the delivery should be attempted now.
+func (self *Delivery) IsDue(now time.Time) bool {
+	return self.Status == DELIVERY_STATUS_PENDING && !self.NextAttempt.After(now)
+}
+
+// RetryDelay returns how long to wait after the attempt before trying again,
+// doubling after each attempt, up to maxRetryDelay.
+func RetryDelay(attempts int) time.Duration {
+	result := firstRetryDelay
+	for i := 1; i < attempts && result < maxRetryDelay; i++ {
+		result *= 2
+	}
+
+	return min(result, maxRetryDelay)
+}
+
+// RecordAttempt records the result of an attempt, which was successful if err is nil,
+// and schedules the next attempt, if there should be one.
+// Attempts should already have been incremented, when the attempt started.
+func (self *Delivery) RecordAttempt(now time.Time, statusCode int, err error) {
+	self.LastAttempt = now
+	self.LastStatusCode = statusCode
+
+	if err == nil {
+		self.Status = DELIVERY_STATUS_DELIVERED
+		self.LastError = ""
+		return
+	}
+
+	self.LastError = err.Error()
+	if self.Attempts >= MaxAttempts {
+		self.Status = DELIVERY_STATUS_FAILED
+		return
+	}
+
+	self.NextAttempt = now.Add(RetryDelay(self.Attempts))
+}
+
+// Fail fails the delivery without attempting it again, such as when its webhook has been removed.
+func (self *Delivery) Fail(now time.Time, reason string) {
+	self.Status = DELIVERY_STATUS_FAILED
+	self.LastAttempt = now
+	self.LastError = reason
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Minute, RetryDelay(1))
+	assert.Equal(t, 2*time.Minute, RetryDelay(2))
+	assert.Equal(t, 4*time.Minute, RetryDelay(3))
+	assert.Equal(t, 6*time.Hour, RetryDelay(20))
+}
+
+func TestDeliveryRecordAttempt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	delivery, err := NewDelivery("chat", EVENT_QUIZ_COMPLETED, []byte(`{}`), now)
+	assert.Nil(t, err)
+	assert.Len(t, delivery.Id, 32)
+	assert.True(t, delivery.IsDue(now))
+
+	delivery.Attempts++
+	delivery.RecordAttempt(now, 503, errors.New("status 503"))
+	assert.Equal(t, DELIVERY_STATUS_PENDING, delivery.Status)
+	assert.Equal(t, 503, delivery.LastStatusCode)
+	assert.Equal(t, "status 503", delivery.LastError)
+	assert.False(t, delivery.IsDue(now))
+	assert.True(t, delivery.IsDue(now.Add(time.Minute)))
+
+	delivery.Attempts++
+	delivery.RecordAttempt(now.Add(time.Minute), 200, nil)
+	assert.Equal(t, DELIVERY_STATUS_DELIVERED, delivery.Status)
+	assert.Empty(t, delivery.LastError)
+	assert.False(t, delivery.IsDue(now.Add(time.Hour)))
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	delivery, err := NewDelivery("chat", EVENT_QUIZ_COMPLETED, []byte(`{}`), now)
+	assert.Nil(t, err)
+
+	for delivery.Status == DELIVERY_STATUS_PENDING {
+		now = delivery.NextAttempt
+		delivery.Attempts++
+		delivery.RecordAttempt(now, 0, errors.New("connection refused"))
+	}
+
+	assert.Equal(t, DELIVERY_STATUS_FAILED, delivery.Status)
+	assert.Equal(t, MaxAttempts, delivery.Attempts)
+
+	// The last attempt is less than a day after the first.
+	assert.Less(t, now.Sub(delivery.Created), 24*time.Hour)
+}
+
+func TestIsKnownEvent(t *testing.T) {
+	assert.True(t, IsKnownEvent(EVENT_STREAK_BROKEN))
+	assert.False(t, IsKnownEvent("section.started"))
+}
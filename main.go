@@ -1,39 +1,101 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // So users' time zones can be loaded even if the system has no time zone database.
 
 	"cloud.google.com/go/datastore"
 	"github.com/julienschmidt/httprouter"
 	"github.com/murraycu/go-bigoquiz-server/config"
 	"github.com/murraycu/go-bigoquiz-server/repositories/db"
 	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/csrf"
+	"github.com/murraycu/go-bigoquiz-server/server/health"
+	"github.com/murraycu/go-bigoquiz-server/server/logging"
 	"github.com/murraycu/go-bigoquiz-server/server/loginserver"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
 	"github.com/murraycu/go-bigoquiz-server/server/restserver"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
 	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
 	"github.com/rs/cors"
 	"golang.org/x/oauth2"
 )
 
+const (
+	// The timeouts for each connection, so slow or idle clients cannot hold connections open forever.
+	// The write timeout allows for the slowest handlers, such as the exports.
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 30 * time.Second
+	serverWriteTimeout      = 60 * time.Second
+	serverIdleTimeout       = 120 * time.Second
+
+	// How long to wait for the in-flight requests to finish, after SIGTERM,
+	// before closing the connections anyway.
+	// App Engine, and Cloud Run, stop the instance 10 seconds after SIGTERM.
+	shutdownTimeout = 8 * time.Second
+
+	// How long each readiness check, such as pinging the datastore, may take.
+	readinessCheckTimeout = 2 * time.Second
+)
+
+// The command that prints the configuration, instead of running the server.
+var commandConfigPrint = []string{"config", "print"}
+
 func main() {
-	allowedEnvs := []string{"prod", "local"}
-	env := flag.String("env", "prod", fmt.Sprintf("Environment to run in. Possible values: %v", allowedEnvs))
+	configFlags := config.RegisterFlags(flag.CommandLine, os.LookupEnv)
+	logLevelName := flag.String("log-level", "info", "The minimum level to log: debug, info, warn, or error.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] [%v]\n", os.Args[0], strings.Join(commandConfigPrint, " "))
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	if !slices.Contains(allowedEnvs, *env) {
-		log.Fatalf("Invalid environment name: %v. Allowed values: %v", *env, allowedEnvs)
-		return
+
+	// Cloud Logging parses JSON records, but people read the local server's log.
+	logFormat := logging.FORMAT_CLOUD_LOGGING
+	if configFlags.Env() == config.ENV_LOCAL {
+		logFormat = logging.FORMAT_TEXT
 	}
 
-	conf, err := config.GenerateConfig(*env)
+	logLevel, ok := logging.ParseLevel(*logLevelName)
+	if !ok {
+		fatalf("Invalid log level: %v", *logLevelName)
+	}
+
+	logging.Setup(logFormat, logLevel)
+
+	conf, err := configFlags.Load()
 	if err != nil {
-		log.Fatalf("Could not load conf file: %v\n", err)
+		fatalf("Could not load the configuration: %v", err)
+		return
+	}
+
+	if flag.NArg() != 0 {
+		if !slices.Equal(flag.Args(), commandConfigPrint) {
+			fatalf("Unknown command: %v. The only command is: %v", strings.Join(flag.Args(), " "), strings.Join(commandConfigPrint, " "))
+		}
+
+		printConfig(conf)
+		return
+	}
+
+	if err := conf.Validate(); err != nil {
+		fatalf("Invalid configuration: %v", err)
 		return
 	}
 
@@ -45,81 +107,228 @@ func main() {
 	gob.Register(&oauth2.Token{})
 	gob.Register(&datastore.Key{})
 
-	userSessionStore, err := usersessionstore.NewUserSessionStore(conf.CookieKey)
+	apierror.SetShowInternalErrors(conf.ShowInternalErrors)
+
+	sampleRatio := 1.0
+	if conf.TracingSampleRatio != nil {
+		sampleRatio = *conf.TracingSampleRatio
+	}
+
+	shutdownTracing, err := tracing.Setup(conf.TracingExporter, sampleRatio)
 	if err != nil {
-		log.Fatalf("NewUserSessionStore failed: %v\n", err)
+		fatalf("tracing.Setup() failed: %v", err)
 		return
 	}
 
-	directoryFilepath, err := filepath.Abs("quizzes")
+	userSessionStore, err := usersessionstore.NewUserSessionStore(conf)
 	if err != nil {
-		log.Fatalf("Couldn't get absolute filepath for quizzes: %v", err)
+		fatalf("NewUserSessionStore failed: %v", err)
+		return
+	}
+
+	directoryFilepath, err := filepath.Abs(conf.QuizzesDir)
+	if err != nil {
+		fatalf("Couldn't get absolute filepath for quizzes (%v): %v", conf.QuizzesDir, err)
 		return
 	}
 
 	quizzesStore, err := quizzes.NewQuizzesRepository(directoryFilepath)
 	if err != nil {
-		log.Fatalf("NewQuizzesRepository failed: %v\n", err)
+		fatalf("NewQuizzesRepository failed: %v", err)
 		return
 	}
 
-	userDataClient, err := db.NewUserDataRepository()
+	userDataClient, err := db.NewUserDataRepository(conf.DatastoreProjectId)
 	if err != nil {
-		log.Fatalf("NewUserDataRepository() failed: %v", err)
+		fatalf("NewUserDataRepository() failed: %v", err)
 	}
 
-	restServer, err := restserver.NewRestServer(quizzesStore, userSessionStore, userDataClient, conf)
+	userDataClient = db.NewInstrumentedUserDataRepository(userDataClient, tracing.ObserveRepositoryCall, metrics.ObserveRepositoryCall)
+
+	questionStatsClient, err := db.NewQuestionStatsRepository(conf.DatastoreProjectId)
 	if err != nil {
-		log.Fatalf("NewRestServer failed: %v\n", err)
+		fatalf("NewQuestionStatsRepository() failed: %v", err)
+	}
+
+	// Webhooks are optional, so their deliveries are only stored if some are configured.
+	var webhookDispatcher *webhooks.Dispatcher
+	var webhookClient db.WebhookRepository
+	if len(conf.Webhooks) != 0 {
+		webhookClient, err = db.NewWebhookRepository(conf.DatastoreProjectId)
+		if err != nil {
+			fatalf("NewWebhookRepository() failed: %v", err)
+		}
+
+		webhookDispatcher = webhooks.NewDispatcher(conf.Webhooks, webhookClient)
+	}
+
+	restServer, err := restserver.NewRestServer(quizzesStore, userSessionStore, userDataClient, questionStatsClient, webhookDispatcher, conf)
+	if err != nil {
+		fatalf("NewRestServer failed: %v", err)
 		return
 	}
 
-	loginServer, err := loginserver.NewLoginServer(userSessionStore, conf)
+	// Cancelled by SIGTERM, which is how App Engine stops instances, or by Ctrl-C locally.
+	signalContext, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	// The background goroutines, which shutdown() stops, and waits for, before closing the datastore clients.
+	backgroundContext, stopBackground := context.WithCancel(signalContext)
+	defer stopBackground()
+
+	var background sync.WaitGroup
+	runInBackground := func(f func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			f()
+		}()
+	}
+
+	// Keep the question statistics, and the question difficulties, up to date, until shutting down.
+	runInBackground(func() { restServer.RunQuestionStatsAggregation(backgroundContext, 10*time.Minute) })
+
+	// Forget the old offline answers, which can no longer be synced, until shutting down.
+	runInBackground(func() { restServer.RunSyncEventExpiry(backgroundContext, time.Hour) })
+
+	// Deliver the webhook events, retrying failed deliveries, until shutting down.
+	if webhookDispatcher != nil {
+		runInBackground(func() { webhookDispatcher.Run(backgroundContext, 30*time.Second) })
+	}
+
+	loginServer, err := loginserver.NewLoginServer(userSessionStore, userDataClient, webhookDispatcher, conf)
 	if err != nil {
-		log.Fatalf("NewLoginServer failed: %v\n", err)
+		fatalf("NewLoginServer failed: %v", err)
 		return
 	}
 
+	// The closers for shutdown(), in the order that they should be closed.
+	closers := []io.Closer{loginServer, restServer}
+	if webhookClient != nil {
+		closers = append(closers, webhookClient)
+	}
+	closers = append(closers, questionStatsClient, userDataClient)
+
 	router := httprouter.New()
-	router.GET("/api/quiz", restServer.HandleQuizAll)
-	router.GET("/api/quiz/:"+restserver.PATH_PARAM_QUIZ_ID, restServer.HandleQuizById)
-	router.GET("/api/quiz/:"+restserver.PATH_PARAM_QUIZ_ID+"/section", restServer.HandleQuizSectionsByQuizId)
-	router.GET("/api/quiz/:"+restserver.PATH_PARAM_QUIZ_ID+"/question/:"+restserver.PATH_PARAM_QUESTION_ID, restServer.HandleQuizQuestionById)
+	router.NotFound = apierror.NotFoundHandler()
+	router.MethodNotAllowed = apierror.MethodNotAllowedHandler()
 
-	router.GET("/api/question/next", restServer.HandleQuestionNext)
+	// The /api routes, and the OpenAPI document that describes them.
+	restServer.RegisterRoutes(router)
 
-	router.GET("/api/user", restServer.HandleUser)
+	loginServer.RegisterRoutes(router)
 
-	router.GET("/api/user-history", restServer.HandleUserHistoryAll)
-	router.GET("/api/user-history/:"+restserver.PATH_PARAM_QUIZ_ID, restServer.HandleUserHistoryByQuizId)
-	router.POST("/api/user-history/submit-answer", restServer.HandleUserHistorySubmitAnswer)
-	router.POST("/api/user-history/submit-dont-know-answer", restServer.HandleUserHistorySubmitDontKnowAnswer)
-	router.POST("/api/user-history/reset-sections", restServer.HandleUserHistoryResetSections)
+	checker := health.NewChecker(readinessCheckTimeout)
+	checker.AddCheck("quizzes", restServer.CheckQuizzesLoaded)
+	checker.AddCheck("datastore", userDataClient.Ping)
+	checker.RegisterRoutes(router)
 
-	router.GET("/login/login-google", loginServer.HandleGoogleLogin)
-	router.GET("/login/"+config.PART_URL_LOGIN_CALLBACK_GOOGLE, loginServer.HandleGoogleCallback)
-	router.GET("/login/login-github", loginServer.HandleGitHubLogin)
-	router.GET("/login/"+config.PART_URL_LOGIN_CALLBACK_GITHUB, loginServer.HandleGitHubCallback)
-	router.GET("/login/login-facebook", loginServer.HandleFacebookLogin)
-	router.GET("/login/"+config.PART_URL_LOGIN_CALLBACK_FACEBOOK, loginServer.HandleFacebookCallback)
-	router.GET("/login/logout", loginServer.HandleLogout)
+	// The metrics are only served if there is a token to protect them.
+	if len(conf.MetricsToken) != 0 {
+		router.GET(metrics.PATH, metrics.Handler(conf.MetricsToken))
+	}
 
 	// Allow Javascript requests from some domains other than the one serving this API.
 	// The browser issue a CORS request before actually issuing the HTTP request.
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{conf.BaseUrl},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedOrigins: conf.CorsAllowedOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "OPTIONS"},
+		// The defaults, plus If-None-Match, so clients can check whether their offline bundles are current.
+		AllowedHeaders:   []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "If-None-Match", csrf.HEADER_TOKEN},
+		ExposedHeaders:   []string{"ETag", logging.HEADER_REQUEST_ID, "Retry-After"},
 		AllowCredentials: true, // Note: The client needs to specify this too, or cookies won't be sent.
 	})
 
-	handler := c.Handler(router)
+	// The request IDs, and the access log, cover all requests, including CORS preflight requests.
+	handler := logging.Middleware(c.Handler(router))
+
+	port := conf.Port
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "port", port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		shutdown(nil, checker, stopBackground, &background, shutdownTracing, closers...)
+		fatalf("ListenAndServe() failed: %v", err)
+	case <-signalContext.Done():
+		// Let a second signal stop the server immediately.
+		stopSignals()
+		shutdown(server, checker, stopBackground, &background, shutdownTracing, closers...)
+	}
+}
+
+// shutdown stops accepting new requests, waits for the in-flight requests, such as answer submissions, to finish,
+// stops the background goroutines, and waits for them,
+// and then closes the connections to the datastore, and exports the remaining tracing spans.
+// server may be nil if it has already stopped.
+func shutdown(server *http.Server, checker *health.Checker, stopBackground context.CancelFunc, background *sync.WaitGroup, shutdownTracing func(c context.Context) error, closers ...io.Closer) {
+	slog.Info("Shutting down")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-		log.Printf("Defaulting to port %s", port)
+	c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	checker.SetShuttingDown()
+
+	if server != nil {
+		if err := server.Shutdown(c); err != nil {
+			slog.Error("server.Shutdown() failed", "error", err)
+		}
 	}
 
-	log.Printf("Listening on port %s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), handler))
+	stopBackground()
+
+	backgroundDone := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(backgroundDone)
+	}()
+
+	select {
+	case <-backgroundDone:
+	case <-c.Done():
+		slog.Error("the background goroutines did not stop before the shutdown timeout")
+	}
+
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			slog.Error("Close() failed", "error", err)
+		}
+	}
+
+	// Export the remaining spans before exiting.
+	if err := shutdownTracing(c); err != nil {
+		slog.Error("shutting down tracing failed", "error", err)
+	}
+
+	slog.Info("Shut down")
+}
+
+// printConfig prints the configuration, without its secrets, and then exits with an error if it is not valid.
+func printConfig(conf *config.Config) {
+	if err := conf.PrintRedacted(os.Stdout); err != nil {
+		fatalf("PrintRedacted() failed: %v", err)
+	}
+
+	if err := conf.Validate(); err != nil {
+		fatalf("Invalid configuration: %v", err)
+	}
+}
+
+// fatalf logs the message as an error, and exits.
+func fatalf(format string, a ...interface{}) {
+	slog.Error(fmt.Sprintf(format, a...))
+	os.Exit(1)
 }
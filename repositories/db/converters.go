@@ -1,18 +1,30 @@
 package db
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"cloud.google.com/go/datastore"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	dtogroup "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/group"
+	dtoquestionstats "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/questionstats"
 	dtouser "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/user"
+	dtowebhook "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/webhook"
 )
 
 func convertDtoQuestionHistoryToDomainQuestionHistory(dto dtouser.QuestionHistory) *domainuser.QuestionHistory {
 	return &domainuser.QuestionHistory{
 		QuestionId:            dto.QuestionId,
 		AnsweredCorrectlyOnce: dto.AnsweredCorrectlyOnce,
-		CountAnsweredWrong:    dto.CountAnsweredWrong}
+		CountAnsweredWrong:    dto.CountAnsweredWrong,
+		Mastery:               dto.Mastery,
+		CountAnswered:         dto.CountAnswered,
+		CountCorrect:          dto.CountCorrect,
+		QuizVersion:           dto.QuizVersion,
+		ContentHash:           dto.ContentHash}
 }
 
 func convertDtoStatsToDomainStats(dto *dtouser.Stats) *domainuser.Stats {
@@ -25,12 +37,17 @@ func convertDtoStatsToDomainStats(dto *dtouser.Stats) *domainuser.Stats {
 	result.Correct = dto.Correct
 	result.CountQuestionsAnsweredOnce = dto.CountQuestionsAnsweredOnce
 	result.CountQuestionsCorrectOnce = dto.CountQuestionsCorrectOnce
+	result.CountQuestionsMastered = dto.CountQuestionsMastered
+	result.MasterySum = dto.MasterySum
 
 	for _, qh := range dto.QuestionHistories {
 		result.QuestionHistories = append(result.QuestionHistories,
 			*convertDtoQuestionHistoryToDomainQuestionHistory(qh))
 	}
 
+	// Older stats do not have the mastery aggregates.
+	result.UpdateMasteryCounts()
+
 	// TODO: Fill extras, which are not in the dot?
 	/*
 		result.CountQuestions = dto.CountQuestions
@@ -46,6 +63,11 @@ func convertDomainQuestionHistoryToDtoQuestionHistory(history domainuser.Questio
 		QuestionId:            history.QuestionId,
 		AnsweredCorrectlyOnce: history.AnsweredCorrectlyOnce,
 		CountAnsweredWrong:    history.CountAnsweredWrong,
+		Mastery:               history.Mastery,
+		CountAnswered:         history.CountAnswered,
+		CountCorrect:          history.CountCorrect,
+		QuizVersion:           history.QuizVersion,
+		ContentHash:           history.ContentHash,
 	}
 
 	// Fill these?
@@ -74,6 +96,8 @@ func convertDomainStatsToDtoStats(stats *domainuser.Stats, userID string) (*dtou
 	result.Correct = stats.Correct
 	result.CountQuestionsAnsweredOnce = stats.CountQuestionsAnsweredOnce
 	result.CountQuestionsCorrectOnce = stats.CountQuestionsCorrectOnce
+	result.CountQuestionsMastered = stats.CountQuestionsMastered
+	result.MasterySum = stats.MasterySum
 
 	for _, qh := range stats.QuestionHistories {
 		result.QuestionHistories = append(result.QuestionHistories,
@@ -103,6 +127,242 @@ func convertDtoProfileToDomainProfile(dto *dtouser.Profile) *domainuser.Profile
 		GitHubProfileUrl:   dto.GitHubProfileUrl,
 		FacebookLinked:     dto.FacebookId != "",
 		FacebookProfileUrl: dto.FacebookProfileUrl,
+
+		TimeZone: dto.TimeZone,
+		DailyGoal: domainuser.DailyGoal{
+			Type:   dto.DailyGoalType,
+			Target: dto.DailyGoalTarget,
+		},
+	}
+}
+
+func convertDtoDailyActivityToDomainDailyActivity(dto *dtouser.DailyActivity) *domainuser.DailyActivity {
+	return &domainuser.DailyActivity{
+		Date:     dto.Date,
+		Answered: dto.Answered,
+		Correct:  dto.Correct,
+		Learned:  dto.Learned,
+	}
+}
+
+func convertDomainSyncEventToDtoSyncEvent(event *domainuser.SyncEvent) *dtouser.SyncEvent {
+	return &dtouser.SyncEvent{
+		QuizId:     event.QuizId,
+		QuestionId: event.QuestionId,
+		Time:       event.Time,
+		Synced:     event.Synced,
+	}
+}
+
+func convertDomainAnswerEventToDtoAnswerEvent(event *domainquestionstats.AnswerEvent) *dtoquestionstats.AnswerEvent {
+	return &dtoquestionstats.AnswerEvent{
+		QuizId:     event.QuizId,
+		QuestionId: event.QuestionId,
+		Correct:    event.Correct,
+		DontKnow:   event.DontKnow,
+		Answer:     event.Answer,
+		Time:       event.Time,
+	}
+}
+
+func convertDtoAnswerEventToDomainAnswerEvent(dto *dtoquestionstats.AnswerEvent) *domainquestionstats.AnswerEvent {
+	return &domainquestionstats.AnswerEvent{
+		QuizId:     dto.QuizId,
+		QuestionId: dto.QuestionId,
+		Correct:    dto.Correct,
+		DontKnow:   dto.DontKnow,
+		Answer:     dto.Answer,
+		Time:       dto.Time,
+	}
+}
+
+func convertDtoQuestionStatsToDomainQuestionStats(dto *dtoquestionstats.QuestionStats) *domainquestionstats.QuestionStats {
+	result := &domainquestionstats.QuestionStats{
+		QuizId:     dto.QuizId,
+		QuestionId: dto.QuestionId,
+		Answered:   dto.Answered,
+		Correct:    dto.Correct,
+		DontKnow:   dto.DontKnow,
+	}
+
+	for _, wrongAnswer := range dto.WrongAnswers {
+		result.WrongAnswers = append(result.WrongAnswers, domainquestionstats.WrongAnswer{
+			Answer: wrongAnswer.Answer,
+			Count:  wrongAnswer.Count,
+		})
+	}
+
+	return result
+}
+
+func convertDomainQuestionStatsToDtoQuestionStats(stats *domainquestionstats.QuestionStats) *dtoquestionstats.QuestionStats {
+	result := &dtoquestionstats.QuestionStats{
+		QuizId:     stats.QuizId,
+		QuestionId: stats.QuestionId,
+		Answered:   stats.Answered,
+		Correct:    stats.Correct,
+		DontKnow:   stats.DontKnow,
+	}
+
+	for _, wrongAnswer := range stats.WrongAnswers {
+		result.WrongAnswers = append(result.WrongAnswers, dtoquestionstats.WrongAnswer{
+			Answer: wrongAnswer.Answer,
+			Count:  wrongAnswer.Count,
+		})
+	}
+
+	return result
+}
+
+func convertDomainStatsUndoToDtoStatsUndo(undo *domainuser.StatsUndo) (*dtouser.StatsUndo, error) {
+	snapshot, err := json.Marshal(undo.Stats)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal() failed: %v", err)
+	}
+
+	return &dtouser.StatsUndo{
+		QuizId:   undo.QuizId,
+		Snapshot: snapshot,
+		Expires:  undo.Expires,
+	}, nil
+}
+
+func convertDtoStatsUndoToDomainStatsUndo(dto *dtouser.StatsUndo) (*domainuser.StatsUndo, error) {
+	result := &domainuser.StatsUndo{
+		QuizId:  dto.QuizId,
+		Expires: dto.Expires,
+	}
+
+	if err := json.Unmarshal(dto.Snapshot, &result.Stats); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal() failed: %v", err)
 	}
 
+	return result, nil
+}
+
+func convertDomainCertificateToDtoCertificate(certificate *domainuser.Certificate) *dtouser.Certificate {
+	return &dtouser.Certificate{
+		Id:             certificate.Id,
+		UserName:       certificate.UserName,
+		QuizId:         certificate.QuizId,
+		QuizTitle:      certificate.QuizTitle,
+		SectionId:      certificate.SectionId,
+		SectionTitle:   certificate.SectionTitle,
+		QuizVersion:    certificate.QuizVersion,
+		CountQuestions: certificate.CountQuestions,
+		Issued:         certificate.Issued,
+		KeyId:          certificate.KeyId,
+		Signature:      certificate.Signature,
+	}
+}
+
+func convertDtoCertificateToDomainCertificate(dto *dtouser.Certificate, userId string) *domainuser.Certificate {
+	return &domainuser.Certificate{
+		Id:             dto.Id,
+		UserId:         userId,
+		UserName:       dto.UserName,
+		QuizId:         dto.QuizId,
+		QuizTitle:      dto.QuizTitle,
+		SectionId:      dto.SectionId,
+		SectionTitle:   dto.SectionTitle,
+		QuizVersion:    dto.QuizVersion,
+		CountQuestions: dto.CountQuestions,
+		Issued:         dto.Issued,
+		KeyId:          dto.KeyId,
+		Signature:      dto.Signature,
+	}
+}
+
+func convertDomainGroupToDtoGroup(group *domaingroup.Group) *dtogroup.Group {
+	return &dtogroup.Group{
+		Name:        group.Name,
+		OwnerUserId: group.OwnerUserId,
+		InviteCode:  group.InviteCode,
+		Created:     group.Created,
+	}
+}
+
+func convertDtoGroupToDomainGroup(dto *dtogroup.Group, groupId string) *domaingroup.Group {
+	return &domaingroup.Group{
+		Id:          groupId,
+		Name:        dto.Name,
+		OwnerUserId: dto.OwnerUserId,
+		InviteCode:  dto.InviteCode,
+		Created:     dto.Created,
+	}
+}
+
+func convertDomainMembershipToDtoMembership(membership *domaingroup.Membership) *dtogroup.Membership {
+	return &dtogroup.Membership{
+		GroupId:              membership.GroupId,
+		UserName:             membership.UserName,
+		SharesProgress:       membership.SharesProgress,
+		SharesWithInstructor: membership.SharesWithInstructor,
+		Joined:               membership.Joined,
+	}
+}
+
+func convertDtoMembershipToDomainMembership(dto *dtogroup.Membership, userId string) *domaingroup.Membership {
+	return &domaingroup.Membership{
+		GroupId:              dto.GroupId,
+		UserId:               userId,
+		UserName:             dto.UserName,
+		SharesProgress:       dto.SharesProgress,
+		SharesWithInstructor: dto.SharesWithInstructor,
+		Joined:               dto.Joined,
+	}
+}
+
+func convertDomainAssignmentToDtoAssignment(assignment *domaingroup.Assignment) *dtogroup.Assignment {
+	return &dtogroup.Assignment{
+		QuizId:            assignment.QuizId,
+		SectionIds:        assignment.SectionIds,
+		Due:               assignment.Due,
+		TargetCorrectOnce: assignment.TargetCorrectOnce,
+		Created:           assignment.Created,
+	}
+}
+
+func convertDtoAssignmentToDomainAssignment(dto *dtogroup.Assignment, groupId string, assignmentId string) *domaingroup.Assignment {
+	return &domaingroup.Assignment{
+		Id:                assignmentId,
+		GroupId:           groupId,
+		QuizId:            dto.QuizId,
+		SectionIds:        dto.SectionIds,
+		Due:               dto.Due,
+		TargetCorrectOnce: dto.TargetCorrectOnce,
+		Created:           dto.Created,
+	}
+}
+
+func convertDomainDeliveryToDtoDelivery(delivery *domainwebhook.Delivery) *dtowebhook.Delivery {
+	return &dtowebhook.Delivery{
+		WebhookId:      delivery.WebhookId,
+		Event:          delivery.Event,
+		Payload:        delivery.Payload,
+		Created:        delivery.Created,
+		Status:         delivery.Status,
+		Pending:        delivery.Status == domainwebhook.DELIVERY_STATUS_PENDING,
+		Attempts:       delivery.Attempts,
+		NextAttempt:    delivery.NextAttempt,
+		LastAttempt:    delivery.LastAttempt,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+	}
+}
+
+func convertDtoDeliveryToDomainDelivery(dto *dtowebhook.Delivery, deliveryId string) *domainwebhook.Delivery {
+	return &domainwebhook.Delivery{
+		Id:             deliveryId,
+		WebhookId:      dto.WebhookId,
+		Event:          dto.Event,
+		Payload:        dto.Payload,
+		Created:        dto.Created,
+		Status:         dto.Status,
+		Attempts:       dto.Attempts,
+		NextAttempt:    dto.NextAttempt,
+		LastAttempt:    dto.LastAttempt,
+		LastStatusCode: dto.LastStatusCode,
+		LastError:      dto.LastError,
+	}
 }
@@ -1,10 +1,13 @@
 package db
 
 import (
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
 	dtouser "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/user"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestConvertDtoQuestionHistoryToDomainQuestionHistory(t *testing.T) {
@@ -12,6 +15,8 @@ func TestConvertDtoQuestionHistoryToDomainQuestionHistory(t *testing.T) {
 		QuestionId:            "question-id-1",
 		AnsweredCorrectlyOnce: true,
 		CountAnsweredWrong:    3,
+		QuizVersion:           "3",
+		ContentHash:           "0123456789abcdef",
 	}
 
 	result := convertDtoQuestionHistoryToDomainQuestionHistory(dto)
@@ -20,6 +25,11 @@ func TestConvertDtoQuestionHistoryToDomainQuestionHistory(t *testing.T) {
 	assert.Equal(t, dto.QuestionId, result.QuestionId)
 	assert.Equal(t, dto.AnsweredCorrectlyOnce, result.AnsweredCorrectlyOnce)
 	assert.Equal(t, dto.CountAnsweredWrong, result.CountAnsweredWrong)
+	assert.Equal(t, dto.QuizVersion, result.QuizVersion)
+	assert.Equal(t, dto.ContentHash, result.ContentHash)
+
+	// And back again.
+	assert.Equal(t, &dto, convertDomainQuestionHistoryToDtoQuestionHistory(*result))
 }
 
 func TestConvertDtoStatsToDomainStats(t *testing.T) {
@@ -69,6 +79,22 @@ func TestConvertDtoStatsToDomainStats(t *testing.T) {
 	assert.Equal(t, dto.QuestionHistories[1].CountAnsweredWrong, qh1.CountAnsweredWrong)
 }
 
+func TestConvertDtoStatsToDomainStatsWithoutMasteryCounts(t *testing.T) {
+	// Stored before we had the mastery aggregates.
+	dto := dtouser.Stats{
+		QuizId:    "example-quiz-id-1",
+		SectionId: "example-section-id-2",
+		QuestionHistories: []dtouser.QuestionHistory{
+			{QuestionId: "question-id-1", AnsweredCorrectlyOnce: true, Mastery: 0.97},
+			{QuestionId: "question-id-2", AnsweredCorrectlyOnce: true, Mastery: 0.5},
+		},
+	}
+
+	result := convertDtoStatsToDomainStats(&dto)
+	assert.Equal(t, 1, result.CountQuestionsMastered)
+	assert.InDelta(t, 1.47, result.MasterySum, 0.0001)
+}
+
 func TestConvertDomainQuestionHistoryToDtoQuestionHistory(t *testing.T) {
 	obj := domainuser.QuestionHistory{
 		QuestionId:            "question-id-1",
@@ -173,3 +199,69 @@ func TestConvertDtoProfileToDomainProfile(t *testing.T) {
 	assert.Equal(t, dto.GitHubProfileUrl, result.GitHubProfileUrl)
 	assert.Equal(t, dto.FacebookProfileUrl, result.FacebookProfileUrl)
 }
+
+func TestConvertQuestionStatsRoundTrip(t *testing.T) {
+	obj := domainquestionstats.QuestionStats{
+		QuizId:     "example-quiz-id-1",
+		QuestionId: "example-question-id-1",
+		Answered:   11,
+		Correct:    5,
+		DontKnow:   2,
+		WrongAnswers: []domainquestionstats.WrongAnswer{
+			{Answer: "some-wrong-answer-1", Count: 3},
+			{Answer: "some-wrong-answer-2", Count: 1},
+		},
+	}
+
+	dto := convertDomainQuestionStatsToDtoQuestionStats(&obj)
+	assert.NotNil(t, dto)
+	assert.Equal(t, obj.QuizId, dto.QuizId)
+	assert.Equal(t, obj.QuestionId, dto.QuestionId)
+	assert.Len(t, dto.WrongAnswers, 2)
+
+	result := convertDtoQuestionStatsToDomainQuestionStats(dto)
+	assert.NotNil(t, result)
+	assert.Equal(t, obj, *result)
+}
+
+func TestConvertStatsUndoRoundTrip(t *testing.T) {
+	stats := &domainuser.Stats{
+		QuizId:    "example-quiz-id-1",
+		SectionId: "example-section-id-2",
+	}
+	stats.UpdateStatsForAnswerCorrectness("question-id-1", true)
+	stats.UpdateStatsForAnswerCorrectness("question-id-2", false)
+
+	obj := domainuser.StatsUndo{
+		QuizId:  stats.QuizId,
+		Stats:   []*domainuser.Stats{stats},
+		Expires: time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC),
+	}
+
+	dto, err := convertDomainStatsUndoToDtoStatsUndo(&obj)
+	assert.Nil(t, err)
+	assert.NotNil(t, dto)
+	assert.Equal(t, obj.QuizId, dto.QuizId)
+	assert.Equal(t, obj.Expires, dto.Expires)
+
+	result, err := convertDtoStatsUndoToDomainStatsUndo(dto)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, obj, *result)
+}
+
+func TestConvertDeliveryRoundTrip(t *testing.T) {
+	now := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+	obj, err := domainwebhook.NewDelivery("chat", domainwebhook.EVENT_QUIZ_COMPLETED, []byte(`{"event":"quiz.completed"}`), now)
+	assert.Nil(t, err)
+
+	dto := convertDomainDeliveryToDtoDelivery(obj)
+	assert.True(t, dto.Pending)
+
+	result := convertDtoDeliveryToDomainDelivery(dto, obj.Id)
+	assert.Equal(t, *obj, *result)
+
+	obj.Attempts++
+	obj.RecordAttempt(now, 200, nil)
+	assert.False(t, convertDomainDeliveryToDtoDelivery(obj).Pending)
+}
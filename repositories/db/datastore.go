@@ -0,0 +1,24 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Like a database table name, but no entities of this kind are ever stored.
+const DB_KIND_PING = "Ping"
+
+// pingDatastore checks that the datastore is reachable, and that the client may use it,
+// by getting an entity that does not exist.
+func pingDatastore(c context.Context, client *datastore.Client) error {
+	var props datastore.PropertyList
+	err := client.Get(c, datastore.NameKey(DB_KIND_PING, "ping", nil), &props)
+	if err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
+		return fmt.Errorf("client.Get() failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The project used with the datastore emulator. See the Makefile.
+const TEST_PROJECT_ID = "bigoquiz"
+
+func TestRepositoriesPingAndClose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataRepository, err := NewUserDataRepository(TEST_PROJECT_ID)
+	require.Nil(t, err)
+
+	questionStatsRepository, err := NewQuestionStatsRepository(TEST_PROJECT_ID)
+	require.Nil(t, err)
+
+	oauthStateDataRepository, err := NewOAuthStateDataRepository(TEST_PROJECT_ID)
+	require.Nil(t, err)
+
+	c := context.Background()
+	for _, repository := range []interface {
+		Ping(c context.Context) error
+		Close() error
+	}{userDataRepository, questionStatsRepository, oauthStateDataRepository} {
+		assert.Nil(t, repository.Ping(c))
+		assert.Nil(t, repository.Close())
+	}
+}
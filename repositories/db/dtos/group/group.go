@@ -0,0 +1,37 @@
+package group
+
+import "time"
+
+// A study group. The key's name is the group's ID.
+type Group struct {
+	Name        string `datastore:"name,noindex"`
+	OwnerUserId string `datastore:"ownerUserId,noindex"`
+
+	// Indexed, to find the group when a user joins it.
+	InviteCode string `datastore:"inviteCode"`
+
+	Created time.Time `datastore:"created,noindex"`
+}
+
+// A user's membership of a group.
+// The key's parent is the user's UserProfile key, so the membership is deleted with the user,
+// and the key's name is the group's ID.
+type Membership struct {
+	// Indexed, to find the group's members.
+	GroupId string `datastore:"groupId"`
+
+	UserName             string    `datastore:"userName,noindex"`
+	SharesProgress       bool      `datastore:"sharesProgress,noindex"`
+	SharesWithInstructor bool      `datastore:"sharesWithInstructor,noindex"`
+	Joined               time.Time `datastore:"joined,noindex"`
+}
+
+// An assignment for a group's members.
+// The key's parent is the Group's key, and the key's name is the assignment's ID.
+type Assignment struct {
+	QuizId            string    `datastore:"quizId,noindex"`
+	SectionIds        []string  `datastore:"sectionIds,noindex"`
+	Due               time.Time `datastore:"due,noindex"`
+	TargetCorrectOnce float64   `datastore:"targetCorrectOnce,noindex"`
+	Created           time.Time `datastore:"created,noindex"`
+}
@@ -0,0 +1,20 @@
+package questionstats
+
+import "time"
+
+// One submitted answer, from any user.
+// These are folded into the QuestionStats by the aggregation, which then deletes them.
+type AnswerEvent struct {
+	QuizId     string `datastore:"quizId"`
+	QuestionId string `datastore:"questionId"`
+
+	Correct  bool   `datastore:"correct,noindex"`
+	DontKnow bool   `datastore:"dontKnow,noindex"`
+	Answer   string `datastore:"answer,noindex"`
+
+	Time time.Time `datastore:"time"`
+
+	// Only set by older versions of the aggregation, which kept the events.
+	// The aggregation now just deletes these.
+	Aggregated bool `datastore:"aggregated,noindex"`
+}
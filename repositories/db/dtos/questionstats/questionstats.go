@@ -0,0 +1,19 @@
+package questionstats
+
+type WrongAnswer struct {
+	Answer string `datastore:"answer,noindex"`
+	Count  int    `datastore:"count,noindex"`
+}
+
+// The aggregate of all users' answers to one question.
+// The key's name is the quiz ID and the question ID. See questionStatsKey().
+type QuestionStats struct {
+	QuizId     string `datastore:"quizId"`
+	QuestionId string `datastore:"questionId"`
+
+	Answered int `datastore:"answered,noindex"`
+	Correct  int `datastore:"correct,noindex"`
+	DontKnow int `datastore:"dontKnow,noindex"`
+
+	WrongAnswers []WrongAnswer `datastore:"wrongAnswers,noindex"`
+}
@@ -0,0 +1,26 @@
+package user
+
+import "time"
+
+// A completion certificate.
+// The key's parent is the user's UserProfile key, and the key's name is the quiz ID and the section ID,
+// so the user has only one certificate for each quiz, and for each section. See userCertificateKey().
+type Certificate struct {
+	// Indexed, to find the certificate for its public verification.
+	Id string `datastore:"id"`
+
+	UserName string `datastore:"userName,noindex"`
+
+	QuizId       string `datastore:"quizId,noindex"`
+	QuizTitle    string `datastore:"quizTitle,noindex"`
+	SectionId    string `datastore:"sectionId,noindex"`
+	SectionTitle string `datastore:"sectionTitle,noindex"`
+	QuizVersion  string `datastore:"quizVersion,noindex"`
+
+	CountQuestions int `datastore:"countQuestions,noindex"`
+
+	Issued time.Time `datastore:"issued,noindex"`
+
+	KeyId     string `datastore:"keyId,noindex"`
+	Signature []byte `datastore:"signature,noindex"`
+}
@@ -0,0 +1,12 @@
+package user
+
+// The aggregate of the user's answers on one day.
+// The key's parent is the user's UserProfile key, and the key's name is the Date.
+type DailyActivity struct {
+	// The day, in the user's time zone, in the format "2006-01-02".
+	Date string `datastore:"date"`
+
+	Answered int `datastore:"answered"`
+	Correct  int `datastore:"correct"`
+	Learned  int `datastore:"learned"`
+}
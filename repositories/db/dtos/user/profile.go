@@ -26,4 +26,10 @@ type Profile struct {
 	// FacebookAccessToken is actually an oauth2.Token, not an access token, but contains an access token (and a refresh token).
 	FacebookAccessToken oauth2.Token `datastore:"facebookAccessToken"`
 	FacebookProfileUrl  string       `datastore:"facebookProfileUrl"`
+
+	// An IANA time zone name, such as "Europe/Berlin".
+	TimeZone string `datastore:"timeZone"`
+
+	DailyGoalType   string `datastore:"dailyGoalType"`
+	DailyGoalTarget int    `datastore:"dailyGoalTarget"`
 }
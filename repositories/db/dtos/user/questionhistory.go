@@ -8,4 +8,16 @@ type QuestionHistory struct {
 	//Decrements once for each time the user answers it correctly.
 	//Increments once for each time the user answers it wrongly.
 	CountAnsweredWrong int `datastore:"countAnsweredWrong"`
+
+	// The estimated probability that the user knows the answer.
+	// This is 0 for histories stored before we estimated mastery.
+	Mastery float64 `datastore:"mastery"`
+
+	// These are 0 for histories stored before we counted answers per question.
+	CountAnswered int `datastore:"countAnswered"`
+	CountCorrect  int `datastore:"countCorrect"`
+
+	// These are empty for histories stored before we recorded the versions.
+	QuizVersion string `datastore:"quizVersion,noindex"`
+	ContentHash string `datastore:"contentHash,noindex"`
 }
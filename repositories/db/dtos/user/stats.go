@@ -28,6 +28,9 @@ type Stats struct {
 	CountQuestionsAnsweredOnce int `datastore:"countQuestionsAnsweredOnce"`
 	CountQuestionsCorrectOnce  int `datastore:"countQuestionsCorrectOnce"`
 
+	CountQuestionsMastered int     `datastore:"countQuestionsMastered"`
+	MasterySum             float64 `datastore:"masterySum"`
+
 	// Note: Go's datastore API doesn't let us use a map,
 	// though Java's does let us use a Map.
 	// (either QuestionHistories map[string]*QuestionHistory or QuestionHistories map[string]QuestionHistory )
@@ -0,0 +1,15 @@
+package user
+
+import "time"
+
+// The user's stats for some sections, from before they were reset.
+// The key's parent is the user's UserProfile key. See userStatsUndoKey().
+type StatsUndo struct {
+	QuizId string `datastore:"quizId,noindex"`
+
+	// The JSON of the domain Stats.
+	// This is only read back all at once, so there is no point in storing it as separate properties.
+	Snapshot []byte `datastore:"snapshot,noindex"`
+
+	Expires time.Time `datastore:"expires,noindex"`
+}
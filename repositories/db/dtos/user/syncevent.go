@@ -0,0 +1,17 @@
+package user
+
+import "time"
+
+// An answer, from the user's offline study, that has already been added to the user's stats,
+// so it is not added again if the client sends it again.
+// The key's parent is the user's UserProfile key, and the key's name is the client's event ID.
+type SyncEvent struct {
+	QuizId     string `datastore:"quizId,noindex"`
+	QuestionId string `datastore:"questionId,noindex"`
+
+	// When the user answered.
+	Time time.Time `datastore:"time,noindex"`
+
+	// When the answer was added to the user's stats.
+	Synced time.Time `datastore:"synced"`
+}
@@ -0,0 +1,27 @@
+package webhook
+
+import "time"
+
+// One event, for one webhook. The key's name is the delivery's ID.
+// These are both the queue of pending deliveries, and the delivery log.
+type Delivery struct {
+	WebhookId string `datastore:"webhookId,noindex"`
+	Event     string `datastore:"event,noindex"`
+	Payload   []byte `datastore:"payload,noindex"`
+
+	// Indexed, for the delivery log, newest first, and to delete old deliveries.
+	Created time.Time `datastore:"created"`
+
+	Status string `datastore:"status,noindex"`
+
+	// Whether Status is pending.
+	// Indexed, with NextAttempt, to find the deliveries that are due. See index.yaml.
+	Pending bool `datastore:"pending"`
+
+	Attempts    int       `datastore:"attempts,noindex"`
+	NextAttempt time.Time `datastore:"nextAttempt"`
+
+	LastAttempt    time.Time `datastore:"lastAttempt,noindex"`
+	LastStatusCode int       `datastore:"lastStatusCode,noindex"`
+	LastError      string    `datastore:"lastError,noindex"`
+}
@@ -0,0 +1,407 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/loginserver/oauthparsers"
+	"golang.org/x/oauth2"
+)
+
+// CallObserver is called before each call to a repository method.
+// It returns the context to use for the call, for instance with a tracing span,
+// and a function to call afterwards, with the call's error, if any.
+type CallObserver func(c context.Context, repository string, method string) (context.Context, func(err error))
+
+const (
+	repositoryNameUserData   = "UserDataRepository"
+	repositoryNameOAuthState = "OAuthStateRepository"
+)
+
+// observeCall calls each of the observers, in order, before a call, returning a function to call after the call.
+func observeCall(c context.Context, observers []CallObserver, repository string, method string) (context.Context, func(err error)) {
+	dones := make([]func(err error), 0, len(observers))
+	for _, observer := range observers {
+		var done func(err error)
+		c, done = observer(c, repository, method)
+		dones = append(dones, done)
+	}
+
+	return c, func(err error) {
+		// In reverse order, so a span ends after the metrics that were recorded inside it.
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](err)
+		}
+	}
+}
+
+// instrumentedUserDataRepository tells CallObservers about each call to the UserDataRepository,
+// for instance to record metrics and tracing spans.
+type instrumentedUserDataRepository struct {
+	inner     UserDataRepository
+	observers []CallObserver
+}
+
+// NewInstrumentedUserDataRepository returns a UserDataRepository that calls the inner one,
+// telling the observers about each call.
+func NewInstrumentedUserDataRepository(inner UserDataRepository, observers ...CallObserver) UserDataRepository {
+	return &instrumentedUserDataRepository{
+		inner:     inner,
+		observers: observers,
+	}
+}
+
+func (db *instrumentedUserDataRepository) observe(c context.Context, method string) (context.Context, func(err error)) {
+	return observeCall(c, db.observers, repositoryNameUserData, method)
+}
+
+func (db *instrumentedUserDataRepository) GetUserProfileById(c context.Context, strUserId string) (*domainuser.Profile, error) {
+	c, done := db.observe(c, "GetUserProfileById")
+	result, err := db.inner.GetUserProfileById(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserStats(c context.Context, strUserId string) (map[string]*domainuser.Stats, error) {
+	c, done := db.observe(c, "GetUserStats")
+	result, err := db.inner.GetUserStats(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserStatsForQuiz(c context.Context, strUserId string, quizId string) (map[string]*domainuser.Stats, error) {
+	c, done := db.observe(c, "GetUserStatsForQuiz")
+	result, err := db.inner.GetUserStatsForQuiz(c, strUserId, quizId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) (*domainuser.Stats, error) {
+	c, done := db.observe(c, "GetUserStatsForSection")
+	result, err := db.inner.GetUserStatsForSection(c, strUserId, quizId, sectionId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) StoreUserStats(c context.Context, userID string, stats *domainuser.Stats) error {
+	c, done := db.observe(c, "StoreUserStats")
+	err := db.inner.StoreUserStats(c, userID, stats)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) UpdateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, update func(stats *domainuser.Stats) error) (*domainuser.Stats, error) {
+	c, done := db.observe(c, "UpdateUserStatsForSection")
+	result, err := db.inner.UpdateUserStatsForSection(c, strUserId, quizId, sectionId, update)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) UpdateUserStatsForSectionOnce(c context.Context, strUserId string, quizId string, sectionId string, event *domainuser.SyncEvent, update func(stats *domainuser.Stats) error) (*domainuser.Stats, bool, error) {
+	c, done := db.observe(c, "UpdateUserStatsForSectionOnce")
+	result, applied, err := db.inner.UpdateUserStatsForSectionOnce(c, strUserId, quizId, sectionId, event, update)
+	done(err)
+	return result, applied, err
+}
+
+func (db *instrumentedUserDataRepository) DeleteOldSyncEvents(c context.Context, before time.Time) (int, error) {
+	c, done := db.observe(c, "DeleteOldSyncEvents")
+	result, err := db.inner.DeleteOldSyncEvents(c, before)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) DeleteUserStatsForQuiz(c context.Context, strUserId string, quizId string) error {
+	c, done := db.observe(c, "DeleteUserStatsForQuiz")
+	err := db.inner.DeleteUserStatsForQuiz(c, strUserId, quizId)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) DeleteUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) error {
+	c, done := db.observe(c, "DeleteUserStatsForSection")
+	err := db.inner.DeleteUserStatsForSection(c, strUserId, quizId, sectionId)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) UpdateUserStatsForSections(c context.Context, strUserId string, quizId string, sectionIds []string, update func(statsBySection map[string]*domainuser.Stats) error) error {
+	c, done := db.observe(c, "UpdateUserStatsForSections")
+	err := db.inner.UpdateUserStatsForSections(c, strUserId, quizId, sectionIds, update)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreUserStatsUndo(c context.Context, strUserId string, undo *domainuser.StatsUndo) error {
+	c, done := db.observe(c, "StoreUserStatsUndo")
+	err := db.inner.StoreUserStatsUndo(c, strUserId, undo)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) GetUserStatsUndo(c context.Context, strUserId string) (*domainuser.StatsUndo, error) {
+	c, done := db.observe(c, "GetUserStatsUndo")
+	result, err := db.inner.GetUserStatsUndo(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) DeleteUserStatsUndo(c context.Context, strUserId string) error {
+	c, done := db.observe(c, "DeleteUserStatsUndo")
+	err := db.inner.DeleteUserStatsUndo(c, strUserId)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreUserCertificateIfNew(c context.Context, strUserId string, certificate *domainuser.Certificate) (*domainuser.Certificate, bool, error) {
+	c, done := db.observe(c, "StoreUserCertificateIfNew")
+	result, stored, err := db.inner.StoreUserCertificateIfNew(c, strUserId, certificate)
+	done(err)
+	return result, stored, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserCertificates(c context.Context, strUserId string) ([]*domainuser.Certificate, error) {
+	c, done := db.observe(c, "GetUserCertificates")
+	result, err := db.inner.GetUserCertificates(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetCertificateById(c context.Context, certificateId string) (*domainuser.Certificate, error) {
+	c, done := db.observe(c, "GetCertificateById")
+	result, err := db.inner.GetCertificateById(c, certificateId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) StoreGroup(c context.Context, group *domaingroup.Group) error {
+	c, done := db.observe(c, "StoreGroup")
+	err := db.inner.StoreGroup(c, group)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) GetGroup(c context.Context, groupId string) (*domaingroup.Group, error) {
+	c, done := db.observe(c, "GetGroup")
+	result, err := db.inner.GetGroup(c, groupId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetGroupByInviteCode(c context.Context, inviteCode string) (*domaingroup.Group, error) {
+	c, done := db.observe(c, "GetGroupByInviteCode")
+	result, err := db.inner.GetGroupByInviteCode(c, inviteCode)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) StoreGroupMembership(c context.Context, membership *domaingroup.Membership) error {
+	c, done := db.observe(c, "StoreGroupMembership")
+	err := db.inner.StoreGroupMembership(c, membership)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) GetGroupMembership(c context.Context, groupId string, strUserId string) (*domaingroup.Membership, error) {
+	c, done := db.observe(c, "GetGroupMembership")
+	result, err := db.inner.GetGroupMembership(c, groupId, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetGroupMemberships(c context.Context, groupId string) ([]*domaingroup.Membership, error) {
+	c, done := db.observe(c, "GetGroupMemberships")
+	result, err := db.inner.GetGroupMemberships(c, groupId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserGroupMemberships(c context.Context, strUserId string) ([]*domaingroup.Membership, error) {
+	c, done := db.observe(c, "GetUserGroupMemberships")
+	result, err := db.inner.GetUserGroupMemberships(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) DeleteGroupMembership(c context.Context, groupId string, strUserId string) error {
+	c, done := db.observe(c, "DeleteGroupMembership")
+	err := db.inner.DeleteGroupMembership(c, groupId, strUserId)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreGroupAssignment(c context.Context, assignment *domaingroup.Assignment) error {
+	c, done := db.observe(c, "StoreGroupAssignment")
+	err := db.inner.StoreGroupAssignment(c, assignment)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) GetGroupAssignment(c context.Context, groupId string, assignmentId string) (*domaingroup.Assignment, error) {
+	c, done := db.observe(c, "GetGroupAssignment")
+	result, err := db.inner.GetGroupAssignment(c, groupId, assignmentId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetGroupAssignments(c context.Context, groupId string) ([]*domaingroup.Assignment, error) {
+	c, done := db.observe(c, "GetGroupAssignments")
+	result, err := db.inner.GetGroupAssignments(c, groupId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
+	c, done := db.observe(c, "StoreGoogleLoginInUserProfile")
+	result, created, err := db.inner.StoreGoogleLoginInUserProfile(c, userInfo, strUserId, token)
+	done(err)
+	return result, created, err
+}
+
+func (db *instrumentedUserDataRepository) StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
+	c, done := db.observe(c, "StoreGitHubLoginInUserProfile")
+	result, created, err := db.inner.StoreGitHubLoginInUserProfile(c, userInfo, strUserId, token)
+	done(err)
+	return result, created, err
+}
+
+func (db *instrumentedUserDataRepository) StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
+	c, done := db.observe(c, "StoreFacebookLoginInUserProfile")
+	result, created, err := db.inner.StoreFacebookLoginInUserProfile(c, userInfo, strUserId, token)
+	done(err)
+	return result, created, err
+}
+
+func (db *instrumentedUserDataRepository) StoreGoogleTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error {
+	c, done := db.observe(c, "StoreGoogleTokenInUserProfile")
+	err := db.inner.StoreGoogleTokenInUserProfile(c, userId, token)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreGitHubTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error {
+	c, done := db.observe(c, "StoreGitHubTokenInUserProfile")
+	err := db.inner.StoreGitHubTokenInUserProfile(c, userId, token)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreFacebookTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error {
+	c, done := db.observe(c, "StoreFacebookTokenInUserProfile")
+	err := db.inner.StoreFacebookTokenInUserProfile(c, userId, token)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) StoreUserDailyGoal(c context.Context, strUserId string, timeZone string, goal domainuser.DailyGoal) error {
+	c, done := db.observe(c, "StoreUserDailyGoal")
+	err := db.inner.StoreUserDailyGoal(c, strUserId, timeZone, goal)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) UpdateUserDailyActivity(c context.Context, strUserId string, date string, answerIsCorrect bool, learned bool) (bool, error) {
+	c, done := db.observe(c, "UpdateUserDailyActivity")
+	result, err := db.inner.UpdateUserDailyActivity(c, strUserId, date, answerIsCorrect, learned)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserDailyActivities(c context.Context, strUserId string) ([]*domainuser.DailyActivity, error) {
+	c, done := db.observe(c, "GetUserDailyActivities")
+	result, err := db.inner.GetUserDailyActivities(c, strUserId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserIds(c context.Context) ([]string, error) {
+	c, done := db.observe(c, "GetUserIds")
+	result, err := db.inner.GetUserIds(c)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserIdsByEmail(c context.Context, email string) ([]string, error) {
+	c, done := db.observe(c, "GetUserIdsByEmail")
+	result, err := db.inner.GetUserIdsByEmail(c, email)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) GetUserIdByLoginId(c context.Context, provider string, loginId string) (string, error) {
+	c, done := db.observe(c, "GetUserIdByLoginId")
+	result, err := db.inner.GetUserIdByLoginId(c, provider, loginId)
+	done(err)
+	return result, err
+}
+
+func (db *instrumentedUserDataRepository) DeleteUser(c context.Context, strUserId string) error {
+	c, done := db.observe(c, "DeleteUser")
+	err := db.inner.DeleteUser(c, strUserId)
+	done(err)
+	return err
+}
+
+// instrumentedOAuthStateRepository tells CallObservers about each call to the OAuthStateRepository.
+type instrumentedOAuthStateRepository struct {
+	inner     OAuthStateRepository
+	observers []CallObserver
+}
+
+// NewInstrumentedOAuthStateRepository returns an OAuthStateRepository that calls the inner one,
+// telling the observers about each call.
+func NewInstrumentedOAuthStateRepository(inner OAuthStateRepository, observers ...CallObserver) OAuthStateRepository {
+	return &instrumentedOAuthStateRepository{
+		inner:     inner,
+		observers: observers,
+	}
+}
+
+func (db *instrumentedOAuthStateRepository) observe(c context.Context, method string) (context.Context, func(err error)) {
+	return observeCall(c, db.observers, repositoryNameOAuthState, method)
+}
+
+func (db *instrumentedOAuthStateRepository) StoreOAuthState(c context.Context, state int64) error {
+	c, done := db.observe(c, "StoreOAuthState")
+	err := db.inner.StoreOAuthState(c, state)
+	done(err)
+	return err
+}
+
+func (db *instrumentedOAuthStateRepository) CheckOAuthState(c context.Context, state int64) error {
+	c, done := db.observe(c, "CheckOAuthState")
+	err := db.inner.CheckOAuthState(c, state)
+	done(err)
+	return err
+}
+
+func (db *instrumentedOAuthStateRepository) RemoveOAuthState(c context.Context, state int64) error {
+	c, done := db.observe(c, "RemoveOAuthState")
+	err := db.inner.RemoveOAuthState(c, state)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) Ping(c context.Context) error {
+	c, done := db.observe(c, "Ping")
+	err := db.inner.Ping(c)
+	done(err)
+	return err
+}
+
+func (db *instrumentedUserDataRepository) Close() error {
+	return db.inner.Close()
+}
+
+func (db *instrumentedOAuthStateRepository) Ping(c context.Context) error {
+	c, done := db.observe(c, "Ping")
+	err := db.inner.Ping(c)
+	done(err)
+	return err
+}
+
+func (db *instrumentedOAuthStateRepository) Close() error {
+	return db.inner.Close()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUserDataRepository implements only the methods that the test calls.
+type fakeUserDataRepository struct {
+	UserDataRepository
+}
+
+func (db *fakeUserDataRepository) GetUserStatsUndo(c context.Context, strUserId string) (*domainuser.StatsUndo, error) {
+	return &domainuser.StatsUndo{QuizId: "some-quiz"}, nil
+}
+
+func (db *fakeUserDataRepository) DeleteUserStatsUndo(c context.Context, strUserId string) error {
+	return errors.New("some error")
+}
+
+func TestInstrumentedUserDataRepository(t *testing.T) {
+	type call struct {
+		repository string
+		method     string
+		failed     bool
+	}
+
+	var calls []call
+	var order []string
+	observer := func(name string) CallObserver {
+		return func(c context.Context, repository string, method string) (context.Context, func(err error)) {
+			order = append(order, "before "+name)
+			return c, func(err error) {
+				order = append(order, "after "+name)
+				if name == "first" {
+					calls = append(calls, call{repository: repository, method: method, failed: err != nil})
+				}
+			}
+		}
+	}
+
+	repo := NewInstrumentedUserDataRepository(&fakeUserDataRepository{}, observer("first"), observer("second"))
+
+	c := context.Background()
+	undo, err := repo.GetUserStatsUndo(c, "some-user")
+	assert.Nil(t, err)
+	assert.Equal(t, "some-quiz", undo.QuizId)
+
+	err = repo.DeleteUserStatsUndo(c, "some-user")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []call{
+		{repository: "UserDataRepository", method: "GetUserStatsUndo", failed: false},
+		{repository: "UserDataRepository", method: "DeleteUserStatsUndo", failed: true},
+	}, calls)
+
+	// The observers are nested, so a span can contain the other observer's work.
+	assert.Equal(t, []string{"before first", "before second", "after second", "after first"}, order[:4])
+}
+
+// fakeOAuthStateRepository checks that the state has been stored.
+type fakeOAuthStateRepository struct {
+	states map[int64]bool
+}
+
+func (db *fakeOAuthStateRepository) StoreOAuthState(c context.Context, state int64) error {
+	db.states[state] = true
+	return nil
+}
+
+func (db *fakeOAuthStateRepository) CheckOAuthState(c context.Context, state int64) error {
+	if !db.states[state] {
+		return errors.New("unknown state")
+	}
+
+	return nil
+}
+
+func (db *fakeOAuthStateRepository) RemoveOAuthState(c context.Context, state int64) error {
+	delete(db.states, state)
+	return nil
+}
+
+func (db *fakeOAuthStateRepository) Ping(c context.Context) error {
+	return nil
+}
+
+func (db *fakeOAuthStateRepository) Close() error {
+	return nil
+}
+
+func TestInstrumentedOAuthStateRepository(t *testing.T) {
+	var methods []string
+	var failures int
+	repo := NewInstrumentedOAuthStateRepository(&fakeOAuthStateRepository{states: make(map[int64]bool)}, func(c context.Context, repository string, method string) (context.Context, func(err error)) {
+		assert.Equal(t, "OAuthStateRepository", repository)
+		methods = append(methods, method)
+		return c, func(err error) {
+			if err != nil {
+				failures++
+			}
+		}
+	})
+
+	c := context.Background()
+	assert.Nil(t, repo.StoreOAuthState(c, 123))
+	assert.Nil(t, repo.CheckOAuthState(c, 123))
+	assert.Nil(t, repo.RemoveOAuthState(c, 123))
+	assert.NotNil(t, repo.CheckOAuthState(c, 123))
+
+	assert.Equal(t, []string{"StoreOAuthState", "CheckOAuthState", "RemoveOAuthState", "CheckOAuthState"}, methods)
+	assert.Equal(t, 1, failures)
+}
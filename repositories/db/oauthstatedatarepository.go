@@ -7,16 +7,31 @@ import (
 	"time"
 )
 
+// OAuthStateRepository stores the OAuth states that have been sent to the OAuth providers,
+// so the callbacks can check that they are expected.
+type OAuthStateRepository interface {
+	StoreOAuthState(c context.Context, state int64) error
+	CheckOAuthState(c context.Context, state int64) error
+	RemoveOAuthState(c context.Context, state int64) error
+
+	// Ping checks that the datastore is reachable.
+	Ping(c context.Context) error
+
+	// Close closes the connection to the datastore. The repository may not be used afterwards.
+	Close() error
+}
+
 type OAuthStateDataRepository struct {
 	client *datastore.Client
 }
 
-func NewOAuthStateDataRepository() (*OAuthStateDataRepository, error) {
+// NewOAuthStateDataRepository connects to the Datastore of the Google Cloud project, such as "bigoquiz".
+func NewOAuthStateDataRepository(projectId string) (*OAuthStateDataRepository, error) {
 	result := &OAuthStateDataRepository{}
 
 	c := context.Background()
 	var err error
-	result.client, err = datastore.NewClient(c, "bigoquiz")
+	result.client, err = datastore.NewClient(c, projectId)
 	if err != nil {
 		return nil, fmt.Errorf("datastore.NewClient() failed: %v", err)
 	}
@@ -24,6 +39,14 @@ func NewOAuthStateDataRepository() (*OAuthStateDataRepository, error) {
 	return result, nil
 }
 
+func (db *OAuthStateDataRepository) Ping(c context.Context) error {
+	return pingDatastore(c, db.client)
+}
+
+func (db *OAuthStateDataRepository) Close() error {
+	return db.client.Close()
+}
+
 /**
  */
 type OAuthState struct {
@@ -11,7 +11,7 @@ func TestNewOAuthStateDataRepository(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	oauthStateDataRepository, err := NewOAuthStateDataRepository()
+	oauthStateDataRepository, err := NewOAuthStateDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, oauthStateDataRepository)
 }
@@ -21,7 +21,7 @@ func TestOAuthStateDataRepositorySetAndGet(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	oauthStateDataRepository, err := NewOAuthStateDataRepository()
+	oauthStateDataRepository, err := NewOAuthStateDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, oauthStateDataRepository)
 
@@ -40,7 +40,7 @@ func TestOAuthStateDataRepositorySetAndRemoveAndGet(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	oauthStateDataRepository, err := NewOAuthStateDataRepository()
+	oauthStateDataRepository, err := NewOAuthStateDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, oauthStateDataRepository)
 
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
+	dtoquestionstats "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/questionstats"
+)
+
+const (
+	DB_KIND_ANSWER_EVENT   = "AnswerEvent"
+	DB_KIND_QUESTION_STATS = "QuestionStats"
+
+	// The maximum number of events to update in one transaction,
+	// staying well below the datastore's limit of 500 mutations per commit.
+	maxAnswerEventsPerTransaction = 250
+)
+
+type QuestionStatsRepository interface {
+	// StoreAnswerEvent logs one answer, to be aggregated later by AggregateAnswerEvents().
+	StoreAnswerEvent(c context.Context, event *domainquestionstats.AnswerEvent) error
+
+	// AggregateAnswerEvents adds up to maxEvents AnswerEvents to the QuestionStats, and deletes them,
+	// returning the number of events that were deleted, and the QuestionStats that changed.
+	AggregateAnswerEvents(c context.Context, maxEvents int) (int, []*domainquestionstats.QuestionStats, error)
+
+	// GetQuestionStats gets the QuestionStats for all questions that have been answered,
+	// or just for the quiz's questions, if quizId is not empty.
+	GetQuestionStats(c context.Context, quizId string) ([]*domainquestionstats.QuestionStats, error)
+
+	// Ping checks that the datastore is reachable.
+	Ping(c context.Context) error
+
+	// Close closes the connection to the datastore. The repository may not be used afterwards.
+	Close() error
+}
+
+type QuestionStatsRepositoryImpl struct {
+	client *datastore.Client
+}
+
+// NewQuestionStatsRepository connects to the Datastore of the Google Cloud project, such as "bigoquiz".
+func NewQuestionStatsRepository(projectId string) (QuestionStatsRepository, error) {
+	result := &QuestionStatsRepositoryImpl{}
+
+	c := context.Background()
+	var err error
+	result.client, err = datastore.NewClient(c, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.NewClient() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+func (db *QuestionStatsRepositoryImpl) Ping(c context.Context) error {
+	return pingDatastore(c, db.client)
+}
+
+func (db *QuestionStatsRepositoryImpl) Close() error {
+	return db.client.Close()
+}
+
+func questionStatsKey(quizId string, questionId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_QUESTION_STATS, quizId+"/"+questionId, nil)
+}
+
+func (db *QuestionStatsRepositoryImpl) StoreAnswerEvent(c context.Context, event *domainquestionstats.AnswerEvent) error {
+	if event == nil {
+		return fmt.Errorf("StoreAnswerEvent(): event is nil")
+	}
+
+	if len(event.QuizId) == 0 || len(event.QuestionId) == 0 {
+		return fmt.Errorf("StoreAnswerEvent(): quiz ID or question ID is empty")
+	}
+
+	key := datastore.IncompleteKey(DB_KIND_ANSWER_EVENT, nil)
+	dto := convertDomainAnswerEventToDtoAnswerEvent(event)
+
+	if _, err := db.client.Put(c, key, dto); err != nil {
+		return fmt.Errorf("datastore Put() failed: %v", err)
+	}
+
+	return nil
+}
+
+func (db *QuestionStatsRepositoryImpl) AggregateAnswerEvents(c context.Context, maxEvents int) (int, []*domainquestionstats.QuestionStats, error) {
+	q := datastore.NewQuery(DB_KIND_ANSWER_EVENT).
+		KeysOnly().
+		Limit(maxEvents)
+
+	keys, err := db.client.GetAll(c, q, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := 0
+	var updated []*domainquestionstats.QuestionStats
+	for start := 0; start < len(keys); start += maxAnswerEventsPerTransaction {
+		end := min(start+maxAnswerEventsPerTransaction, len(keys))
+
+		count, stats, err := db.aggregateAnswerEvents(c, keys[start:end])
+		if err != nil {
+			return result, updated, fmt.Errorf("aggregateAnswerEvents() failed: %v", err)
+		}
+
+		result += count
+		updated = append(updated, stats...)
+	}
+
+	return result, updated, nil
+}
+
+// aggregateAnswerEvents adds the events to their QuestionStats, and deletes them,
+// in one transaction, so each event is counted exactly once,
+// even if several instances of the server are aggregating at the same time.
+// This returns the number of events that were deleted, and the QuestionStats that changed.
+func (db *QuestionStatsRepositoryImpl) aggregateAnswerEvents(c context.Context, keys []*datastore.Key) (int, []*domainquestionstats.QuestionStats, error) {
+	var result int
+	var updated []*domainquestionstats.QuestionStats
+
+	_, err := db.client.RunInTransaction(c, func(tx *datastore.Transaction) error {
+		result = 0
+		updated = nil
+
+		events := make([]*dtoquestionstats.AnswerEvent, len(keys))
+		err := tx.GetMulti(keys, events)
+		eventsMultiErr, isEventsMultiErr := err.(datastore.MultiError)
+		if err != nil && !isEventsMultiErr {
+			return fmt.Errorf("datastore GetMulti() failed: %v", err)
+		}
+
+		// Group the events by question.
+		statsByKey := make(map[string]*domainquestionstats.QuestionStats)
+		var statsKeys []*datastore.Key
+		var eventKeys []*datastore.Key
+		for i, dto := range events {
+			if isEventsMultiErr && eventsMultiErr[i] != nil {
+				if eventsMultiErr[i] == datastore.ErrNoSuchEntity {
+					// Another aggregation got to this event first.
+					continue
+				}
+
+				return fmt.Errorf("datastore GetMulti() failed for key: %v: %v", keys[i], eventsMultiErr[i])
+			}
+
+			eventKeys = append(eventKeys, keys[i])
+
+			if dto.Aggregated {
+				// Aggregated before we deleted the events, so just delete it.
+				continue
+			}
+
+			key := questionStatsKey(dto.QuizId, dto.QuestionId)
+			stats, ok := statsByKey[key.Name]
+			if !ok {
+				stats = &domainquestionstats.QuestionStats{
+					QuizId:     dto.QuizId,
+					QuestionId: dto.QuestionId,
+				}
+
+				statsByKey[key.Name] = stats
+				statsKeys = append(statsKeys, key)
+			}
+
+			stats.Add(convertDtoAnswerEventToDomainAnswerEvent(dto))
+		}
+
+		if len(eventKeys) == 0 {
+			return nil
+		}
+
+		if len(statsKeys) != 0 {
+			// Add the new counts to the existing QuestionStats.
+			existing := make([]*dtoquestionstats.QuestionStats, len(statsKeys))
+			err := tx.GetMulti(statsKeys, existing)
+			multiErr, isMultiErr := err.(datastore.MultiError)
+			if err != nil && !isMultiErr {
+				return fmt.Errorf("datastore GetMulti() failed: %v", err)
+			}
+
+			statsDtos := make([]*dtoquestionstats.QuestionStats, len(statsKeys))
+			for i, key := range statsKeys {
+				if isMultiErr && multiErr[i] != nil && multiErr[i] != datastore.ErrNoSuchEntity {
+					return fmt.Errorf("datastore GetMulti() failed for key: %v: %v", key, multiErr[i])
+				}
+
+				stats := statsByKey[key.Name]
+				if existing[i] != nil && (!isMultiErr || multiErr[i] == nil) {
+					merged := convertDtoQuestionStatsToDomainQuestionStats(existing[i])
+					merged.Merge(stats)
+					stats = merged
+				}
+
+				statsDtos[i] = convertDomainQuestionStatsToDtoQuestionStats(stats)
+				updated = append(updated, stats)
+			}
+
+			if _, err := tx.PutMulti(statsKeys, statsDtos); err != nil {
+				return fmt.Errorf("datastore PutMulti() failed for QuestionStats: %v", err)
+			}
+		}
+
+		if err := tx.DeleteMulti(eventKeys); err != nil {
+			return fmt.Errorf("datastore DeleteMulti() failed for AnswerEvents: %v", err)
+		}
+
+		result = len(eventKeys)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("RunInTransaction() failed: %v", err)
+	}
+
+	return result, updated, nil
+}
+
+func (db *QuestionStatsRepositoryImpl) GetQuestionStats(c context.Context, quizId string) ([]*domainquestionstats.QuestionStats, error) {
+	q := datastore.NewQuery(DB_KIND_QUESTION_STATS)
+	if len(quizId) != 0 {
+		q = q.FilterField("quizId", "=", quizId)
+	}
+
+	var dtos []*dtoquestionstats.QuestionStats
+	if _, err := db.client.GetAll(c, q, &dtos); err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domainquestionstats.QuestionStats, 0, len(dtos))
+	for _, dto := range dtos {
+		result = append(result, convertDtoQuestionStatsToDomainQuestionStats(dto))
+	}
+
+	return result, nil
+}
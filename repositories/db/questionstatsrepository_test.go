@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuestionStatsRepositoryAggregateAnswerEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	client, err := NewQuestionStatsRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+
+	c := context.Background()
+
+	// Use a unique quiz ID so previous test runs don't affect the counts.
+	quizId := "some-test-quiz-" + time.Now().Format("20060102150405.000000000")
+	questionId := "some-question-id"
+
+	events := []*domainquestionstats.AnswerEvent{
+		domainquestionstats.NewAnswerEvent(quizId, questionId, "some-right-answer", true, false, time.Now()),
+		domainquestionstats.NewAnswerEvent(quizId, questionId, "some-wrong-answer", false, false, time.Now()),
+		domainquestionstats.NewAnswerEvent(quizId, questionId, "", false, true, time.Now()),
+	}
+
+	for _, event := range events {
+		err = client.StoreAnswerEvent(c, event)
+		assert.Nil(t, err)
+	}
+
+	// Wait for the datastore to update its indexes.
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	count, updated, err := client.AggregateAnswerEvents(c, 1000)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, count, len(events))
+
+	var found *domainquestionstats.QuestionStats
+	for _, stats := range updated {
+		if stats.QuizId == quizId {
+			found = stats
+		}
+	}
+
+	assert.NotNil(t, found)
+	assert.Equal(t, 3, found.Answered)
+
+	// The events have been deleted, so they are not counted again.
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+	_, updated, err = client.AggregateAnswerEvents(c, 1000)
+	assert.Nil(t, err)
+	for _, stats := range updated {
+		assert.NotEqual(t, quizId, stats.QuizId)
+	}
+
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+	stats, err := client.GetQuestionStats(c, quizId)
+	assert.Nil(t, err)
+	assert.Len(t, stats, 1)
+
+	assert.Equal(t, questionId, stats[0].QuestionId)
+	assert.Equal(t, 3, stats[0].Answered)
+	assert.Equal(t, 1, stats[0].Correct)
+	assert.Equal(t, 1, stats[0].DontKnow)
+	assert.Equal(t, []domainquestionstats.WrongAnswer{{Answer: "some-wrong-answer", Count: 1}}, stats[0].WrongAnswers)
+}
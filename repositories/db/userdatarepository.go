@@ -4,9 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/datastore"
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	dtogroup "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/group"
 	dtouser "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/user"
 	"github.com/murraycu/go-bigoquiz-server/server/loginserver/oauthparsers"
 	"golang.org/x/oauth2"
@@ -18,6 +25,28 @@ const (
 	DB_KIND_PROFILE     = "UserProfile"
 	DB_KIND_USER_STATS  = "UserStats"
 	DB_KIND_OAUTH_STATE = "OAuthState"
+	DB_KIND_GROUP       = "Group"
+
+	// Each entity's parent is a UserProfile.
+	DB_KIND_USER_DAILY_ACTIVITY = "UserDailyActivity"
+	DB_KIND_USER_STATS_UNDO     = "UserStatsUndo"
+	DB_KIND_USER_SYNC_EVENT     = "UserSyncEvent"
+	DB_KIND_USER_CERTIFICATE    = "UserCertificate"
+
+	// The key's name is the Group's ID.
+	DB_KIND_USER_GROUP_MEMBERSHIP = "UserGroupMembership"
+
+	// Each entity's parent is a Group.
+	DB_KIND_GROUP_ASSIGNMENT = "GroupAssignment"
+
+	// How many times to try a transaction that changes a UserStats,
+	// if other transactions change it at the same time.
+	// Users can answer quickly in several tabs, so this is more than the datastore's default of 3.
+	userStatsTransactionMaxAttempts = 10
+
+	// The maximum number of SyncEvents to delete in one call,
+	// staying well below the datastore's limit of 500 mutations per commit.
+	maxSyncEventsPerDelete = 250
 )
 
 type UserDataRepository interface {
@@ -26,27 +55,91 @@ type UserDataRepository interface {
 	GetUserStatsForQuiz(c context.Context, strUserId string, quizId string) (map[string]*domainuser.Stats, error)
 	GetUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) (*domainuser.Stats, error)
 	StoreUserStats(c context.Context, userID string, stats *domainuser.Stats) error
-	DeleteUserStatsForQuiz(c context.Context, strUserId string, quizId string) error
+	UpdateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, update func(stats *domainuser.Stats) error) (*domainuser.Stats, error)
+	UpdateUserStatsForSectionOnce(c context.Context, strUserId string, quizId string, sectionId string, event *domainuser.SyncEvent, update func(stats *domainuser.Stats) error) (*domainuser.Stats, bool, error)
 
-	StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, error)
-	StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, error)
-	StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, error)
+	// DeleteOldSyncEvents deletes all users' SyncEvents that were synced before the time,
+	// returning the number that were deleted.
+	DeleteOldSyncEvents(c context.Context, before time.Time) (int, error)
+
+	DeleteUserStatsForQuiz(c context.Context, strUserId string, quizId string) error
+	DeleteUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) error
+
+	// UpdateUserStatsForSections is like UpdateUserStatsForSection(), but changes the stats for several sections
+	// in one transaction, so stats can be moved between sections.
+	// update() may remove a section's stats from the map, or set them to nil, to delete them.
+	UpdateUserStatsForSections(c context.Context, strUserId string, quizId string, sectionIds []string, update func(statsBySection map[string]*domainuser.Stats) error) error
+
+	// The user has only one StatsUndo, so storing one replaces any previous one.
+	StoreUserStatsUndo(c context.Context, strUserId string, undo *domainuser.StatsUndo) error
+	GetUserStatsUndo(c context.Context, strUserId string) (*domainuser.StatsUndo, error)
+	DeleteUserStatsUndo(c context.Context, strUserId string) error
+
+	// The user has only one Certificate for each quiz, and for each section,
+	// so storing another one returns the existing one instead, with false.
+	StoreUserCertificateIfNew(c context.Context, strUserId string, certificate *domainuser.Certificate) (*domainuser.Certificate, bool, error)
+	GetUserCertificates(c context.Context, strUserId string) ([]*domainuser.Certificate, error)
+	GetCertificateById(c context.Context, certificateId string) (*domainuser.Certificate, error)
+
+	// The groups, and their members. A user's memberships are deleted with the user, but their groups are not.
+	StoreGroup(c context.Context, group *domaingroup.Group) error
+	GetGroup(c context.Context, groupId string) (*domaingroup.Group, error)
+	GetGroupByInviteCode(c context.Context, inviteCode string) (*domaingroup.Group, error)
+	StoreGroupMembership(c context.Context, membership *domaingroup.Membership) error
+	GetGroupMembership(c context.Context, groupId string, strUserId string) (*domaingroup.Membership, error)
+	GetGroupMemberships(c context.Context, groupId string) ([]*domaingroup.Membership, error)
+	GetUserGroupMemberships(c context.Context, strUserId string) ([]*domaingroup.Membership, error)
+	DeleteGroupMembership(c context.Context, groupId string, strUserId string) error
+
+	StoreGroupAssignment(c context.Context, assignment *domaingroup.Assignment) error
+	GetGroupAssignment(c context.Context, groupId string, assignmentId string) (*domaingroup.Assignment, error)
+	GetGroupAssignments(c context.Context, groupId string) ([]*domaingroup.Assignment, error)
+
+	StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, bool, error)
+	StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, bool, error)
+	StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, bool, error)
 
 	StoreGoogleTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error
 	StoreGitHubTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error
 	StoreFacebookTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error
+
+	StoreUserDailyGoal(c context.Context, strUserId string, timeZone string, goal domainuser.DailyGoal) error
+	UpdateUserDailyActivity(c context.Context, strUserId string, date string, answerIsCorrect bool, learned bool) (bool, error)
+	GetUserDailyActivities(c context.Context, strUserId string) ([]*domainuser.DailyActivity, error)
+
+	// GetUserIdsByEmail returns the IDs of the users whose profiles have the email address.
+	// There may be several, such as when someone logged in with different providers.
+	GetUserIdsByEmail(c context.Context, email string) ([]string, error)
+
+	// GetUserIdByLoginId returns the ID of the user who logged in with the provider's ID for them,
+	// such as Google's "sub" ID, or an empty string if there is none.
+	// provider is one of the config.LOGIN_PROVIDER_* constants.
+	GetUserIdByLoginId(c context.Context, provider string, loginId string) (string, error)
+
+	// GetUserIds returns the IDs of all the users.
+	GetUserIds(c context.Context) ([]string, error)
+
+	// DeleteUser deletes the user's profile, and all their stats, daily activities, and other data.
+	DeleteUser(c context.Context, strUserId string) error
+
+	// Ping checks that the datastore is reachable.
+	Ping(c context.Context) error
+
+	// Close closes the connection to the datastore. The repository may not be used afterwards.
+	Close() error
 }
 
 type UserDataRepositoryImpl struct {
 	client *datastore.Client
 }
 
-func NewUserDataRepository() (UserDataRepository, error) {
+// NewUserDataRepository connects to the Datastore of the Google Cloud project, such as "bigoquiz".
+func NewUserDataRepository(projectId string) (UserDataRepository, error) {
 	result := &UserDataRepositoryImpl{}
 
 	c := context.Background()
 	var err error
-	result.client, err = datastore.NewClient(c, "bigoquiz")
+	result.client, err = datastore.NewClient(c, projectId)
 	if err != nil {
 		return nil, fmt.Errorf("datastore.NewClient() failed: %v", err)
 	}
@@ -54,6 +147,14 @@ func NewUserDataRepository() (UserDataRepository, error) {
 	return result, nil
 }
 
+func (db *UserDataRepositoryImpl) Ping(c context.Context) error {
+	return pingDatastore(c, db.client)
+}
+
+func (db *UserDataRepositoryImpl) Close() error {
+	return db.client.Close()
+}
+
 func (db *UserDataRepositoryImpl) getProfileFromDbQuery(c context.Context, q *datastore.Query) (*datastore.Key, *dtouser.Profile, error) {
 	iter := db.client.Run(c, q)
 	if iter == nil {
@@ -73,22 +174,22 @@ func (db *UserDataRepositoryImpl) getProfileFromDbQuery(c context.Context, q *da
 	return userId, &profile, nil
 }
 
-func (db *UserDataRepositoryImpl) StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (db *UserDataRepositoryImpl) StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
 	return storeOAuthLoginInUserProfile(db, c, userInfo, userInfo.Id, strUserId, token, db.getProfileFromDbByGitHubID, db.updateProfileFromGitHubUserInfo)
 }
 
-func (db *UserDataRepositoryImpl) StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (db *UserDataRepositoryImpl) StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
 	return storeOAuthLoginInUserProfile(db, c, userInfo, userInfo.Id, strUserId, token, db.getProfileFromDbByFacebookID, db.updateProfileFromFacebookUserInfo)
 }
 
-func (db *UserDataRepositoryImpl) StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (db *UserDataRepositoryImpl) StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
 	return storeOAuthLoginInUserProfile(db, c, userInfo, userInfo.Sub, strUserId, token, db.getProfileFromDbByGoogleID, db.updateProfileFromGoogleUserInfo)
 }
 
-func storeOAuthLoginInUserProfile[OAuthUserInfo any, ID any](db *UserDataRepositoryImpl, c context.Context, userInfo OAuthUserInfo, id ID, strUserId string, token *oauth2.Token, getProfileByOAuthId func(context.Context, ID) (*datastore.Key, *dtouser.Profile, error), updateProfile func(*dtouser.Profile, *OAuthUserInfo, *oauth2.Token) error) (string, error) {
+func storeOAuthLoginInUserProfile[OAuthUserInfo any, ID any](db *UserDataRepositoryImpl, c context.Context, userInfo OAuthUserInfo, id ID, strUserId string, token *oauth2.Token, getProfileByOAuthId func(context.Context, ID) (*datastore.Key, *dtouser.Profile, error), updateProfile func(*dtouser.Profile, *OAuthUserInfo, *oauth2.Token) error) (string, bool, error) {
 	userIdFound, profile, err := getProfileByOAuthId(c, id)
 	if err != nil {
-		return "", fmt.Errorf("getProfileByOAuthId() failed: %v", err)
+		return "", false, fmt.Errorf("getProfileByOAuthId() failed: %v", err)
 	}
 
 	var userId *datastore.Key
@@ -99,39 +200,41 @@ func storeOAuthLoginInUserProfile[OAuthUserInfo any, ID any](db *UserDataReposit
 	} else if len(strUserId) != 0 {
 		userId, err = datastore.DecodeKey(strUserId)
 		if err != nil {
-			return "", fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+			return "", false, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
 		}
 
 		// Try getting it via the supplied userID instead:
 		profile, err = db.getProfileFromDbByUserID(c, userId)
 		if err != nil {
-			return "", fmt.Errorf("getProfileFromDbByUserID() failed")
+			return "", false, fmt.Errorf("getProfileFromDbByUserID() failed")
 		}
 	}
 
+	created := false
 	if profile == nil {
 		// It is not in the datastore yet, so we add it.
+		created = true
 		profile = new(dtouser.Profile)
 		if err := updateProfile(profile, &userInfo, token); err != nil {
-			return "", fmt.Errorf("updateProfile() failed (new profile): %v", err)
+			return "", false, fmt.Errorf("updateProfile() failed (new profile): %v", err)
 		}
 
 		userId = datastore.IncompleteKey(DB_KIND_PROFILE, nil)
 		if userId, err = db.client.Put(c, userId, profile); err != nil {
-			return "", fmt.Errorf("datastore Put(with incomplete userId %v) failed: %v", userId, err)
+			return "", false, fmt.Errorf("datastore Put(with incomplete userId %v) failed: %v", userId, err)
 		}
 	} else if userId != nil {
 		// Update the Profile:
 		if err := updateProfile(profile, &userInfo, token); err != nil {
-			return "", fmt.Errorf("updateProfile() failed: %v", err)
+			return "", false, fmt.Errorf("updateProfile() failed: %v", err)
 		}
 
 		if userId, err = db.client.Put(c, userId, profile); err != nil {
-			return "", fmt.Errorf("datastore Put(with userId %v) failed: %v", userId, err)
+			return "", false, fmt.Errorf("datastore Put(with userId %v) failed: %v", userId, err)
 		}
 	}
 
-	return userId.Encode(), nil
+	return userId.Encode(), created, nil
 }
 
 func (db *UserDataRepositoryImpl) StoreGitHubTokenInUserProfile(c context.Context, userId string, token *oauth2.Token) error {
@@ -179,7 +282,7 @@ func storeOAuthTokenInUserProfile(db *UserDataRepositoryImpl, c context.Context,
 
 func (db *UserDataRepositoryImpl) getProfileFromDbByGitHubID(c context.Context, id int) (*datastore.Key, *dtouser.Profile, error) {
 	q := datastore.NewQuery(DB_KIND_PROFILE).
-		Filter("githubId =", id).
+		Filter("gitHubId =", id).
 		Limit(1)
 	return db.getProfileFromDbQuery(c, q)
 }
@@ -198,6 +301,122 @@ func (db *UserDataRepositoryImpl) getProfileFromDbByGoogleID(c context.Context,
 	return db.getProfileFromDbQuery(c, q)
 }
 
+func (db *UserDataRepositoryImpl) GetUserIdsByEmail(c context.Context, email string) ([]string, error) {
+	// In case an empty value could find all the users who have no email address:
+	if len(email) == 0 {
+		return nil, fmt.Errorf("GetUserIdsByEmail(): email is empty")
+	}
+
+	q := datastore.NewQuery(DB_KIND_PROFILE).
+		Filter("email =", email).
+		KeysOnly()
+	keys, err := db.client.GetAll(c, q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key.Encode())
+	}
+
+	return result, nil
+}
+
+func (db *UserDataRepositoryImpl) GetUserIdByLoginId(c context.Context, provider string, loginId string) (string, error) {
+	if len(loginId) == 0 {
+		return "", fmt.Errorf("GetUserIdByLoginId(): loginId is empty")
+	}
+
+	var userId *datastore.Key
+	var err error
+	switch provider {
+	case config.LOGIN_PROVIDER_GOOGLE:
+		userId, _, err = db.getProfileFromDbByGoogleID(c, loginId)
+	case config.LOGIN_PROVIDER_GITHUB:
+		id, parseErr := strconv.Atoi(loginId)
+		if parseErr != nil {
+			return "", fmt.Errorf("GitHub IDs are numbers: %q", loginId)
+		}
+
+		userId, _, err = db.getProfileFromDbByGitHubID(c, id)
+	case config.LOGIN_PROVIDER_FACEBOOK:
+		userId, _, err = db.getProfileFromDbByFacebookID(c, loginId)
+	default:
+		return "", fmt.Errorf("unknown login provider: %q", provider)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("getProfileFromDbBy*ID() failed: %v", err)
+	}
+
+	if userId == nil {
+		return "", nil
+	}
+
+	return userId.Encode(), nil
+}
+
+func (db *UserDataRepositoryImpl) GetUserIds(c context.Context) ([]string, error) {
+	q := datastore.NewQuery(DB_KIND_PROFILE).
+		KeysOnly()
+	keys, err := db.client.GetAll(c, q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key.Encode())
+	}
+
+	return result, nil
+}
+
+// The maximum number of entities that the datastore deletes in one call.
+const deleteBatchSize = 500
+
+func (db *UserDataRepositoryImpl) DeleteUser(c context.Context, strUserId string) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	// In case a nil value could lead to deleting all users' data:
+	if userId == nil {
+		return fmt.Errorf("DeleteUser(): userId is nil")
+	}
+
+	// Stats stored before they had the profile as their parent. See userStatsKey().
+	if err := db.deleteUserStats(c, db.getQueryForUserStats(userId)); err != nil {
+		return fmt.Errorf("deleteUserStats() failed: %v", err)
+	}
+
+	// Everything whose ancestor is the profile, of any kind, and the profile itself.
+	q := datastore.NewQuery("").
+		Ancestor(userId).
+		KeysOnly()
+	keys, err := db.client.GetAll(c, q, nil)
+	if err != nil {
+		return fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	// Delete the profile last, so a failed deletion can be tried again, finding the rest via the same user ID.
+	keys = slices.DeleteFunc(keys, func(key *datastore.Key) bool {
+		return key.Equal(userId)
+	})
+	keys = append(keys, userId)
+
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(keys))
+		if err := db.client.DeleteMulti(c, keys[start:end]); err != nil {
+			return fmt.Errorf("datastore DeleteMulti() failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
 func (db *UserDataRepositoryImpl) getProfileFromDbByUserID(c context.Context, userId *datastore.Key) (*dtouser.Profile, error) {
 	var profile dtouser.Profile
 	err := db.client.Get(c, userId, &profile)
@@ -242,7 +461,7 @@ func (db *UserDataRepositoryImpl) GetUserProfileById(c context.Context, strUserI
 * ignoring the question histories,
 * without changing this instance.
  */
-func createCombinedUserStatsWithoutQuestionHistories(self *domainuser.Stats, stats *dtouser.Stats) *domainuser.Stats {
+func createCombinedUserStatsWithoutQuestionHistories(self *domainuser.Stats, stats *domainuser.Stats) *domainuser.Stats {
 	if stats == nil {
 		return self
 	}
@@ -256,6 +475,9 @@ func createCombinedUserStatsWithoutQuestionHistories(self *domainuser.Stats, sta
 	result.CountQuestionsAnsweredOnce = self.CountQuestionsAnsweredOnce + stats.CountQuestionsAnsweredOnce
 	result.CountQuestionsCorrectOnce = self.CountQuestionsCorrectOnce + stats.CountQuestionsCorrectOnce
 
+	result.CountQuestionsMastered = self.CountQuestionsMastered + stats.CountQuestionsMastered
+	result.MasterySum = self.MasterySum + stats.MasterySum
+
 	return &result
 }
 
@@ -312,7 +534,7 @@ func (db *UserDataRepositoryImpl) GetUserStats(c context.Context, strUserId stri
 			existing.QuizId = quizId
 		}
 
-		combinedStats := createCombinedUserStatsWithoutQuestionHistories(existing, &stats)
+		combinedStats := createCombinedUserStatsWithoutQuestionHistories(existing, convertDtoStatsToDomainStats(&stats))
 		result[stats.QuizId] = combinedStats
 	}
 
@@ -378,104 +600,410 @@ func (db *UserDataRepositoryImpl) GetUserStatsForQuiz(c context.Context, strUser
 
 // Get the stats for a specific section ID, from the database.
 func (db *UserDataRepositoryImpl) GetUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) (*domainuser.Stats, error) {
-	stats, err := db.getUserStatsForSectionAsDto(c, quizId, sectionId, strUserId)
+	userId, err := datastore.DecodeKey(strUserId)
 	if err != nil {
-		return nil, fmt.Errorf("getUserStatsForSectionAsDto() failed: %v", err)
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
 	}
 
-	if stats == nil {
-		// This is not an error.
-		// There are just no stats stored yet for this section.
-		return nil, nil
+	key := userStatsKey(userId, quizId, sectionId)
+
+	var stats dtouser.Stats
+	err = db.client.Get(c, key, &stats)
+	if err == datastore.ErrNoSuchEntity {
+		legacyStats, err := db.getLegacyUserStatsForSectionAsDto(c, userId, quizId, sectionId)
+		if err != nil {
+			return nil, fmt.Errorf("getLegacyUserStatsForSectionAsDto() failed: %v", err)
+		}
+
+		if legacyStats == nil {
+			// This is not an error.
+			// There are just no stats stored yet for this section.
+			return nil, nil
+		}
+
+		return convertDtoStatsToDomainStats(legacyStats), nil
+	}
+
+	if err != nil && !isErrFieldMismatch(err) {
+		return nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
 	}
 
-	return convertDtoStatsToDomainStats(stats), nil
+	return convertDtoStatsToDomainStats(&stats), nil
 }
 
-func (db *UserDataRepositoryImpl) getUserStatsForSectionAsDto(c context.Context, quizId string, sectionId string, strUserId string) (*dtouser.Stats, error) {
-	userId, err := datastore.DecodeKey(strUserId)
-	if err != nil {
-		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
-	}
+// userStatsKey returns the key for the user's stats for the section.
+// UserStats entities stored before we used these keys have IDs generated by the datastore,
+// and no parent. See getLegacyUserStatsForSectionAsDto().
+func userStatsKey(userId *datastore.Key, quizId string, sectionId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_STATS, quizId+"/"+sectionId, userId)
+}
+
+func isErrFieldMismatch(err error) bool {
+	// Ignore errors caused by old fields in the datastore that are no longer mentioned in our Go struct.
+	_, ok := err.(*datastore.ErrFieldMismatch)
+	return ok
+}
 
+// getLegacyUserStatsForSectionAsDto gets the user's stats for the section,
+// if they were stored before we used userStatsKey(),
+// returning nil if there are none.
+func (db *UserDataRepositoryImpl) getLegacyUserStatsForSectionAsDto(c context.Context, userId *datastore.Key, quizId string, sectionId string) (*dtouser.Stats, error) {
 	// Get the Stats from the db, for this section:
 	// TODO: Remove duplicates if there is more than one?
 	q := db.getQueryForUserStatsForQuiz(userId, quizId).
-		Filter("sectionId =", sectionId).
-		Limit(1)
+		Filter("sectionId =", sectionId)
 	iter := db.client.Run(c, q)
 	if iter == nil {
 		return nil, fmt.Errorf("datastore query for Stats failed")
 	}
 
-	var stats dtouser.Stats
-	key, err := iter.Next(&stats)
-	if err != nil {
+	for {
+		var stats dtouser.Stats
+		key, err := iter.Next(&stats)
 		if err == iterator.Done {
 			// It was not found.
 			return nil, nil
-		} else {
-			if _, ok := err.(*datastore.ErrFieldMismatch); ok {
-				// Ignore these errors during development,
-				// TODO: Remove this for production,
-				// because it then gives us a Stats instance in an unpredictable state.
-			} else {
-				return nil, fmt.Errorf("iter.Next() failed: %v", err)
+		}
+
+		if err != nil && !isErrFieldMismatch(err) {
+			return nil, fmt.Errorf("iter.Next() failed: %v", err)
+		}
+
+		if key.Parent != nil {
+			// This is not a legacy entity.
+			// We might find it here just after a transaction has migrated the legacy entity.
+			continue
+		}
+
+		stats.Key = key
+		// See the comment on user.Stats.Key
+		return &stats, nil
+	}
+}
+
+// StoreUserStats stores the stats for the section, replacing any existing stats for the section.
+// To change the existing stats, use UpdateUserStatsForSection() instead,
+// so changes made at the same time are not lost.
+func (db *UserDataRepositoryImpl) StoreUserStats(c context.Context, strUserId string, stats *domainuser.Stats) error {
+	_, err := db.UpdateUserStatsForSection(c, strUserId, stats.QuizId, stats.SectionId, func(existing *domainuser.Stats) error {
+		*existing = *stats
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateUserStatsForSection() failed: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateUserStatsForSection calls update() with the user's current stats for the section,
+// or with new empty stats, and stores the changed stats,
+// all in one transaction, so changes made at the same time, for instance in other browser tabs, are not lost.
+// update() will be called again if the transaction must be retried,
+// so it should not have other side effects.
+// This returns the stored stats.
+func (db *UserDataRepositoryImpl) UpdateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, update func(stats *domainuser.Stats) error) (*domainuser.Stats, error) {
+	result, _, err := db.updateUserStatsForSection(c, strUserId, quizId, sectionId, nil, update)
+	return result, err
+}
+
+func syncEventKey(userId *datastore.Key, eventId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_SYNC_EVENT, eventId, userId)
+}
+
+// UpdateUserStatsForSectionOnce is like UpdateUserStatsForSection(),
+// but only changes the stats once for the event's ID,
+// so a client may safely send the same answer again, for instance after a lost response.
+// If the event has a Date, this also adds the answer to the user's daily activity, in the same transaction,
+// so the activity is also only changed once.
+// This returns false, and the unchanged stats, if the event was already applied.
+func (db *UserDataRepositoryImpl) UpdateUserStatsForSectionOnce(c context.Context, strUserId string, quizId string, sectionId string, event *domainuser.SyncEvent, update func(stats *domainuser.Stats) error) (*domainuser.Stats, bool, error) {
+	if event == nil || len(event.EventId) == 0 {
+		return nil, false, fmt.Errorf("UpdateUserStatsForSectionOnce(): the event ID is empty")
+	}
+
+	return db.updateUserStatsForSection(c, strUserId, quizId, sectionId, event, update)
+}
+
+func (db *UserDataRepositoryImpl) DeleteOldSyncEvents(c context.Context, before time.Time) (int, error) {
+	q := datastore.NewQuery(DB_KIND_USER_SYNC_EVENT).
+		FilterField("synced", "<", before).
+		KeysOnly()
+
+	result := 0
+	var toDelete []*datastore.Key
+	deleteBatch := func() error {
+		if err := db.client.DeleteMulti(c, toDelete); err != nil {
+			return fmt.Errorf("datastore DeleteMulti() failed: %v", err)
+		}
+
+		result += len(toDelete)
+		toDelete = toDelete[:0]
+		return nil
+	}
+
+	// The iterator pages through the results, so there may be any number of them.
+	it := db.client.Run(c, q)
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("datastore iter.Next() failed: %v", err)
+		}
+
+		toDelete = append(toDelete, key)
+		if len(toDelete) == maxSyncEventsPerDelete {
+			if err := deleteBatch(); err != nil {
+				return result, err
 			}
 		}
 	}
 
-	stats.Key = key
-	// See the comment on user.Stats.Key
-	return &stats, nil
+	if len(toDelete) != 0 {
+		if err := deleteBatch(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
 }
 
-func (db *UserDataRepositoryImpl) StoreUserStats(c context.Context, userID string, stats *domainuser.Stats) error {
-	if len(stats.QuizId) == 0 {
-		return fmt.Errorf("StoreUserStats(): QuizId is empty")
+func (db *UserDataRepositoryImpl) UpdateUserStatsForSections(c context.Context, strUserId string, quizId string, sectionIds []string, update func(statsBySection map[string]*domainuser.Stats) error) error {
+	if len(quizId) == 0 {
+		return fmt.Errorf("UpdateUserStatsForSections(): quizId is empty")
 	}
 
-	if len(stats.SectionId) == 0 {
-		return fmt.Errorf("StoreUserStats(): SectionId is empty")
+	if slices.Contains(sectionIds, "") {
+		return fmt.Errorf("UpdateUserStatsForSections(): a sectionId is empty")
 	}
 
-	dtoOldStats, err := db.getUserStatsForSectionAsDto(c, stats.QuizId, stats.SectionId, userID)
+	userId, err := datastore.DecodeKey(strUserId)
 	if err != nil {
-		return fmt.Errorf("getUserStatsForSectionAsDto() failed: %v", err)
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
 	}
 
-	dtoStats, err := convertDomainStatsToDtoStats(stats, userID)
+	err = db.runInTransactionWithRetries(c, userStatsTransactionMaxAttempts, func(tx *datastore.Transaction) error {
+		statsBySection := make(map[string]*domainuser.Stats, len(sectionIds))
+		legacyKeys := make(map[string]*datastore.Key)
+		for _, sectionId := range sectionIds {
+			dto, legacyKey, err := db.getUserStatsInTransaction(c, tx, userId, quizId, sectionId)
+			if err != nil {
+				return err
+			}
+
+			stats := convertDtoStatsToDomainStats(dto)
+			stats.QuizId = quizId
+			stats.SectionId = sectionId
+			statsBySection[sectionId] = stats
+
+			if legacyKey != nil {
+				legacyKeys[sectionId] = legacyKey
+			}
+		}
+
+		if err := update(statsBySection); err != nil {
+			return fmt.Errorf("update() failed: %v", err)
+		}
+
+		for _, sectionId := range sectionIds {
+			key := userStatsKey(userId, quizId, sectionId)
+
+			stats, ok := statsBySection[sectionId]
+			if ok && stats != nil {
+				// In case update() replaced them:
+				stats.QuizId = quizId
+				stats.SectionId = sectionId
+
+				dtoStats, err := convertDomainStatsToDtoStats(stats, strUserId)
+				if err != nil {
+					return fmt.Errorf("convertDomainStatsToDtoStats() failed: %v", err)
+				}
+
+				if _, err := tx.Put(key, dtoStats); err != nil {
+					return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+				}
+			} else if err := tx.Delete(key); err != nil {
+				return fmt.Errorf("datastore Delete() failed with key: %v: %v", key, err)
+			}
+
+			if legacyKey, ok := legacyKeys[sectionId]; ok {
+				if err := tx.Delete(legacyKey); err != nil {
+					return fmt.Errorf("datastore Delete() failed with key: %v: %v", legacyKey, err)
+				}
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("convertDomainStatsToDtoStats() failed: %v", err)
+		return fmt.Errorf("runInTransactionWithRetries() failed: %w", err)
+	}
+
+	return nil
+}
+
+// updateUserStatsForSection implements UpdateUserStatsForSection() and UpdateUserStatsForSectionOnce().
+// event may be nil.
+func (db *UserDataRepositoryImpl) updateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, event *domainuser.SyncEvent, update func(stats *domainuser.Stats) error) (*domainuser.Stats, bool, error) {
+	if len(quizId) == 0 {
+		return nil, false, fmt.Errorf("UpdateUserStatsForSection(): quizId is empty")
 	}
 
-	// Use an existing key, to replace the existing entity, if one exists,
-	// instead of just adding another one.
-	if dtoOldStats != nil {
-		dtoStats.Key = dtoOldStats.Key
+	if len(sectionId) == 0 {
+		return nil, false, fmt.Errorf("UpdateUserStatsForSection(): sectionId is empty")
 	}
 
-	key := dtoStats.Key
-	if key == nil {
-		// It hasn't been updated yet.
-		//
-		// Note: Don't store the key in stats.Key - that confuses the datastore API,
-		// (but without any error being returned to our code.)
-		// so we won't be able to read the entity back later.
-		// That also results in an error when trying to list the UserStats entities in dev_server.py's
-		// Datastore Viewer:
-		// "in ValidatePropertyKey 'Incomplete key found for reference property %s.' % name)
-		// BadValueError: Incomplete key found for reference property Key."
-		key = datastore.IncompleteKey(DB_KIND_USER_STATS, nil)
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, false, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
 	}
 
-	if key, err = db.client.Put(c, key, dtoStats); err != nil {
-		return fmt.Errorf("StoreUserStats(): datastore Put() failed: %v", err)
+	key := userStatsKey(userId, quizId, sectionId)
+
+	var eventKey *datastore.Key
+	if event != nil {
+		eventKey = syncEventKey(userId, event.EventId)
 	}
 
-	// TODO: stats.UserId = key // See the comment on Stats.Key.
+	var result *domainuser.Stats
+	var applied bool
+	err = db.runInTransactionWithRetries(c, userStatsTransactionMaxAttempts, func(tx *datastore.Transaction) error {
+		applied = false
+
+		alreadyApplied := false
+		if eventKey != nil {
+			var eventDto dtouser.SyncEvent
+			err := tx.Get(eventKey, &eventDto)
+			if err == nil {
+				alreadyApplied = true
+			} else if err != datastore.ErrNoSuchEntity && !isErrFieldMismatch(err) {
+				return fmt.Errorf("datastore Get() failed with key: %v: %v", eventKey, err)
+			}
+		}
 
-	return nil
+		dto, legacyKey, err := db.getUserStatsInTransaction(c, tx, userId, quizId, sectionId)
+		if err != nil {
+			return err
+		}
+
+		stats := convertDtoStatsToDomainStats(dto)
+		stats.QuizId = quizId
+		stats.SectionId = sectionId
+
+		if alreadyApplied {
+			result = stats
+			return nil
+		}
+
+		countQuestionsCorrectOnceBefore := stats.CountQuestionsCorrectOnce
+		if err := update(stats); err != nil {
+			return fmt.Errorf("update() failed: %v", err)
+		}
+
+		// In case update() replaced them:
+		stats.QuizId = quizId
+		stats.SectionId = sectionId
+
+		dtoStats, err := convertDomainStatsToDtoStats(stats, strUserId)
+		if err != nil {
+			return fmt.Errorf("convertDomainStatsToDtoStats() failed: %v", err)
+		}
+
+		if _, err := tx.Put(key, dtoStats); err != nil {
+			return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+		}
+
+		if legacyKey != nil {
+			if err := tx.Delete(legacyKey); err != nil {
+				return fmt.Errorf("datastore Delete() failed with key: %v: %v", legacyKey, err)
+			}
+		}
+
+		if eventKey != nil {
+			eventDto := convertDomainSyncEventToDtoSyncEvent(event)
+			if _, err := tx.Put(eventKey, eventDto); err != nil {
+				return fmt.Errorf("datastore Put() failed with key: %v: %v", eventKey, err)
+			}
+
+			if len(event.Date) != 0 {
+				learned := stats.CountQuestionsCorrectOnce > countQuestionsCorrectOnceBefore
+				if _, err := updateUserDailyActivityInTransaction(tx, userId, event.Date, event.Correct, learned); err != nil {
+					return fmt.Errorf("updateUserDailyActivityInTransaction() failed: %v", err)
+				}
+			}
+		}
+
+		result = stats
+		applied = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("runInTransactionWithRetries() failed: %w", err)
+	}
+
+	return result, applied, nil
+}
+
+// getUserStatsInTransaction gets the user's stats for the section, or empty stats if there are none.
+// If the stats were stored without userStatsKey(), this also returns their key,
+// so they can be replaced by stats with the userStatsKey().
+func (db *UserDataRepositoryImpl) getUserStatsInTransaction(c context.Context, tx *datastore.Transaction, userId *datastore.Key, quizId string, sectionId string) (*dtouser.Stats, *datastore.Key, error) {
+	key := userStatsKey(userId, quizId, sectionId)
+
+	var dto dtouser.Stats
+	err := tx.Get(key, &dto)
+	if err == nil || isErrFieldMismatch(err) {
+		return &dto, nil, nil
+	} else if err != datastore.ErrNoSuchEntity {
+		return nil, nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	// Queries cannot be part of the transaction, unless they are ancestor queries,
+	// but getting the entity again, via tx.Get(), makes the transaction fail
+	// if another transaction has already changed or migrated it.
+	legacyDto, err := db.getLegacyUserStatsForSectionAsDto(c, userId, quizId, sectionId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getLegacyUserStatsForSectionAsDto() failed: %v", err)
+	}
+
+	dto = dtouser.Stats{}
+	if legacyDto == nil {
+		return &dto, nil, nil
+	}
+
+	err = tx.Get(legacyDto.Key, &dto)
+	if err == datastore.ErrNoSuchEntity {
+		// Another transaction migrated it since our query.
+		return nil, nil, datastore.ErrConcurrentTransaction
+	}
+
+	if err != nil && !isErrFieldMismatch(err) {
+		return nil, nil, fmt.Errorf("datastore Get() failed with key: %v: %v", legacyDto.Key, err)
+	}
+
+	return &dto, legacyDto.Key, nil
+}
+
+// runInTransactionWithRetries is like datastore.Client.RunInTransaction(),
+// but f() may also return datastore.ErrConcurrentTransaction to try again,
+// for instance when it discovers a change that the transaction could not detect itself.
+// f() may wrap datastore.ErrConcurrentTransaction with %w.
+func (db *UserDataRepositoryImpl) runInTransactionWithRetries(c context.Context, maxAttempts int, f func(tx *datastore.Transaction) error) error {
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		_, err = db.client.RunInTransaction(c, f, datastore.MaxAttempts(1))
+		if !errors.Is(err, datastore.ErrConcurrentTransaction) {
+			return err
+		}
+
+		// The context has the request's ID, so this can be matched with the request.
+		slog.DebugContext(c, "transaction conflict", "attempt", attempt+1, "maxAttempts", maxAttempts)
+	}
+
+	return err
 }
 
 func (db *UserDataRepositoryImpl) getQueryForUserStats(userId *datastore.Key) *datastore.Query {
@@ -505,6 +1033,33 @@ func (db *UserDataRepositoryImpl) DeleteUserStatsForQuiz(c context.Context, strU
 	}
 
 	q := db.getQueryForUserStatsForQuiz(userId, quizId)
+	return db.deleteUserStats(c, q)
+}
+
+func (db *UserDataRepositoryImpl) DeleteUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	// In case a nil value could lead to deleting all users' stats:
+	if userId == nil {
+		return fmt.Errorf("DeleteUserStatsForSection(): userId is nil")
+	}
+
+	// In case an empty value could lead to deleting all quizzes' or sections' stats:
+	if len(quizId) == 0 || len(sectionId) == 0 {
+		return fmt.Errorf("DeleteUserStatsForSection(): quizId or sectionId is empty")
+	}
+
+	// This deletes any duplicates too.
+	q := db.getQueryForUserStatsForQuiz(userId, quizId).
+		Filter("sectionId =", sectionId)
+	return db.deleteUserStats(c, q)
+}
+
+// deleteUserStats deletes all the UserStats entities found by the query.
+func (db *UserDataRepositoryImpl) deleteUserStats(c context.Context, q *datastore.Query) error {
 	q = q.KeysOnly()
 	iter := db.client.Run(c, q)
 
@@ -637,3 +1192,530 @@ func (db *UserDataRepositoryImpl) updateProfileFromFacebookUserInfo(profile *dto
 
 	return nil
 }
+
+// StoreUserDailyGoal stores the user's daily goal, and the time zone used to decide when each day starts.
+func (db *UserDataRepositoryImpl) StoreUserDailyGoal(c context.Context, strUserId string, timeZone string, goal domainuser.DailyGoal) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	_, err = db.client.RunInTransaction(c, func(tx *datastore.Transaction) error {
+		var profile dtouser.Profile
+		err := tx.Get(userId, &profile)
+		if err != nil {
+			// Ignore errors caused by old fields in the datastore that are no longer mentioned in our Go struct.
+			if _, ok := err.(*datastore.ErrFieldMismatch); !ok {
+				return fmt.Errorf("datastore Get() failed with key: %v: %v", userId, err)
+			}
+		}
+
+		profile.TimeZone = timeZone
+		profile.DailyGoalType = goal.Type
+		profile.DailyGoalTarget = goal.Target
+
+		if _, err := tx.Put(userId, &profile); err != nil {
+			return fmt.Errorf("datastore Put() failed with key: %v: %v", userId, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("RunInTransaction() failed: %v", err)
+	}
+
+	return nil
+}
+
+func dailyActivityKey(userId *datastore.Key, date string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_DAILY_ACTIVITY, date, userId)
+}
+
+// UpdateUserDailyActivity adds one answer to the user's activity for the day.
+// date should be in the user's time zone, in domainuser.DailyActivityDateLayout format.
+// This returns true if this was the user's first answer on that day.
+func (db *UserDataRepositoryImpl) UpdateUserDailyActivity(c context.Context, strUserId string, date string, answerIsCorrect bool, learned bool) (bool, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return false, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	if len(date) == 0 {
+		return false, fmt.Errorf("UpdateUserDailyActivity(): date is empty")
+	}
+
+	var first bool
+	_, err = db.client.RunInTransaction(c, func(tx *datastore.Transaction) error {
+		var err error
+		first, err = updateUserDailyActivityInTransaction(tx, userId, date, answerIsCorrect, learned)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("RunInTransaction() failed: %v", err)
+	}
+
+	return first, nil
+}
+
+// updateUserDailyActivityInTransaction implements UpdateUserDailyActivity(),
+// so the activity can also be updated in other transactions.
+func updateUserDailyActivityInTransaction(tx *datastore.Transaction, userId *datastore.Key, date string, answerIsCorrect bool, learned bool) (bool, error) {
+	key := dailyActivityKey(userId, date)
+
+	var dto dtouser.DailyActivity
+	err := tx.Get(key, &dto)
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return false, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	first := err == datastore.ErrNoSuchEntity
+
+	activity := convertDtoDailyActivityToDomainDailyActivity(&dto)
+	activity.Date = date
+	activity.Add(answerIsCorrect, learned)
+
+	dto = dtouser.DailyActivity{
+		Date:     activity.Date,
+		Answered: activity.Answered,
+		Correct:  activity.Correct,
+		Learned:  activity.Learned,
+	}
+
+	if _, err := tx.Put(key, &dto); err != nil {
+		return false, fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+	}
+
+	return first, nil
+}
+
+// GetUserDailyActivities gets the user's activity for all days on which the user answered any questions.
+func (db *UserDataRepositoryImpl) GetUserDailyActivities(c context.Context, strUserId string) ([]*domainuser.DailyActivity, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	// In case a nil value could lead to getting all users' activities:
+	if userId == nil {
+		return nil, fmt.Errorf("GetUserDailyActivities(): userId is nil")
+	}
+
+	q := datastore.NewQuery(DB_KIND_USER_DAILY_ACTIVITY).
+		Ancestor(userId)
+
+	var dtos []*dtouser.DailyActivity
+	if _, err := db.client.GetAll(c, q, &dtos); err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domainuser.DailyActivity, 0, len(dtos))
+	for _, dto := range dtos {
+		result = append(result, convertDtoDailyActivityToDomainDailyActivity(dto))
+	}
+
+	return result, nil
+}
+
+func userStatsUndoKey(userId *datastore.Key) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_STATS_UNDO, "latest", userId)
+}
+
+func (db *UserDataRepositoryImpl) StoreUserStatsUndo(c context.Context, strUserId string, undo *domainuser.StatsUndo) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	dto, err := convertDomainStatsUndoToDtoStatsUndo(undo)
+	if err != nil {
+		return fmt.Errorf("convertDomainStatsUndoToDtoStatsUndo() failed: %v", err)
+	}
+
+	key := userStatsUndoKey(userId)
+	if _, err := db.client.Put(c, key, dto); err != nil {
+		return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetUserStatsUndo returns the user's StatsUndo, even if it has expired, or nil if there is none.
+func (db *UserDataRepositoryImpl) GetUserStatsUndo(c context.Context, strUserId string) (*domainuser.StatsUndo, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := userStatsUndoKey(userId)
+
+	var dto dtouser.StatsUndo
+	err = db.client.Get(c, key, &dto)
+	if err == datastore.ErrNoSuchEntity {
+		// This is not an error.
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	result, err := convertDtoStatsUndoToDomainStatsUndo(&dto)
+	if err != nil {
+		return nil, fmt.Errorf("convertDtoStatsUndoToDomainStatsUndo() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+func (db *UserDataRepositoryImpl) DeleteUserStatsUndo(c context.Context, strUserId string) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := userStatsUndoKey(userId)
+	if err := db.client.Delete(c, key); err != nil {
+		return fmt.Errorf("datastore Delete() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// The key's name ends with a slash for the whole quiz, so it cannot clash with a section's certificate.
+func userCertificateKey(userId *datastore.Key, quizId string, sectionId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_CERTIFICATE, quizId+"/"+sectionId, userId)
+}
+
+// StoreUserCertificateIfNew stores the certificate, unless the user already has one for the same quiz, or section,
+// returning the stored certificate, and true if it is the new one.
+func (db *UserDataRepositoryImpl) StoreUserCertificateIfNew(c context.Context, strUserId string, certificate *domainuser.Certificate) (*domainuser.Certificate, bool, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, false, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := userCertificateKey(userId, certificate.QuizId, certificate.SectionId)
+
+	var result *domainuser.Certificate
+	var stored bool
+	_, err = db.client.RunInTransaction(c, func(tx *datastore.Transaction) error {
+		var dto dtouser.Certificate
+		err := tx.Get(key, &dto)
+		if err == nil {
+			result = convertDtoCertificateToDomainCertificate(&dto, strUserId)
+			stored = false
+			return nil
+		}
+
+		if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+		}
+
+		if _, err := tx.Put(key, convertDomainCertificateToDtoCertificate(certificate)); err != nil {
+			return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+		}
+
+		result = certificate
+		stored = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("RunInTransaction() failed: %v", err)
+	}
+
+	return result, stored, nil
+}
+
+// GetUserCertificates returns all the user's certificates.
+func (db *UserDataRepositoryImpl) GetUserCertificates(c context.Context, strUserId string) ([]*domainuser.Certificate, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	// In case a nil value could lead to getting all users' certificates:
+	if userId == nil {
+		return nil, fmt.Errorf("GetUserCertificates(): userId is nil")
+	}
+
+	q := datastore.NewQuery(DB_KIND_USER_CERTIFICATE).
+		Ancestor(userId)
+
+	var dtos []*dtouser.Certificate
+	if _, err := db.client.GetAll(c, q, &dtos); err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domainuser.Certificate, 0, len(dtos))
+	for _, dto := range dtos {
+		result = append(result, convertDtoCertificateToDomainCertificate(dto, strUserId))
+	}
+
+	return result, nil
+}
+
+// GetCertificateById returns the certificate, of any user, or nil if there is none.
+func (db *UserDataRepositoryImpl) GetCertificateById(c context.Context, certificateId string) (*domainuser.Certificate, error) {
+	if len(certificateId) == 0 {
+		return nil, nil
+	}
+
+	q := datastore.NewQuery(DB_KIND_USER_CERTIFICATE).
+		FilterField("id", "=", certificateId).
+		Limit(1)
+
+	var dtos []*dtouser.Certificate
+	keys, err := db.client.GetAll(c, q, &dtos)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	if len(dtos) == 0 {
+		return nil, nil
+	}
+
+	var userId string
+	if parent := keys[0].Parent; parent != nil {
+		userId = parent.Encode()
+	}
+
+	return convertDtoCertificateToDomainCertificate(dtos[0], userId), nil
+}
+
+func groupKey(groupId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_GROUP, groupId, nil)
+}
+
+func groupMembershipKey(userId *datastore.Key, groupId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_USER_GROUP_MEMBERSHIP, groupId, userId)
+}
+
+func (db *UserDataRepositoryImpl) StoreGroup(c context.Context, group *domaingroup.Group) error {
+	if len(group.Id) == 0 {
+		return fmt.Errorf("StoreGroup(): the group's ID is empty")
+	}
+
+	key := groupKey(group.Id)
+	if _, err := db.client.Put(c, key, convertDomainGroupToDtoGroup(group)); err != nil {
+		return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetGroup returns the group, or nil if there is none.
+func (db *UserDataRepositoryImpl) GetGroup(c context.Context, groupId string) (*domaingroup.Group, error) {
+	if len(groupId) == 0 {
+		return nil, nil
+	}
+
+	key := groupKey(groupId)
+
+	var dto dtogroup.Group
+	err := db.client.Get(c, key, &dto)
+	if err == datastore.ErrNoSuchEntity {
+		// This is not an error.
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	return convertDtoGroupToDomainGroup(&dto, groupId), nil
+}
+
+// GetGroupByInviteCode returns the group with the invite code, or nil if there is none.
+func (db *UserDataRepositoryImpl) GetGroupByInviteCode(c context.Context, inviteCode string) (*domaingroup.Group, error) {
+	if len(inviteCode) == 0 {
+		return nil, nil
+	}
+
+	q := datastore.NewQuery(DB_KIND_GROUP).
+		FilterField("inviteCode", "=", inviteCode).
+		Limit(1)
+
+	var dtos []*dtogroup.Group
+	keys, err := db.client.GetAll(c, q, &dtos)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	if len(dtos) == 0 {
+		return nil, nil
+	}
+
+	return convertDtoGroupToDomainGroup(dtos[0], keys[0].Name), nil
+}
+
+// StoreGroupMembership adds the user to the group, or changes their membership.
+func (db *UserDataRepositoryImpl) StoreGroupMembership(c context.Context, membership *domaingroup.Membership) error {
+	userId, err := datastore.DecodeKey(membership.UserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := groupMembershipKey(userId, membership.GroupId)
+	if _, err := db.client.Put(c, key, convertDomainMembershipToDtoMembership(membership)); err != nil {
+		return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetGroupMembership returns the user's membership of the group, or nil if they are not a member.
+func (db *UserDataRepositoryImpl) GetGroupMembership(c context.Context, groupId string, strUserId string) (*domaingroup.Membership, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := groupMembershipKey(userId, groupId)
+
+	var dto dtogroup.Membership
+	err = db.client.Get(c, key, &dto)
+	if err == datastore.ErrNoSuchEntity {
+		// This is not an error.
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	return convertDtoMembershipToDomainMembership(&dto, strUserId), nil
+}
+
+// GetGroupMemberships returns the memberships of all the group's members.
+func (db *UserDataRepositoryImpl) GetGroupMemberships(c context.Context, groupId string) ([]*domaingroup.Membership, error) {
+	// In case an empty ID could lead to getting all groups' members:
+	if len(groupId) == 0 {
+		return nil, fmt.Errorf("GetGroupMemberships(): groupId is empty")
+	}
+
+	q := datastore.NewQuery(DB_KIND_USER_GROUP_MEMBERSHIP).
+		FilterField("groupId", "=", groupId)
+
+	var dtos []*dtogroup.Membership
+	keys, err := db.client.GetAll(c, q, &dtos)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domaingroup.Membership, 0, len(dtos))
+	for i, dto := range dtos {
+		var userId string
+		if parent := keys[i].Parent; parent != nil {
+			userId = parent.Encode()
+		}
+
+		result = append(result, convertDtoMembershipToDomainMembership(dto, userId))
+	}
+
+	return result, nil
+}
+
+// GetUserGroupMemberships returns the user's memberships of all their groups.
+func (db *UserDataRepositoryImpl) GetUserGroupMemberships(c context.Context, strUserId string) ([]*domaingroup.Membership, error) {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	// In case a nil value could lead to getting all users' memberships:
+	if userId == nil {
+		return nil, fmt.Errorf("GetUserGroupMemberships(): userId is nil")
+	}
+
+	q := datastore.NewQuery(DB_KIND_USER_GROUP_MEMBERSHIP).
+		Ancestor(userId)
+
+	var dtos []*dtogroup.Membership
+	if _, err := db.client.GetAll(c, q, &dtos); err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domaingroup.Membership, 0, len(dtos))
+	for _, dto := range dtos {
+		result = append(result, convertDtoMembershipToDomainMembership(dto, strUserId))
+	}
+
+	return result, nil
+}
+
+func (db *UserDataRepositoryImpl) DeleteGroupMembership(c context.Context, groupId string, strUserId string) error {
+	userId, err := datastore.DecodeKey(strUserId)
+	if err != nil {
+		return fmt.Errorf("datastore.DecodeKey() failed: %v", err)
+	}
+
+	key := groupMembershipKey(userId, groupId)
+	if err := db.client.Delete(c, key); err != nil {
+		return fmt.Errorf("datastore Delete() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+func groupAssignmentKey(groupId string, assignmentId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_GROUP_ASSIGNMENT, assignmentId, groupKey(groupId))
+}
+
+func (db *UserDataRepositoryImpl) StoreGroupAssignment(c context.Context, assignment *domaingroup.Assignment) error {
+	if len(assignment.GroupId) == 0 || len(assignment.Id) == 0 {
+		return fmt.Errorf("StoreGroupAssignment(): the assignment's group ID or ID is empty")
+	}
+
+	key := groupAssignmentKey(assignment.GroupId, assignment.Id)
+	if _, err := db.client.Put(c, key, convertDomainAssignmentToDtoAssignment(assignment)); err != nil {
+		return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// GetGroupAssignment returns the group's assignment, or nil if there is none.
+func (db *UserDataRepositoryImpl) GetGroupAssignment(c context.Context, groupId string, assignmentId string) (*domaingroup.Assignment, error) {
+	if len(groupId) == 0 || len(assignmentId) == 0 {
+		return nil, nil
+	}
+
+	key := groupAssignmentKey(groupId, assignmentId)
+
+	var dto dtogroup.Assignment
+	err := db.client.Get(c, key, &dto)
+	if err == datastore.ErrNoSuchEntity {
+		// This is not an error.
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+	}
+
+	return convertDtoAssignmentToDomainAssignment(&dto, groupId, assignmentId), nil
+}
+
+// GetGroupAssignments returns all the group's assignments.
+func (db *UserDataRepositoryImpl) GetGroupAssignments(c context.Context, groupId string) ([]*domaingroup.Assignment, error) {
+	// In case an empty ID could lead to getting all groups' assignments:
+	if len(groupId) == 0 {
+		return nil, fmt.Errorf("GetGroupAssignments(): groupId is empty")
+	}
+
+	q := datastore.NewQuery(DB_KIND_GROUP_ASSIGNMENT).
+		Ancestor(groupKey(groupId))
+
+	var dtos []*dtogroup.Assignment
+	keys, err := db.client.GetAll(c, q, &dtos)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domaingroup.Assignment, 0, len(dtos))
+	for i, dto := range dtos {
+		result = append(result, convertDtoAssignmentToDomainAssignment(dto, groupId, keys[i].Name))
+	}
+
+	return result, nil
+}
@@ -2,10 +2,16 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/datastore"
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	dtouser "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/user"
 	"github.com/murraycu/go-bigoquiz-server/server/loginserver/oauthparsers"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/oauth2"
@@ -18,7 +24,7 @@ func TestNewUserDataRepositoryInstantiate(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 }
@@ -28,7 +34,7 @@ func TestNewUserDataRepositoryGetUserProfileByIdForNonExistantUser(t *testing.T)
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -47,7 +53,7 @@ func TestNewUserDataRepositoryStoreAndGetUserProfileById(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -66,9 +72,16 @@ func TestNewUserDataRepositoryStoreAndGetUserProfileById(t *testing.T) {
 	token := oauth2.Token{
 		AccessToken: "some-access-token",
 	}
-	userId, err = userDataClient.StoreGoogleLoginInUserProfile(c, userInfo, strUserId, &token)
+	userId, created, err := userDataClient.StoreGoogleLoginInUserProfile(c, userInfo, strUserId, &token)
 	assert.Nil(t, err)
 	assert.NotNil(t, userId)
+	assert.True(t, created)
+
+	// Logging in again uses the same profile.
+	userIdAgain, created, err := userDataClient.StoreGoogleLoginInUserProfile(c, userInfo, strUserId, &token)
+	assert.Nil(t, err)
+	assert.Equal(t, userId, userIdAgain)
+	assert.False(t, created)
 
 	userProfile, err := userDataClient.GetUserProfileById(c, userId)
 	assert.Nil(t, err)
@@ -121,7 +134,7 @@ func createGoogleUserInStore(t *testing.T, c context.Context, userDataClient Use
 		AccessToken: "some-access-token",
 	}
 
-	userId, err := userDataClient.StoreGoogleLoginInUserProfile(c, userInfo, "", &token)
+	userId, _, err := userDataClient.StoreGoogleLoginInUserProfile(c, userInfo, "", &token)
 	assert.Nil(t, err)
 	assert.NotNil(t, userId)
 
@@ -143,7 +156,7 @@ func createGitHubUserInStore(t *testing.T, c context.Context, userDataClient Use
 		AccessToken: "some-access-token",
 	}
 
-	userId, err := userDataClient.StoreGitHubLoginInUserProfile(c, userInfo, "", &token)
+	userId, _, err := userDataClient.StoreGitHubLoginInUserProfile(c, userInfo, "", &token)
 	assert.Nil(t, err)
 	assert.NotNil(t, userId)
 
@@ -165,7 +178,7 @@ func createFacebookUserInStore(t *testing.T, c context.Context, userDataClient U
 		AccessToken: "some-access-token",
 	}
 
-	userId, err := userDataClient.StoreFacebookLoginInUserProfile(c, userInfo, "", &token)
+	userId, _, err := userDataClient.StoreFacebookLoginInUserProfile(c, userInfo, "", &token)
 	assert.Nil(t, err)
 	assert.NotNil(t, userId)
 
@@ -180,7 +193,7 @@ func TestNewUserDataRepositoryStoreStoreGoogleLoginInUserProfile(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -195,7 +208,7 @@ func TestNewUserDataRepositoryStoreStoreGitHubLoginInUserProfile(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -210,7 +223,7 @@ func TestNewUserDataRepositoryStoreStoreFacebookLoginInUserProfile(t *testing.T)
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -225,7 +238,7 @@ func TestNewUserDataRepositoryStoreAndGetStatsForSection(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -257,7 +270,7 @@ func TestNewUserDataRepositoryStoreAndGetStatsForQuiz(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -283,7 +296,7 @@ func TestNewUserDataRepositoryStoreAndGetStatsForAll(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -309,7 +322,7 @@ func TestNewUserDataRepositoryStoreAndDeleteStatsForSection(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -338,7 +351,7 @@ func TestNewUserDataRepositoryUpdateStatsCorrectly(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userDataClient, err := NewUserDataRepository()
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
@@ -391,3 +404,566 @@ func TestNewUserDataRepositoryUpdateStatsCorrectly(t *testing.T) {
 	assert.Equal(t, 1, result.CountQuestionsCorrectOnce)
 
 }
+
+func TestNewUserDataRepositoryUpdateAndGetDailyActivities(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	first, err := userDataClient.UpdateUserDailyActivity(c, userId, "2024-03-09", true, true)
+	assert.Nil(t, err)
+	assert.True(t, first)
+
+	first, err = userDataClient.UpdateUserDailyActivity(c, userId, "2024-03-10", true, true)
+	assert.Nil(t, err)
+	assert.True(t, first)
+
+	first, err = userDataClient.UpdateUserDailyActivity(c, userId, "2024-03-10", false, false)
+	assert.Nil(t, err)
+	assert.False(t, first)
+
+	result, err := userDataClient.GetUserDailyActivities(c, userId)
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+
+	for _, activity := range result {
+		if activity.Date == "2024-03-10" {
+			assert.Equal(t, 2, activity.Answered)
+			assert.Equal(t, 1, activity.Correct)
+			assert.Equal(t, 1, activity.Learned)
+		}
+	}
+}
+
+func TestNewUserDataRepositoryStoreDailyGoal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	goal := domainuser.DailyGoal{
+		Type:   domainuser.DailyGoalTypeLearned,
+		Target: 5,
+	}
+	err = userDataClient.StoreUserDailyGoal(c, userId, "Europe/Berlin", goal)
+	assert.Nil(t, err)
+
+	profile, err := userDataClient.GetUserProfileById(c, userId)
+	assert.Nil(t, err)
+	assert.NotNil(t, profile)
+
+	assert.Equal(t, "Europe/Berlin", profile.TimeZone)
+	assert.Equal(t, goal, profile.DailyGoal)
+
+	// The rest of the profile should not have changed.
+	assert.Equal(t, "Example McExample", profile.Name)
+}
+
+func TestNewUserDataRepositoryStoreAndGetUserStatsUndo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	// This must be decodable with datastore.DecodeKey().
+	userId := "EhYKC1VzZXJQcm9maWxlEICAgICw2IIM"
+
+	stats := &domainuser.Stats{
+		QuizId:    "some-quiz-id",
+		SectionId: "some-section-id",
+	}
+	stats.UpdateStatsForAnswerCorrectness("some-question-id", true)
+
+	undo := &domainuser.StatsUndo{
+		QuizId:  stats.QuizId,
+		Stats:   []*domainuser.Stats{stats},
+		Expires: time.Now().UTC().Add(time.Minute).Truncate(time.Microsecond),
+	}
+
+	err = userDataClient.StoreUserStatsUndo(c, userId, undo)
+	assert.Nil(t, err)
+
+	result, err := userDataClient.GetUserStatsUndo(c, userId)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, undo.QuizId, result.QuizId)
+	assert.True(t, undo.Expires.Equal(result.Expires))
+	assert.Equal(t, undo.Stats, result.Stats)
+
+	err = userDataClient.DeleteUserStatsUndo(c, userId)
+	assert.Nil(t, err)
+
+	result, err = userDataClient.GetUserStatsUndo(c, userId)
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+}
+
+func TestNewUserDataRepositoryUpdateStatsConcurrently(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	const quizId = "some-quiz-id-concurrent"
+	const sectionId = "some-section-id-concurrent"
+	const countAnswers = 20
+
+	// Answer several questions at the same time, as if from several browser tabs.
+	var wg sync.WaitGroup
+	errs := make(chan error, countAnswers)
+	for i := 0; i < countAnswers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			questionId := fmt.Sprintf("some-question-id-%d", i)
+			_, err := userDataClient.UpdateUserStatsForSection(c, userId, quizId, sectionId, func(stats *domainuser.Stats) error {
+				stats.UpdateStatsForAnswerCorrectness(questionId, true)
+				return nil
+			})
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+
+	result, err := userDataClient.GetUserStatsForSection(c, userId, quizId, sectionId)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+
+	// No answers should have been lost.
+	assert.Equal(t, countAnswers, result.Answered)
+	assert.Equal(t, countAnswers, result.Correct)
+	assert.Equal(t, countAnswers, result.CountQuestionsAnsweredOnce)
+	assert.Len(t, result.QuestionHistories, countAnswers)
+}
+
+func TestNewUserDataRepositoryUpdateStatsMigratesLegacyStats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	const quizId = "some-quiz-id-legacy"
+	const sectionId = "some-section-id-legacy"
+	const questionId = "some-question-id-legacy"
+
+	// Store the stats as they were stored before we used userStatsKey().
+	stats := &domainuser.Stats{
+		QuizId:    quizId,
+		SectionId: sectionId,
+	}
+	stats.UpdateStatsForAnswerCorrectness(questionId, true)
+
+	dto, err := convertDomainStatsToDtoStats(stats, userId)
+	assert.Nil(t, err)
+
+	impl := userDataClient.(*UserDataRepositoryImpl)
+	legacyKey, err := impl.client.Put(c, datastore.IncompleteKey(DB_KIND_USER_STATS, nil), dto)
+	assert.Nil(t, err)
+
+	// This seems necessary for the datastore emulator to let us read the data back reliably.
+	time.Sleep(time.Millisecond * datastoreDelayMs)
+
+	_, err = userDataClient.UpdateUserStatsForSection(c, userId, quizId, sectionId, func(stats *domainuser.Stats) error {
+		stats.UpdateStatsForAnswerCorrectness(questionId, false)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	time.Sleep(time.Millisecond * datastoreDelayMs)
+
+	result, err := userDataClient.GetUserStatsForSection(c, userId, quizId, sectionId)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, 2, result.Answered)
+	assert.Equal(t, 1, result.Correct)
+
+	// The legacy entity should have been replaced.
+	err = impl.client.Get(c, legacyKey, &dtouser.Stats{})
+	assert.Equal(t, datastore.ErrNoSuchEntity, err)
+
+	mapStats, err := userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+	assert.Nil(t, err)
+	assert.Len(t, mapStats, 1)
+}
+
+func TestNewUserDataRepositoryUpdateStatsOnce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, userDataClient)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	const quizId = "some-quiz-id-once"
+	const sectionId = "some-section-id-once"
+	const questionId = "some-question-id-once"
+
+	event := domainuser.SyncEvent{
+		EventId:    "some-event-id",
+		QuizId:     quizId,
+		QuestionId: questionId,
+		Time:       time.Now().UTC().Add(-time.Hour),
+		Synced:     time.Now().UTC(),
+		Date:       "2024-03-09",
+		Correct:    true,
+	}
+
+	update := func(stats *domainuser.Stats) error {
+		stats.UpdateStatsForAnswerCorrectness(questionId, true)
+		return nil
+	}
+
+	result, applied, err := userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, sectionId, &event, update)
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.NotNil(t, result)
+	assert.Equal(t, 1, result.Answered)
+
+	// Sending the same event again should not change the stats.
+	result, applied, err = userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, sectionId, &event, update)
+	assert.Nil(t, err)
+	assert.False(t, applied)
+	assert.NotNil(t, result)
+	assert.Equal(t, 1, result.Answered)
+
+	// But a different event should.
+	event.EventId = "some-other-event-id"
+	result, applied, err = userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, sectionId, &event, update)
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, 2, result.Answered)
+
+	// The daily activity is only changed when the stats are.
+	activities, err := userDataClient.GetUserDailyActivities(c, userId)
+	assert.Nil(t, err)
+	assert.Len(t, activities, 1)
+	assert.Equal(t, "2024-03-09", activities[0].Date)
+	assert.Equal(t, 2, activities[0].Answered)
+	assert.Equal(t, 2, activities[0].Correct)
+	assert.Equal(t, 1, activities[0].Learned)
+
+	_, _, err = userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, sectionId, &domainuser.SyncEvent{}, update)
+	assert.NotNil(t, err)
+
+	// After the events are deleted, they are applied again.
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+	count, err := userDataClient.DeleteOldSyncEvents(c, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, count, 2)
+
+	_, applied, err = userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, sectionId, &event, update)
+	assert.Nil(t, err)
+	assert.True(t, applied)
+}
+
+func TestNewUserDataRepositoryGetUserIdByLoginId(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	googleUserId := createGoogleUserInStore(t, c, userDataClient)
+	gitHubUserId := createGitHubUserInStore(t, c, userDataClient)
+
+	userId, err := userDataClient.GetUserIdByLoginId(c, config.LOGIN_PROVIDER_GOOGLE, "some-google-user-id")
+	assert.Nil(t, err)
+	assert.Equal(t, googleUserId, userId)
+
+	userId, err = userDataClient.GetUserIdByLoginId(c, config.LOGIN_PROVIDER_GITHUB, "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, gitHubUserId, userId)
+
+	userId, err = userDataClient.GetUserIdByLoginId(c, config.LOGIN_PROVIDER_FACEBOOK, "nonexistent")
+	assert.Nil(t, err)
+	assert.Empty(t, userId)
+
+	_, err = userDataClient.GetUserIdByLoginId(c, config.LOGIN_PROVIDER_GITHUB, "not-a-number")
+	assert.NotNil(t, err)
+
+	userIds, err := userDataClient.GetUserIdsByEmail(c, "example@example.com")
+	assert.Nil(t, err)
+	assert.Contains(t, userIds, googleUserId)
+	assert.Contains(t, userIds, gitHubUserId)
+}
+
+func TestNewUserDataRepositoryDeleteUser(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	_, err = userDataClient.UpdateUserStatsForSection(c, userId, "bigo", "sorting", func(stats *domainuser.Stats) error {
+		stats.UpdateStatsForAnswerCorrectness("quicksort", true)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	_, err = userDataClient.UpdateUserDailyActivity(c, userId, "2024-03-09", true, true)
+	assert.Nil(t, err)
+
+	err = userDataClient.DeleteUser(c, userId)
+	assert.Nil(t, err)
+
+	profile, err := userDataClient.GetUserProfileById(c, userId)
+	assert.Nil(t, err)
+	assert.Nil(t, profile)
+
+	stats, err := userDataClient.GetUserStats(c, userId)
+	assert.Nil(t, err)
+	assert.Empty(t, stats)
+
+	activities, err := userDataClient.GetUserDailyActivities(c, userId)
+	assert.Nil(t, err)
+	assert.Empty(t, activities)
+}
+
+func TestNewUserDataRepositoryUpdateUserStatsForSections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+	defer func() {
+		assert.Nil(t, userDataClient.DeleteUser(c, userId))
+	}()
+
+	_, err = userDataClient.UpdateUserStatsForSection(c, userId, "bigo", "old-sorting", func(stats *domainuser.Stats) error {
+		stats.UpdateStatsForAnswerCorrectness("quicksort", true)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	ids, err := userDataClient.GetUserIds(c)
+	assert.Nil(t, err)
+	assert.Contains(t, ids, userId)
+
+	// Move the stats to another section.
+	err = userDataClient.UpdateUserStatsForSections(c, userId, "bigo", []string{"old-sorting", "sorting"}, func(statsBySection map[string]*domainuser.Stats) error {
+		statsBySection["sorting"].Merge(statsBySection["old-sorting"])
+		delete(statsBySection, "old-sorting")
+		return nil
+	})
+	assert.Nil(t, err)
+
+	statsBySection, err := userDataClient.GetUserStatsForQuiz(c, userId, "bigo")
+	assert.Nil(t, err)
+	assert.NotContains(t, statsBySection, "old-sorting")
+	assert.Contains(t, statsBySection, "sorting")
+	assert.Equal(t, 1, statsBySection["sorting"].Answered)
+	assert.True(t, statsBySection["sorting"].GetQuestionWasAnswered("quicksort"))
+}
+
+func TestNewUserDataRepositoryCertificates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+	defer func() {
+		assert.Nil(t, userDataClient.DeleteUser(c, userId))
+	}()
+
+	certificate := &domainuser.Certificate{
+		Id:             fmt.Sprintf("test-certificate-%v", time.Now().UnixNano()),
+		UserId:         userId,
+		UserName:       "Some User",
+		QuizId:         "bigo",
+		QuizTitle:      "Big-O",
+		SectionId:      "sorting",
+		SectionTitle:   "Sorting",
+		CountQuestions: 3,
+		Issued:         time.Now().UTC().Truncate(time.Second),
+		KeyId:          "some-key",
+		Signature:      []byte("some-signature"),
+	}
+
+	stored, isNew, err := userDataClient.StoreUserCertificateIfNew(c, userId, certificate)
+	assert.Nil(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, certificate.Id, stored.Id)
+
+	// The user already has a certificate for the section.
+	again := *certificate
+	again.Id = certificate.Id + "-again"
+	stored, isNew, err = userDataClient.StoreUserCertificateIfNew(c, userId, &again)
+	assert.Nil(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, certificate.Id, stored.Id)
+
+	found, err := userDataClient.GetCertificateById(c, certificate.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, found)
+	assert.Equal(t, userId, found.UserId)
+	assert.Equal(t, certificate.Signature, found.Signature)
+	assert.True(t, certificate.Issued.Equal(found.Issued))
+
+	found, err = userDataClient.GetCertificateById(c, again.Id)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	certificates, err := userDataClient.GetUserCertificates(c, userId)
+	assert.Nil(t, err)
+	assert.Len(t, certificates, 1)
+}
+
+func TestNewUserDataRepositoryGroups(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	group, err := domaingroup.NewGroup("Some Team", userId, time.Now().UTC())
+	assert.Nil(t, err)
+	assert.Nil(t, userDataClient.StoreGroup(c, group))
+
+	found, err := userDataClient.GetGroupByInviteCode(c, group.InviteCode)
+	assert.Nil(t, err)
+	assert.NotNil(t, found)
+	assert.Equal(t, group.Id, found.Id)
+	assert.Equal(t, "Some Team", found.Name)
+
+	found, err = userDataClient.GetGroup(c, "some-unknown-group")
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	membership := &domaingroup.Membership{GroupId: group.Id, UserId: userId, UserName: "Some User", Joined: time.Now().UTC()}
+	assert.Nil(t, userDataClient.StoreGroupMembership(c, membership))
+
+	membership.SharesProgress = true
+	membership.SharesWithInstructor = true
+	assert.Nil(t, userDataClient.StoreGroupMembership(c, membership))
+
+	memberships, err := userDataClient.GetGroupMemberships(c, group.Id)
+	assert.Nil(t, err)
+	assert.Len(t, memberships, 1)
+	assert.Equal(t, userId, memberships[0].UserId)
+	assert.True(t, memberships[0].SharesProgress)
+	assert.True(t, memberships[0].SharesWithInstructor)
+
+	memberships, err = userDataClient.GetUserGroupMemberships(c, userId)
+	assert.Nil(t, err)
+	assert.Len(t, memberships, 1)
+
+	// Deleting the user deletes their memberships, but not the group.
+	assert.Nil(t, userDataClient.DeleteUser(c, userId))
+
+	found, err = userDataClient.GetGroup(c, group.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, found)
+
+	memberships, err = userDataClient.GetGroupMemberships(c, group.Id)
+	assert.Nil(t, err)
+	assert.Empty(t, memberships)
+}
+
+func TestNewUserDataRepositoryGroupAssignments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	userDataClient, err := NewUserDataRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+
+	c := context.Background()
+
+	userId := createGoogleUserInStore(t, c, userDataClient)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	group, err := domaingroup.NewGroup("Some Team", userId, now)
+	assert.Nil(t, err)
+	assert.Nil(t, userDataClient.StoreGroup(c, group))
+
+	assignment, err := domaingroup.NewAssignment(group.Id, "bigo", []string{"sorting"}, now.Add(7*24*time.Hour), 0.8, now)
+	assert.Nil(t, err)
+	assert.Nil(t, userDataClient.StoreGroupAssignment(c, assignment))
+
+	found, err := userDataClient.GetGroupAssignment(c, group.Id, assignment.Id)
+	assert.Nil(t, err)
+	assert.NotNil(t, found)
+	assert.Equal(t, "bigo", found.QuizId)
+	assert.Equal(t, []string{"sorting"}, found.SectionIds)
+	assert.True(t, assignment.Due.Equal(found.Due))
+	assert.Equal(t, 0.8, found.TargetCorrectOnce)
+
+	found, err = userDataClient.GetGroupAssignment(c, "some-other-group", assignment.Id)
+	assert.Nil(t, err)
+	assert.Nil(t, found)
+
+	assignments, err := userDataClient.GetGroupAssignments(c, group.Id)
+	assert.Nil(t, err)
+	assert.Len(t, assignments, 1)
+	assert.Equal(t, assignment.Id, assignments[0].Id)
+	assert.Equal(t, group.Id, assignments[0].GroupId)
+}
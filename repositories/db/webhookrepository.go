@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	dtowebhook "github.com/murraycu/go-bigoquiz-server/repositories/db/dtos/webhook"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	DB_KIND_WEBHOOK_DELIVERY = "WebhookDelivery"
+
+	// The maximum number of deliveries to store, or delete, in one call,
+	// staying well below the datastore's limit of 500 entities per call.
+	maxWebhookDeliveriesPerCall = 250
+)
+
+type WebhookRepository interface {
+	// StoreWebhookDeliveries adds the deliveries, or stores their changes.
+	StoreWebhookDeliveries(c context.Context, deliveries []*domainwebhook.Delivery) error
+
+	// GetDueWebhookDeliveries returns up to maxDeliveries pending deliveries whose NextAttempt is not after now,
+	// the longest overdue first, so deliveries that are waiting to be retried do not hide the others.
+	GetDueWebhookDeliveries(c context.Context, now time.Time, maxDeliveries int) ([]*domainwebhook.Delivery, error)
+
+	// StartWebhookDeliveryAttempt increments the delivery's Attempts, and sets its NextAttempt to leaseUntil,
+	// in a transaction, so other instances of the server do not attempt it at the same time.
+	// It returns the delivery, or nil if it is no longer due, for instance because another instance has started it.
+	StartWebhookDeliveryAttempt(c context.Context, deliveryId string, now time.Time, leaseUntil time.Time) (*domainwebhook.Delivery, error)
+
+	// GetWebhookDeliveries returns the most recent deliveries, newest first, for the delivery log.
+	GetWebhookDeliveries(c context.Context, maxDeliveries int) ([]*domainwebhook.Delivery, error)
+
+	// DeleteOldWebhookDeliveries deletes all the deliveries that were created before the time,
+	// and that are no longer pending, returning the number that were deleted.
+	DeleteOldWebhookDeliveries(c context.Context, before time.Time) (int, error)
+
+	// Ping checks that the datastore is reachable.
+	Ping(c context.Context) error
+
+	// Close closes the connection to the datastore. The repository may not be used afterwards.
+	Close() error
+}
+
+type WebhookRepositoryImpl struct {
+	client *datastore.Client
+}
+
+// NewWebhookRepository connects to the Datastore of the Google Cloud project, such as "bigoquiz".
+func NewWebhookRepository(projectId string) (WebhookRepository, error) {
+	result := &WebhookRepositoryImpl{}
+
+	c := context.Background()
+	var err error
+	result.client, err = datastore.NewClient(c, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("datastore.NewClient() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+func (db *WebhookRepositoryImpl) Ping(c context.Context) error {
+	return pingDatastore(c, db.client)
+}
+
+func (db *WebhookRepositoryImpl) Close() error {
+	return db.client.Close()
+}
+
+func webhookDeliveryKey(deliveryId string) *datastore.Key {
+	return datastore.NameKey(DB_KIND_WEBHOOK_DELIVERY, deliveryId, nil)
+}
+
+func (db *WebhookRepositoryImpl) StoreWebhookDeliveries(c context.Context, deliveries []*domainwebhook.Delivery) error {
+	for start := 0; start < len(deliveries); start += maxWebhookDeliveriesPerCall {
+		end := min(start+maxWebhookDeliveriesPerCall, len(deliveries))
+
+		keys := make([]*datastore.Key, 0, end-start)
+		dtos := make([]*dtowebhook.Delivery, 0, end-start)
+		for _, delivery := range deliveries[start:end] {
+			if len(delivery.Id) == 0 {
+				return fmt.Errorf("StoreWebhookDeliveries(): a delivery's ID is empty")
+			}
+
+			keys = append(keys, webhookDeliveryKey(delivery.Id))
+			dtos = append(dtos, convertDomainDeliveryToDtoDelivery(delivery))
+		}
+
+		if _, err := db.client.PutMulti(c, keys, dtos); err != nil {
+			return fmt.Errorf("datastore PutMulti() failed: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// This needs the composite index in index.yaml.
+func (db *WebhookRepositoryImpl) GetDueWebhookDeliveries(c context.Context, now time.Time, maxDeliveries int) ([]*domainwebhook.Delivery, error) {
+	q := datastore.NewQuery(DB_KIND_WEBHOOK_DELIVERY).
+		FilterField("pending", "=", true).
+		FilterField("nextAttempt", "<=", now).
+		Order("nextAttempt").
+		Limit(maxDeliveries)
+
+	return db.getWebhookDeliveries(c, q)
+}
+
+func (db *WebhookRepositoryImpl) StartWebhookDeliveryAttempt(c context.Context, deliveryId string, now time.Time, leaseUntil time.Time) (*domainwebhook.Delivery, error) {
+	key := webhookDeliveryKey(deliveryId)
+
+	var result *domainwebhook.Delivery
+	_, err := db.client.RunInTransaction(c, func(tx *datastore.Transaction) error {
+		result = nil
+
+		var dto dtowebhook.Delivery
+		err := tx.Get(key, &dto)
+		if err == datastore.ErrNoSuchEntity {
+			// It has been deleted.
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("datastore Get() failed with key: %v: %v", key, err)
+		}
+
+		delivery := convertDtoDeliveryToDomainDelivery(&dto, deliveryId)
+		if !delivery.IsDue(now) {
+			return nil
+		}
+
+		delivery.Attempts++
+		delivery.NextAttempt = leaseUntil
+
+		if _, err := tx.Put(key, convertDomainDeliveryToDtoDelivery(delivery)); err != nil {
+			return fmt.Errorf("datastore Put() failed with key: %v: %v", key, err)
+		}
+
+		result = delivery
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("datastore RunInTransaction() failed: %v", err)
+	}
+
+	return result, nil
+}
+
+func (db *WebhookRepositoryImpl) GetWebhookDeliveries(c context.Context, maxDeliveries int) ([]*domainwebhook.Delivery, error) {
+	q := datastore.NewQuery(DB_KIND_WEBHOOK_DELIVERY).
+		Order("-created").
+		Limit(maxDeliveries)
+
+	return db.getWebhookDeliveries(c, q)
+}
+
+func (db *WebhookRepositoryImpl) getWebhookDeliveries(c context.Context, q *datastore.Query) ([]*domainwebhook.Delivery, error) {
+	var dtos []*dtowebhook.Delivery
+	keys, err := db.client.GetAll(c, q, &dtos)
+	if err != nil {
+		return nil, fmt.Errorf("datastore GetAll() failed: %v", err)
+	}
+
+	result := make([]*domainwebhook.Delivery, 0, len(dtos))
+	for i, dto := range dtos {
+		result = append(result, convertDtoDeliveryToDomainDelivery(dto, keys[i].Name))
+	}
+
+	return result, nil
+}
+
+func (db *WebhookRepositoryImpl) DeleteOldWebhookDeliveries(c context.Context, before time.Time) (int, error) {
+	q := datastore.NewQuery(DB_KIND_WEBHOOK_DELIVERY).
+		FilterField("created", "<", before)
+
+	result := 0
+	var toDelete []*datastore.Key
+	deleteBatch := func() error {
+		if err := db.client.DeleteMulti(c, toDelete); err != nil {
+			return fmt.Errorf("datastore DeleteMulti() failed: %v", err)
+		}
+
+		result += len(toDelete)
+		toDelete = toDelete[:0]
+		return nil
+	}
+
+	// The iterator pages through the results, so there may be any number of them.
+	it := db.client.Run(c, q)
+	for {
+		var dto dtowebhook.Delivery
+		key, err := it.Next(&dto)
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("datastore iter.Next() failed: %v", err)
+		}
+
+		// Deliveries are retried for much less time than they are kept, but just in case.
+		if dto.Pending {
+			continue
+		}
+
+		toDelete = append(toDelete, key)
+		if len(toDelete) == maxWebhookDeliveriesPerCall {
+			if err := deleteBatch(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if len(toDelete) != 0 {
+		if err := deleteBatch(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRepositoryDeliveries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	client, err := NewWebhookRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+
+	c := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	delivery, err := domainwebhook.NewDelivery("some-webhook", domainwebhook.EVENT_USER_CREATED, []byte(`{}`), now)
+	assert.Nil(t, err)
+	assert.Nil(t, client.StoreWebhookDeliveries(c, []*domainwebhook.Delivery{delivery}))
+
+	// Wait for the datastore to update its indexes.
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	due, err := client.GetDueWebhookDeliveries(c, now, 1000)
+	assert.Nil(t, err)
+	assert.Contains(t, deliveryIds(due), delivery.Id)
+
+	due, err = client.GetDueWebhookDeliveries(c, now.Add(-time.Second), 1000)
+	assert.Nil(t, err)
+	assert.NotContains(t, deliveryIds(due), delivery.Id)
+
+	started, err := client.StartWebhookDeliveryAttempt(c, delivery.Id, now, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.NotNil(t, started)
+	assert.Equal(t, 1, started.Attempts)
+	assert.Equal(t, []byte(`{}`), started.Payload)
+
+	// Another instance cannot start it during the lease.
+	again, err := client.StartWebhookDeliveryAttempt(c, delivery.Id, now, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Nil(t, again)
+
+	started.RecordAttempt(now, 204, nil)
+	assert.Nil(t, client.StoreWebhookDeliveries(c, []*domainwebhook.Delivery{started}))
+
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	due, err = client.GetDueWebhookDeliveries(c, now.Add(time.Hour), 1000)
+	assert.Nil(t, err)
+	assert.NotContains(t, deliveryIds(due), delivery.Id)
+
+	deliveries, err := client.GetWebhookDeliveries(c, 1000)
+	assert.Nil(t, err)
+	assert.Contains(t, deliveryIds(deliveries), delivery.Id)
+
+	_, err = client.DeleteOldWebhookDeliveries(c, now.Add(time.Second))
+	assert.Nil(t, err)
+
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	deliveries, err = client.GetWebhookDeliveries(c, 1000)
+	assert.Nil(t, err)
+	assert.NotContains(t, deliveryIds(deliveries), delivery.Id)
+}
+
+func TestWebhookRepositoryDeleteManyOldDeliveries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping test which requires more setup.")
+	}
+
+	client, err := NewWebhookRepository(TEST_PROJECT_ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+
+	c := context.Background()
+
+	// More than one batch, with some still pending.
+	created := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	var deliveries []*domainwebhook.Delivery
+	for i := 0; i < maxWebhookDeliveriesPerCall*2+10; i++ {
+		delivery, err := domainwebhook.NewDelivery("some-webhook", domainwebhook.EVENT_USER_CREATED, []byte(`{}`), created)
+		assert.Nil(t, err)
+
+		if i%100 != 0 {
+			delivery.Attempts = 1
+			delivery.RecordAttempt(created, 204, nil)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	assert.Nil(t, client.StoreWebhookDeliveries(c, deliveries))
+
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	_, err = client.DeleteOldWebhookDeliveries(c, created.Add(time.Second))
+	assert.Nil(t, err)
+
+	time.Sleep(datastoreDelayMs * time.Millisecond)
+
+	remaining, err := client.GetWebhookDeliveries(c, 10000)
+	assert.Nil(t, err)
+
+	remainingIds := deliveryIds(remaining)
+	for i, delivery := range deliveries {
+		if i%100 == 0 {
+			assert.Contains(t, remainingIds, delivery.Id)
+		} else {
+			assert.NotContains(t, remainingIds, delivery.Id)
+		}
+	}
+}
+
+func deliveryIds(deliveries []*domainwebhook.Delivery) []string {
+	var result []string
+	for _, delivery := range deliveries {
+		result = append(result, delivery.Id)
+	}
+
+	return result
+}
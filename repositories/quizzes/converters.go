@@ -2,6 +2,7 @@ package quizzes
 
 import (
 	"fmt"
+	"strconv"
 
 	domainquiz "github.com/murraycu/go-bigoquiz-server/domain/quiz"
 	dtoquiz "github.com/murraycu/go-bigoquiz-server/repositories/quizzes/dtos/quiz"
@@ -44,6 +45,10 @@ func convertDtoQuizToDomainQuiz(dto *dtoquiz.Quiz) (*domainquiz.Quiz, error) {
 
 	result.IsPrivate = dto.IsPrivate
 
+	if dto.Version != 0 {
+		result.Version = strconv.Itoa(dto.Version)
+	}
+
 	for _, dtoSection := range dto.Sections {
 		section, err := convertDtoSectionToDomainSection(dtoSection)
 		if err != nil {
@@ -60,6 +65,15 @@ func convertDtoQuizToDomainQuiz(dto *dtoquiz.Quiz) (*domainquiz.Quiz, error) {
 
 	result.UsesMathML = dto.UsesMathML
 	result.AnswersAsChoices = dto.AnswersAsChoices
+	result.Tags = dto.Tags
+	result.IdMigrations.Sections = dto.IdMigrations.Sections
+	result.IdMigrations.Questions = dto.IdMigrations.Questions
+
+	if err := result.CheckIdMigrations(); err != nil {
+		return nil, fmt.Errorf("CheckIdMigrations() failed for quiz %v: %v", result.Id, err)
+	}
+
+	result.SetContentVersions()
 
 	return &result, nil
 }
@@ -91,6 +105,7 @@ func convertDtoQuestionToDomainQuestion(dto *dtoquiz.Question) (*domainquiz.Ques
 	var result domainquiz.Question
 	result.Id = dto.Id
 	result.Link = dto.Link
+	result.Tags = dto.Tags
 
 	var text *domainquiz.Text
 	var err error
@@ -191,6 +206,8 @@ func convertDtoSectionToDomainSection(dto *dtoquiz.Section) (*domainquiz.Section
 	}
 
 	result.AnswersAsChoices = dto.AnswersAsChoices
+	result.Tags = dto.Tags
+	result.ReverseOf = dto.ReverseOf
 
 	return &result, nil
 }
@@ -273,6 +273,8 @@ func testQuiz(prefix string) *dtoquiz.Quiz {
 
 		Sections:  testSections(subPrefix + "-some-quiz-sections"),
 		Questions: testQuestions(subPrefix + "-some-quiz-questions"),
+
+		Tags: []string{subPrefix + "some-tag-0", subPrefix + "some-tag-1"},
 	}
 }
 
@@ -298,6 +300,16 @@ func TestConvertDtoQuizToDomainQuiz(t *testing.T) {
 
 	assert.Equal(t, dto.UsesMathML, result.UsesMathML)
 	assert.Equal(t, dto.AnswersAsChoices, result.AnswersAsChoices)
+	assert.Equal(t, dto.Tags, result.Tags)
+
+	// The version is a hash, unless the quiz has an explicit version.
+	assert.NotEmpty(t, result.Version)
+	assert.NotEmpty(t, result.Questions[0].ContentHash)
+
+	dto.Version = 3
+	result, err = convertDtoQuizToDomainQuiz(dto)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", result.Version)
 }
 
 func TestConvertDtoQuizzesToDomainQuizzes(t *testing.T) {
@@ -13,4 +13,6 @@ type Question struct {
 	// TextSimple is an alternative to TextDetail.
 	// Only one of these should be set.
 	TextSimple string `json:"text,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
 }
@@ -14,6 +14,7 @@ type QuestionAndAnswer struct {
 func (self *QuestionAndAnswer) createReverse() *QuestionAndAnswer {
 	var result QuestionAndAnswer
 	result.Id = "reverse-" + self.Id
+	result.Tags = self.Tags
 
 	// Copy the answer to the question.
 	if self.AnswerSimple != "" {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 type Quiz struct {
@@ -12,38 +13,50 @@ type Quiz struct {
 	IsPrivate        bool `json:"isPrivate,omitempty"`
 	AnswersAsChoices bool `json:"answersAsChoices,omitempty"`
 
+	// An optional version number, to increase when the content changes.
+	// Otherwise, the version is a hash of the content.
+	Version int `json:"version,omitempty"`
+
 	Sections  []*Section           `json:"sections,omitempty"`
 	Questions []*QuestionAndAnswer `json:"questions,omitempty"`
 
 	UsesMathML bool `json:"usesMathML,omitempty"`
+
+	// Tags apply to all sections and questions in the quiz.
+	Tags []string `json:"tags,omitempty"`
+
+	// The IDs of sections and questions that have been renamed, so the users' stats can be kept.
+	IdMigrations IdMigrations `json:"idMigrations,omitzero"`
+}
+
+// IdMigrations maps old IDs to new IDs, such as {"sections": {"sorting": "sorting-algorithms"}}.
+// Several old IDs may map to the same new ID, to merge sections or questions.
+type IdMigrations struct {
+	Sections  map[string]string `json:"sections,omitempty"`
+	Questions map[string]string `json:"questions,omitempty"`
 }
 
 func LoadQuiz(absFilePath string, id string) (*Quiz, error) {
 	var q Quiz
 
 	file, err := os.Open(absFilePath)
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
-
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("os.Open() failed: %v", err)
 	}
 
+	// The file was only read, so there is nothing useful to do if closing it fails.
+	defer func() {
+		_ = file.Close()
+	}()
+
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("ioutil.ReadAll() failed for %v: %v", absFilePath, err)
 	}
 
 	err = json.Unmarshal(data, &q)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return nil, fmt.Errorf("json.Unmarshal() failed for %v: %v", absFilePath, err)
 	}
 
 	q.Id = id
@@ -64,6 +77,7 @@ func LoadQuiz(absFilePath string, id string) (*Quiz, error) {
 	}
 
 	q.addReverseSections()
+	q.IdMigrations.addReverseIds()
 
 	return &q, nil
 }
@@ -80,3 +94,20 @@ func (self *Quiz) addReverseSections() {
 
 	self.Sections = append(self.Sections, reverseSections...)
 }
+
+// addReverseIds also maps the IDs of the generated reverse sections and questions,
+// so a renamed section's reverse section is renamed too.
+// This is harmless for sections that have no reverse section.
+func (self *IdMigrations) addReverseIds() {
+	addReverse := func(ids map[string]string) {
+		for oldId, newId := range ids {
+			reverseOldId := "reverse-" + oldId
+			if _, ok := ids[reverseOldId]; !ok && !strings.HasPrefix(oldId, "reverse-") {
+				ids[reverseOldId] = "reverse-" + newId
+			}
+		}
+	}
+
+	addReverse(self.Sections)
+	addReverse(self.Questions)
+}
@@ -179,3 +179,39 @@ func TestLoadQuizWithNoSections(t *testing.T) {
 
 	assert.Equal(t, QUESTION_ID, qa.Id)
 }
+
+func TestLoadQuizWithTags(t *testing.T) {
+	q := loadQuiz(t, "graphs")
+
+	// TODO: This depends on knowledge of the real quiz.
+	assert.Contains(t, q.Tags, "graphs")
+
+	section := getSection(q, "polynomial-or-np-complete")
+	assert.NotNil(t, section)
+	assert.Contains(t, section.Tags, "complexity")
+}
+
+func TestIdMigrationsAddReverseIds(t *testing.T) {
+	migrations := IdMigrations{
+		Sections: map[string]string{"old-section": "section"},
+		Questions: map[string]string{
+			"old-question": "question",
+
+			// Explicitly renamed, differently.
+			"old-other":         "other",
+			"reverse-old-other": "reverse-something-else",
+		},
+	}
+
+	migrations.addReverseIds()
+	assert.Equal(t, map[string]string{
+		"old-section":         "section",
+		"reverse-old-section": "reverse-section",
+	}, migrations.Sections)
+	assert.Equal(t, map[string]string{
+		"old-question":         "question",
+		"reverse-old-question": "reverse-question",
+		"old-other":            "other",
+		"reverse-old-other":    "reverse-something-else",
+	}, migrations.Questions)
+}
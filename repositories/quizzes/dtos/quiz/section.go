@@ -11,6 +11,14 @@ type Section struct {
 	// Whether the quiz should contain an extra generated section,
 	// with the answers as questions, and the questions as the answers.
 	AndReverse bool `json:"andReverse,omitempty"`
+
+	// Tags apply to all questions in the section.
+	Tags []string `json:"tags,omitempty"`
+
+	// The ID of the section that this section was generated from,
+	// if it was generated because of AndReverse.
+	// This is not in the data files.
+	ReverseOf string `json:"-"`
 }
 
 func (self *Section) createReverse() *Section {
@@ -20,6 +28,8 @@ func (self *Section) createReverse() *Section {
 	result.Title = "Reverse: " + self.Title
 	result.Link = self.Link
 	result.AnswersAsChoices = self.AnswersAsChoices
+	result.Tags = self.Tags
+	result.ReverseOf = self.Id
 
 	for _, sub := range self.SubSections {
 		var reverseSub SubSection
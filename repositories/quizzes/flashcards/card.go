@@ -0,0 +1,147 @@
+package flashcards
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// The formats that we can write and read.
+const (
+	// Anki's "Notes in Plain Text" format, with file headers,
+	// so Anki can import it into subdecks without any manual mapping.
+	FORMAT_ANKI = "anki"
+
+	// Comma-separated values, with a header row.
+	FORMAT_CSV = "csv"
+
+	// Tab-separated term/definition pairs, one per line, with no header,
+	// as exported and imported by Quizlet.
+	FORMAT_TSV = "tsv"
+)
+
+// Anki's separator between the levels of a deck name.
+const DECK_SEPARATOR = "::"
+
+// Anki's built-in note types.
+const (
+	ANKI_NOTETYPE_BASIC              = "Basic"
+	ANKI_NOTETYPE_BASIC_AND_REVERSED = "Basic (and reversed card)"
+)
+
+type Text struct {
+	Text   string
+	IsHtml bool
+}
+
+// Card is one flashcard, with a question on the front and its answer on the back.
+type Card struct {
+	// The (sub)deck path, without the quiz's own deck.
+	// For instance, the section title followed by the sub-section title.
+	Deck []string
+
+	Front Text
+	Back  Text
+
+	Tags []string
+
+	// Whether the card should also be studied with the front and back swapped.
+	AndReverse bool
+}
+
+func IsValidFormat(format string) bool {
+	switch format {
+	case FORMAT_ANKI, FORMAT_CSV, FORMAT_TSV:
+		return true
+	default:
+		return false
+	}
+}
+
+func checkFormat(format string) error {
+	if !IsValidFormat(format) {
+		return fmt.Errorf("unknown flashcards format: %v", format)
+	}
+
+	return nil
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FORMAT_CSV:
+		return "text/csv; charset=utf-8"
+	case FORMAT_TSV:
+		return "text/tab-separated-values; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func FileExtension(format string) string {
+	switch format {
+	case FORMAT_CSV:
+		return "csv"
+	case FORMAT_TSV:
+		return "tsv"
+	default:
+		return "txt"
+	}
+}
+
+var htmlTagRegexp = regexp.MustCompile(`</?[a-zA-Z][^<>]*>`)
+
+// parseText guesses whether text from another tool is HTML.
+// unescape should be true if the plain text has been HTML-escaped, as by Anki.
+func parseText(str string, unescape bool) Text {
+	if htmlTagRegexp.MatchString(str) {
+		return Text{Text: str, IsHtml: true}
+	}
+
+	if unescape {
+		str = html.UnescapeString(str)
+	}
+
+	return Text{Text: str}
+}
+
+// textAsHtml returns the text as HTML, escaping it if it is plain text.
+func textAsHtml(text *Text) string {
+	if text.IsHtml {
+		return text.Text
+	}
+
+	str := html.EscapeString(text.Text)
+	return strings.ReplaceAll(str, "\n", "<br>")
+}
+
+// joinTags joins tags with spaces, as used by Anki, so a tag may not contain a space.
+func joinTags(tags []string) string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, strings.Join(strings.Fields(tag), "_"))
+	}
+
+	return strings.Join(result, " ")
+}
+
+func splitTags(str string) []string {
+	return strings.Fields(str)
+}
+
+func splitDeck(str string) []string {
+	if str == "" {
+		return nil
+	}
+
+	parts := strings.Split(str, DECK_SEPARATOR)
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,289 @@
+package flashcards
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dtoquiz "github.com/murraycu/go-bigoquiz-server/repositories/quizzes/dtos/quiz"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCards() []*Card {
+	return []*Card{
+		{
+			Deck:  []string{"Sorting"},
+			Front: Text{Text: "Bubble sort, worst case"},
+			Back:  Text{Text: "O(n²) < O(n³)"},
+			Tags:  []string{"sorting", "worst case"},
+		},
+		{
+			Deck:       []string{"Sorting", "Stable"},
+			Front:      Text{Text: "Merge sort,\tstable?\nReally?"},
+			Back:       Text{Text: "<b>Yes</b>", IsHtml: true},
+			AndReverse: true,
+		},
+		{
+			Deck:  []string{"Searching"},
+			Front: Text{Text: `Binary search, "sorted" input`},
+			Back:  Text{Text: "O(log n)"},
+		},
+	}
+}
+
+func TestWriteCardsUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCards(&buf, "apkg", "Algorithms", testCards())
+	assert.NotNil(t, err)
+}
+
+func TestWriteCardsAnkiHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCards(&buf, FORMAT_ANKI, "Algorithms", testCards())
+	assert.Nil(t, err)
+
+	str := buf.String()
+	assert.True(t, strings.HasPrefix(str, "#separator:tab\n#html:true\n"))
+	assert.Contains(t, str, "Algorithms::Sorting::Stable")
+	assert.Contains(t, str, ANKI_NOTETYPE_BASIC_AND_REVERSED)
+
+	// Plain text should be escaped, because the fields are HTML.
+	assert.Contains(t, str, "O(n²) &lt; O(n³)")
+	assert.Contains(t, str, "sorting worst_case")
+}
+
+func TestReadCardsAnkiRoundTrip(t *testing.T) {
+	cards := testCards()
+
+	var buf bytes.Buffer
+	err := WriteCards(&buf, FORMAT_ANKI, "Algorithms", cards)
+	assert.Nil(t, err)
+
+	deckName, result, err := ReadCards(&buf, FORMAT_ANKI)
+	assert.Nil(t, err)
+	assert.Equal(t, "Algorithms", deckName)
+	assert.Len(t, result, len(cards))
+
+	assert.Equal(t, cards[0].Deck, result[0].Deck)
+	assert.Equal(t, cards[0].Front, result[0].Front)
+	assert.Equal(t, cards[0].Back, result[0].Back)
+	assert.Equal(t, []string{"sorting", "worst_case"}, result[0].Tags)
+	assert.False(t, result[0].AndReverse)
+
+	assert.Equal(t, cards[1].Deck, result[1].Deck)
+	assert.Equal(t, cards[1].Back, result[1].Back)
+	assert.True(t, result[1].AndReverse)
+
+	// The line break becomes HTML.
+	assert.True(t, result[1].Front.IsHtml)
+	assert.Equal(t, "Merge sort,\tstable?<br>Really?", result[1].Front.Text)
+
+	assert.Equal(t, cards[2].Front, result[2].Front)
+}
+
+func TestReadCardsAnkiWithoutHeaders(t *testing.T) {
+	input := "Bubble sort\tO(n²)\nMerge sort\tO(n log n)\n"
+
+	deckName, result, err := ReadCards(strings.NewReader(input), FORMAT_ANKI)
+	assert.Nil(t, err)
+	assert.Empty(t, deckName)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "Merge sort", result[1].Front.Text)
+	assert.Equal(t, "O(n log n)", result[1].Back.Text)
+	assert.Empty(t, result[1].Deck)
+}
+
+func TestReadCardsAnkiOtherSeparator(t *testing.T) {
+	input := "#separator:Semicolon\n#html:false\n#guid column:1\n#deck column:2\nabc;Spanish::Colors;rojo;red\n"
+
+	deckName, result, err := ReadCards(strings.NewReader(input), FORMAT_ANKI)
+	assert.Nil(t, err)
+	assert.Equal(t, "Spanish", deckName)
+	assert.Len(t, result, 1)
+	assert.Equal(t, []string{"Colors"}, result[0].Deck)
+	assert.Equal(t, Text{Text: "rojo"}, result[0].Front)
+	assert.Equal(t, Text{Text: "red"}, result[0].Back)
+}
+
+func TestReadCardsAnkiMissingBack(t *testing.T) {
+	_, _, err := ReadCards(strings.NewReader("just a front\n"), FORMAT_ANKI)
+	assert.NotNil(t, err)
+}
+
+func TestReadCardsCsvRoundTrip(t *testing.T) {
+	cards := testCards()
+
+	var buf bytes.Buffer
+	err := WriteCards(&buf, FORMAT_CSV, "Algorithms", cards)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "front,back,deck,tags,reverse\n"))
+
+	deckName, result, err := ReadCards(&buf, FORMAT_CSV)
+	assert.Nil(t, err)
+	assert.Empty(t, deckName)
+	assert.Len(t, result, len(cards))
+
+	for i, card := range cards {
+		assert.Equal(t, card.Deck, result[i].Deck)
+		assert.Equal(t, card.Front, result[i].Front)
+		assert.Equal(t, card.Back, result[i].Back)
+		assert.Equal(t, card.AndReverse, result[i].AndReverse)
+	}
+}
+
+func TestReadCardsCsvHeaderAliases(t *testing.T) {
+	input := "Term,Definition\nrojo,red\n"
+
+	_, result, err := ReadCards(strings.NewReader(input), FORMAT_CSV)
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "rojo", result[0].Front.Text)
+	assert.Equal(t, "red", result[0].Back.Text)
+}
+
+func TestReadCardsCsvNoHeader(t *testing.T) {
+	_, _, err := ReadCards(strings.NewReader("rojo,red\n"), FORMAT_CSV)
+	assert.NotNil(t, err)
+}
+
+func TestReadCardsCsvInvalidReverse(t *testing.T) {
+	_, _, err := ReadCards(strings.NewReader("front,back,reverse\nrojo,red,maybe\n"), FORMAT_CSV)
+	assert.NotNil(t, err)
+}
+
+func TestWriteCardsTsv(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCards(&buf, FORMAT_TSV, "Algorithms", testCards())
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "Merge sort, stable? Really?\t<b>Yes</b>", lines[1])
+}
+
+func TestReadCardsTsv(t *testing.T) {
+	input := "rojo\tred\r\n\nazul\tblue\n"
+
+	deckName, result, err := ReadCards(strings.NewReader(input), FORMAT_TSV)
+	assert.Nil(t, err)
+	assert.Empty(t, deckName)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "azul", result[1].Front.Text)
+	assert.Equal(t, "blue", result[1].Back.Text)
+}
+
+func TestReadCardsTsvMissingTab(t *testing.T) {
+	_, _, err := ReadCards(strings.NewReader("rojo red\n"), FORMAT_TSV)
+	assert.NotNil(t, err)
+}
+
+func TestSlugify(t *testing.T) {
+	assert.Equal(t, "bubble-sort-worst-case", slugify("Bubble sort, worst case!"))
+	assert.Equal(t, "o-n-log-n", slugify("O(n log n)"))
+	assert.Empty(t, slugify("()"))
+	assert.Len(t, slugify(strings.Repeat("abc ", 100)), maxIdLength)
+}
+
+func TestBuildQuiz(t *testing.T) {
+	q := BuildQuiz("algorithms", "Algorithms", testCards(), false)
+	assert.Equal(t, "algorithms", q.Id)
+	assert.Equal(t, "Algorithms", q.Title)
+	assert.Len(t, q.Sections, 2)
+
+	sorting := q.Sections[0]
+	assert.Equal(t, "sorting", sorting.Id)
+	assert.Equal(t, "Sorting", sorting.Title)
+	assert.True(t, sorting.AndReverse)
+	assert.Len(t, sorting.Questions, 1)
+	assert.Equal(t, "sorting-bubble-sort-worst-case", sorting.Questions[0].Id)
+	assert.Equal(t, "Bubble sort, worst case", sorting.Questions[0].TextSimple)
+	assert.Equal(t, "O(n²) < O(n³)", sorting.Questions[0].AnswerSimple)
+
+	assert.Len(t, sorting.SubSections, 1)
+	stable := sorting.SubSections[0]
+	assert.Equal(t, "Stable", stable.Title)
+	assert.Len(t, stable.Questions, 1)
+	assert.Equal(t, dtoquiz.Text{Text: "<b>Yes</b>", IsHtml: true}, stable.Questions[0].AnswerDetail)
+
+	searching := q.Sections[1]
+	assert.False(t, searching.AndReverse)
+}
+
+func TestBuildQuizWithoutDecks(t *testing.T) {
+	cards := []*Card{
+		{Front: Text{Text: "rojo"}, Back: Text{Text: "red"}},
+		{Front: Text{Text: "rojo"}, Back: Text{Text: "scarlet"}},
+	}
+
+	q := BuildQuiz("spanish", "Spanish", cards, true)
+	assert.Len(t, q.Sections, 1)
+
+	section := q.Sections[0]
+	assert.Equal(t, "Spanish", section.Title)
+	assert.True(t, section.AndReverse)
+	assert.Len(t, section.Questions, 2)
+
+	// The IDs must be unique.
+	assert.Equal(t, "spanish-rojo", section.Questions[0].Id)
+	assert.Equal(t, "spanish-rojo-2", section.Questions[1].Id)
+}
+
+func TestBuildQuizDetectsReversedCards(t *testing.T) {
+	cards := []*Card{
+		{Front: Text{Text: "rojo"}, Back: Text{Text: "red"}},
+		{Front: Text{Text: "azul"}, Back: Text{Text: "blue"}},
+		{Front: Text{Text: "red"}, Back: Text{Text: "rojo"}},
+	}
+
+	q := BuildQuiz("spanish", "Spanish", cards, false)
+	assert.Len(t, q.Sections, 1)
+	assert.True(t, q.Sections[0].AndReverse)
+	assert.Len(t, q.Sections[0].Questions, 2)
+}
+
+func TestBuildQuizDetectsReverseDecks(t *testing.T) {
+	cards := []*Card{
+		{Deck: []string{"Colors"}, Front: Text{Text: "rojo"}, Back: Text{Text: "red"}},
+		{Deck: []string{"Reverse: Colors"}, Front: Text{Text: "red"}, Back: Text{Text: "rojo"}},
+		{Deck: []string{"Reverse: Numbers"}, Front: Text{Text: "one"}, Back: Text{Text: "uno"}},
+	}
+
+	q := BuildQuiz("spanish", "Spanish", cards, false)
+	assert.Len(t, q.Sections, 2)
+
+	assert.Equal(t, "Colors", q.Sections[0].Title)
+	assert.True(t, q.Sections[0].AndReverse)
+	assert.Len(t, q.Sections[0].Questions, 1)
+
+	// There is no "Numbers" section, so this is just a normal section.
+	assert.Equal(t, "Reverse: Numbers", q.Sections[1].Title)
+	assert.False(t, q.Sections[1].AndReverse)
+	assert.Len(t, q.Sections[1].Questions, 1)
+}
+
+func TestBuildQuizIsValidQuizJson(t *testing.T) {
+	q := BuildQuiz("algorithms", "Algorithms", testCards(), false)
+
+	data, err := json.Marshal(q)
+	assert.Nil(t, err)
+
+	filePath := filepath.Join(t.TempDir(), "algorithms.json")
+	err = os.WriteFile(filePath, data, 0644)
+	assert.Nil(t, err)
+
+	loaded, err := dtoquiz.LoadQuiz(filePath, "algorithms")
+	assert.Nil(t, err)
+	assert.NotNil(t, loaded)
+
+	// The AndReverse section gets its generated reverse section.
+	assert.Len(t, loaded.Sections, 3)
+	assert.Equal(t, "reverse-sorting", loaded.Sections[2].Id)
+	assert.Equal(t, "sorting", loaded.Sections[2].ReverseOf)
+
+	// The sub-section questions survive the round trip.
+	assert.Len(t, loaded.Sections[0].SubSections, 1)
+	assert.Len(t, loaded.Sections[0].SubSections[0].Questions, 1)
+}
@@ -0,0 +1,209 @@
+package flashcards
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	dtoquiz "github.com/murraycu/go-bigoquiz-server/repositories/quizzes/dtos/quiz"
+)
+
+// The prefix of the titles of the reverse sections generated for AndReverse.
+const REVERSE_SECTION_TITLE_PREFIX = "Reverse: "
+
+// The maximum length of a generated ID, before any suffix to make it unique.
+const maxIdLength = 50
+
+type cardPair struct {
+	front string
+	back  string
+}
+
+// sectionBuilder collects the cards of one section and its sub-sections.
+type sectionBuilder struct {
+	section *dtoquiz.Section
+
+	subSections map[string]*dtoquiz.SubSection
+
+	// The cards already in the section, to find cards that are the reverse of another.
+	pairs map[cardPair]bool
+}
+
+// quizBuilder generates unique IDs for the sections and questions.
+type quizBuilder struct {
+	usedIds map[string]bool
+}
+
+// slugify creates an ID, such as "bubble-sort", from a title or question.
+func slugify(str string) string {
+	var b strings.Builder
+	needsDash := false
+	for _, r := range strings.ToLower(str) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if needsDash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+
+			b.WriteRune(r)
+			needsDash = false
+		} else {
+			needsDash = true
+		}
+
+		if b.Len() >= maxIdLength {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+func (self *quizBuilder) uniqueId(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if slug := slugify(part); slug != "" {
+			nonEmpty = append(nonEmpty, slug)
+		}
+	}
+
+	id := strings.Join(nonEmpty, "-")
+	if id == "" {
+		id = "question"
+	}
+
+	result := id
+	for i := 2; self.usedIds[result]; i++ {
+		result = id + "-" + strconv.Itoa(i)
+	}
+
+	self.usedIds[result] = true
+	return result
+}
+
+func setQuestionText(qa *dtoquiz.QuestionAndAnswer, card *Card) {
+	if card.Front.IsHtml {
+		qa.TextDetail.Text = card.Front.Text
+		qa.TextDetail.IsHtml = true
+	} else {
+		qa.TextSimple = card.Front.Text
+	}
+
+	if card.Back.IsHtml {
+		qa.AnswerDetail.Text = card.Back.Text
+		qa.AnswerDetail.IsHtml = true
+	} else {
+		qa.AnswerSimple = card.Back.Text
+	}
+}
+
+// BuildQuiz creates a quiz from flashcards, with a section for each top-level deck,
+// and a sub-section for any deeper decks.
+//
+// A section gets AndReverse if any of its cards should be reversed,
+// if it contains both a card and its reverse, or if there is a matching "Reverse: " deck,
+// as exported for an AndReverse section by some tools.
+// In the last two cases, the reversed cards are not added, because the quiz will generate them.
+// andReverse sets AndReverse for all the sections.
+func BuildQuiz(id string, title string, cards []*Card, andReverse bool) *dtoquiz.Quiz {
+	var result dtoquiz.Quiz
+	result.Id = id
+	result.Title = title
+
+	builder := quizBuilder{usedIds: make(map[string]bool)}
+
+	var sectionBuilders []*sectionBuilder
+	sectionsByTitle := make(map[string]*sectionBuilder)
+	getSection := func(sectionTitle string) *sectionBuilder {
+		sb := sectionsByTitle[sectionTitle]
+		if sb == nil {
+			var section dtoquiz.Section
+			section.Id = builder.uniqueId(sectionTitle)
+			section.Title = sectionTitle
+
+			sb = &sectionBuilder{
+				section:     &section,
+				subSections: make(map[string]*dtoquiz.SubSection),
+				pairs:       make(map[cardPair]bool),
+			}
+			sectionsByTitle[sectionTitle] = sb
+			sectionBuilders = append(sectionBuilders, sb)
+		}
+
+		return sb
+	}
+
+	var reverseDeckCards []*Card
+	for _, card := range cards {
+		sectionTitle := title
+		if len(card.Deck) > 0 {
+			sectionTitle = card.Deck[0]
+		}
+
+		// Deal with these after we have found all the other sections.
+		if strings.HasPrefix(sectionTitle, REVERSE_SECTION_TITLE_PREFIX) {
+			reverseDeckCards = append(reverseDeckCards, card)
+			continue
+		}
+
+		addCard(&builder, getSection(sectionTitle), card)
+	}
+
+	for _, card := range reverseDeckCards {
+		sectionTitle := strings.TrimPrefix(card.Deck[0], REVERSE_SECTION_TITLE_PREFIX)
+		if sb := sectionsByTitle[sectionTitle]; sb != nil {
+			sb.section.AndReverse = true
+			continue
+		}
+
+		// There is no section that this could be the reverse of.
+		addCard(&builder, getSection(card.Deck[0]), card)
+	}
+
+	for _, sb := range sectionBuilders {
+		if andReverse {
+			sb.section.AndReverse = true
+		}
+
+		result.Sections = append(result.Sections, sb.section)
+	}
+
+	return &result
+}
+
+func addCard(builder *quizBuilder, sb *sectionBuilder, card *Card) {
+	section := sb.section
+	if card.AndReverse {
+		section.AndReverse = true
+	}
+
+	pair := cardPair{front: card.Front.Text, back: card.Back.Text}
+	if sb.pairs[cardPair{front: pair.back, back: pair.front}] {
+		// This is the reverse of a card that we already have.
+		section.AndReverse = true
+		return
+	}
+
+	sb.pairs[pair] = true
+
+	var qa dtoquiz.QuestionAndAnswer
+	qa.Id = builder.uniqueId(section.Id, card.Front.Text)
+	qa.Tags = card.Tags
+	setQuestionText(&qa, card)
+
+	if len(card.Deck) < 2 {
+		section.Questions = append(section.Questions, &qa)
+		return
+	}
+
+	subSectionTitle := strings.Join(card.Deck[1:], " - ")
+	subSection := sb.subSections[subSectionTitle]
+	if subSection == nil {
+		subSection = &dtoquiz.SubSection{}
+		subSection.Id = builder.uniqueId(subSectionTitle)
+		subSection.Title = subSectionTitle
+		sb.subSections[subSectionTitle] = subSection
+		section.SubSections = append(section.SubSections, subSection)
+	}
+
+	subSection.Questions = append(subSection.Questions, &qa)
+}
@@ -0,0 +1,288 @@
+package flashcards
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadCards reads cards in the format, as written by WriteCards() or by the other tools.
+//
+// For the Anki format, if all the cards are in subdecks of the same top-level deck,
+// that deck's name is returned as deckName and is removed from the cards' decks.
+func ReadCards(r io.Reader, format string) (deckName string, cards []*Card, err error) {
+	if err := checkFormat(format); err != nil {
+		return "", nil, err
+	}
+
+	switch format {
+	case FORMAT_ANKI:
+		cards, err = readAnki(r)
+		if err != nil {
+			return "", nil, err
+		}
+
+		deckName, cards = removeCommonDeck(cards)
+		return deckName, cards, nil
+	case FORMAT_CSV:
+		cards, err = readCsv(r)
+		return "", cards, err
+	default:
+		cards, err = readTsv(r)
+		return "", cards, err
+	}
+}
+
+// removeCommonDeck removes the top-level deck if it is shared by all the cards.
+func removeCommonDeck(cards []*Card) (string, []*Card) {
+	if len(cards) == 0 || len(cards[0].Deck) == 0 {
+		return "", cards
+	}
+
+	common := cards[0].Deck[0]
+	for _, card := range cards {
+		if len(card.Deck) == 0 || card.Deck[0] != common {
+			return "", cards
+		}
+	}
+
+	for _, card := range cards {
+		card.Deck = card.Deck[1:]
+	}
+
+	return common, cards
+}
+
+func parseAnkiSeparator(value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "tab", "\t":
+		return '\t', nil
+	case "comma", ",":
+		return ',', nil
+	case "semicolon", ";":
+		return ';', nil
+	case "pipe", "|":
+		return '|', nil
+	case "colon", ":":
+		return ':', nil
+	case "space", " ":
+		return ' ', nil
+	default:
+		return 0, fmt.Errorf("unknown separator: %v", value)
+	}
+}
+
+// parseAnkiColumn parses a 1-based column number from a header, returning a 0-based index.
+func parseAnkiColumn(key string, value string) (int, error) {
+	column, err := strconv.Atoi(value)
+	if err != nil || column < 1 {
+		return 0, fmt.Errorf("invalid column number for %v: %v", key, value)
+	}
+
+	return column - 1, nil
+}
+
+func readAnki(r io.Reader) ([]*Card, error) {
+	reader := bufio.NewReader(r)
+
+	separator := '\t'
+	isHtml := false
+	deckColumn := -1
+	tagsColumn := -1
+	notetypeColumn := -1
+	guidColumn := -1
+
+	// Parse the file headers, which must be at the start of the file.
+	// See https://docs.ankiweb.net/importing/text-files.html#file-headers
+	for {
+		next, err := reader.Peek(1)
+		if err != nil || next[0] != '#' {
+			break
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("ReadString() failed: %v", err)
+		}
+
+		key, value, found := strings.Cut(strings.TrimRight(line[1:], "\r\n"), ":")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "separator":
+			separator, err = parseAnkiSeparator(value)
+		case "html":
+			isHtml, err = strconv.ParseBool(value)
+		case "deck column":
+			deckColumn, err = parseAnkiColumn(key, value)
+		case "tags column":
+			tagsColumn, err = parseAnkiColumn(key, value)
+		case "notetype column":
+			notetypeColumn, err = parseAnkiColumn(key, value)
+		case "guid column":
+			guidColumn, err = parseAnkiColumn(key, value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %v", line, err)
+		}
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = separator
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	var result []*Card
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Read() failed: %v", err)
+		}
+
+		var card Card
+		var fields []string
+		for i, value := range record {
+			switch i {
+			case deckColumn:
+				card.Deck = splitDeck(value)
+			case tagsColumn:
+				card.Tags = splitTags(value)
+			case notetypeColumn:
+				card.AndReverse = strings.Contains(strings.ToLower(value), "reverse")
+			case guidColumn:
+				// Ignore it.
+			default:
+				fields = append(fields, value)
+			}
+		}
+
+		if len(fields) < 2 {
+			line, _ := csvReader.FieldPos(0)
+			return nil, fmt.Errorf("line %v has no back field", line)
+		}
+
+		if isHtml {
+			card.Front = parseText(fields[0], true)
+			card.Back = parseText(fields[1], true)
+		} else {
+			card.Front = Text{Text: fields[0]}
+			card.Back = Text{Text: fields[1]}
+		}
+
+		result = append(result, &card)
+	}
+
+	return result, nil
+}
+
+// findCsvColumn returns the index of the first column with any of the names, or -1.
+func findCsvColumn(header []string, names ...string) int {
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		for _, name := range names {
+			if column == name {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func readCsv(r io.Reader) ([]*Card, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Read() failed for the header: %v", err)
+	}
+
+	frontColumn := findCsvColumn(header, "front", "question", "term")
+	backColumn := findCsvColumn(header, "back", "answer", "definition")
+	if frontColumn < 0 || backColumn < 0 {
+		return nil, fmt.Errorf("the header needs front and back columns: %v", header)
+	}
+
+	deckColumn := findCsvColumn(header, "deck", "section")
+	tagsColumn := findCsvColumn(header, "tags")
+	reverseColumn := findCsvColumn(header, "reverse")
+
+	get := func(record []string, column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+
+		return record[column]
+	}
+
+	var result []*Card
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Read() failed: %v", err)
+		}
+
+		var card Card
+		card.Front = parseText(get(record, frontColumn), false)
+		card.Back = parseText(get(record, backColumn), false)
+		card.Deck = splitDeck(get(record, deckColumn))
+		card.Tags = splitTags(get(record, tagsColumn))
+
+		if reverse := get(record, reverseColumn); reverse != "" {
+			card.AndReverse, err = strconv.ParseBool(reverse)
+			if err != nil {
+				line, _ := csvReader.FieldPos(reverseColumn)
+				return nil, fmt.Errorf("invalid reverse value on line %v: %v", line, reverse)
+			}
+		}
+
+		result = append(result, &card)
+	}
+
+	return result, nil
+}
+
+func readTsv(r io.Reader) ([]*Card, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	var result []*Card
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		front, back, found := strings.Cut(line, "\t")
+		if !found {
+			return nil, fmt.Errorf("line %v has no tab between the front and back", lineNumber)
+		}
+
+		var card Card
+		card.Front = parseText(front, false)
+		card.Back = parseText(back, false)
+		result = append(result, &card)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan() failed: %v", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package flashcards
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The header row of the CSV format.
+var csvHeader = []string{"front", "back", "deck", "tags", "reverse"}
+
+// WriteCards writes the cards in the format.
+//
+// deckName is the name of the top-level deck, such as the quiz title.
+// The cards' own decks are its subdecks.
+func WriteCards(w io.Writer, format string, deckName string, cards []*Card) error {
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+
+	switch format {
+	case FORMAT_ANKI:
+		return writeAnki(w, deckName, cards)
+	case FORMAT_CSV:
+		return writeCsv(w, cards)
+	default:
+		return writeTsv(w, cards)
+	}
+}
+
+func writeAnki(w io.Writer, deckName string, cards []*Card) error {
+	// See https://docs.ankiweb.net/importing/text-files.html#file-headers
+	headers := []string{
+		"#separator:tab",
+		"#html:true",
+		"#notetype column:1",
+		"#deck column:2",
+		"#tags column:5",
+	}
+
+	for _, header := range headers {
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return fmt.Errorf("Fprintln() failed: %v", err)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+
+	for _, card := range cards {
+		notetype := ANKI_NOTETYPE_BASIC
+		if card.AndReverse {
+			notetype = ANKI_NOTETYPE_BASIC_AND_REVERSED
+		}
+
+		deck := make([]string, 0, len(card.Deck)+1)
+		if deckName != "" {
+			deck = append(deck, deckName)
+		}
+		deck = append(deck, card.Deck...)
+
+		record := []string{
+			notetype,
+			strings.Join(deck, DECK_SEPARATOR),
+			textAsHtml(&card.Front),
+			textAsHtml(&card.Back),
+			joinTags(card.Tags),
+		}
+
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("Write() failed: %v", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeCsv(w io.Writer, cards []*Card) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("Write() failed: %v", err)
+	}
+
+	for _, card := range cards {
+		reverse := ""
+		if card.AndReverse {
+			reverse = strconv.FormatBool(card.AndReverse)
+		}
+
+		record := []string{
+			card.Front.Text,
+			card.Back.Text,
+			strings.Join(card.Deck, DECK_SEPARATOR),
+			joinTags(card.Tags),
+			reverse,
+		}
+
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("Write() failed: %v", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// tsvField removes the tabs and line breaks that Quizlet would take as separators.
+func tsvField(str string) string {
+	return strings.Join(strings.Fields(str), " ")
+}
+
+func writeTsv(w io.Writer, cards []*Card) error {
+	for _, card := range cards {
+		_, err := fmt.Fprintf(w, "%s\t%s\n", tsvField(card.Front.Text), tsvField(card.Back.Text))
+		if err != nil {
+			return fmt.Errorf("Fprintf() failed: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -40,8 +40,7 @@ func filesWithExtension(dirPath string, ext string) ([]string, error) {
 
 	files, err := ioutil.ReadDir(dirPath)
 	if err != nil {
-		fmt.Println(err)
-		return result, err
+		return result, fmt.Errorf("ioutil.ReadDir() failed: %v", err)
 	}
 
 	dotSuffix := "." + ext
@@ -75,15 +74,13 @@ func loadQuizzesAsDto(directoryFilepath string) (MapDtoQuizzes, error) {
 
 	quizNames, err := filesWithExtension(directoryFilepath, "json")
 	if err != nil {
-		fmt.Println(err)
-		return quizzes, err
+		return quizzes, fmt.Errorf("filesWithExtension() failed: %v", err)
 	}
 
 	for _, name := range quizNames {
 		q, err := loadQuizAsDto(directoryFilepath, name)
 		if err != nil {
-			fmt.Println(err)
-			return quizzes, err
+			return quizzes, fmt.Errorf("loadQuizAsDto() failed for quiz %v: %v", name, err)
 		}
 
 		quizzes[q.Id] = q
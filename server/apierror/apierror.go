@@ -0,0 +1,177 @@
+// Package apierror writes errors to API clients as RFC 7807 problem details,
+// with stable codes that clients may check, instead of the human-readable messages.
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/murraycu/go-bigoquiz-server/server/logging"
+)
+
+// Code identifies the kind of error. These values must not change, because clients check them.
+type Code string
+
+const (
+	// The request is invalid in some way not covered by a more specific code.
+	CODE_INVALID_REQUEST Code = "invalid_request"
+
+	// The request body is not valid JSON, or does not have the expected structure.
+	CODE_INVALID_JSON Code = "invalid_json"
+
+	// A required query or path parameter is missing. Details has the "parameter".
+	CODE_MISSING_PARAMETER Code = "missing_parameter"
+
+	// A query parameter, or a field in the request body, has an invalid value. Details has the "parameter".
+	CODE_INVALID_PARAMETER Code = "invalid_parameter"
+
+	// The request has too many items, such as answers to sync.
+	CODE_TOO_MANY_ITEMS Code = "too_many_items"
+
+	// The user must log in first.
+	CODE_NOT_LOGGED_IN Code = "not_logged_in"
+
+	// The user is logged in, but may not do this.
+	CODE_FORBIDDEN Code = "forbidden"
+
+	// The request, which would change the user's data, did not come from the frontend, or did not have the CSRF token.
+	CODE_CROSS_SITE_REQUEST Code = "cross_site_request"
+
+	CODE_NOT_FOUND             Code = "not_found"
+	CODE_QUIZ_NOT_FOUND        Code = "quiz_not_found"
+	CODE_SECTION_NOT_FOUND     Code = "section_not_found"
+	CODE_QUESTION_NOT_FOUND    Code = "question_not_found"
+	CODE_COLLECTION_NOT_FOUND  Code = "collection_not_found"
+	CODE_CERTIFICATE_NOT_FOUND Code = "certificate_not_found"
+	CODE_GROUP_NOT_FOUND       Code = "group_not_found"
+	CODE_ASSIGNMENT_NOT_FOUND  Code = "assignment_not_found"
+
+	// The group already has its maximum number of members.
+	CODE_GROUP_FULL Code = "group_full"
+
+	// There are no more questions to choose as the next question.
+	CODE_NO_QUESTION_AVAILABLE Code = "no_question_available"
+
+	CODE_NOTHING_TO_UNDO Code = "nothing_to_undo"
+	CODE_UNDO_EXPIRED    Code = "undo_expired"
+
+	CODE_METHOD_NOT_ALLOWED Code = "method_not_allowed"
+
+	CODE_LOGIN_FAILED Code = "login_failed"
+
+	// The client has made too many requests. The Retry-After header says when to try again.
+	CODE_RATE_LIMITED Code = "rate_limited"
+
+	// Something went wrong on the server. The message is only shown if SetShowInternalErrors(true) was called.
+	CODE_INTERNAL_ERROR Code = "internal_error"
+)
+
+const CONTENT_TYPE = "application/problem+json"
+
+// The message shown, instead of the real message, for server errors, unless SetShowInternalErrors(true) was called.
+const internalErrorMessage = "internal server error"
+
+// Problem is the response body, as described by RFC 7807.
+type Problem struct {
+	// A URI reference that identifies the kind of problem. This is "about:blank", so Title is just the HTTP status text.
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+
+	// Extension members:
+
+	Code Code `json:"code"`
+
+	// A human-readable explanation, which clients should not parse.
+	Message string `json:"message"`
+
+	Details map[string]string `json:"details,omitempty"`
+}
+
+var showInternalErrors atomic.Bool
+
+// SetShowInternalErrors chooses whether the messages of server errors are sent to the client.
+// These messages can contain details about the server, so this should only be true when developing.
+func SetShowInternalErrors(show bool) {
+	showInternalErrors.Store(show)
+}
+
+// NewProblem returns the problem that Write() would write.
+func NewProblem(status int, code Code, message string, details map[string]string) *Problem {
+	if status >= http.StatusInternalServerError && !showInternalErrors.Load() {
+		message = internalErrorMessage
+		details = nil
+	}
+
+	return &Problem{
+		Type:    "about:blank",
+		Title:   http.StatusText(status),
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+}
+
+// Write logs the error and writes it to the client.
+// details may be nil.
+func Write(w http.ResponseWriter, status int, code Code, message string, details map[string]string) {
+	// So the record has the request's ID.
+	c := logging.ContextFromResponseWriter(w)
+
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	slog.Log(c, level, message, "status", status, "code", code)
+
+	problem := NewProblem(status, code, message, details)
+	body, err := json.Marshal(problem)
+	if err != nil {
+		// This should never happen.
+		slog.ErrorContext(c, "json.Marshal() failed for problem", "error", err)
+		http.Error(w, problem.Message, status)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", CONTENT_TYPE)
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	// Don't cache errors, even for responses that would otherwise be cached.
+	header.Set("Cache-Control", "no-store")
+	header.Del("ETag")
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	header.Del("Content-Disposition")
+
+	w.WriteHeader(status)
+
+	// It's too late to report an error to the client.
+	_, _ = w.Write(body)
+}
+
+// Writef is like Write(), but formats the message.
+func Writef(w http.ResponseWriter, status int, code Code, format string, a ...interface{}) {
+	Write(w, status, code, fmt.Sprintf(format, a...), nil)
+}
+
+// NotFoundHandler returns a handler that writes a CODE_NOT_FOUND problem,
+// for instance for httprouter's NotFound.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, http.StatusNotFound, CODE_NOT_FOUND, "not found", nil)
+	})
+}
+
+// MethodNotAllowedHandler returns a handler that writes a CODE_METHOD_NOT_ALLOWED problem,
+// for instance for httprouter's MethodNotAllowed, which sets the Allow header before calling it.
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, http.StatusMethodNotAllowed, CODE_METHOD_NOT_ALLOWED, "method not allowed", nil)
+	})
+}
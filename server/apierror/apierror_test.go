@@ -0,0 +1,72 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) *Problem {
+	assert.Equal(t, CONTENT_TYPE, w.Header().Get("Content-Type"))
+
+	var result Problem
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+	assert.Nil(t, err)
+
+	return &result
+}
+
+func TestWriteClientError(t *testing.T) {
+	w := httptest.NewRecorder()
+	Write(w, http.StatusBadRequest, CODE_MISSING_PARAMETER, "quiz-id not specified", map[string]string{"parameter": "quiz-id"})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	problem := decodeProblem(t, w)
+	assert.Equal(t, "about:blank", problem.Type)
+	assert.Equal(t, "Bad Request", problem.Title)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, CODE_MISSING_PARAMETER, problem.Code)
+	assert.Equal(t, "quiz-id not specified", problem.Message)
+	assert.Equal(t, "quiz-id", problem.Details["parameter"])
+}
+
+func TestWriteServerErrorHidesMessage(t *testing.T) {
+	SetShowInternalErrors(false)
+
+	w := httptest.NewRecorder()
+	Writef(w, http.StatusInternalServerError, CODE_INTERNAL_ERROR, "GetUserStats() failed: %v", "some database detail")
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "some database detail")
+
+	problem := decodeProblem(t, w)
+	assert.Equal(t, CODE_INTERNAL_ERROR, problem.Code)
+	assert.Equal(t, internalErrorMessage, problem.Message)
+}
+
+func TestWriteServerErrorShowsMessage(t *testing.T) {
+	SetShowInternalErrors(true)
+	defer SetShowInternalErrors(false)
+
+	w := httptest.NewRecorder()
+	Writef(w, http.StatusInternalServerError, CODE_INTERNAL_ERROR, "GetUserStats() failed: %v", "some database detail")
+
+	problem := decodeProblem(t, w)
+	assert.Equal(t, "GetUserStats() failed: some database detail", problem.Message)
+}
+
+func TestWriteRemovesCachingHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("ETag", `"abc"`)
+	w.Header().Set("Content-Encoding", "gzip")
+	Write(w, http.StatusNotFound, CODE_QUIZ_NOT_FOUND, "quiz not found", nil)
+
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Nil(t, decodeProblem(t, w).Details)
+}
@@ -0,0 +1,127 @@
+// Package certificates signs and verifies the completion certificates, with Ed25519 keys,
+// and renders them as SVG images.
+//
+// The signing key can be changed by moving its public key to the previous public keys,
+// so the certificates that it signed can still be verified.
+package certificates
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+)
+
+// The length, in bytes, of the random certificate IDs, before hex encoding.
+const idLength = 16
+
+// ErrUnknownKey means that the certificate was signed by a key that is not the current or a previous key.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// ErrInvalidSignature means that the certificate, or its signature, has been changed.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+type Signer struct {
+	privateKey ed25519.PrivateKey
+	keyId      string
+
+	// The current and previous public keys, by key ID.
+	publicKeys map[string]ed25519.PublicKey
+}
+
+// NewSigner returns a Signer that signs with the base64 Ed25519 private key seed,
+// and that verifies with its public key or with any of the base64 previous public keys.
+func NewSigner(signingKey string, previousPublicKeys []string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil {
+		return nil, fmt.Errorf("base64 DecodeString() failed for the signing key: %v", err)
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("the signing key has %v bytes instead of %v", len(seed), ed25519.SeedSize)
+	}
+
+	result := &Signer{
+		privateKey: ed25519.NewKeyFromSeed(seed),
+		publicKeys: make(map[string]ed25519.PublicKey),
+	}
+
+	publicKey := result.privateKey.Public().(ed25519.PublicKey)
+	result.keyId = KeyId(publicKey)
+	result.publicKeys[result.keyId] = publicKey
+
+	for _, previous := range previousPublicKeys {
+		key, err := base64.StdEncoding.DecodeString(previous)
+		if err != nil {
+			return nil, fmt.Errorf("base64 DecodeString() failed for a previous public key: %v", err)
+		}
+
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("a previous public key has %v bytes instead of %v", len(key), ed25519.PublicKeySize)
+		}
+
+		result.publicKeys[KeyId(key)] = key
+	}
+
+	return result, nil
+}
+
+// KeyId returns a short ID for the public key, so a certificate can say which key signed it.
+func KeyId(publicKey ed25519.PublicKey) string {
+	hash := sha256.Sum256(publicKey)
+	return hex.EncodeToString(hash[:8])
+}
+
+// NewId returns a random, unguessable, ID for a certificate.
+func NewId() (string, error) {
+	b := make([]byte, idLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Sign sets the certificate's KeyId and Signature.
+func (self *Signer) Sign(certificate *domainuser.Certificate) error {
+	certificate.KeyId = self.keyId
+
+	data, err := certificate.SignedData()
+	if err != nil {
+		return fmt.Errorf("SignedData() failed: %v", err)
+	}
+
+	certificate.Signature = ed25519.Sign(self.privateKey, data)
+	return nil
+}
+
+// Verify returns nil if the certificate was signed by the current key or a previous key,
+// ErrUnknownKey if the key is not known, or ErrInvalidSignature if the signature does not match.
+func (self *Signer) Verify(certificate *domainuser.Certificate) error {
+	publicKey, ok := self.PublicKey(certificate.KeyId)
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	data, err := certificate.SignedData()
+	if err != nil {
+		return fmt.Errorf("SignedData() failed: %v", err)
+	}
+
+	if !ed25519.Verify(publicKey, data, certificate.Signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// PublicKey returns the current or previous public key with the ID.
+func (self *Signer) PublicKey(keyId string) (ed25519.PublicKey, bool) {
+	key, ok := self.publicKeys[keyId]
+	return key, ok
+}
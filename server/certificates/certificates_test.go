@@ -0,0 +1,114 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, ed25519.SeedSize))
+}
+
+func testPublicKey(b byte) string {
+	seed := bytes.Repeat([]byte{b}, ed25519.SeedSize)
+	return base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+}
+
+func testCertificate() *domainuser.Certificate {
+	return &domainuser.Certificate{
+		Id:             "some-id",
+		UserId:         "some-user",
+		UserName:       "Some User",
+		QuizId:         "bigo",
+		QuizTitle:      "Big-O",
+		SectionId:      "sorting",
+		SectionTitle:   "Sorting",
+		QuizVersion:    "3",
+		CountQuestions: 12,
+		Issued:         time.Date(2024, 12, 31, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := NewSigner(testKey(1), nil)
+	assert.Nil(t, err)
+
+	certificate := testCertificate()
+	assert.Nil(t, signer.Sign(certificate))
+	assert.NotEmpty(t, certificate.KeyId)
+	assert.Len(t, certificate.Signature, ed25519.SignatureSize)
+	assert.Nil(t, signer.Verify(certificate))
+
+	// The user ID is not signed, because it is not public.
+	certificate.UserId = "other-user"
+	assert.Nil(t, signer.Verify(certificate))
+
+	certificate.CountQuestions = 13
+	assert.ErrorIs(t, signer.Verify(certificate), ErrInvalidSignature)
+}
+
+func TestVerifyWithPreviousKey(t *testing.T) {
+	oldSigner, err := NewSigner(testKey(1), nil)
+	assert.Nil(t, err)
+
+	certificate := testCertificate()
+	assert.Nil(t, oldSigner.Sign(certificate))
+
+	signer, err := NewSigner(testKey(2), nil)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, signer.Verify(certificate), ErrUnknownKey)
+
+	signer, err = NewSigner(testKey(2), []string{testPublicKey(1)})
+	assert.Nil(t, err)
+	assert.Nil(t, signer.Verify(certificate))
+
+	// New certificates are signed with the new key.
+	newCertificate := testCertificate()
+	assert.Nil(t, signer.Sign(newCertificate))
+	assert.NotEqual(t, certificate.KeyId, newCertificate.KeyId)
+}
+
+func TestNewSignerInvalidKeys(t *testing.T) {
+	_, err := NewSigner("not base64", nil)
+	assert.NotNil(t, err)
+
+	_, err = NewSigner(base64.StdEncoding.EncodeToString([]byte("short")), nil)
+	assert.NotNil(t, err)
+
+	_, err = NewSigner(testKey(1), []string{testKey(2) + "AA"})
+	assert.NotNil(t, err)
+}
+
+func TestNewId(t *testing.T) {
+	id, err := NewId()
+	assert.Nil(t, err)
+	assert.Len(t, id, idLength*2)
+
+	other, err := NewId()
+	assert.Nil(t, err)
+	assert.NotEqual(t, id, other)
+}
+
+func TestRenderSVG(t *testing.T) {
+	certificate := testCertificate()
+	certificate.UserName = "<script>alert(1)</script> & Co"
+
+	var b bytes.Buffer
+	err := RenderSVG(&b, certificate, "https://api.bigoquiz.com/api/v2/certificates/some-id")
+	assert.Nil(t, err)
+
+	svg := b.String()
+	assert.Contains(t, svg, "&lt;script&gt;alert(1)&lt;/script&gt; &amp; Co")
+	assert.NotContains(t, svg, "<script>")
+	assert.Contains(t, svg, "Big-O")
+	assert.Contains(t, svg, "Sorting")
+	assert.Contains(t, svg, "all 12 questions")
+	assert.Contains(t, svg, "31 December 2024")
+	assert.Contains(t, svg, "https://api.bigoquiz.com/api/v2/certificates/some-id")
+}
@@ -0,0 +1,62 @@
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+)
+
+const CONTENT_TYPE_SVG = "image/svg+xml"
+
+// The text comes from users and quizzes, so it is always escaped, with the "xml" function.
+var svgTemplate = template.Must(template.New("certificate").Funcs(template.FuncMap{
+	"xml": template.HTMLEscapeString,
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="800" height="560" viewBox="0 0 800 560" font-family="Georgia, serif" text-anchor="middle">
+  <rect x="0" y="0" width="800" height="560" fill="#fffdf5"/>
+  <rect x="20" y="20" width="760" height="520" fill="none" stroke="#3a5a80" stroke-width="6"/>
+  <text x="400" y="110" font-size="40" fill="#3a5a80">Certificate of Completion</text>
+  <text x="400" y="190" font-size="20">This certifies that</text>
+  <text x="400" y="245" font-size="34" font-weight="bold">{{xml .UserName}}</text>
+  <text x="400" y="300" font-size="20">answered all {{.CountQuestions}} questions correctly in</text>
+  <text x="400" y="355" font-size="28" font-weight="bold">{{xml .QuizTitle}}</text>
+{{- if .SectionTitle}}
+  <text x="400" y="395" font-size="22">{{xml .SectionTitle}}</text>
+{{- end}}
+  <text x="400" y="450" font-size="18">{{.Issued}}</text>
+  <text x="400" y="500" font-size="12" fill="#555555">Certificate {{xml .Id}}. Verify at {{xml .VerifyUrl}}</text>
+</svg>
+`))
+
+type svgData struct {
+	*domainuser.Certificate
+
+	// Hides Certificate.Issued, with the formatted date.
+	Issued string
+
+	VerifyUrl string
+}
+
+// RenderSVG writes the certificate as an SVG image, mentioning the URL at which it can be verified.
+func RenderSVG(w io.Writer, certificate *domainuser.Certificate, verifyUrl string) error {
+	data := svgData{
+		Certificate: certificate,
+		Issued:      certificate.Issued.UTC().Format("2 January 2006"),
+		VerifyUrl:   verifyUrl,
+	}
+
+	// Render it all first, so an error does not leave a partial image.
+	var b bytes.Buffer
+	if err := svgTemplate.Execute(&b, &data); err != nil {
+		return fmt.Errorf("template Execute() failed: %v", err)
+	}
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("Write() failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package csrf rejects requests that would change the user's data if they come from another site,
+// which could otherwise make the user's browser send them, with the user's session cookie.
+//
+// Browsers send an Origin header with such requests, or at least a Sec-Fetch-Site header,
+// so requests from origins other than the frontend are rejected.
+// Requests from other clients, which send neither, may instead send the session's CSRF token,
+// which only pages that can read the API's responses, such as the frontend, can know.
+package csrf
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+)
+
+// The header with the session's CSRF token.
+const HEADER_TOKEN = "X-CSRF-Token"
+
+// Values of the Sec-Fetch-Site header.
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Sec-Fetch-Site
+const (
+	secFetchSiteSameOrigin = "same-origin"
+	secFetchSiteSameSite   = "same-site"
+	secFetchSiteNone       = "none"
+)
+
+type Protector struct {
+	// Normalized, as returned by normalizeOrigin().
+	trustedOrigins []string
+
+	userSessionStore usersessionstore.UserSessionStore
+}
+
+// NewProtector returns a Protector that allows requests from the trusted origins, such as https://bigoquiz.com,
+// and requests with the session's CSRF token. Empty origins are ignored.
+func NewProtector(trustedOrigins []string, userSessionStore usersessionstore.UserSessionStore) *Protector {
+	result := &Protector{
+		userSessionStore: userSessionStore,
+	}
+
+	for _, origin := range trustedOrigins {
+		if normalized := normalizeOrigin(origin); len(normalized) != 0 {
+			result.trustedOrigins = append(result.trustedOrigins, normalized)
+		}
+	}
+
+	return result
+}
+
+// normalizeOrigin returns the scheme and host of the URL, in lower case, such as https://bigoquiz.com,
+// or an empty string if it is not a URL with a scheme and host.
+func normalizeOrigin(origin string) string {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// isSafeMethod returns whether requests with the method should not change anything,
+// so they do not need to be checked.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// Handle returns a handler that responds with 403 Forbidden, instead of calling h,
+// if the request changes something, and might have come from another site.
+func (self *Protector) Handle(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := self.Check(r); err != nil {
+			apierror.Writef(w, http.StatusForbidden, apierror.CODE_CROSS_SITE_REQUEST, "cross-site request rejected: %v", err)
+			return
+		}
+
+		h(w, r, ps)
+	}
+}
+
+// Check returns an error if the request changes something, and might have come from another site.
+func (self *Protector) Check(r *http.Request) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+
+	// A correct token shows that the request came from a page that could read it.
+	if token := r.Header.Get(HEADER_TOKEN); len(token) != 0 {
+		return self.checkToken(r, token)
+	}
+
+	if origin := r.Header.Get("Origin"); len(origin) != 0 {
+		// Browsers send "null" for some requests, such as from sandboxed iframes, which we cannot trust.
+		if !self.isTrustedOrigin(origin) {
+			return fmt.Errorf("untrusted origin: %v", origin)
+		}
+
+		return nil
+	}
+
+	// Browsers that send Sec-Fetch-Site also send Origin with cross-origin requests,
+	// but check it anyway, in case a proxy has removed the Origin header.
+	switch site := r.Header.Get("Sec-Fetch-Site"); site {
+	case "", secFetchSiteSameOrigin, secFetchSiteNone:
+		// Not from a browser, or from the user, such as a typed URL, or from the same origin.
+		return nil
+	case secFetchSiteSameSite:
+		// The frontend is the same site, but so might be other pages that we do not trust.
+		return fmt.Errorf("same-site request without an Origin header")
+	default:
+		return fmt.Errorf("cross-site request: %v", site)
+	}
+}
+
+func (self *Protector) isTrustedOrigin(origin string) bool {
+	normalized := normalizeOrigin(origin)
+	if len(normalized) == 0 {
+		return false
+	}
+
+	for _, trusted := range self.trustedOrigins {
+		if normalized == trusted {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *Protector) checkToken(r *http.Request, token string) error {
+	if self.userSessionStore == nil {
+		return fmt.Errorf("no session for the CSRF token")
+	}
+
+	expected, err := self.userSessionStore.GetCSRFToken(r)
+	if err != nil {
+		return fmt.Errorf("GetCSRFToken() failed: %v", err)
+	}
+
+	if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return fmt.Errorf("invalid CSRF token")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/config"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(method string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(method, "https://api.bigoquiz.com/api/user-history/reset-sections", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	return r
+}
+
+func TestCheckOrigin(t *testing.T) {
+	protector := NewProtector([]string{"https://bigoquiz.com", "", "https://api.bigoquiz.com/"}, nil)
+
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "https://bigoquiz.com"})))
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "HTTPS://API.bigoquiz.com"})))
+
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "https://evil.example"})))
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "http://bigoquiz.com"})))
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "https://bigoquiz.com.evil.example"})))
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "null"})))
+}
+
+func TestCheckSecFetchSite(t *testing.T) {
+	protector := NewProtector([]string{"https://bigoquiz.com"}, nil)
+
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"})))
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Sec-Fetch-Site": "none"})))
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-site"})))
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"})))
+
+	// The trusted Origin is enough.
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, map[string]string{"Origin": "https://bigoquiz.com", "Sec-Fetch-Site": "same-site"})))
+}
+
+func TestCheckAllowsNonBrowserAndSafeRequests(t *testing.T) {
+	protector := NewProtector([]string{"https://bigoquiz.com"}, nil)
+
+	assert.Nil(t, protector.Check(newRequest(http.MethodPost, nil)))
+	assert.Nil(t, protector.Check(newRequest(http.MethodGet, map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"})))
+	assert.Nil(t, protector.Check(newRequest(http.MethodOptions, map[string]string{"Origin": "https://evil.example"})))
+}
+
+func TestCheckToken(t *testing.T) {
+	store, err := usersessionstore.NewUserSessionStore(&config.Config{CookieKey: "some-key"})
+	assert.Nil(t, err)
+
+	protector := NewProtector([]string{"https://bigoquiz.com"}, store)
+
+	// Get a token, in a session cookie.
+	w := httptest.NewRecorder()
+	token, err := store.GetOrCreateCSRFToken(newRequest(http.MethodGet, nil), w)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+
+	cookies := w.Result().Cookies()
+	assert.NotEmpty(t, cookies)
+
+	withSession := func(headers map[string]string) *http.Request {
+		r := newRequest(http.MethodPost, headers)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+
+		return r
+	}
+
+	// The same session returns the same token.
+	sameToken, err := store.GetOrCreateCSRFToken(withSession(nil), httptest.NewRecorder())
+	assert.Nil(t, err)
+	assert.Equal(t, token, sameToken)
+
+	assert.Nil(t, protector.Check(withSession(map[string]string{HEADER_TOKEN: token})))
+
+	// The token is checked even if the origin is trusted.
+	assert.NotNil(t, protector.Check(withSession(map[string]string{HEADER_TOKEN: "wrong-token", "Origin": "https://bigoquiz.com"})))
+
+	// The token is only valid with its session.
+	assert.NotNil(t, protector.Check(newRequest(http.MethodPost, map[string]string{HEADER_TOKEN: token})))
+}
+
+func TestHandle(t *testing.T) {
+	protector := NewProtector([]string{"https://bigoquiz.com"}, nil)
+
+	called := false
+	handler := protector.Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		called = true
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, newRequest(http.MethodPost, map[string]string{"Origin": "https://evil.example"}), nil)
+	assert.False(t, called)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, apierror.CONTENT_TYPE, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), string(apierror.CODE_CROSS_SITE_REQUEST))
+
+	w = httptest.NewRecorder()
+	handler(w, newRequest(http.MethodPost, map[string]string{"Origin": "https://bigoquiz.com"}), nil)
+	assert.True(t, called)
+}
@@ -0,0 +1,136 @@
+// Package health serves the liveness and readiness checks,
+// so the server only gets traffic when it can handle it, and is restarted if it stops responding.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	PATH_LIVENESS  = "/healthz"
+	PATH_READINESS = "/readyz"
+)
+
+const (
+	STATUS_OK            = "ok"
+	STATUS_FAILED        = "failed"
+	STATUS_SHUTTING_DOWN = "shutting-down"
+)
+
+// CheckFunc returns an error if something that the server needs is not available.
+type CheckFunc func(c context.Context) error
+
+type check struct {
+	name  string
+	check CheckFunc
+}
+
+// Response is the body of the liveness and readiness responses.
+// The checks' errors are logged, but not sent, because the checks are public.
+type Response struct {
+	Status string `json:"status"`
+
+	// The status of each readiness check, by name.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	checks []check
+
+	// How long each readiness check may take.
+	timeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker whose readiness checks fail if they take longer than the timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+	}
+}
+
+// AddCheck adds a readiness check. This should be called before RegisterRoutes().
+func (self *Checker) AddCheck(name string, f CheckFunc) {
+	self.checks = append(self.checks, check{name: name, check: f})
+}
+
+// SetShuttingDown makes the readiness check fail from now on,
+// so no new traffic is sent while the in-flight requests finish.
+func (self *Checker) SetShuttingDown() {
+	self.shuttingDown.Store(true)
+}
+
+// RegisterRoutes registers the liveness and readiness routes with the router.
+// They are not instrumented, because they are called so often.
+func (self *Checker) RegisterRoutes(router *httprouter.Router) {
+	router.GET(PATH_LIVENESS, self.HandleLiveness)
+	router.GET(PATH_READINESS, self.HandleReadiness)
+}
+
+// HandleLiveness responds if the server is running, without checking anything else,
+// so the server is not restarted just because the datastore is unavailable.
+func (self *Checker) HandleLiveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeResponse(w, http.StatusOK, &Response{Status: STATUS_OK})
+}
+
+// HandleReadiness runs the checks, all at once, responding with 503 Service Unavailable if any fail,
+// or if the server is shutting down.
+func (self *Checker) HandleReadiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if self.shuttingDown.Load() {
+		writeResponse(w, http.StatusServiceUnavailable, &Response{Status: STATUS_SHUTTING_DOWN})
+		return
+	}
+
+	c, cancel := context.WithTimeout(r.Context(), self.timeout)
+	defer cancel()
+
+	errs := make([]error, len(self.checks))
+	var wg sync.WaitGroup
+	for i, check := range self.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = check.check(c)
+		}()
+	}
+	wg.Wait()
+
+	response := &Response{
+		Status: STATUS_OK,
+		Checks: make(map[string]string, len(self.checks)),
+	}
+
+	status := http.StatusOK
+	for i, check := range self.checks {
+		if errs[i] != nil {
+			slog.WarnContext(r.Context(), "readiness check failed", "check", check.name, "error", errs[i])
+			response.Checks[check.name] = STATUS_FAILED
+			response.Status = STATUS_FAILED
+			status = http.StatusServiceUnavailable
+			continue
+		}
+
+		response.Checks[check.name] = STATUS_OK
+	}
+
+	writeResponse(w, status, response)
+}
+
+func writeResponse(w http.ResponseWriter, status int, response *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("writing the health response failed", "error", err)
+	}
+}
@@ -0,0 +1,99 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func get(t *testing.T, checker *Checker, path string) (int, *Response) {
+	router := httprouter.New()
+	checker.RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var response Response
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	return w.Code, &response
+}
+
+func TestLivenessIgnoresChecks(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("datastore", func(c context.Context) error {
+		return errors.New("some error")
+	})
+
+	status, response := get(t, checker, PATH_LIVENESS)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, STATUS_OK, response.Status)
+}
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("quizzes", func(c context.Context) error {
+		return nil
+	})
+	checker.AddCheck("datastore", func(c context.Context) error {
+		return nil
+	})
+
+	status, response := get(t, checker, PATH_READINESS)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, STATUS_OK, response.Status)
+	assert.Equal(t, map[string]string{"quizzes": STATUS_OK, "datastore": STATUS_OK}, response.Checks)
+}
+
+func TestReadinessFailed(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("quizzes", func(c context.Context) error {
+		return nil
+	})
+	checker.AddCheck("datastore", func(c context.Context) error {
+		return errors.New("some secret error")
+	})
+
+	status, response := get(t, checker, PATH_READINESS)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, STATUS_FAILED, response.Status)
+	assert.Equal(t, map[string]string{"quizzes": STATUS_OK, "datastore": STATUS_FAILED}, response.Checks)
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.AddCheck("datastore", func(c context.Context) error {
+		<-c.Done()
+		return c.Err()
+	})
+
+	status, response := get(t, checker, PATH_READINESS)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, STATUS_FAILED, response.Checks["datastore"])
+}
+
+func TestReadinessShuttingDown(t *testing.T) {
+	checker := NewChecker(time.Second)
+
+	status, _ := get(t, checker, PATH_READINESS)
+	assert.Equal(t, http.StatusOK, status)
+
+	checker.SetShuttingDown()
+
+	status, response := get(t, checker, PATH_READINESS)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, STATUS_SHUTTING_DOWN, response.Status)
+
+	// The server is still alive while it finishes the in-flight requests.
+	status, _ = get(t, checker, PATH_LIVENESS)
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,153 @@
+// Package logging sets up structured logging with log/slog,
+// adding each request's ID to the log records for that request,
+// so the records for one request can be found together.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	FORMAT_TEXT = "text"
+
+	// JSON with the field names that Google Cloud Logging understands.
+	FORMAT_CLOUD_LOGGING = "cloud-logging"
+)
+
+// The attribute keys added to each record.
+const (
+	KEY_REQUEST_ID = "requestId"
+
+	// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+	keyCloudLoggingTrace = "logging.googleapis.com/trace"
+)
+
+type contextKey int
+
+const (
+	requestIdContextKey contextKey = iota
+	traceContextKey
+)
+
+// WithRequestId returns a context that has the request ID, which will be added to records logged with it.
+func WithRequestId(c context.Context, requestId string) context.Context {
+	return context.WithValue(c, requestIdContextKey, requestId)
+}
+
+// RequestIdFromContext returns the request ID, or an empty string if the context has none.
+func RequestIdFromContext(c context.Context) string {
+	if c == nil {
+		return ""
+	}
+
+	requestId, _ := c.Value(requestIdContextKey).(string)
+	return requestId
+}
+
+// withTrace returns a context that has the Cloud Trace resource name, such as projects/my-project/traces/abc123.
+func withTrace(c context.Context, trace string) context.Context {
+	return context.WithValue(c, traceContextKey, trace)
+}
+
+func traceFromContext(c context.Context) string {
+	if c == nil {
+		return ""
+	}
+
+	trace, _ := c.Value(traceContextKey).(string)
+	return trace
+}
+
+// contextHandler adds the request ID, and the trace, if any, from the context, to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (self *contextHandler) Handle(c context.Context, record slog.Record) error {
+	if requestId := RequestIdFromContext(c); len(requestId) != 0 {
+		record.AddAttrs(slog.String(KEY_REQUEST_ID, requestId))
+	}
+
+	if trace := traceFromContext(c); len(trace) != 0 {
+		record.AddAttrs(slog.String(keyCloudLoggingTrace, trace))
+	}
+
+	return self.Handler.Handle(c, record)
+}
+
+func (self *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: self.Handler.WithAttrs(attrs)}
+}
+
+func (self *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: self.Handler.WithGroup(name)}
+}
+
+// cloudLoggingSeverity returns the Cloud Logging severity for the level.
+// See https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#logseverity
+func cloudLoggingSeverity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// replaceCloudLoggingAttr renames the standard attributes to the names that Cloud Logging understands.
+func replaceCloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) != 0 {
+		return a
+	}
+
+	switch a.Key {
+	case slog.LevelKey:
+		level, _ := a.Value.Any().(slog.Level)
+		return slog.String("severity", cloudLoggingSeverity(level))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+
+	return a
+}
+
+// NewHandler returns a handler that writes records in the format, FORMAT_TEXT or FORMAT_CLOUD_LOGGING,
+// adding the request ID from the context.
+func NewHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	var handler slog.Handler
+	if format == FORMAT_CLOUD_LOGGING {
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: replaceCloudLoggingAttr,
+		})
+	} else {
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{
+			Level: level,
+		})
+	}
+
+	return &contextHandler{Handler: handler}
+}
+
+// ParseLevel parses a level name, such as "debug" or "warn", returning false if it is not valid.
+func ParseLevel(name string) (slog.Level, bool) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return slog.LevelInfo, false
+	}
+
+	return level, true
+}
+
+// Setup makes slog's default logger, and the standard log package, write to stderr in the format.
+func Setup(format string, level slog.Leveler) {
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, format, level)))
+}
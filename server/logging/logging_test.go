@@ -0,0 +1,195 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		err := json.Unmarshal([]byte(line), &record)
+		assert.Nil(t, err)
+		result = append(result, record)
+	}
+
+	return result
+}
+
+func TestCloudLoggingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, FORMAT_CLOUD_LOGGING, slog.LevelInfo))
+
+	c := WithRequestId(context.Background(), "some-request-id")
+	logger.WarnContext(c, "something happened", "quizId", "graphs")
+	logger.DebugContext(c, "not logged")
+
+	records := decodeRecords(t, &buf)
+	assert.Len(t, records, 1)
+
+	record := records[0]
+	assert.Equal(t, "WARNING", record["severity"])
+	assert.Equal(t, "something happened", record["message"])
+	assert.Equal(t, "some-request-id", record[KEY_REQUEST_ID])
+	assert.Equal(t, "graphs", record["quizId"])
+	assert.NotContains(t, record, "level")
+	assert.NotContains(t, record, "msg")
+}
+
+func TestHandlerWithoutRequestId(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, FORMAT_CLOUD_LOGGING, slog.LevelInfo))
+	logger.With("component", "test").Info("hello")
+
+	records := decodeRecords(t, &buf)
+	assert.Len(t, records, 1)
+	assert.NotContains(t, records[0], KEY_REQUEST_ID)
+	assert.Equal(t, "test", records[0]["component"])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("debug")
+	assert.True(t, ok)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, ok = ParseLevel("WARN")
+	assert.True(t, ok)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, ok = ParseLevel("loud")
+	assert.False(t, ok)
+}
+
+func TestCloudTrace(t *testing.T) {
+	assert.Equal(t, "projects/some-project/traces/105445aa7843bc8bf206b120001000", cloudTrace("105445aa7843bc8bf206b120001000/1;o=1", "some-project"))
+	assert.Empty(t, cloudTrace("105445aa7843bc8bf206b120001000/1;o=1", ""))
+	assert.Empty(t, cloudTrace("", "some-project"))
+	assert.Empty(t, cloudTrace("bad trace/1", "some-project"))
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(NewHandler(&buf, FORMAT_CLOUD_LOGGING, slog.LevelInfo)))
+	defer slog.SetDefault(previous)
+
+	var requestId string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId = RequestIdFromContext(r.Context())
+
+		// Code with only the ResponseWriter can still log with the request ID.
+		slog.InfoContext(ContextFromResponseWriter(w), "in handler")
+
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/nonexistent?list-only=true", nil)
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotEmpty(t, requestId)
+	assert.Equal(t, requestId, w.Header().Get(HEADER_REQUEST_ID))
+
+	records := decodeRecords(t, &buf)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "in handler", records[0]["message"])
+	assert.Equal(t, requestId, records[0][KEY_REQUEST_ID])
+
+	access := records[1]
+	assert.Equal(t, "WARNING", access["severity"])
+	assert.Equal(t, requestId, access[KEY_REQUEST_ID])
+
+	httpRequest, ok := access["httpRequest"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, http.MethodGet, httpRequest["requestMethod"])
+	assert.Equal(t, "/api/quiz/nonexistent?list-only=true", httpRequest["requestUrl"])
+	assert.Equal(t, float64(http.StatusNotFound), httpRequest["status"])
+	assert.Equal(t, float64(len("not found")), httpRequest["responseSize"])
+	assert.True(t, strings.HasSuffix(httpRequest["latency"].(string), "s"))
+}
+
+func TestMiddlewareRequestIdsDiffer(t *testing.T) {
+	var requestIds []string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIds = append(requestIds, RequestIdFromContext(r.Context()))
+	}))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	assert.Len(t, requestIds, 2)
+	assert.NotEqual(t, requestIds[0], requestIds[1])
+}
+
+// wrappingResponseWriter is like the response writers of other middleware, such as the metrics.
+type wrappingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (self *wrappingResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+func TestContextFromWrappedResponseWriter(t *testing.T) {
+	var requestId string
+	var c context.Context
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId = RequestIdFromContext(r.Context())
+
+		w = &wrappingResponseWriter{&wrappingResponseWriter{w}}
+		c = ContextFromResponseWriter(w)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, requestId)
+	assert.Equal(t, requestId, RequestIdFromContext(c))
+
+	// A wrapper around a writer that is not from Middleware().
+	c = ContextFromResponseWriter(&wrappingResponseWriter{httptest.NewRecorder()})
+	assert.Empty(t, RequestIdFromContext(c))
+}
+
+func TestContextFromResponseWriterWithoutMiddleware(t *testing.T) {
+	c := ContextFromResponseWriter(httptest.NewRecorder())
+	assert.NotNil(t, c)
+	assert.Empty(t, RequestIdFromContext(c))
+}
+
+func TestNewResponseWriter(t *testing.T) {
+	var requestId string
+	var recorder *ResponseWriter
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId = RequestIdFromContext(r.Context())
+
+		recorder = NewResponseWriter(w)
+		assert.Equal(t, requestId, RequestIdFromContext(ContextFromResponseWriter(recorder)))
+
+		// Nothing written yet.
+		assert.Equal(t, http.StatusOK, recorder.Status())
+
+		recorder.WriteHeader(http.StatusTeapot)
+		_, _ = recorder.Write([]byte("short and stout"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Equal(t, http.StatusTeapot, recorder.Status())
+	assert.Equal(t, int64(len("short and stout")), recorder.Size())
+}
@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The response header with the request's ID,
+// so users can quote it when reporting a problem.
+const HEADER_REQUEST_ID = "X-Request-Id"
+
+// The header added by Google's load balancers. See https://cloud.google.com/trace/docs/trace-context
+const headerCloudTraceContext = "X-Cloud-Trace-Context"
+
+const maxTraceIdLength = 64
+
+// isValidTraceId returns true if the ID, from a request header, is safe to log.
+func isValidTraceId(traceId string) bool {
+	if len(traceId) == 0 || len(traceId) > maxTraceIdLength {
+		return false
+	}
+
+	for _, c := range traceId {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateRequestId() string {
+	b := make([]byte, 16)
+
+	// This never returns an error.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// cloudTrace returns the Cloud Trace resource name, such as projects/my-project/traces/abc123,
+// from the X-Cloud-Trace-Context header, or an empty string if it cannot.
+func cloudTrace(header string, projectId string) string {
+	if len(header) == 0 || len(projectId) == 0 {
+		return ""
+	}
+
+	traceId, _, _ := strings.Cut(header, "/")
+	if !isValidTraceId(traceId) {
+		return ""
+	}
+
+	return "projects/" + projectId + "/traces/" + traceId
+}
+
+// ResponseWriter records the status and size of the response, for the access log, the metrics, and the traces,
+// and gives the request's context to code that only has the http.ResponseWriter.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	// This is nil if the context is in a wrapped ResponseWriter, or if there is none.
+	ctx    context.Context
+	status int
+	size   int64
+}
+
+// NewResponseWriter returns a ResponseWriter that records the response written to w,
+// such as for metrics.
+// ContextFromResponseWriter() still finds the request's context, if w has it.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+func (self *ResponseWriter) WriteHeader(status int) {
+	if self.status == 0 {
+		self.status = status
+	}
+
+	self.ResponseWriter.WriteHeader(status)
+}
+
+func (self *ResponseWriter) Write(b []byte) (int, error) {
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+
+	n, err := self.ResponseWriter.Write(b)
+	self.size += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to find the underlying ResponseWriter's features, such as flushing.
+func (self *ResponseWriter) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
+// Status returns the response's status.
+// This is 200 if nothing has been written, because net/http sends that when the handler returns.
+func (self *ResponseWriter) Status() int {
+	if self.status == 0 {
+		return http.StatusOK
+	}
+
+	return self.status
+}
+
+// Size returns the number of bytes written in the response's body.
+func (self *ResponseWriter) Size() int64 {
+	return self.size
+}
+
+// ContextFromResponseWriter returns the request's context, with its request ID,
+// if the response writer came from Middleware(), even if other middleware has wrapped it since,
+// or context.Background() otherwise.
+func ContextFromResponseWriter(w http.ResponseWriter) context.Context {
+	for w != nil {
+		if rw, ok := w.(*ResponseWriter); ok && rw.ctx != nil {
+			return rw.ctx
+		}
+
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+
+		w = unwrapper.Unwrap()
+	}
+
+	return context.Background()
+}
+
+// Middleware gives each request an ID, in the request's context and in the response's X-Request-Id header,
+// and writes an access log record, with the status and latency, for each request.
+func Middleware(next http.Handler) http.Handler {
+	// Set by Google Cloud, so log records can be linked to traces.
+	projectId := os.Getenv("GOOGLE_CLOUD_PROJECT")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestId := generateRequestId()
+
+		c := WithRequestId(r.Context(), requestId)
+		if trace := cloudTrace(r.Header.Get(headerCloudTraceContext), projectId); len(trace) != 0 {
+			c = withTrace(c, trace)
+		}
+
+		r = r.WithContext(c)
+
+		w.Header().Set(HEADER_REQUEST_ID, requestId)
+		rw := &ResponseWriter{ResponseWriter: w, ctx: c}
+
+		next.ServeHTTP(rw, r)
+
+		status := rw.Status()
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if status >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+
+		// httpRequest is understood by Cloud Logging.
+		// See https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
+		latency := time.Since(start)
+		slog.Default().LogAttrs(c, level, "request",
+			slog.Group("httpRequest",
+				slog.String("requestMethod", r.Method),
+				slog.String("requestUrl", r.URL.RequestURI()),
+				slog.Int("status", status),
+				slog.Int64("responseSize", rw.Size()),
+				slog.String("userAgent", r.UserAgent()),
+				slog.String("remoteIp", r.RemoteAddr),
+				slog.String("latency", formatLatency(latency)),
+			),
+			slog.Int64("latencyMs", latency.Milliseconds()),
+		)
+	})
+}
+
+// formatLatency formats the duration like "0.012s", as Cloud Logging expects.
+func formatLatency(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -2,13 +2,18 @@ package loginserver
 
 import (
 	"fmt"
-	"log"
 	"net/http"
+	"slices"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/murraycu/go-bigoquiz-server/config"
 	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	"github.com/murraycu/go-bigoquiz-server/server/ratelimit"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
 	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
 )
 
 type LoginServer struct {
@@ -18,19 +23,29 @@ type LoginServer struct {
 	userSessionStore usersessionstore.UserSessionStore
 
 	oauthClient *OAuthClient
+
+	// Limits the starts of logins, each of which stores an OAuth state.
+	loginsLimiter *ratelimit.Limiter
+
+	// The enabled login providers, such as config.LOGIN_PROVIDER_GOOGLE.
+	loginProviders []string
 }
 
-func NewLoginServer(userSessionStore usersessionstore.UserSessionStore, conf *config.Config) (*LoginServer, error) {
+// The name of the rate limiter for the logins, in the metrics.
+const RATE_LIMITER_LOGINS = "logins"
+
+// webhookDispatcher may be nil.
+func NewLoginServer(userSessionStore usersessionstore.UserSessionStore, userDataClient db.UserDataRepository, webhookDispatcher *webhooks.Dispatcher, conf *config.Config) (*LoginServer, error) {
 	result := &LoginServer{}
 
 	result.userSessionStore = userSessionStore
+	result.userDataClient = userDataClient
+	result.loginProviders = conf.LoginProviders
+	result.loginsLimiter = ratelimit.NewLimiter(RATE_LIMITER_LOGINS, ratelimit.NewMemoryStore(),
+		ratelimit.FromConfig(conf.RateLimits.LoginsPerIp), ratelimit.Limit{}, nil, conf.RateLimits.ClientIpHeader)
 
-	userDataClient, err := db.NewUserDataRepository()
-	if err != nil {
-		return nil, fmt.Errorf("NewUserDataRepository() failed: %v", err)
-	}
-
-	result.oauthClient, err = NewOAuthClient(userSessionStore, userDataClient, conf)
+	var err error
+	result.oauthClient, err = NewOAuthClient(userSessionStore, userDataClient, webhookDispatcher, conf)
 	if err != nil {
 		return nil, fmt.Errorf("NewOAuthClient() failed: %v", err)
 	}
@@ -38,6 +53,49 @@ func NewLoginServer(userSessionStore usersessionstore.UserSessionStore, conf *co
 	return result, nil
 }
 
+// Close closes the server's own connections to the datastore.
+// The repository passed to NewLoginServer() is not closed.
+func (s *LoginServer) Close() error {
+	return s.oauthClient.Close()
+}
+
+// RegisterRoutes registers the /login routes with the router.
+// There are only routes for the enabled login providers.
+func (s *LoginServer) RegisterRoutes(router *httprouter.Router) {
+	routes := []struct {
+		path    string
+		handler httprouter.Handle
+
+		// Whether the route stores an OAuth state, so it is limited by the logins rate limit.
+		rateLimited bool
+
+		// The login provider, or empty if the route is for all providers.
+		loginProvider string
+	}{
+		{"/login/login-google", s.HandleGoogleLogin, true, config.LOGIN_PROVIDER_GOOGLE},
+		{"/login/" + config.PART_URL_LOGIN_CALLBACK_GOOGLE, s.HandleGoogleCallback, false, config.LOGIN_PROVIDER_GOOGLE},
+		{"/login/login-github", s.HandleGitHubLogin, true, config.LOGIN_PROVIDER_GITHUB},
+		{"/login/" + config.PART_URL_LOGIN_CALLBACK_GITHUB, s.HandleGitHubCallback, false, config.LOGIN_PROVIDER_GITHUB},
+		{"/login/login-facebook", s.HandleFacebookLogin, true, config.LOGIN_PROVIDER_FACEBOOK},
+		{"/login/" + config.PART_URL_LOGIN_CALLBACK_FACEBOOK, s.HandleFacebookCallback, false, config.LOGIN_PROVIDER_FACEBOOK},
+		{"/login/logout", s.HandleLogout, false, ""},
+	}
+
+	for _, route := range routes {
+		if len(route.loginProvider) != 0 && !slices.Contains(s.loginProviders, route.loginProvider) {
+			continue
+		}
+
+		handler := route.handler
+		if route.rateLimited {
+			handler = s.loginsLimiter.Handle(handler)
+		}
+
+		handler = tracing.InstrumentHandle(http.MethodGet, route.path, handler)
+		router.GET(route.path, metrics.InstrumentHandle(http.MethodGet, route.path, handler))
+	}
+}
+
 func (s *LoginServer) HandleGoogleLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	s.oauthClient.RedirectToGoogleLogin(w, r)
 }
@@ -86,12 +144,10 @@ func (s *LoginServer) HandleFacebookLogin(w http.ResponseWriter, r *http.Request
 }
 
 func logoutError(message string, err error, w http.ResponseWriter) {
-	handleErrorAsHttpError(w, http.StatusInternalServerError, "message: %v", err)
+	handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "%v: %v", message, err)
 }
 
-func handleErrorAsHttpError(w http.ResponseWriter, code int, format string, a ...interface{}) {
-	msg := fmt.Sprintf(format, a...)
-	log.Print(msg)
-
-	http.Error(w, msg, code)
+// handleErrorAsHttpError writes the error as a problem+json response, like the REST API's errors.
+func handleErrorAsHttpError(w http.ResponseWriter, status int, code apierror.Code, format string, a ...interface{}) {
+	apierror.Writef(w, status, code, format, a...)
 }
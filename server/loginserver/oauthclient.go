@@ -5,19 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 
 	"github.com/murraycu/go-bigoquiz-server/config"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
 	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
 	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
 )
 
 type OAuthClient struct {
-	oAuthStateClient *db.OAuthStateDataRepository
+	oAuthStateClient db.OAuthStateRepository
 
 	// Session cookie store.
 	userSessionStore usersessionstore.UserSessionStore
@@ -29,34 +36,47 @@ type OAuthClient struct {
 	config *config.Config
 
 	userDataClient db.UserDataRepository
+
+	// Sends the "user.created" event. This is nil if there are no webhooks.
+	webhooks *webhooks.Dispatcher
 }
 
-func NewOAuthClient(userSessionStore usersessionstore.UserSessionStore, userDataClient db.UserDataRepository, conf *config.Config) (*OAuthClient, error) {
+// webhookDispatcher may be nil.
+func NewOAuthClient(userSessionStore usersessionstore.UserSessionStore, userDataClient db.UserDataRepository, webhookDispatcher *webhooks.Dispatcher, conf *config.Config) (*OAuthClient, error) {
 	result := &OAuthClient{}
 	result.config = conf
 
-	var err error
-	result.oAuthStateClient, err = db.NewOAuthStateDataRepository()
+	oAuthStateClient, err := db.NewOAuthStateDataRepository(conf.DatastoreProjectId)
 	if err != nil {
 		return nil, fmt.Errorf("NewOAuthStateDataRepository() failed: %v", err)
 	}
 
+	result.oAuthStateClient = db.NewInstrumentedOAuthStateRepository(oAuthStateClient, tracing.ObserveRepositoryCall, metrics.ObserveRepositoryCall)
+
 	result.userSessionStore = userSessionStore
 	result.userDataClient = userDataClient
+	result.webhooks = webhookDispatcher
 
-	result.confOAuthGoogle, err = config.GenerateGoogleOAuthConfig(conf)
-	if err != nil {
-		return nil, fmt.Errorf("unable to generate Google OAuth config: %v", err)
+	// The credentials are only needed for the enabled login providers.
+	if conf.IsLoginProviderEnabled(config.LOGIN_PROVIDER_GOOGLE) {
+		result.confOAuthGoogle, err = config.GenerateGoogleOAuthConfig(conf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate Google OAuth config: %v", err)
+		}
 	}
 
-	result.confOAuthGitHub, err = config.GenerateGitHubOAuthConfig(conf)
-	if err != nil {
-		return nil, fmt.Errorf("unable to generate GitHub OAuth config: %v", err)
+	if conf.IsLoginProviderEnabled(config.LOGIN_PROVIDER_GITHUB) {
+		result.confOAuthGitHub, err = config.GenerateGitHubOAuthConfig(conf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate GitHub OAuth config: %v", err)
+		}
 	}
 
-	result.confOAuthFacebook, err = config.GenerateFacebookOAuthConfig(conf)
-	if err != nil {
-		return nil, fmt.Errorf("unable to generate Facebook OAuth config: %v", err)
+	if conf.IsLoginProviderEnabled(config.LOGIN_PROVIDER_FACEBOOK) {
+		result.confOAuthFacebook, err = config.GenerateFacebookOAuthConfig(conf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate Facebook OAuth config: %v", err)
+		}
 	}
 
 	return result, nil
@@ -89,6 +109,11 @@ func (o *OAuthClient) generateOAuthUrl(r *http.Request, oauthConfig *oauth2.Conf
 	return oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
 }
 
+// Close closes the connection to the datastore for the OAuth states.
+func (o *OAuthClient) Close() error {
+	return o.oAuthStateClient.Close()
+}
+
 func (o *OAuthClient) generateOAuthState(ctx context.Context) (string, error) {
 	state := rand.Int63()
 	err := o.oAuthStateClient.StoreOAuthState(ctx, state)
@@ -154,9 +179,15 @@ func (o *OAuthClient) HandleFacebookCallback(w http.ResponseWriter, r *http.Requ
 // handleOAuthCallback handles the OAuth callback response, interpreting it as the specific OAuthUserInfo struct type.
 // oauthType should be one of usersessionstore.OAuthTokenTypeGoogle, usersessionstore.OAuthTokenTypeGitHub,
 // usersessionstore.OAuthTokenTypeFacebook, etc.
-func handleOAuthCallback[OAuthUserInfo any](o *OAuthClient, w http.ResponseWriter, r *http.Request, userInfoUrl string, conf *oauth2.Config, oauthType string, storeLogin func(context.Context, OAuthUserInfo, string, *oauth2.Token) (string, error)) {
+func handleOAuthCallback[OAuthUserInfo any](o *OAuthClient, w http.ResponseWriter, r *http.Request, userInfoUrl string, conf *oauth2.Config, oauthType string, storeLogin func(context.Context, OAuthUserInfo, string, *oauth2.Token) (string, bool, error)) {
 	ctx := r.Context()
 
+	// Each failure below sets err before returning.
+	var err error
+	defer func() {
+		metrics.ObserveOAuthCallback(oauthType, err)
+	}()
+
 	checkStateResult, err := o.checkOAuthResponseStateAndGetBody(w, r, conf, userInfoUrl, ctx)
 	if err != nil {
 		o.loginFailed("checkOAuthResponseStateAndGetBody() failed", err, w, r)
@@ -177,13 +208,18 @@ func handleOAuthCallback[OAuthUserInfo any](o *OAuthClient, w http.ResponseWrite
 		return
 	}
 
-	userId, err := storeLogin(ctx, userinfo, userIdAndToken.UserId, checkStateResult.token)
+	userId, created, err := storeLogin(ctx, userinfo, userIdAndToken.UserId, checkStateResult.token)
 	if err != nil {
 		o.loginFailed("storeLogin() failed", err, w, r)
 		return
 	}
 
-	if err := o.storeCookie(r, w, checkStateResult.token, oauthType, userId); err != nil {
+	if created {
+		o.enqueueUserCreatedWebhookEvent(ctx, userId)
+	}
+
+	err = o.storeCookie(r, w, checkStateResult.token, oauthType, userId)
+	if err != nil {
 		o.loginFailed("storeCookie() failed", err, w, r)
 		return
 	}
@@ -191,6 +227,29 @@ func handleOAuthCallback[OAuthUserInfo any](o *OAuthClient, w http.ResponseWrite
 	o.redirectToInitialPage(r, w)
 }
 
+// enqueueUserCreatedWebhookEvent queues the "user.created" event for the webhooks that subscribe to it.
+// Webhooks are not important enough to fail the login, so any failure is just logged.
+func (o *OAuthClient) enqueueUserCreatedWebhookEvent(c context.Context, userId string) {
+	if o.webhooks == nil || !o.webhooks.IsSubscribed(domainwebhook.EVENT_USER_CREATED) {
+		return
+	}
+
+	profile, err := o.userDataClient.GetUserProfileById(c, userId)
+	if err != nil {
+		slog.ErrorContext(c, "GetUserProfileById() failed", "error", err)
+		return
+	}
+
+	data := &webhooks.Data{UserId: userId}
+	if profile != nil {
+		data.UserName = profile.Name
+	}
+
+	if err := o.webhooks.Enqueue(c, domainwebhook.EVENT_USER_CREATED, data); err != nil {
+		slog.ErrorContext(c, "Enqueue() failed", "event", domainwebhook.EVENT_USER_CREATED, "error", err)
+	}
+}
+
 type CheckStateResult struct {
 	token *oauth2.Token
 	body  []byte
@@ -213,9 +272,9 @@ func (o *OAuthClient) exchangeAndGetUserBody(w http.ResponseWriter, r *http.Requ
 	// Extract the token, which will have the
 	// - OAuth access token
 	// - OAuth refresh code, because we specified oauth2.AccessTypeOffline to oauth2.Config.AuthCodeURL().
-	token, err := conf.Exchange(ctx, code)
+	token, err := exchange(ctx, conf, code)
 	if err != nil {
-		return nil, fmt.Errorf("config.Exchange() failed: %v", err)
+		return nil, fmt.Errorf("exchange() failed: %v", err)
 	}
 
 	if !token.Valid() {
@@ -226,6 +285,43 @@ func (o *OAuthClient) exchangeAndGetUserBody(w http.ResponseWriter, r *http.Requ
 		}, fmt.Errorf("loginFailedUrl.Exchange() returned an invalid token")
 	}
 
+	body, err := o.getUserBody(w, r, conf, token, url, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getUserBody() failed: %v", err)
+	}
+
+	return &CheckStateResult{
+		token: token,
+		body:  body,
+	}, nil
+}
+
+// exchange exchanges the authorization code for a token, with the OAuth provider, in a tracing span.
+func exchange(ctx context.Context, conf *oauth2.Config, code string) (token *oauth2.Token, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "oauth2.Exchange",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(urlHost(conf.Endpoint.TokenURL))))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	token, err = conf.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("config.Exchange() failed: %v", err)
+	}
+
+	return token, nil
+}
+
+// getUserBody gets the user's details from the OAuth provider, in a tracing span.
+func (o *OAuthClient) getUserBody(w http.ResponseWriter, r *http.Request, conf *oauth2.Config, token *oauth2.Token, url string, ctx context.Context) (body []byte, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "oauth2.GetUserInfo",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(urlHost(url))))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
 	client := conf.Client(ctx, token)
 	infoResponse, err := client.Get(url)
 	if err != nil {
@@ -239,15 +335,24 @@ func (o *OAuthClient) exchangeAndGetUserBody(w http.ResponseWriter, r *http.Requ
 		}
 	}()
 
-	body, err := ioutil.ReadAll(infoResponse.Body)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(infoResponse.StatusCode))
+
+	body, err = ioutil.ReadAll(infoResponse.Body)
 	if err != nil {
 		return nil, fmt.Errorf("ReadAll(body) failed: %v", err)
 	}
 
-	return &CheckStateResult{
-		token: token,
-		body:  body,
-	}, nil
+	return body, nil
+}
+
+// urlHost returns the URL's host, or an empty string if it cannot be parsed.
+func urlHost(rawUrl string) string {
+	u, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
 }
 
 func (o *OAuthClient) redirectToInitialPage(r *http.Request, w http.ResponseWriter) {
@@ -274,6 +379,14 @@ func (o *OAuthClient) storeCookie(r *http.Request, w http.ResponseWriter, token
 
 	session.Values[usersessionstore.UserIdSessionKey] = strUserId
 
+	// A new CSRF token for each login, so a token from before the login cannot be used.
+	csrfToken, err := usersessionstore.NewCSRFToken()
+	if err != nil {
+		return fmt.Errorf("NewCSRFToken() failed: %v", err)
+	}
+
+	session.Values[usersessionstore.CSRFTokenSessionKey] = csrfToken
+
 	if err := session.Save(r, w); err != nil {
 		return fmt.Errorf("could not save session: %v", err)
 	}
@@ -284,7 +397,7 @@ func (o *OAuthClient) storeCookie(r *http.Request, w http.ResponseWriter, token
 func (o *OAuthClient) loginFailed(message string, err error, w http.ResponseWriter, r *http.Request) {
 	var loginFailedUrl = o.config.BaseUrl + "/login?failed=true"
 
-	log.Printf(message+":'%v'\n", err)
+	slog.ErrorContext(r.Context(), message, "error", err)
 	http.Redirect(w, r, loginFailedUrl, http.StatusTemporaryRedirect)
 }
 
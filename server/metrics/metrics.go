@@ -0,0 +1,232 @@
+// Package metrics has the server's Prometheus metrics,
+// and the /metrics handler that serves them.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const PATH = "/metrics"
+
+const namespace = "bigoquiz"
+
+// The values of outcome labels.
+const (
+	OUTCOME_SUCCESS = "success"
+	OUTCOME_FAILURE = "failure"
+)
+
+// The values of the answers' result label.
+const (
+	ANSWER_CORRECT   = "correct"
+	ANSWER_WRONG     = "wrong"
+	ANSWER_DONT_KNOW = "dont_know"
+)
+
+// Registry has only this package's metrics, and the Go runtime and process metrics,
+// instead of anything that other packages might register with prometheus.DefaultRegisterer.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests, by route, method, and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "How long HTTP requests took, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	repositoryCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repository_calls_total",
+		Help:      "Repository method calls, by repository, method, and outcome.",
+	}, []string{"repository", "method", "outcome"})
+
+	repositoryCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_call_duration_seconds",
+		Help:      "How long repository method calls took, such as the Datastore calls, by repository and method.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"repository", "method"})
+
+	oauthCallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_callbacks_total",
+		Help:      "OAuth login callbacks, by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused because the client made too many requests, by limiter.",
+	}, []string{"limiter"})
+
+	answers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "answers_total",
+		Help:      "Answers to questions, by result.",
+	}, []string{"result"})
+
+	quizLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quiz_loads_total",
+		Help:      "Loads of the quizzes from their files, by outcome.",
+	}, []string{"outcome"})
+
+	quizzesLoaded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quizzes_loaded",
+		Help:      "The number of quizzes loaded by the last successful load.",
+	})
+
+	quizLastLoad = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quizzes_last_load_timestamp_seconds",
+		Help:      "When the quizzes were last loaded successfully, as a Unix time.",
+	})
+
+	webhookDeliveryAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Attempts to deliver events to webhooks, by webhook, event, and outcome.",
+	}, []string{"webhook", "event", "outcome"})
+
+	cachedResponseBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cached_response_bytes",
+		Help:      "The total size of the precomputed quiz responses, by content encoding.",
+	}, []string{"encoding"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		repositoryCalls,
+		repositoryCallDuration,
+		oauthCallbacks,
+		rateLimited,
+		answers,
+		quizLoads,
+		quizzesLoaded,
+		quizLastLoad,
+		webhookDeliveryAttempts,
+		cachedResponseBytes,
+	)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OUTCOME_FAILURE
+	}
+
+	return OUTCOME_SUCCESS
+}
+
+// ObserveRepositoryCall records a call to a repository method,
+// returning a function to call with the call's error, if any, when the call has finished.
+// This is a db.CallObserver, so it can be used with db.NewInstrumentedUserDataRepository().
+func ObserveRepositoryCall(c context.Context, repository string, method string) (context.Context, func(err error)) {
+	start := time.Now()
+
+	return c, func(err error) {
+		repositoryCalls.WithLabelValues(repository, method, outcome(err)).Inc()
+		repositoryCallDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveOAuthCallback records the result of an OAuth login callback.
+// provider should be one of usersessionstore.OAuthTokenTypeGoogle, etc.
+func ObserveOAuthCallback(provider string, err error) {
+	oauthCallbacks.WithLabelValues(provider, outcome(err)).Inc()
+}
+
+// ObserveRateLimited records a request that was refused by the rate limiter.
+func ObserveRateLimited(limiter string) {
+	rateLimited.WithLabelValues(limiter).Inc()
+}
+
+// ObserveAnswer records an answer to a question.
+func ObserveAnswer(correct bool, dontKnow bool) {
+	result := ANSWER_WRONG
+	if dontKnow {
+		result = ANSWER_DONT_KNOW
+	} else if correct {
+		result = ANSWER_CORRECT
+	}
+
+	answers.WithLabelValues(result).Inc()
+}
+
+// ObserveWebhookDeliveryAttempt records an attempt to deliver an event to a webhook.
+func ObserveWebhookDeliveryAttempt(webhookId string, event string, err error) {
+	webhookDeliveryAttempts.WithLabelValues(webhookId, event, outcome(err)).Inc()
+}
+
+// ObserveQuizLoad records a load of the quizzes, with the number of quizzes if it succeeded.
+func ObserveQuizLoad(count int, err error) {
+	quizLoads.WithLabelValues(outcome(err)).Inc()
+	if err != nil {
+		return
+	}
+
+	quizzesLoaded.Set(float64(count))
+	quizLastLoad.SetToCurrentTime()
+}
+
+// SetCachedResponseBytes records the total size of the precomputed responses, for the content encoding.
+func SetCachedResponseBytes(encoding string, size int) {
+	cachedResponseBytes.WithLabelValues(encoding).Set(float64(size))
+}
+
+// InstrumentHandle returns a handler that records the requests to the route,
+// which should be the path as registered with the router, such as /api/quiz/:quizId,
+// so the requests for all quizzes are counted together.
+func InstrumentHandle(method string, route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		recorder := logging.NewResponseWriter(w)
+
+		h(recorder, r, ps)
+
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(recorder.Status())).Inc()
+		httpRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler returns the handler for the metrics,
+// which requires an "Authorization: Bearer" header with the token,
+// because the metrics are not meant for the public.
+// If the token is empty, all requests are refused.
+func Handler(token string) httprouter.Handle {
+	promHandler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || len(token) == 0 || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		promHandler.ServeHTTP(w, r)
+	}
+}
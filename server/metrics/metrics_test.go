@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "some-token"
+
+func scrape(t *testing.T, token string) (int, string) {
+	router := httprouter.New()
+	router.GET(PATH, Handler(testToken))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, PATH, nil)
+	if len(token) != 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	router.ServeHTTP(w, r)
+
+	body, err := io.ReadAll(w.Body)
+	assert.Nil(t, err)
+
+	return w.Code, string(body)
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	code, _ := scrape(t, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = scrape(t, "wrong-token")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body := scrape(t, testToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestHandlerWithEmptyToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, PATH, nil)
+	r.Header.Set("Authorization", "Bearer ")
+	Handler("")(w, r, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestInstrumentHandle(t *testing.T) {
+	route := "/api/test/:thingId"
+	router := httprouter.New()
+	router.GET(route, InstrumentHandle(http.MethodGet, route, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName("thingId") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	for _, path := range []string{"/api/test/a", "/api/test/b", "/api/test/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	_, body := scrape(t, testToken)
+	assert.Contains(t, body, `bigoquiz_http_requests_total{method="GET",route="/api/test/:thingId",status="200"} 2`)
+	assert.Contains(t, body, `bigoquiz_http_requests_total{method="GET",route="/api/test/:thingId",status="404"} 1`)
+	assert.Contains(t, body, `bigoquiz_http_request_duration_seconds_count{method="GET",route="/api/test/:thingId"} 3`)
+}
+
+func TestObserveFunctions(t *testing.T) {
+	c := context.Background()
+	_, done := ObserveRepositoryCall(c, "TestRepository", "GetThing")
+	done(nil)
+	_, done = ObserveRepositoryCall(c, "TestRepository", "GetThing")
+	done(errors.New("some error"))
+	ObserveOAuthCallback("test-provider", nil)
+	ObserveOAuthCallback("test-provider", errors.New("some error"))
+	ObserveQuizLoad(3, nil)
+	ObserveWebhookDeliveryAttempt("test-webhook", "quiz.completed", errors.New("some error"))
+
+	_, body := scrape(t, testToken)
+	assert.Contains(t, body, `bigoquiz_repository_calls_total{method="GetThing",outcome="success",repository="TestRepository"} 1`)
+	assert.Contains(t, body, `bigoquiz_repository_calls_total{method="GetThing",outcome="failure",repository="TestRepository"} 1`)
+	assert.Contains(t, body, `bigoquiz_repository_call_duration_seconds_count{method="GetThing",repository="TestRepository"} 2`)
+	assert.Contains(t, body, `bigoquiz_oauth_callbacks_total{outcome="success",provider="test-provider"} 1`)
+	assert.Contains(t, body, `bigoquiz_oauth_callbacks_total{outcome="failure",provider="test-provider"} 1`)
+	assert.Contains(t, body, `bigoquiz_quizzes_loaded 3`)
+	assert.Contains(t, body, `bigoquiz_quiz_loads_total{outcome="success"}`)
+	assert.Contains(t, body, `bigoquiz_webhook_delivery_attempts_total{event="quiz.completed",outcome="failure",webhook="test-webhook"} 1`)
+}
+
+func TestObserveAnswer(t *testing.T) {
+	before := testCounterValue(t, ANSWER_DONT_KNOW)
+	ObserveAnswer(true, true)
+	assert.Equal(t, before+1, testCounterValue(t, ANSWER_DONT_KNOW))
+
+	before = testCounterValue(t, ANSWER_CORRECT)
+	ObserveAnswer(true, false)
+	assert.Equal(t, before+1, testCounterValue(t, ANSWER_CORRECT))
+}
+
+func testCounterValue(t *testing.T, result string) float64 {
+	families, err := Registry.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "bigoquiz_answers_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "result" && label.GetValue() == result {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
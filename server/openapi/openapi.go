@@ -0,0 +1,230 @@
+// Package openapi describes HTTP APIs with OpenAPI 3 documents,
+// generating the JSON schemas from Go types, using their JSON struct tags.
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const VERSION = "3.0.3"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods, such as "get", to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref string `json:"$ref,omitempty"`
+
+	Type   string `json:"type,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// The prefix of the Ref of schemas in the document's Components.
+const SCHEMA_REF_PREFIX = "#/components/schemas/"
+
+func NewDocument(title string, version string) *Document {
+	return &Document{
+		OpenAPI: VERSION,
+		Info: Info{
+			Title:   title,
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+		},
+	}
+}
+
+// AddOperation adds the operation for the method, such as "GET", to the path,
+// in OpenAPI syntax, such as /api/quiz/{quizId}.
+func (self *Document) AddOperation(method string, path string, operation *Operation) {
+	item, ok := self.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		self.Paths[path] = item
+	}
+
+	(*item)[strings.ToLower(method)] = operation
+}
+
+// LookupSchema returns the schema, following its Ref if it has one,
+// or nil if the Ref is not in the document's Components.
+func (self *Document) LookupSchema(schema *Schema) *Schema {
+	if schema == nil || len(schema.Ref) == 0 {
+		return schema
+	}
+
+	return self.Components.Schemas[strings.TrimPrefix(schema.Ref, SCHEMA_REF_PREFIX)]
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaName returns a name for a struct type, such as "quiz.Question",
+// so types with the same name in different packages are not confused.
+func schemaName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// SchemaFor returns the schema for values of the type, as serialized by encoding/json,
+// adding the schemas of any named struct types to the document's Components,
+// and returning a reference to them.
+func (self *Document) SchemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json uses base64 for []byte.
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: self.SchemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: self.SchemaFor(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return self.structSchema(t)
+		}
+
+		name := schemaName(t)
+		if _, ok := self.Components.Schemas[name]; !ok {
+			// Add it before generating the properties, in case the type refers to itself.
+			self.Components.Schemas[name] = &Schema{}
+			*self.Components.Schemas[name] = *self.structSchema(t)
+		}
+
+		return &Schema{Ref: SCHEMA_REF_PREFIX + name}
+	default:
+		// Any JSON value.
+		return &Schema{}
+	}
+}
+
+func (self *Document) structSchema(t reflect.Type) *Schema {
+	result := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	self.addStructProperties(t, result, false)
+	return result
+}
+
+// addStructProperties adds the struct's fields to the schema, as encoding/json would serialize them,
+// including the fields of embedded structs, which do not replace the outer struct's own fields.
+func (self *Document) addStructProperties(t reflect.Type, schema *Schema, embedded bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		// encoding/json adds the fields of an embedded struct, unless the JSON tag gives it a name.
+		if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+			self.addStructProperties(fieldType, schema, true)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		if _, exists := schema.Properties[name]; exists && embedded {
+			continue
+		}
+
+		schema.Properties[name] = self.SchemaFor(field.Type)
+	}
+}
@@ -0,0 +1,79 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testInner struct {
+	Value  string `json:"value"`
+	Shared int    `json:"shared"`
+}
+
+type testOuter struct {
+	testInner
+
+	Shared   string `json:"shared"`
+	Omitted  string `json:"-"`
+	NoTag    bool
+	Optional *float64          `json:"optional,omitempty"`
+	When     time.Time         `json:"when"`
+	Data     []byte            `json:"data"`
+	Children []*testOuter      `json:"children"`
+	ByName   map[string]string `json:"byName"`
+	private  string
+}
+
+func TestSchemaForStruct(t *testing.T) {
+	doc := NewDocument("test", "1")
+
+	schema := doc.SchemaFor(reflect.TypeOf(&testOuter{}))
+	assert.Equal(t, SCHEMA_REF_PREFIX+"openapi.testOuter", schema.Ref)
+
+	resolved := doc.LookupSchema(schema)
+	assert.NotNil(t, resolved)
+	assert.Equal(t, "object", resolved.Type)
+
+	var names []string
+	for name := range resolved.Properties {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{"value", "shared", "NoTag", "optional", "when", "data", "children", "byName"}, names)
+
+	// The outer struct's field replaces the embedded struct's field.
+	assert.Equal(t, "string", resolved.Properties["shared"].Type)
+
+	assert.Equal(t, "boolean", resolved.Properties["NoTag"].Type)
+	assert.Equal(t, "number", resolved.Properties["optional"].Type)
+	assert.Equal(t, "date-time", resolved.Properties["when"].Format)
+	assert.Equal(t, "byte", resolved.Properties["data"].Format)
+
+	// The type refers to itself.
+	assert.Equal(t, "array", resolved.Properties["children"].Type)
+	assert.Equal(t, schema.Ref, resolved.Properties["children"].Items.Ref)
+
+	assert.Equal(t, "object", resolved.Properties["byName"].Type)
+	assert.Equal(t, "string", resolved.Properties["byName"].AdditionalProperties.Type)
+}
+
+func TestAddOperation(t *testing.T) {
+	doc := NewDocument("test", "1")
+	doc.AddOperation("GET", "/things/{id}", &Operation{OperationId: "getThing"})
+	doc.AddOperation("DELETE", "/things/{id}", &Operation{OperationId: "deleteThing"})
+
+	item, ok := doc.Paths["/things/{id}"]
+	assert.True(t, ok)
+	assert.Equal(t, "getThing", (*item)["get"].OperationId)
+	assert.Equal(t, "deleteThing", (*item)["delete"].OperationId)
+}
+
+func TestLookupSchemaUnknown(t *testing.T) {
+	doc := NewDocument("test", "1")
+	assert.Nil(t, doc.LookupSchema(&Schema{Ref: SCHEMA_REF_PREFIX + "nonexistent"}))
+
+	schema := &Schema{Type: "string"}
+	assert.Equal(t, schema, doc.LookupSchema(schema))
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// How many calls to Take() between removals of the buckets that have refilled.
+const memoryStoreSweepInterval = 1000
+
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps the token buckets in memory, for one instance of the server.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+
+	// Counts the calls to Take(), to sweep the buckets occasionally.
+	takes int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (self *MemoryStore) Take(c context.Context, key string, limit Limit, count int, now time.Time) (bool, time.Duration, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.takes++
+	if self.takes%memoryStoreSweepInterval == 0 {
+		self.sweep(now)
+	}
+
+	b, ok := self.buckets[key]
+	if !ok {
+		b = &bucket{
+			limit:  limit,
+			tokens: float64(limit.Burst),
+			last:   now,
+		}
+		self.buckets[key] = b
+	}
+
+	b.limit = limit
+	b.refill(now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		return false, wait, nil
+	}
+
+	// This may leave the bucket in debt.
+	b.tokens -= float64(count)
+	return true, 0, nil
+}
+
+func (self *MemoryStore) Refund(c context.Context, key string, limit Limit, count int, now time.Time) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	// A bucket that has been swept was already full.
+	b, ok := self.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	b.limit = limit
+	b.refill(now)
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+float64(count))
+	return nil
+}
+
+// refill adds the tokens for the time since the last refill, up to the bucket's size.
+func (self *bucket) refill(now time.Time) {
+	elapsed := now.Sub(self.last).Seconds()
+	if elapsed > 0 {
+		self.tokens = math.Min(float64(self.limit.Burst), self.tokens+elapsed*self.limit.Rate)
+		self.last = now
+	}
+}
+
+// sweep removes the buckets that are full, so the map does not grow forever.
+// A removed bucket is the same as a new one.
+func (self *MemoryStore) sweep(now time.Time) {
+	for key, b := range self.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(self.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets being kept.
+func (self *MemoryStore) Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return len(self.buckets)
+}
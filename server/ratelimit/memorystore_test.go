@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(60, 2)
+	c := context.Background()
+	now := time.Now()
+
+	// The burst:
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(c, "some-key", limit, 1, now)
+		assert.Nil(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, retryAfter, err := store.Take(c, "some-key", limit, 1, now)
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Other keys have their own buckets.
+	allowed, _, err = store.Take(c, "some-other-key", limit, 1, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// One token is added each second.
+	allowed, retryAfter, err = store.Take(c, "some-key", limit, 1, now.Add(500*time.Millisecond))
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	allowed, _, err = store.Take(c, "some-key", limit, 1, now.Add(time.Second))
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	allowed, _, err = store.Take(c, "some-key", limit, 1, now.Add(time.Second))
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+
+	// The bucket does not fill beyond the burst.
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		allowed, _, _ = store.Take(c, "some-key", limit, 1, later)
+		assert.True(t, allowed)
+	}
+
+	allowed, _, _ = store.Take(c, "some-key", limit, 1, later)
+	assert.False(t, allowed)
+}
+
+func TestMemoryStoreTakeSeveral(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(60, 5)
+	c := context.Background()
+	now := time.Now()
+
+	allowed, _, err := store.Take(c, "some-key", limit, 3, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// More than the bucket has, or could ever have, is allowed, leaving the bucket in debt.
+	allowed, _, err = store.Take(c, "some-key", limit, 20, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// The debt of 18 tokens, and one more token, must be refilled first.
+	allowed, retryAfter, err := store.Take(c, "some-key", limit, 1, now)
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 19*time.Second, retryAfter)
+
+	allowed, _, err = store.Take(c, "some-key", limit, 1, now.Add(19*time.Second))
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+}
+
+func TestMemoryStoreRefund(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(60, 5)
+	c := context.Background()
+	now := time.Now()
+
+	allowed, _, err := store.Take(c, "some-key", limit, 20, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// Refunding the tokens repays the debt.
+	assert.Nil(t, store.Refund(c, "some-key", limit, 20, now))
+	allowed, _, err = store.Take(c, "some-key", limit, 5, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// The bucket does not fill beyond the burst.
+	assert.Nil(t, store.Refund(c, "some-key", limit, 100, now))
+	assert.Equal(t, 5.0, store.buckets["some-key"].tokens)
+
+	// A bucket that was never taken from is already full.
+	assert.Nil(t, store.Refund(c, "some-other-key", limit, 1, now))
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	fast := PerMinute(60, 1)
+	slow := PerMinute(1, 1)
+	c := context.Background()
+	now := time.Now()
+
+	_, _, _ = store.Take(c, "slow-key", slow, 1, now)
+	for i := 0; i < memoryStoreSweepInterval-2; i++ {
+		_, _, _ = store.Take(c, "fast-key", fast, 1, now)
+	}
+
+	// Sweep, after the fast bucket has refilled, but before the slow bucket has.
+	_, _, _ = store.Take(c, "other-key", fast, 1, now.Add(10*time.Second))
+	assert.Equal(t, 2, store.Len())
+
+	allowed, _, _ := store.Take(c, "slow-key", slow, 1, now.Add(10*time.Second))
+	assert.False(t, allowed)
+}
@@ -0,0 +1,207 @@
+// Package ratelimit limits how often each client may call expensive endpoints,
+// with a token bucket for each client IP address, and for each logged-in user.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/config"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+)
+
+// Limit is a token bucket's size and refill rate.
+// A request takes one token, or one for each of its items, and is refused if the bucket is empty.
+type Limit struct {
+	// How many tokens are added to the bucket each second.
+	Rate float64
+
+	// The bucket's size: How many requests may be made at once, after a quiet period.
+	Burst int
+}
+
+// PerMinute returns a Limit that allows count requests per minute, on average,
+// with up to burst requests at once.
+func PerMinute(count float64, burst int) Limit {
+	return Limit{
+		Rate:  count / 60,
+		Burst: burst,
+	}
+}
+
+// FromConfig returns the Limit for the configured limit, which may be nil, for no limit.
+func FromConfig(limit *config.RateLimit) Limit {
+	if limit == nil {
+		return Limit{}
+	}
+
+	return PerMinute(limit.PerMinute, limit.Burst)
+}
+
+// Enabled returns whether the limit allows any requests. A zero Limit is disabled, not a limit of zero requests.
+func (self Limit) Enabled() bool {
+	return self.Rate > 0 && self.Burst > 0
+}
+
+// Store keeps the token buckets.
+// The in-memory MemoryStore only limits the requests to one instance of the server,
+// so a shared store, such as one backed by the datastore or Redis, would be needed to limit all instances.
+type Store interface {
+	// Take takes count tokens from the key's bucket, if it has at least one token,
+	// returning false, and how long until there will be a token, if it has none.
+	// If the bucket has fewer than count tokens, it is left in debt, so later requests wait until the debt is repaid.
+	// This lets a request with more items than the Limit's Burst, such as a sync of offline answers, succeed, while still paying for all of them.
+	Take(c context.Context, key string, limit Limit, count int, now time.Time) (allowed bool, retryAfter time.Duration, err error)
+
+	// Refund gives back count tokens that Take() took, up to the bucket's size,
+	// when another limit then refused the request.
+	Refund(c context.Context, key string, limit Limit, count int, now time.Time) error
+}
+
+// UserIdFunc returns the ID of the request's logged-in user, or an empty string if the user is not logged in.
+// This should be cheap, such as reading the session cookie, because it is called before the request is handled.
+type UserIdFunc func(r *http.Request) string
+
+// Limiter limits the requests to some routes, by client IP address and by user.
+// The routes share the buckets, so a client cannot avoid the limit by using several of the routes.
+type Limiter struct {
+	// Used in the bucket keys, and in the metrics.
+	name string
+
+	store Store
+
+	perIp   Limit
+	perUser Limit
+
+	// Nil if the requests are not limited by user.
+	userId UserIdFunc
+
+	// See ClientIp().
+	clientIpHeader string
+
+	now func() time.Time
+}
+
+// NewLimiter returns a Limiter that limits each IP address to perIp, and each user to perUser,
+// ignoring a Limit that is not Enabled().
+// userId may be nil if perUser is not enabled.
+// clientIpHeader is the header that has the client's IP address, if any. See ClientIp().
+func NewLimiter(name string, store Store, perIp Limit, perUser Limit, userId UserIdFunc, clientIpHeader string) *Limiter {
+	return &Limiter{
+		name:           name,
+		store:          store,
+		perIp:          perIp,
+		perUser:        perUser,
+		userId:         userId,
+		clientIpHeader: clientIpHeader,
+		now:            time.Now,
+	}
+}
+
+// Handle returns a handler that responds with 429 Too Many Requests, with a Retry-After header,
+// instead of calling h, if the client has made too many requests.
+func (self *Limiter) Handle(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !self.Allow(w, r, 1) {
+			return
+		}
+
+		h(w, r, ps)
+	}
+}
+
+// Allow takes count tokens, such as one for each item in the request,
+// for a handler that only knows the count after reading the request, so it cannot use Handle().
+// Like Handle(), it responds with 429 Too Many Requests, and returns false, if the client has made too many requests.
+func (self *Limiter) Allow(w http.ResponseWriter, r *http.Request, count int) bool {
+	retryAfter, limited := self.check(r, max(count, 1))
+	if !limited {
+		return true
+	}
+
+	metrics.ObserveRateLimited(self.name)
+
+	// Round up, so the client does not retry too early.
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	apierror.Write(w, http.StatusTooManyRequests, apierror.CODE_RATE_LIMITED, "too many requests", nil)
+	return false
+}
+
+// check returns true, and how long the client should wait, if the request should be refused.
+// The tokens are only taken if both limits allow the request,
+// so a user who is over their own limit does not use up the limit of the other users at the same IP address.
+func (self *Limiter) check(r *http.Request, count int) (time.Duration, bool) {
+	c := r.Context()
+	now := self.now()
+
+	var ipKey string
+	if self.perIp.Enabled() {
+		ipKey = "ip:" + ClientIp(r, self.clientIpHeader)
+		if retryAfter, limited := self.take(c, ipKey, self.perIp, count, now); limited {
+			return retryAfter, true
+		}
+	}
+
+	if self.perUser.Enabled() && self.userId != nil {
+		if userId := self.userId(r); len(userId) != 0 {
+			if retryAfter, limited := self.take(c, "user:"+userId, self.perUser, count, now); limited {
+				if len(ipKey) != 0 {
+					self.refund(c, ipKey, self.perIp, count, now)
+				}
+
+				return retryAfter, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func (self *Limiter) take(c context.Context, key string, limit Limit, count int, now time.Time) (time.Duration, bool) {
+	allowed, retryAfter, err := self.store.Take(c, self.name+":"+key, limit, count, now)
+	if err != nil {
+		// Allow the request, rather than refusing everyone while the store is unavailable.
+		slog.ErrorContext(c, "rate limit store failed", "limiter", self.name, "error", err)
+		return 0, false
+	}
+
+	return retryAfter, !allowed
+}
+
+func (self *Limiter) refund(c context.Context, key string, limit Limit, count int, now time.Time) {
+	if err := self.store.Refund(c, self.name+":"+key, limit, count, now); err != nil {
+		slog.ErrorContext(c, "rate limit store failed to refund", "limiter", self.name, "error", err)
+	}
+}
+
+// ClientIp returns the client's IP address.
+// If header is not empty, and the request has it, it is the header's value.
+// This should be a header that the platform sets, replacing any header sent by the client,
+// such as App Engine's X-Appengine-User-Ip.
+// Otherwise, it is the address of the connection, which could be a proxy's address.
+func ClientIp(r *http.Request, header string) string {
+	if len(header) != 0 {
+		if ip := strings.TrimSpace(r.Header.Get(header)); len(ip) != 0 {
+			return ip
+		}
+	}
+
+	return remoteIp(r.RemoteAddr)
+}
+
+func remoteIp(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
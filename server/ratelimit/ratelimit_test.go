@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/config"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func testHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	_, _ = w.Write([]byte("ok"))
+}
+
+func serve(handler httprouter.Handle, remoteAddr string, userId string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/test", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("X-Test-User", userId)
+	handler(w, r, nil)
+	return w
+}
+
+func testUserId(r *http.Request) string {
+	return r.Header.Get("X-Test-User")
+}
+
+func TestLimiterPerIp(t *testing.T) {
+	limiter := NewLimiter("test", NewMemoryStore(), PerMinute(30, 2), Limit{}, testUserId, "")
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Handle(testHandler)
+
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "").Code)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:5678", "").Code)
+
+	w := serve(handler, "192.0.2.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, apierror.CONTENT_TYPE, w.Header().Get("Content-Type"))
+
+	var problem apierror.Problem
+	err := json.Unmarshal(w.Body.Bytes(), &problem)
+	assert.Nil(t, err)
+	assert.Equal(t, apierror.CODE_RATE_LIMITED, problem.Code)
+
+	// Another client is not limited.
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.2:1234", "").Code)
+
+	// Later:
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "").Code)
+}
+
+func TestLimiterPerUser(t *testing.T) {
+	limiter := NewLimiter("test", NewMemoryStore(), PerMinute(600, 100), PerMinute(60, 1), testUserId, "")
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	handler := limiter.Handle(testHandler)
+
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "some-user").Code)
+
+	// The same user, from another address:
+	w := serve(handler, "192.0.2.2:1234", "some-user")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// Another user, and users who are not logged in, are not limited by the user limit.
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "some-other-user").Code)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "").Code)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "").Code)
+}
+
+func TestLimiterPerUserDoesNotTakeIpTokens(t *testing.T) {
+	store := NewMemoryStore()
+	limiter := NewLimiter("test", store, PerMinute(60, 10), PerMinute(60, 1), testUserId, "")
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	allow := func(userId string, count int) bool {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/test", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("X-Test-User", userId)
+		return limiter.Allow(w, r, count)
+	}
+
+	ipTokens := func() float64 {
+		return store.buckets["test:ip:192.0.2.1"].tokens
+	}
+
+	assert.True(t, allow("some-user", 1))
+	assert.Equal(t, 9.0, ipTokens())
+
+	// The user is over their own limit, so the IP address's tokens are not taken, even for a large request.
+	for i := 0; i < 3; i++ {
+		assert.False(t, allow("some-user", 500))
+		assert.Equal(t, 9.0, ipTokens())
+	}
+
+	// Other users at the same address are not limited.
+	assert.True(t, allow("some-other-user", 1))
+}
+
+func TestLimiterAllowSeveral(t *testing.T) {
+	limiter := NewLimiter("test", NewMemoryStore(), Limit{}, PerMinute(60, 10), testUserId, "")
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	allow := func(count int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/test", nil)
+		r.Header.Set("X-Test-User", "some-user")
+		allowed := limiter.Allow(w, r, count)
+		assert.Equal(t, allowed, w.Code == http.StatusOK)
+		return w
+	}
+
+	// One token for each item, even more than the burst.
+	assert.Equal(t, http.StatusOK, allow(50).Code)
+
+	w := allow(1)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "41", w.Header().Get("Retry-After"))
+
+	// The requests that Handle() allows share the tokens.
+	handler := limiter.Handle(testHandler)
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, "192.0.2.1:1234", "some-user").Code)
+
+	now = now.Add(41 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "some-user").Code)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter("test", NewMemoryStore(), FromConfig(nil), FromConfig(&config.RateLimit{}), testUserId, "")
+	handler := limiter.Handle(testHandler)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "some-user").Code)
+	}
+}
+
+// failingStore fails to take any tokens.
+type failingStore struct{}
+
+func (self failingStore) Take(c context.Context, key string, limit Limit, count int, now time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("some error")
+}
+
+func (self failingStore) Refund(c context.Context, key string, limit Limit, count int, now time.Time) error {
+	return errors.New("some error")
+}
+
+func TestLimiterStoreFailure(t *testing.T) {
+	limiter := NewLimiter("test", failingStore{}, PerMinute(1, 1), PerMinute(1, 1), testUserId, "")
+	handler := limiter.Handle(testHandler)
+
+	// Allowed, rather than refusing all requests.
+	assert.Equal(t, http.StatusOK, serve(handler, "192.0.2.1:1234", "some-user").Code)
+}
+
+func TestClientIp(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "192.0.2.1", ClientIp(r, ""))
+	assert.Equal(t, "192.0.2.1", ClientIp(r, "X-Appengine-User-Ip"))
+
+	r.Header.Set("X-Appengine-User-Ip", "198.51.100.7")
+	assert.Equal(t, "198.51.100.7", ClientIp(r, "X-Appengine-User-Ip"))
+
+	// The header is ignored unless it is configured, because clients could send it.
+	assert.Equal(t, "192.0.2.1", ClientIp(r, ""))
+
+	r.RemoteAddr = "[2001:db8::1]:1234"
+	assert.Equal(t, "2001:db8::1", ClientIp(r, ""))
+}
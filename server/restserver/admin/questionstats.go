@@ -0,0 +1,37 @@
+package admin
+
+import (
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+)
+
+type WrongAnswer struct {
+	Answer string `json:"answer"`
+	Count  int    `json:"count"`
+}
+
+// QuestionStats describes how all users have answered a question,
+// so quiz authors can find questions that are too hard, or that are confusing.
+type QuestionStats struct {
+	QuizId     string `json:"quizId"`
+	QuestionId string `json:"questionId"`
+
+	Answered int `json:"answered"`
+	Correct  int `json:"correct"`
+	DontKnow int `json:"dontKnow"`
+
+	// The proportion, from 0 to 1, of answers that were correct.
+	CorrectRate float64 `json:"correctRate"`
+
+	// The proportion, from 0 to 1, of answers that were wrong, including "I don't know" answers.
+	WrongRate float64 `json:"wrongRate"`
+
+	// An estimate, from 0 (easy) to 1 (hard), which takes the number of answers into account.
+	Difficulty float64 `json:"difficulty"`
+
+	// The most common wrong answers, most common first.
+	CommonWrongAnswers []WrongAnswer `json:"commonWrongAnswers,omitempty"`
+
+	// Extras, from the quiz, not from the stats:
+	SectionId     string         `json:"sectionId,omitempty"`
+	QuestionTitle *restquiz.Text `json:"questionTitle,omitempty"`
+}
@@ -0,0 +1,27 @@
+package admin
+
+// WebhookDelivery is one entry in the webhook delivery log.
+type WebhookDelivery struct {
+	Id        string `json:"id"`
+	WebhookId string `json:"webhookId"`
+	Event     string `json:"event"`
+
+	// "pending", "delivered", or "failed".
+	Status string `json:"status"`
+
+	Attempts int `json:"attempts"`
+
+	// The times are in RFC 3339 format.
+	Created string `json:"created"`
+
+	// When the next attempt is due, if the delivery is pending.
+	NextAttempt string `json:"nextAttempt,omitempty"`
+
+	LastAttempt string `json:"lastAttempt,omitempty"`
+
+	// The HTTP status of the last attempt's response, if there was a response.
+	LastStatusCode int `json:"lastStatusCode,omitempty"`
+
+	// Why the last attempt failed, if it failed.
+	LastError string `json:"lastError,omitempty"`
+}
@@ -0,0 +1,77 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) *apierror.Problem {
+	assert.Equal(t, apierror.CONTENT_TYPE, w.Header().Get("Content-Type"))
+
+	var result apierror.Problem
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+	assert.Nil(t, err)
+
+	return &result
+}
+
+func TestHandleQuestionNextWithoutQuizIdOrTag(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/question/next", nil)
+	s.HandleQuestionNext(w, r, nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	problem := decodeProblem(t, w)
+	assert.Equal(t, apierror.CODE_MISSING_PARAMETER, problem.Code)
+	assert.Equal(t, QUERY_PARAM_QUIZ_ID, problem.Details["parameter"])
+}
+
+func TestHandleQuizQuestionByIdNotFound(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/graphs/question/nonexistent", nil)
+	s.HandleQuizQuestionById(w, r, httprouter.Params{
+		{Key: PATH_PARAM_QUIZ_ID, Value: "graphs"},
+		{Key: PATH_PARAM_QUESTION_ID, Value: "nonexistent"},
+	})
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, apierror.CODE_QUESTION_NOT_FOUND, decodeProblem(t, w).Code)
+}
+
+func TestHandleQuizExportUnknownFormatProblem(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/graphs/export?format=apkg", nil)
+	s.HandleQuizExport(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: "graphs"}})
+
+	problem := decodeProblem(t, w)
+	assert.Equal(t, apierror.CODE_INVALID_PARAMETER, problem.Code)
+	assert.Equal(t, QUERY_PARAM_FORMAT, problem.Details["parameter"])
+}
+
+func TestHandleV2SubmitAnswerInvalidJson(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v2/user/history/graphs/questions/terminology-dag/answers", strings.NewReader("{"))
+	s.HandleV2SubmitAnswer(w, r, httprouter.Params{
+		{Key: PATH_PARAM_QUIZ_ID, Value: "graphs"},
+		{Key: PATH_PARAM_QUESTION_ID, Value: "terminology-dag"},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, apierror.CODE_INVALID_JSON, decodeProblem(t, w).Code)
+}
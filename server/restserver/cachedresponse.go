@@ -0,0 +1,159 @@
+package restserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// The quizzes do not change while the server runs, but may change when it is deployed again,
+// so clients may use their copy for a while, and then check it cheaply, with If-None-Match.
+const quizzesCacheControl = "public, max-age=300"
+
+const (
+	contentEncodingBrotli   = "br"
+	contentEncodingGzip     = "gzip"
+	contentEncodingIdentity = "identity"
+)
+
+// cachedResponse is a JSON response body that is serialized and compressed only once,
+// for content that does not change while the server runs.
+type cachedResponse struct {
+	json   []byte
+	gzip   []byte
+	brotli []byte
+
+	etag string
+}
+
+func newCachedResponse(v interface{}) (*cachedResponse, error) {
+	jsonStr, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal() failed: %v", err)
+	}
+
+	var result cachedResponse
+	result.json = jsonStr
+	result.etag = generateETag(jsonStr)
+
+	var gzipBuf bytes.Buffer
+	gzipWriter, err := gzip.NewWriterLevel(&gzipBuf, gzip.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("gzip.NewWriterLevel() failed: %v", err)
+	}
+
+	if _, err := gzipWriter.Write(jsonStr); err != nil {
+		return nil, fmt.Errorf("gzip Write() failed: %v", err)
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("gzip Close() failed: %v", err)
+	}
+
+	result.gzip = gzipBuf.Bytes()
+
+	var brotliBuf bytes.Buffer
+	brotliWriter := brotli.NewWriterLevel(&brotliBuf, brotli.DefaultCompression)
+	if _, err := brotliWriter.Write(jsonStr); err != nil {
+		return nil, fmt.Errorf("brotli Write() failed: %v", err)
+	}
+
+	if err := brotliWriter.Close(); err != nil {
+		return nil, fmt.Errorf("brotli Close() failed: %v", err)
+	}
+
+	result.brotli = brotliBuf.Bytes()
+
+	return &result, nil
+}
+
+// write writes the response, or just http.StatusNotModified if the client already has it,
+// compressed if the client accepts that.
+func (self *cachedResponse) write(w http.ResponseWriter, r *http.Request, cacheControl string) {
+	header := w.Header()
+	header.Set("ETag", self.etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Add("Vary", "Accept-Encoding")
+
+	if etagMatches(r.Header.Get("If-None-Match"), self.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body := self.json
+	switch chooseContentEncoding(r.Header.Get("Accept-Encoding")) {
+	case contentEncodingBrotli:
+		body = self.brotli
+		header.Set("Content-Encoding", contentEncodingBrotli)
+	case contentEncodingGzip:
+		body = self.gzip
+		header.Set("Content-Encoding", contentEncodingGzip)
+	}
+
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+
+	// It's too late to report an error to the client.
+	_, _ = w.Write(body)
+}
+
+// chooseContentEncoding chooses brotli, gzip, or identity, depending on the Accept-Encoding header,
+// preferring brotli when the client likes them equally.
+func chooseContentEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if len(coding) == 0 {
+			continue
+		}
+
+		q := 1.0
+		params = strings.TrimSpace(params)
+		if value, found := strings.CutPrefix(params, "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		qualities[coding] = q
+	}
+
+	quality := func(coding string) float64 {
+		if q, ok := qualities[coding]; ok {
+			return q
+		}
+
+		if q, ok := qualities["*"]; ok {
+			return q
+		}
+
+		if coding == contentEncodingIdentity {
+			// Identity is acceptable unless it is explicitly refused.
+			return 0.001
+		}
+
+		return 0
+	}
+
+	result := contentEncodingIdentity
+	best := quality(contentEncodingIdentity)
+	for _, coding := range []string{contentEncodingGzip, contentEncodingBrotli} {
+		if q := quality(coding); q > 0 && q >= best {
+			result = coding
+			best = q
+		}
+	}
+
+	return result
+}
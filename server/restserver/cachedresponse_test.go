@@ -0,0 +1,161 @@
+package restserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseContentEncoding(t *testing.T) {
+	assert.Equal(t, contentEncodingIdentity, chooseContentEncoding(""))
+	assert.Equal(t, contentEncodingGzip, chooseContentEncoding("gzip"))
+	assert.Equal(t, contentEncodingGzip, chooseContentEncoding("deflate, gzip"))
+	assert.Equal(t, contentEncodingBrotli, chooseContentEncoding("gzip, deflate, br"))
+	assert.Equal(t, contentEncodingBrotli, chooseContentEncoding("*"))
+	assert.Equal(t, contentEncodingGzip, chooseContentEncoding("br;q=0.5, gzip;q=0.8"))
+	assert.Equal(t, contentEncodingGzip, chooseContentEncoding("br;q=0, gzip"))
+	assert.Equal(t, contentEncodingIdentity, chooseContentEncoding("gzip;q=0"))
+	assert.Equal(t, contentEncodingIdentity, chooseContentEncoding("compress"))
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) []byte {
+	var reader io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case contentEncodingGzip:
+		gzipReader, err := gzip.NewReader(w.Body)
+		assert.Nil(t, err)
+		reader = gzipReader
+	case contentEncodingBrotli:
+		reader = brotli.NewReader(w.Body)
+	}
+
+	result, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return result
+}
+
+func TestCachedResponseWrite(t *testing.T) {
+	v := map[string]string{"some-key": "some-value"}
+	expected, err := json.Marshal(v)
+	assert.Nil(t, err)
+
+	response, err := newCachedResponse(v)
+	assert.Nil(t, err)
+	assert.Equal(t, generateETag(expected), response.etag)
+
+	for _, acceptEncoding := range []string{"", "gzip", "br"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		response.write(w, r, quizzesCacheControl)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, response.etag, w.Header().Get("ETag"))
+		assert.Equal(t, quizzesCacheControl, w.Header().Get("Cache-Control"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, acceptEncoding, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, expected, decodeBody(t, w))
+	}
+}
+
+func TestCachedResponseWriteNotModified(t *testing.T) {
+	response, err := newCachedResponse([]string{"some-value"})
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", response.etag)
+	response.write(w, r, quizzesCacheControl)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, response.etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func testQuizResponsesServer(t *testing.T) *RestServer {
+	quiz := testRestQuiz()
+	s := &RestServer{
+		quizzes: restQuizMap{quiz.Id: quiz},
+	}
+	s.quizzesListSimple = buildQuizzesSimple(s.quizzes)
+	s.quizzesListFull = buildQuizzesFull(s.quizzes)
+
+	err := s.buildQuizResponses()
+	assert.Nil(t, err)
+
+	return s
+}
+
+func TestHandleQuizById(t *testing.T) {
+	s := testQuizResponsesServer(t)
+	quiz := testRestQuiz()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/"+quiz.Id, nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	s.HandleQuizById(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: quiz.Id}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	expected, err := json.Marshal(quiz)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, decodeBody(t, w))
+
+	// The client already has it:
+	etag := w.Header().Get("ETag")
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", etag)
+	s.HandleQuizById(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: quiz.Id}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestHandleQuizSectionsByQuizIdListOnly(t *testing.T) {
+	s := testQuizResponsesServer(t)
+	quiz := testRestQuiz()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/"+quiz.Id+"/section?list-only=true", nil)
+	s.HandleQuizSectionsByQuizId(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: quiz.Id}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	expected, err := json.Marshal(buildSectionsSimple(quiz.Sections))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, w.Body.Bytes())
+	assert.False(t, bytes.Contains(w.Body.Bytes(), []byte(`"questions"`)))
+}
+
+func TestHandleQuizAllEtagsDiffer(t *testing.T) {
+	s := testQuizResponsesServer(t)
+
+	w := httptest.NewRecorder()
+	s.HandleQuizAll(w, httptest.NewRequest(http.MethodGet, "/api/quiz", nil), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	wListOnly := httptest.NewRecorder()
+	s.HandleQuizAll(wListOnly, httptest.NewRequest(http.MethodGet, "/api/quiz?list-only=true", nil), nil)
+	assert.Equal(t, http.StatusOK, wListOnly.Code)
+
+	assert.NotEqual(t, w.Header().Get("ETag"), wListOnly.Header().Get("ETag"))
+	assert.Less(t, wListOnly.Body.Len(), w.Body.Len())
+}
+
+func TestHandleQuizByIdNotFound(t *testing.T) {
+	s := testQuizResponsesServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/nonexistent", nil)
+	s.HandleQuizById(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: "nonexistent"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, apierror.CODE_QUIZ_NOT_FOUND, decodeProblem(t, w).Code)
+}
@@ -0,0 +1,163 @@
+package group
+
+// Group is a study group, as seen by one of its members.
+type Group struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+
+	// Other users can join the group with this.
+	InviteCode string `json:"inviteCode"`
+
+	// Whether the user created the group.
+	IsOwner bool `json:"isOwner"`
+
+	// Whether the user includes their stats in the group's progress,
+	// and in the totals of the assignment reports, without their name.
+	SharesProgress bool `json:"sharesProgress"`
+
+	// Whether the group's owner sees the user's own progress on each assignment, by name.
+	SharesWithInstructor bool `json:"sharesWithInstructor"`
+
+	// Only when getting one group.
+	Members []*Member `json:"members,omitempty"`
+}
+
+type Member struct {
+	UserName             string `json:"userName"`
+	IsOwner              bool   `json:"isOwner"`
+	SharesProgress       bool   `json:"sharesProgress"`
+	SharesWithInstructor bool   `json:"sharesWithInstructor"`
+
+	// In RFC 3339 format.
+	Joined string `json:"joined"`
+}
+
+type CreateRequest struct {
+	Name string `json:"name"`
+
+	// Whether the creator includes their own stats in the group's progress.
+	SharesProgress bool `json:"sharesProgress"`
+}
+
+type JoinRequest struct {
+	InviteCode string `json:"inviteCode"`
+
+	// Members must choose to include their stats in the group's progress.
+	SharesProgress bool `json:"sharesProgress"`
+}
+
+// MembershipRequest replaces both choices. Leaving one out means false.
+type MembershipRequest struct {
+	SharesProgress       bool `json:"sharesProgress"`
+	SharesWithInstructor bool `json:"sharesWithInstructor"`
+}
+
+// Progress is the total of the stats, for one quiz, of the members who share their progress.
+// It does not say which member answered what.
+type Progress struct {
+	GroupId   string `json:"groupId"`
+	QuizId    string `json:"quizId"`
+	QuizTitle string `json:"quizTitle"`
+
+	CountMembersSharing    int `json:"countMembersSharing"`
+	CountMembersNotSharing int `json:"countMembersNotSharing"`
+
+	// In the quiz's order.
+	Sections []*SectionProgress `json:"sections"`
+}
+
+type SectionProgress struct {
+	SectionId    string `json:"sectionId"`
+	SectionTitle string `json:"sectionTitle"`
+
+	CountQuestions int `json:"countQuestions"`
+
+	// How many of the sharing members have answered any of the section's questions.
+	CountMembersStarted int `json:"countMembersStarted"`
+
+	Answered               int `json:"answered"`
+	Correct                int `json:"correct"`
+	CountQuestionsMastered int `json:"countQuestionsMastered"`
+
+	// The proportion, from 0 to 1, of the answers that were correct.
+	CorrectRate float64 `json:"correctRate"`
+
+	// The average proportion, from 0 to 1, of the section's questions that the sharing members
+	// have answered correctly at least once. Members who have not started the section count as 0.
+	CompletionRate float64 `json:"completionRate"`
+}
+
+// AssignmentRequest creates an assignment for the group's members.
+type AssignmentRequest struct {
+	QuizId string `json:"quizId"`
+
+	// The sections, or empty for the whole quiz.
+	SectionIds []string `json:"sectionIds,omitempty"`
+
+	// In RFC 3339 format.
+	Due string `json:"due"`
+
+	// The proportion, from 0 to 1, of the questions to answer correctly at least once.
+	// For instance, 0.8. The default is 1.
+	TargetCorrectOnce float64 `json:"targetCorrectOnce,omitempty"`
+}
+
+type Assignment struct {
+	Id        string `json:"id"`
+	GroupId   string `json:"groupId"`
+	GroupName string `json:"groupName"`
+
+	QuizId    string `json:"quizId"`
+	QuizTitle string `json:"quizTitle"`
+
+	// Empty for the whole quiz.
+	Sections []*AssignmentSection `json:"sections,omitempty"`
+
+	// In RFC 3339 format.
+	Due string `json:"due"`
+
+	TargetCorrectOnce float64 `json:"targetCorrectOnce"`
+
+	// In RFC 3339 format.
+	Created string `json:"created"`
+
+	// The user's own progress. Not for the group's owner, who set the assignment.
+	Progress *AssignmentProgress `json:"progress,omitempty"`
+}
+
+type AssignmentSection struct {
+	SectionId    string `json:"sectionId"`
+	SectionTitle string `json:"sectionTitle"`
+}
+
+type AssignmentProgress struct {
+	CountQuestions            int `json:"countQuestions"`
+	CountQuestionsCorrectOnce int `json:"countQuestionsCorrectOnce"`
+
+	// The proportion, from 0 to 1, of the questions answered correctly at least once.
+	CorrectOnceRate float64 `json:"correctOnceRate"`
+
+	// "not-started", "in-progress", "complete", or "overdue".
+	Status string `json:"status"`
+}
+
+// AssignmentReport is the status of the learners, for the group's owner.
+// The totals include the learners who share their progress with the group,
+// but only the learners who share it with the instructor are listed by name.
+type AssignmentReport struct {
+	Assignment *Assignment `json:"assignment"`
+
+	CountLearnersSharing    int `json:"countLearnersSharing"`
+	CountLearnersNotSharing int `json:"countLearnersNotSharing"`
+
+	// How many of the sharing learners have each status.
+	CountByStatus map[string]int `json:"countByStatus"`
+
+	// Only the learners who share their progress with the instructor. Sorted by name.
+	Learners []*LearnerProgress `json:"learners"`
+}
+
+type LearnerProgress struct {
+	UserName string              `json:"userName"`
+	Progress *AssignmentProgress `json:"progress"`
+}
@@ -0,0 +1,11 @@
+package quiz
+
+// Collection describes the questions, from any quiz, that have a tag.
+type Collection struct {
+	Tag string `json:"tag"`
+
+	// The quizzes that contain questions with this tag.
+	QuizIds []string `json:"quizIds,omitempty"`
+
+	CountQuestions int `json:"countQuestions"`
+}
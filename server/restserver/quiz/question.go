@@ -8,12 +8,22 @@ type Question struct {
 
 	Text Text `json:"text,omitempty"`
 
+	Tags []string `json:"tags,omitempty"`
+
 	// These are not in the data files.
+	QuizId       string `json:"quizId,omitempty"`
 	SectionId    string `json:"sectionId,omitempty"`
 	SubSectionId string `json:"subSectionId,omitempty"`
 
 	QuizUsesMathML bool `json:"quizUsesMathML"`
 
+	// The quiz's version, so an answer given offline can be recorded against this version.
+	QuizVersion string `json:"quizVersion,omitempty"`
+
+	// A hash of the question's text and answer.
+	// This is not in the JSON, because a client could find the answer by hashing each choice.
+	ContentHash string `json:"-"`
+
 	// These are not in the data files or domain structure.
 	// But we want to show them in the JSON.
 	// We don't use the Section and SubSection types here,
@@ -4,8 +4,13 @@ type Quiz struct {
 	HasIdAndTitle
 	IsPrivate bool `json:"isPrivate"`
 
+	// Changes when the quiz's content changes.
+	Version string `json:"version,omitempty"`
+
 	Sections []*Section `json:"sections,omitempty"`
 	// (Unlike the DTO struct, this only has questions inside a Section or SubSection.)
 
 	UsesMathML bool `json:"usesMathML"`
+
+	Tags []string `json:"tags,omitempty"`
 }
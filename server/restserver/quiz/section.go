@@ -7,6 +7,12 @@ type Section struct {
 
 	DefaultChoices []*Text `json:"defaultChoices,omitempty"`
 
+	Tags []string `json:"tags,omitempty"`
+
+	// The ID of the section that this section was generated from, if any,
+	// with the questions and answers swapped.
+	ReverseOf string `json:"reverseOf,omitempty"`
+
 	// TODO: We only need this until we have called setQuestionsChoicesFromAnswers().
 	AnswersAsChoices bool `json:"-"`
 }
@@ -178,6 +178,8 @@ func convertDomainQuizToRestQuiz(obj *domainquiz.Quiz) (*restquiz.Quiz, error) {
 	}
 
 	result.UsesMathML = obj.UsesMathML
+	result.Tags = obj.Tags
+	result.Version = obj.Version
 
 	return &result, nil
 }
@@ -209,6 +211,7 @@ func convertDomainQuestionToRestQuestion(obj *domainquiz.Question) (*restquiz.Qu
 	var result restquiz.Question
 	result.Id = obj.Id
 	result.Link = obj.Link
+	result.Tags = obj.Tags
 
 	text, err := convertDomainTextToRestText(&obj.Text)
 	if err != nil {
@@ -229,6 +232,7 @@ func convertDomainQAToRestQA(obj *domainquiz.QuestionAndAnswer) (*restquiz.Quest
 	}
 
 	result.Question = *question
+	result.ContentHash = obj.ContentHash
 
 	answer, err := convertDomainTextToRestText(&obj.Answer)
 	if err != nil {
@@ -294,6 +298,8 @@ func convertDomainSectionToRestSection(obj *domainquiz.Section) (*restquiz.Secti
 	}
 
 	result.AnswersAsChoices = obj.AnswersAsChoices
+	result.Tags = obj.Tags
+	result.ReverseOf = obj.ReverseOf
 
 	return &result, nil
 }
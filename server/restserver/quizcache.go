@@ -101,7 +101,7 @@ func getRandomQuestionFromSlice(questions []*restquiz.QuestionAndAnswer) *restqu
 		return nil
 	}
 
-	i := rand.Intn(count - 1)
+	i := rand.Intn(count)
 	qa := questions[i]
 	return &(qa.Question)
 }
@@ -0,0 +1,422 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restgroup "github.com/murraycu/go-bigoquiz-server/server/restserver/group"
+)
+
+const PATH_PARAM_ASSIGNMENT_ID = "assignmentId"
+
+// newAssignmentFromRequest returns the assignment, or the name of the invalid field and an error.
+func newAssignmentFromRequest(groupId string, request *restgroup.AssignmentRequest, quizCache *QuizCache, now time.Time) (*domaingroup.Assignment, string, error) {
+	sectionIds := make([]string, 0, len(request.SectionIds))
+	seen := make(map[string]bool)
+	for _, sectionId := range request.SectionIds {
+		if seen[sectionId] {
+			return nil, "sectionIds", fmt.Errorf("the section is listed more than once: %v", sectionId)
+		}
+
+		seen[sectionId] = true
+
+		if section, err := quizCache.GetSection(sectionId); err != nil || section == nil {
+			return nil, "sectionIds", fmt.Errorf("the quiz has no section: %v", sectionId)
+		}
+
+		sectionIds = append(sectionIds, sectionId)
+	}
+
+	if len(request.Due) == 0 {
+		return nil, "due", fmt.Errorf("due not specified")
+	}
+
+	due, err := time.Parse(time.RFC3339, request.Due)
+	if err != nil {
+		return nil, "due", fmt.Errorf("due must be in RFC 3339 format: %v", err)
+	}
+
+	if !due.After(now) {
+		return nil, "due", fmt.Errorf("due must be in the future")
+	}
+
+	target := request.TargetCorrectOnce
+	if target == 0 {
+		target = 1
+	}
+
+	if !domaingroup.IsValidTarget(target) {
+		return nil, "targetCorrectOnce", fmt.Errorf("targetCorrectOnce must be more than 0, and at most 1")
+	}
+
+	assignment, err := domaingroup.NewAssignment(groupId, quizCache.Quiz.Id, sectionIds, due.UTC(), target, now)
+	if err != nil {
+		return nil, "", fmt.Errorf("NewAssignment() failed: %v", err)
+	}
+
+	return assignment, "", nil
+}
+
+// assignmentSectionQuestionCounts returns the number of questions in each of the sections that the assignment covers,
+// ignoring any sections that have since been removed from the quiz.
+func assignmentSectionQuestionCounts(assignment *domaingroup.Assignment, quizCache *QuizCache) map[string]int {
+	result := make(map[string]int)
+	if len(assignment.SectionIds) == 0 {
+		for _, section := range quizCache.Quiz.Sections {
+			result[section.Id] = quizCache.GetSectionQuestionsCount(section.Id)
+		}
+
+		return result
+	}
+
+	for _, sectionId := range assignment.SectionIds {
+		if section, err := quizCache.GetSection(sectionId); err == nil && section != nil {
+			result[sectionId] = quizCache.GetSectionQuestionsCount(sectionId)
+		}
+	}
+
+	return result
+}
+
+// assignmentProgress returns the learner's progress, only counting the questions that are still in the quiz.
+// sectionQuestionCounts is from assignmentSectionQuestionCounts().
+func assignmentProgress(assignment *domaingroup.Assignment, quizCache *QuizCache, sectionQuestionCounts map[string]int, statsBySection map[string]*domainuser.Stats, now time.Time) *domaingroup.AssignmentProgress {
+	countCorrectOnce := func(sectionId string, stats *domainuser.Stats) int {
+		return countSectionQuestionsCorrectOnce(quizCache, sectionId, stats)
+	}
+
+	return assignment.Progress(statsBySection, sectionQuestionCounts, countCorrectOnce, now)
+}
+
+func convertDomainAssignmentToRestAssignment(assignment *domaingroup.Assignment, group *domaingroup.Group, quizCache *QuizCache) *restgroup.Assignment {
+	result := &restgroup.Assignment{
+		Id:                assignment.Id,
+		GroupId:           group.Id,
+		GroupName:         group.Name,
+		QuizId:            assignment.QuizId,
+		QuizTitle:         quizCache.Quiz.Title,
+		Due:               assignment.Due.UTC().Format(time.RFC3339),
+		TargetCorrectOnce: assignment.TargetCorrectOnce,
+		Created:           assignment.Created.UTC().Format(time.RFC3339),
+	}
+
+	for _, sectionId := range assignment.SectionIds {
+		section, err := quizCache.GetSection(sectionId)
+		if err != nil || section == nil {
+			continue
+		}
+
+		result.Sections = append(result.Sections, &restgroup.AssignmentSection{
+			SectionId:    section.Id,
+			SectionTitle: section.Title,
+		})
+	}
+
+	return result
+}
+
+func convertDomainAssignmentProgressToRestAssignmentProgress(progress *domaingroup.AssignmentProgress) *restgroup.AssignmentProgress {
+	return &restgroup.AssignmentProgress{
+		CountQuestions:            progress.CountQuestions,
+		CountQuestionsCorrectOnce: progress.CountQuestionsCorrectOnce,
+		CorrectOnceRate:           progress.CorrectOnceRate(),
+		Status:                    progress.Status,
+	}
+}
+
+// sortRestAssignments sorts the assignments with the soonest due first.
+func sortRestAssignments(assignments []*restgroup.Assignment) {
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].Due != assignments[j].Due {
+			return assignments[i].Due < assignments[j].Due
+		}
+
+		return assignments[i].Id < assignments[j].Id
+	})
+}
+
+// buildUserAssignments returns the assignments of the groups, with the user's own progress,
+// apart from the assignments of groups that the user owns, which they set.
+// Assignments for quizzes that no longer exist are left out.
+func (s *RestServer) buildUserAssignments(c context.Context, userId string, groups []*domaingroup.Group, now time.Time) ([]*restgroup.Assignment, error) {
+	// The user's stats, by quiz ID, read once for all the assignments for the quiz.
+	statsByQuiz := make(map[string]map[string]*domainuser.Stats)
+
+	result := make([]*restgroup.Assignment, 0)
+	for _, group := range groups {
+		assignments, err := s.userDataClient.GetGroupAssignments(c, group.Id)
+		if err != nil {
+			return nil, fmt.Errorf("GetGroupAssignments() failed: %v", err)
+		}
+
+		for _, assignment := range assignments {
+			quizCache, ok := s.quizCacheMap[assignment.QuizId]
+			if !ok {
+				continue
+			}
+
+			restAssignment := convertDomainAssignmentToRestAssignment(assignment, group, quizCache)
+			result = append(result, restAssignment)
+
+			if group.OwnerUserId == userId {
+				continue
+			}
+
+			statsBySection, ok := statsByQuiz[assignment.QuizId]
+			if !ok {
+				statsBySection, err = s.userDataClient.GetUserStatsForQuiz(c, userId, assignment.QuizId)
+				if err != nil {
+					return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+				}
+
+				statsByQuiz[assignment.QuizId] = statsBySection
+			}
+
+			progress := assignmentProgress(assignment, quizCache, assignmentSectionQuestionCounts(assignment, quizCache), statsBySection, now)
+			restAssignment.Progress = convertDomainAssignmentProgressToRestAssignmentProgress(progress)
+		}
+	}
+
+	sortRestAssignments(result)
+	return result, nil
+}
+
+// buildAssignmentReport only reads the stats of the learners who share their progress with the group,
+// or with the instructor, and only lists the learners who share it with the instructor.
+// The group's owner is not a learner.
+func (s *RestServer) buildAssignmentReport(c context.Context, group *domaingroup.Group, assignment *domaingroup.Assignment, quizCache *QuizCache, now time.Time) (*restgroup.AssignmentReport, error) {
+	members, err := s.userDataClient.GetGroupMemberships(c, group.Id)
+	if err != nil {
+		return nil, fmt.Errorf("GetGroupMemberships() failed: %v", err)
+	}
+
+	result := &restgroup.AssignmentReport{
+		Assignment:    convertDomainAssignmentToRestAssignment(assignment, group, quizCache),
+		CountByStatus: make(map[string]int),
+		Learners:      make([]*restgroup.LearnerProgress, 0, len(members)),
+	}
+
+	sectionQuestionCounts := assignmentSectionQuestionCounts(assignment, quizCache)
+	for _, member := range members {
+		if member.UserId == group.OwnerUserId {
+			continue
+		}
+
+		if !member.SharesProgress && !member.SharesWithInstructor {
+			result.CountLearnersNotSharing++
+			continue
+		}
+
+		statsBySection, err := s.userDataClient.GetUserStatsForQuiz(c, member.UserId, assignment.QuizId)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+		}
+
+		progress := assignmentProgress(assignment, quizCache, sectionQuestionCounts, statsBySection, now)
+		result.CountLearnersSharing++
+		result.CountByStatus[progress.Status]++
+		if !member.SharesWithInstructor {
+			continue
+		}
+
+		result.Learners = append(result.Learners, &restgroup.LearnerProgress{
+			UserName: member.UserName,
+			Progress: convertDomainAssignmentProgressToRestAssignmentProgress(progress),
+		})
+	}
+
+	sort.SliceStable(result.Learners, func(i, j int) bool {
+		return result.Learners[i].UserName < result.Learners[j].UserName
+	})
+
+	return result, nil
+}
+
+// getGroupForOwnerOrHttpError is like getGroupForMemberOrHttpError,
+// but also writes an HTTP error, and returns false, if the user is not the group's owner.
+func (s *RestServer) getGroupForOwnerOrHttpError(w http.ResponseWriter, r *http.Request, ps httprouter.Params, userId string) (*domaingroup.Group, bool) {
+	group, _, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return nil, false
+	}
+
+	if group.OwnerUserId != userId {
+		handleErrorAsHttpError(w, http.StatusForbidden, apierror.CODE_FORBIDDEN, "only the group's owner may do this")
+		return nil, false
+	}
+
+	return group, true
+}
+
+// HandleCreateAssignment lets the group's owner assign a quiz, or some of its sections, to the group's members.
+func (s *RestServer) HandleCreateAssignment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var request restgroup.AssignmentRequest
+	if !readJsonBodyOrHttpError(w, r, &request) {
+		return
+	}
+
+	if len(request.QuizId) == 0 {
+		handleMissingParameterAsHttpError(w, "quizId")
+		return
+	}
+
+	quizCache, ok := s.quizCacheMap[request.QuizId]
+	if !ok {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+		return
+	}
+
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, ok := s.getGroupForOwnerOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	assignment, parameter, err := newAssignmentFromRequest(group.Id, &request, quizCache, time.Now().UTC())
+	if err != nil {
+		if len(parameter) == 0 {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "newAssignmentFromRequest() failed: %v", err)
+		} else {
+			handleInvalidParameterAsHttpError(w, parameter, "%v", err)
+		}
+
+		return
+	}
+
+	c := r.Context()
+	assignments, err := s.userDataClient.GetGroupAssignments(c, group.Id)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupAssignments() failed: %v", err)
+		return
+	}
+
+	if len(assignments) >= domaingroup.MaxAssignments {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_TOO_MANY_ITEMS, "the group already has %v assignments", domaingroup.MaxAssignments)
+		return
+	}
+
+	if err := s.userDataClient.StoreGroupAssignment(c, assignment); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroupAssignment() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertDomainAssignmentToRestAssignment(assignment, group, quizCache))
+}
+
+// HandleGroupAssignments returns the group's assignments, soonest due first,
+// with the user's own progress, unless the user is the group's owner.
+func (s *RestServer) HandleGroupAssignments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, _, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	result, err := s.buildUserAssignments(r.Context(), userId, []*domaingroup.Group{group}, time.Now().UTC())
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildUserAssignments() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// HandleUserAssignments returns the assignments of all the user's groups, soonest due first,
+// with the user's own progress. Assignments of the groups that the user owns are not included.
+func (s *RestServer) HandleUserAssignments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	c := r.Context()
+	memberships, err := s.userDataClient.GetUserGroupMemberships(c, userId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserGroupMemberships() failed: %v", err)
+		return
+	}
+
+	groups := make([]*domaingroup.Group, 0, len(memberships))
+	for _, membership := range memberships {
+		group, err := s.userDataClient.GetGroup(c, membership.GroupId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroup() failed: %v", err)
+			return
+		}
+
+		// Groups are not deleted, but just in case.
+		if group == nil || group.OwnerUserId == userId {
+			continue
+		}
+
+		groups = append(groups, group)
+	}
+
+	result, err := s.buildUserAssignments(c, userId, groups, time.Now().UTC())
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildUserAssignments() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// HandleAssignmentReport returns the status of each learner who shares their progress, for the group's owner.
+func (s *RestServer) HandleAssignmentReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, ok := s.getGroupForOwnerOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	assignmentId := ps.ByName(PATH_PARAM_ASSIGNMENT_ID)
+	if len(assignmentId) == 0 {
+		handleMissingParameterAsHttpError(w, PATH_PARAM_ASSIGNMENT_ID)
+		return
+	}
+
+	c := r.Context()
+	assignment, err := s.userDataClient.GetGroupAssignment(c, group.Id, assignmentId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupAssignment() failed: %v", err)
+		return
+	}
+
+	if assignment == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_ASSIGNMENT_NOT_FOUND, "assignment not found")
+		return
+	}
+
+	quizCache, ok := s.quizCacheMap[assignment.QuizId]
+	if !ok {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "the assignment's quiz no longer exists")
+		return
+	}
+
+	result, err := s.buildAssignmentReport(c, group, assignment, quizCache, time.Now().UTC())
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildAssignmentReport() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
@@ -0,0 +1,184 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	restgroup "github.com/murraycu/go-bigoquiz-server/server/restserver/group"
+	"github.com/stretchr/testify/assert"
+)
+
+// assignmentsUserDataRepository has one group's members, assignments, and their stats for one quiz.
+type assignmentsUserDataRepository struct {
+	groupsUserDataRepository
+
+	assignments []*domaingroup.Assignment
+}
+
+func (db *assignmentsUserDataRepository) GetGroupAssignments(c context.Context, groupId string) ([]*domaingroup.Assignment, error) {
+	return db.assignments, nil
+}
+
+func TestNewAssignmentFromRequest(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	request := &restgroup.AssignmentRequest{
+		QuizId:     quiz.Id,
+		SectionIds: []string{section.Id},
+		Due:        "2024-03-08T17:00:00+01:00",
+	}
+
+	assignment, _, err := newAssignmentFromRequest("some-group", request, quizCache, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "some-group", assignment.GroupId)
+	assert.Equal(t, quiz.Id, assignment.QuizId)
+	assert.Equal(t, []string{section.Id}, assignment.SectionIds)
+	assert.Equal(t, time.Date(2024, 3, 8, 16, 0, 0, 0, time.UTC), assignment.Due)
+
+	// The default target is all the questions.
+	assert.Equal(t, 1.0, assignment.TargetCorrectOnce)
+
+	invalid := []struct {
+		request   restgroup.AssignmentRequest
+		parameter string
+	}{
+		{restgroup.AssignmentRequest{SectionIds: []string{"some-unknown-section"}, Due: request.Due}, "sectionIds"},
+		{restgroup.AssignmentRequest{SectionIds: []string{section.Id, section.Id}, Due: request.Due}, "sectionIds"},
+		{restgroup.AssignmentRequest{}, "due"},
+		{restgroup.AssignmentRequest{Due: "next week"}, "due"},
+		{restgroup.AssignmentRequest{Due: "2024-02-01T00:00:00Z"}, "due"},
+		{restgroup.AssignmentRequest{Due: request.Due, TargetCorrectOnce: 1.5}, "targetCorrectOnce"},
+		{restgroup.AssignmentRequest{Due: request.Due, TargetCorrectOnce: -0.5}, "targetCorrectOnce"},
+	}
+
+	for _, test := range invalid {
+		_, parameter, err := newAssignmentFromRequest("some-group", &test.request, quizCache, now)
+		assert.NotNil(t, err)
+		assert.Equal(t, test.parameter, parameter)
+	}
+}
+
+func TestAssignmentSectionQuestionCounts(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+
+	counts := assignmentSectionQuestionCounts(&domaingroup.Assignment{}, quizCache)
+	assert.Len(t, counts, len(quiz.Sections))
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	assert.Equal(t, quizCache.GetQuestionsCount(), total)
+
+	// Sections that have been removed from the quiz are ignored.
+	counts = assignmentSectionQuestionCounts(&domaingroup.Assignment{SectionIds: []string{section.Id, "some-removed-section"}}, quizCache)
+	assert.Equal(t, map[string]int{section.Id: quizCache.GetSectionQuestionsCount(section.Id)}, counts)
+}
+
+func TestBuildAssignmentReport(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	repository := &groupsUserDataRepository{
+		members: []*domaingroup.Membership{
+			{GroupId: "some-group", UserId: "owner", UserName: "Owner", SharesProgress: true},
+			{GroupId: "some-group", UserId: "user-1", UserName: "Zoe", SharesProgress: true, SharesWithInstructor: true},
+			{GroupId: "some-group", UserId: "user-2", UserName: "Alex", SharesProgress: true},
+			{GroupId: "some-group", UserId: "user-3", UserName: "Sam", SharesProgress: false},
+			{GroupId: "some-group", UserId: "user-4", UserName: "Kim", SharesWithInstructor: true},
+		},
+		stats: map[string]map[string]*domainuser.Stats{
+			"user-1": {section.Id: answerAllCorrectly(quiz, section)},
+			"user-3": {section.Id: answerAllCorrectly(quiz, section)},
+		},
+	}
+
+	s := &RestServer{userDataClient: repository}
+	group := &domaingroup.Group{Id: "some-group", Name: "Some Team", OwnerUserId: "owner"}
+	assignment := &domaingroup.Assignment{Id: "some-assignment", GroupId: group.Id, QuizId: quiz.Id, SectionIds: []string{section.Id}, Due: now.Add(time.Hour), TargetCorrectOnce: 0.8}
+
+	report, err := s.buildAssignmentReport(context.Background(), group, assignment, quizCache, now)
+	assert.Nil(t, err)
+
+	// The stats of the owner, and of learners who have not opted in, are not even read.
+	assert.Equal(t, []string{"user-1", "user-2", "user-4"}, repository.readUserIds)
+
+	assert.Equal(t, "Some Team", report.Assignment.GroupName)
+	assert.Equal(t, section.Title, report.Assignment.Sections[0].SectionTitle)
+	assert.Equal(t, 3, report.CountLearnersSharing)
+	assert.Equal(t, 1, report.CountLearnersNotSharing)
+	assert.Equal(t, map[string]int{domaingroup.ASSIGNMENT_STATUS_COMPLETE: 1, domaingroup.ASSIGNMENT_STATUS_NOT_STARTED: 2}, report.CountByStatus)
+
+	// Learners who only share their progress with the group are counted, but not listed by name.
+	assert.Len(t, report.Learners, 2)
+	assert.Equal(t, "Kim", report.Learners[0].UserName)
+	assert.Equal(t, domaingroup.ASSIGNMENT_STATUS_NOT_STARTED, report.Learners[0].Progress.Status)
+	assert.Equal(t, "Zoe", report.Learners[1].UserName)
+	assert.Equal(t, 1.0, report.Learners[1].Progress.CorrectOnceRate)
+
+	// After the due date.
+	report, err = s.buildAssignmentReport(context.Background(), group, assignment, quizCache, now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{domaingroup.ASSIGNMENT_STATUS_COMPLETE: 1, domaingroup.ASSIGNMENT_STATUS_OVERDUE: 2}, report.CountByStatus)
+}
+
+func TestBuildUserAssignments(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// One question answered correctly, and one that has since been removed from the quiz.
+	questionId := quizCache.getQuestionsArrayForSection(section.Id)[0].Id
+	stats := &domainuser.Stats{QuizId: quiz.Id, SectionId: section.Id}
+	stats.UpdateStatsForAnswerCorrectness(questionId, true)
+	stats.UpdateStatsForAnswerCorrectness("some-removed-question", true)
+
+	repository := &assignmentsUserDataRepository{
+		groupsUserDataRepository: groupsUserDataRepository{
+			stats: map[string]map[string]*domainuser.Stats{
+				"user-1": {section.Id: stats},
+			},
+		},
+		assignments: []*domaingroup.Assignment{
+			{Id: "later", GroupId: "some-group", QuizId: quiz.Id, Due: now.Add(48 * time.Hour), TargetCorrectOnce: 1},
+			{Id: "sooner", GroupId: "some-group", QuizId: quiz.Id, SectionIds: []string{section.Id}, Due: now.Add(time.Hour), TargetCorrectOnce: 0.5},
+			{Id: "removed-quiz", GroupId: "some-group", QuizId: "some-removed-quiz", Due: now.Add(time.Hour), TargetCorrectOnce: 1},
+		},
+	}
+
+	s := &RestServer{
+		userDataClient: repository,
+		quizCacheMap:   restQuizCacheMap{quiz.Id: quizCache},
+	}
+	group := &domaingroup.Group{Id: "some-group", Name: "Some Team", OwnerUserId: "owner"}
+
+	result, err := s.buildUserAssignments(context.Background(), "user-1", []*domaingroup.Group{group}, now)
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "sooner", result[0].Id)
+	assert.Equal(t, quiz.Title, result[0].QuizTitle)
+	assert.Equal(t, 1, result[0].Progress.CountQuestionsCorrectOnce)
+	assert.Equal(t, domaingroup.ASSIGNMENT_STATUS_IN_PROGRESS, result[0].Progress.Status)
+	assert.Equal(t, "later", result[1].Id)
+	assert.Equal(t, quizCache.GetQuestionsCount(), result[1].Progress.CountQuestions)
+
+	// The stats are read once for both assignments for the quiz.
+	assert.Equal(t, []string{"user-1"}, repository.readUserIds)
+
+	// The owner, who set the assignments, has no progress.
+	result, err = s.buildUserAssignments(context.Background(), "owner", []*domaingroup.Group{group}, now)
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+	assert.Nil(t, result[0].Progress)
+}
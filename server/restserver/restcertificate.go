@@ -0,0 +1,377 @@
+package restserver
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/certificates"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+)
+
+const PATH_PARAM_CERTIFICATE_ID = "certificateId"
+
+const certificatesPath = "/api/v2/certificates/"
+
+// countSectionQuestionsCorrectOnce returns how many of the section's current questions
+// the user has answered correctly at least once.
+// This can be less than the stats' CountQuestionsCorrectOnce,
+// which still counts questions that have since been removed from the section.
+func countSectionQuestionsCorrectOnce(quizCache *QuizCache, sectionId string, stats *domainuser.Stats) int {
+	if stats == nil {
+		return 0
+	}
+
+	result := 0
+	for _, qh := range stats.QuestionHistories {
+		if !qh.AnsweredCorrectlyOnce {
+			continue
+		}
+
+		qa := quizCache.GetQuestionAndAnswer(qh.QuestionId)
+		if qa != nil && qa.SectionId == sectionId {
+			result++
+		}
+	}
+
+	return result
+}
+
+// earnedCertificates returns the certificates, without IDs or signatures,
+// for the section, and for the whole quiz, if the user has answered all of their questions correctly at least once.
+// statsBySection has the user's stats for each section of the quiz, including sectionId.
+func earnedCertificates(quizCache *QuizCache, sectionId string, statsBySection map[string]*domainuser.Stats) []*domainuser.Certificate {
+	quiz := quizCache.Quiz
+
+	newCertificate := func(countQuestions int) *domainuser.Certificate {
+		return &domainuser.Certificate{
+			QuizId:         quiz.Id,
+			QuizTitle:      quiz.Title,
+			QuizVersion:    quiz.Version,
+			CountQuestions: countQuestions,
+		}
+	}
+
+	sectionQuestionsCount := quizCache.GetSectionQuestionsCount(sectionId)
+	if sectionQuestionsCount == 0 || countSectionQuestionsCorrectOnce(quizCache, sectionId, statsBySection[sectionId]) < sectionQuestionsCount {
+		// The whole quiz cannot be complete either.
+		return nil
+	}
+
+	sectionCertificate := newCertificate(sectionQuestionsCount)
+	sectionCertificate.SectionId = sectionId
+	if section, err := quizCache.GetSection(sectionId); err == nil && section != nil {
+		sectionCertificate.SectionTitle = section.Title
+	}
+
+	result := []*domainuser.Certificate{sectionCertificate}
+
+	countCorrectOnce := 0
+	for _, section := range quiz.Sections {
+		countCorrectOnce += countSectionQuestionsCorrectOnce(quizCache, section.Id, statsBySection[section.Id])
+	}
+
+	if countCorrectOnce >= quizCache.GetQuestionsCount() {
+		result = append(result, newCertificate(quizCache.GetQuestionsCount()))
+	}
+
+	return result
+}
+
+// issueCertificates issues the certificates that the user has earned, if they have not already been issued,
+// after the user has answered a question in the section correctly for the first time.
+// sectionStats is the user's latest stats for the section.
+// Certificates are not important enough to fail the answer, so any failure is just logged.
+func (s *RestServer) issueCertificates(c context.Context, userId string, quizId string, sectionStats *domainuser.Stats) {
+	if s.certificateSigner == nil || sectionStats == nil {
+		return
+	}
+
+	if err := s.issueCertificatesOrError(c, userId, quizId, sectionStats); err != nil {
+		slog.ErrorContext(c, "issueCertificates() failed", "quizId", quizId, "sectionId", sectionStats.SectionId, "error", err)
+	}
+}
+
+func (s *RestServer) issueCertificatesOrError(c context.Context, userId string, quizId string, sectionStats *domainuser.Stats) error {
+	quizCache, err := s.getQuizCache(quizId)
+	if err != nil {
+		return fmt.Errorf("getQuizCache() failed: %v", err)
+	}
+
+	sectionId := sectionStats.SectionId
+
+	// Check the section first, to avoid getting the stats for the whole quiz after most answers.
+	statsBySection := map[string]*domainuser.Stats{sectionId: sectionStats}
+	if len(earnedCertificates(quizCache, sectionId, statsBySection)) == 0 {
+		return nil
+	}
+
+	statsBySection, err = s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+	if err != nil {
+		return fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+	}
+
+	// The latest stats for the section, in case the others were read before the change was visible.
+	statsBySection[sectionId] = sectionStats
+
+	if err := s.storeCertificates(c, userId, earnedCertificates(quizCache, sectionId, statsBySection)); err != nil {
+		return fmt.Errorf("storeCertificates() failed: %v", err)
+	}
+
+	return nil
+}
+
+// issueQuizCertificates issues all the certificates that the user has earned for the quiz,
+// if they have not already been issued.
+// This is for users who earned them before certificates were issued, or when issuing them after an answer failed.
+func (s *RestServer) issueQuizCertificates(c context.Context, userId string, quizCache *QuizCache) error {
+	statsBySection, err := s.userDataClient.GetUserStatsForQuiz(c, userId, quizCache.Quiz.Id)
+	if err != nil {
+		return fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+	}
+
+	// Each section's certificates include the quiz's certificate, if the quiz is complete.
+	var earned []*domainuser.Certificate
+	var quizCertificate *domainuser.Certificate
+	for _, section := range quizCache.Quiz.Sections {
+		for _, certificate := range earnedCertificates(quizCache, section.Id, statsBySection) {
+			if certificate.IsForSection() {
+				earned = append(earned, certificate)
+			} else {
+				quizCertificate = certificate
+			}
+		}
+	}
+
+	if quizCertificate != nil {
+		earned = append(earned, quizCertificate)
+	}
+
+	if err := s.storeCertificates(c, userId, earned); err != nil {
+		return fmt.Errorf("storeCertificates() failed: %v", err)
+	}
+
+	return nil
+}
+
+// storeCertificates signs and stores the certificates, from earnedCertificates(), for the user,
+// unless the user already has them.
+func (s *RestServer) storeCertificates(c context.Context, userId string, earned []*domainuser.Certificate) error {
+	if len(earned) == 0 {
+		return nil
+	}
+
+	profile, err := s.userDataClient.GetUserProfileById(c, userId)
+	if err != nil {
+		return fmt.Errorf("GetUserProfileById() failed: %v", err)
+	}
+
+	if profile == nil {
+		return fmt.Errorf("no profile for the user")
+	}
+
+	issued := time.Now().UTC().Truncate(time.Second)
+	for _, certificate := range earned {
+		certificate.Id, err = certificates.NewId()
+		if err != nil {
+			return fmt.Errorf("NewId() failed: %v", err)
+		}
+
+		certificate.UserId = userId
+		certificate.UserName = profile.Name
+		certificate.Issued = issued
+
+		if err := s.certificateSigner.Sign(certificate); err != nil {
+			return fmt.Errorf("Sign() failed: %v", err)
+		}
+
+		_, isNew, err := s.userDataClient.StoreUserCertificateIfNew(c, userId, certificate)
+		if err != nil {
+			return fmt.Errorf("StoreUserCertificateIfNew() failed: %v", err)
+		}
+
+		if isNew {
+			slog.InfoContext(c, "Issued certificate", "certificateId", certificate.Id, "quizId", certificate.QuizId, "sectionId", certificate.SectionId)
+		}
+	}
+
+	return nil
+}
+
+// convertDomainCertificateToRestCertificate also verifies the certificate's signature.
+func (s *RestServer) convertDomainCertificateToRestCertificate(certificate *domainuser.Certificate) (*restuser.Certificate, error) {
+	signedData, err := certificate.SignedData()
+	if err != nil {
+		return nil, fmt.Errorf("SignedData() failed: %v", err)
+	}
+
+	url := s.baseApiUrl + certificatesPath + certificate.Id
+	result := &restuser.Certificate{
+		Id:             certificate.Id,
+		UserName:       certificate.UserName,
+		QuizId:         certificate.QuizId,
+		QuizTitle:      certificate.QuizTitle,
+		SectionId:      certificate.SectionId,
+		SectionTitle:   certificate.SectionTitle,
+		QuizVersion:    certificate.QuizVersion,
+		CountQuestions: certificate.CountQuestions,
+		Issued:         certificate.Issued.UTC().Format(time.RFC3339),
+		KeyId:          certificate.KeyId,
+		SignedData:     base64.StdEncoding.EncodeToString(signedData),
+		Signature:      base64.StdEncoding.EncodeToString(certificate.Signature),
+		Url:            url,
+		SvgUrl:         url + "/svg",
+	}
+
+	if s.certificateSigner != nil {
+		if publicKey, ok := s.certificateSigner.PublicKey(certificate.KeyId); ok {
+			result.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+		}
+
+		err := s.certificateSigner.Verify(certificate)
+		if err != nil && !errors.Is(err, certificates.ErrUnknownKey) && !errors.Is(err, certificates.ErrInvalidSignature) {
+			return nil, fmt.Errorf("Verify() failed: %v", err)
+		}
+
+		result.Verified = err == nil
+	}
+
+	return result, nil
+}
+
+// getCertificateOrHttpError writes an error response if the certificate cannot be found.
+func (s *RestServer) getCertificateOrHttpError(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (*domainuser.Certificate, bool) {
+	certificateId := ps.ByName(PATH_PARAM_CERTIFICATE_ID)
+	if len(certificateId) == 0 {
+		handleMissingParameterAsHttpError(w, PATH_PARAM_CERTIFICATE_ID)
+		return nil, false
+	}
+
+	certificate, err := s.userDataClient.GetCertificateById(r.Context(), certificateId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetCertificateById() failed: %v", err)
+		return nil, false
+	}
+
+	if certificate == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_CERTIFICATE_NOT_FOUND, "certificate not found")
+		return nil, false
+	}
+
+	return certificate, true
+}
+
+// HandleCertificateById returns the certificate, and whether it is verified, to anyone with its ID.
+func (s *RestServer) HandleCertificateById(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	certificate, ok := s.getCertificateOrHttpError(w, r, ps)
+	if !ok {
+		return
+	}
+
+	result, err := s.convertDomainCertificateToRestCertificate(certificate)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "convertDomainCertificateToRestCertificate() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// HandleCertificateSvg returns the certificate as an SVG image, to anyone with its ID.
+func (s *RestServer) HandleCertificateSvg(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	certificate, ok := s.getCertificateOrHttpError(w, r, ps)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", certificates.CONTENT_TYPE_SVG)
+	if err := certificates.RenderSVG(w, certificate, s.baseApiUrl+certificatesPath+certificate.Id); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "RenderSVG() failed: %v", err)
+	}
+}
+
+// HandleUserCertificates returns the logged-in user's certificates, sorted by quiz and section.
+func (s *RestServer) HandleUserCertificates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeUserCertificatesOrHttpError(w, r, userId)
+}
+
+// HandleIssueUserCertificates issues the certificates that the logged-in user has already earned,
+// for the quiz-id quiz, or for all quizzes, if they have not been issued yet,
+// and then returns all of the user's certificates, like HandleUserCertificates().
+func (s *RestServer) HandleIssueUserCertificates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var quizCaches []*QuizCache
+	if quizId := r.URL.Query().Get(QUERY_PARAM_QUIZ_ID); len(quizId) != 0 {
+		quizCache, err := s.getQuizCache(quizId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+			return
+		}
+
+		quizCaches = append(quizCaches, quizCache)
+	} else {
+		for _, q := range s.quizzesListSimple {
+			if quizCache, err := s.getQuizCache(q.Id); err == nil {
+				quizCaches = append(quizCaches, quizCache)
+			}
+		}
+	}
+
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	// Without a signing key, no certificates are issued.
+	if s.certificateSigner != nil {
+		for _, quizCache := range quizCaches {
+			if err := s.issueQuizCertificates(r.Context(), userId, quizCache); err != nil {
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "issueQuizCertificates() failed: %v", err)
+				return
+			}
+		}
+	}
+
+	s.writeUserCertificatesOrHttpError(w, r, userId)
+}
+
+func (s *RestServer) writeUserCertificatesOrHttpError(w http.ResponseWriter, r *http.Request, userId string) {
+	domainCertificates, err := s.userDataClient.GetUserCertificates(r.Context(), userId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserCertificates() failed: %v", err)
+		return
+	}
+
+	result := make([]*restuser.Certificate, 0, len(domainCertificates))
+	for _, certificate := range domainCertificates {
+		restCertificate, err := s.convertDomainCertificateToRestCertificate(certificate)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "convertDomainCertificateToRestCertificate() failed: %v", err)
+			return
+		}
+
+		result = append(result, restCertificate)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].QuizId != result[j].QuizId {
+			return result[i].QuizId < result[j].QuizId
+		}
+
+		return result[i].SectionId < result[j].SectionId
+	})
+
+	marshalAndWriteOrHttpError(w, result)
+}
@@ -0,0 +1,230 @@
+package restserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/certificates"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// certificatesUserDataRepository stores the certificates in memory.
+type certificatesUserDataRepository struct {
+	MockUserDataRepository
+
+	statsBySection map[string]*domainuser.Stats
+	certificates   map[string]*domainuser.Certificate
+}
+
+func (db *certificatesUserDataRepository) GetUserProfileById(c context.Context, strUserId string) (*domainuser.Profile, error) {
+	return &domainuser.Profile{UserId: strUserId, Name: "Some User"}, nil
+}
+
+func (db *certificatesUserDataRepository) GetUserStatsForQuiz(c context.Context, strUserId string, quizId string) (map[string]*domainuser.Stats, error) {
+	return db.statsBySection, nil
+}
+
+func (db *certificatesUserDataRepository) StoreUserCertificateIfNew(c context.Context, strUserId string, certificate *domainuser.Certificate) (*domainuser.Certificate, bool, error) {
+	for _, existing := range db.certificates {
+		if existing.UserId == strUserId && existing.QuizId == certificate.QuizId && existing.SectionId == certificate.SectionId {
+			return existing, false, nil
+		}
+	}
+
+	db.certificates[certificate.Id] = certificate
+	return certificate, true, nil
+}
+
+func (db *certificatesUserDataRepository) GetCertificateById(c context.Context, certificateId string) (*domainuser.Certificate, error) {
+	return db.certificates[certificateId], nil
+}
+
+// answerAllCorrectly returns stats for the section in which all its questions have been answered correctly.
+func answerAllCorrectly(quiz *restquiz.Quiz, section *restquiz.Section) *domainuser.Stats {
+	stats := &domainuser.Stats{QuizId: quiz.Id, SectionId: section.Id}
+	answer := func(questions []*restquiz.QuestionAndAnswer) {
+		for _, qa := range questions {
+			stats.UpdateStatsForAnswerCorrectness(qa.Id, true)
+		}
+	}
+
+	answer(section.Questions)
+	for _, subSection := range section.SubSections {
+		answer(subSection.Questions)
+	}
+
+	return stats
+}
+
+func TestEarnedCertificates(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+
+	statsBySection := map[string]*domainuser.Stats{
+		section.Id: answerAllCorrectly(quiz, section),
+	}
+
+	// A question that is not in the section does not count.
+	stats := statsBySection[section.Id]
+	stats.ForgetQuestions([]string{stats.QuestionHistories[0].QuestionId})
+	stats.UpdateStatsForAnswerCorrectness("some-removed-question", true)
+	assert.Empty(t, earnedCertificates(quizCache, section.Id, statsBySection))
+
+	statsBySection[section.Id] = answerAllCorrectly(quiz, section)
+	earned := earnedCertificates(quizCache, section.Id, statsBySection)
+	assert.Len(t, earned, 1)
+	assert.Equal(t, quiz.Id, earned[0].QuizId)
+	assert.Equal(t, section.Id, earned[0].SectionId)
+	assert.Equal(t, section.Title, earned[0].SectionTitle)
+	assert.Equal(t, quizCache.GetSectionQuestionsCount(section.Id), earned[0].CountQuestions)
+
+	for _, other := range quiz.Sections {
+		statsBySection[other.Id] = answerAllCorrectly(quiz, other)
+	}
+
+	earned = earnedCertificates(quizCache, section.Id, statsBySection)
+	assert.Len(t, earned, 2)
+	assert.False(t, earned[1].IsForSection())
+	assert.Equal(t, quizCache.GetQuestionsCount(), earned[1].CountQuestions)
+	assert.Equal(t, quiz.Version, earned[1].QuizVersion)
+}
+
+func testCertificatesServer(t *testing.T, quiz *restquiz.Quiz, repository *certificatesUserDataRepository) *RestServer {
+	signer, err := certificates.NewSigner(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, ed25519.SeedSize)), nil)
+	assert.Nil(t, err)
+
+	return &RestServer{
+		quizzes:           restQuizMap{quiz.Id: quiz},
+		quizCacheMap:      restQuizCacheMap{quiz.Id: testQuizCacheFor(t, quiz)},
+		userDataClient:    repository,
+		certificateSigner: signer,
+		baseApiUrl:        "https://api.bigoquiz.com",
+	}
+}
+
+func TestIssueAndVerifyCertificates(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	repository := &certificatesUserDataRepository{
+		statsBySection: make(map[string]*domainuser.Stats),
+		certificates:   make(map[string]*domainuser.Certificate),
+	}
+	s := testCertificatesServer(t, quiz, repository)
+
+	c := context.Background()
+	for _, section := range quiz.Sections {
+		stats := answerAllCorrectly(quiz, section)
+		repository.statsBySection[section.Id] = stats
+		s.issueCertificates(c, "some-user", quiz.Id, stats)
+	}
+
+	// One for each section, and one for the whole quiz.
+	assert.Len(t, repository.certificates, len(quiz.Sections)+1)
+
+	// Answering again does not issue more.
+	s.issueCertificates(c, "some-user", quiz.Id, repository.statsBySection[quiz.Sections[0].Id])
+	assert.Len(t, repository.certificates, len(quiz.Sections)+1)
+
+	var certificate *domainuser.Certificate
+	for _, c := range repository.certificates {
+		if !c.IsForSection() {
+			certificate = c
+		}
+	}
+	assert.NotNil(t, certificate)
+
+	router := httprouter.New()
+	router.GET("/api/v2/certificates/:"+PATH_PARAM_CERTIFICATE_ID, s.HandleCertificateById)
+	router.GET("/api/v2/certificates/:"+PATH_PARAM_CERTIFICATE_ID+"/svg", s.HandleCertificateSvg)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/certificates/"+certificate.Id, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "some-user")
+
+	var result restuser.Certificate
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Verified)
+	assert.Equal(t, "Some User", result.UserName)
+	assert.Equal(t, quiz.Title, result.QuizTitle)
+	assert.Equal(t, "https://api.bigoquiz.com/api/v2/certificates/"+certificate.Id, result.Url)
+
+	// Anyone can check the signature, without trusting Verified.
+	signedData, _ := base64.StdEncoding.DecodeString(result.SignedData)
+	signature, _ := base64.StdEncoding.DecodeString(result.Signature)
+	publicKey, _ := base64.StdEncoding.DecodeString(result.PublicKey)
+	assert.True(t, ed25519.Verify(publicKey, signedData, signature))
+
+	// A changed certificate is not verified.
+	certificate.UserName = "Someone Else"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/certificates/"+certificate.Id, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Verified)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/certificates/"+certificate.Id+"/svg", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, certificates.CONTENT_TYPE_SVG, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/certificates/some-unknown-id", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), string(apierror.CODE_CERTIFICATE_NOT_FOUND))
+}
+
+func TestIssueQuizCertificates(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	repository := &certificatesUserDataRepository{
+		statsBySection: make(map[string]*domainuser.Stats),
+		certificates:   make(map[string]*domainuser.Certificate),
+	}
+	s := testCertificatesServer(t, quiz, repository)
+	quizCache := s.quizCacheMap[quiz.Id]
+
+	// Earned, for instance, before certificates were issued.
+	section := quiz.Sections[0]
+	repository.statsBySection[section.Id] = answerAllCorrectly(quiz, section)
+
+	c := context.Background()
+	assert.Nil(t, s.issueQuizCertificates(c, "some-user", quizCache))
+	assert.Len(t, repository.certificates, 1)
+
+	for _, section := range quiz.Sections {
+		repository.statsBySection[section.Id] = answerAllCorrectly(quiz, section)
+	}
+
+	// One for each section, and only one for the whole quiz.
+	assert.Nil(t, s.issueQuizCertificates(c, "some-user", quizCache))
+	assert.Len(t, repository.certificates, len(quiz.Sections)+1)
+
+	assert.Nil(t, s.issueQuizCertificates(c, "some-user", quizCache))
+	assert.Len(t, repository.certificates, len(quiz.Sections)+1)
+}
+
+func TestIssueCertificatesDisabled(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	repository := &certificatesUserDataRepository{
+		statsBySection: make(map[string]*domainuser.Stats),
+		certificates:   make(map[string]*domainuser.Certificate),
+	}
+	s := testCertificatesServer(t, quiz, repository)
+	s.certificateSigner = nil
+
+	section := quiz.Sections[0]
+	s.issueCertificates(context.Background(), "some-user", quiz.Id, answerAllCorrectly(quiz, section))
+	assert.Empty(t, repository.certificates)
+}
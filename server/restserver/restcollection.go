@@ -0,0 +1,50 @@
+package restserver
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+)
+
+func convertTagCollectionToRestCollection(collection *TagCollection) *restquiz.Collection {
+	return &restquiz.Collection{
+		Tag:            collection.Tag,
+		QuizIds:        collection.GetQuizIds(),
+		CountQuestions: collection.GetQuestionsCount(),
+	}
+}
+
+func (s *RestServer) HandleCollectionAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	result := make([]*restquiz.Collection, 0, len(s.tagCollections))
+	for _, collection := range s.tagCollections {
+		result = append(result, convertTagCollectionToRestCollection(collection))
+	}
+
+	// Sort them alphabetically by tag,
+	// as a convenience to the client.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Tag < result[j].Tag
+	})
+
+	marshalAndWriteOrHttpError(w, &result)
+}
+
+func (s *RestServer) HandleCollectionByTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	tag := ps.ByName(PATH_PARAM_TAG)
+	if tag == "" {
+		// This makes no sense. HandleCollectionAll() should have been called.
+		handleMissingParameterAsHttpError(w, PATH_PARAM_TAG)
+		return
+	}
+
+	collection := s.getTagCollection(tag)
+	if collection == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_COLLECTION_NOT_FOUND, "collection not found")
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertTagCollectionToRestCollection(collection))
+}
@@ -0,0 +1,111 @@
+package restserver
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes/flashcards"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+)
+
+// HandleQuizExport returns the quiz as flashcards, in the format query parameter's format,
+// such as flashcards.FORMAT_ANKI, with each section as a subdeck.
+// The generated reverse sections are not exported. Instead their original sections'
+// cards are marked as reversible, where the format allows that.
+func (s *RestServer) HandleQuizExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
+	if quizId == "" {
+		// This makes no sense.
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
+		return
+	}
+
+	var format string
+	queryValues := r.URL.Query()
+	if queryValues != nil {
+		format = queryValues.Get(QUERY_PARAM_FORMAT)
+	}
+
+	if !flashcards.IsValidFormat(format) {
+		handleInvalidParameterAsHttpError(w, QUERY_PARAM_FORMAT, "unknown format: %v", format)
+		return
+	}
+
+	q := s.getQuiz(quizId)
+	if q == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+		return
+	}
+
+	quizCache, err := s.getQuizCache(quizId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getQuizCache() failed: %v", err)
+		return
+	}
+
+	// Write to a buffer first, so we can still respond with an error.
+	var buf bytes.Buffer
+	err = flashcards.WriteCards(&buf, format, q.Title, buildQuizFlashcards(quizCache))
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "WriteCards() failed: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", flashcards.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", quizId+"."+flashcards.FileExtension(format)))
+	w.WriteHeader(http.StatusOK)
+
+	// The response has started, so it is too late to respond with an error.
+	// The client has probably disconnected.
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.ErrorContext(r.Context(), "Write() failed", "quizId", quizId, "error", err)
+	}
+}
+
+func buildQuizFlashcards(quizCache *QuizCache) []*flashcards.Card {
+	q := quizCache.Quiz
+
+	// The sections that have generated reverse sections.
+	reversed := make(map[string]bool)
+	for _, section := range q.Sections {
+		if len(section.ReverseOf) != 0 {
+			reversed[section.ReverseOf] = true
+		}
+	}
+
+	var result []*flashcards.Card
+	add := func(qa *restquiz.QuestionAndAnswer, deck []string, andReverse bool) {
+		var card flashcards.Card
+		card.Deck = deck
+		card.Front = flashcards.Text{Text: qa.Text.Text, IsHtml: qa.Text.IsHtml}
+		card.Back = flashcards.Text{Text: qa.Answer.Text, IsHtml: qa.Answer.IsHtml}
+		card.Tags = quizCache.getQuestionTags(qa)
+		card.AndReverse = andReverse
+
+		result = append(result, &card)
+	}
+
+	for _, section := range q.Sections {
+		if len(section.ReverseOf) != 0 {
+			continue
+		}
+
+		andReverse := reversed[section.Id]
+
+		for _, qa := range section.Questions {
+			add(qa, []string{section.Title}, andReverse)
+		}
+
+		for _, subSection := range section.SubSections {
+			for _, qa := range subSection.Questions {
+				add(qa, []string{section.Title, subSection.Title}, andReverse)
+			}
+		}
+	}
+
+	return result
+}
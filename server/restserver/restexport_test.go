@@ -0,0 +1,118 @@
+package restserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes/flashcards"
+	"github.com/stretchr/testify/assert"
+)
+
+func testExportServer(t *testing.T) *RestServer {
+	quiz := loadRealRestQuiz(t, "graphs")
+
+	return &RestServer{
+		quizzes:      restQuizMap{quiz.Id: quiz},
+		quizCacheMap: restQuizCacheMap{quiz.Id: testQuizCacheFor(t, quiz)},
+	}
+}
+
+func TestBuildQuizFlashcardsSkipsReverseSections(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+
+	cards := buildQuizFlashcards(quizCache)
+	assert.NotEmpty(t, cards)
+
+	countQuestions := 0
+	for _, section := range quiz.Sections {
+		if len(section.ReverseOf) != 0 {
+			continue
+		}
+
+		countQuestions += quizCache.GetSectionQuestionsCount(section.Id)
+	}
+
+	assert.Len(t, cards, countQuestions)
+
+	countReversed := 0
+	for _, card := range cards {
+		assert.NotEmpty(t, card.Deck)
+		assert.False(t, strings.HasPrefix(card.Deck[0], "Reverse: "))
+
+		if card.AndReverse {
+			countReversed++
+		}
+	}
+
+	assert.NotZero(t, countReversed)
+}
+
+func TestBuildQuizFlashcardsRoundTrip(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+
+	var buf bytes.Buffer
+	err := flashcards.WriteCards(&buf, flashcards.FORMAT_ANKI, quiz.Title, buildQuizFlashcards(quizCache))
+	assert.Nil(t, err)
+
+	deckName, cards, err := flashcards.ReadCards(&buf, flashcards.FORMAT_ANKI)
+	assert.Nil(t, err)
+	assert.Equal(t, quiz.Title, deckName)
+
+	imported := flashcards.BuildQuiz(quiz.Id, deckName, cards, false)
+
+	// The reversed sections should still be reversed.
+	countReverseOf := 0
+	for _, section := range quiz.Sections {
+		if len(section.ReverseOf) != 0 {
+			countReverseOf++
+		}
+	}
+
+	countAndReverse := 0
+	for _, section := range imported.Sections {
+		if section.AndReverse {
+			countAndReverse++
+		}
+	}
+
+	assert.Equal(t, countReverseOf, countAndReverse)
+}
+
+func TestHandleQuizExport(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/graphs/export?format=csv", nil)
+	s.HandleQuizExport(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: "graphs"}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, flashcards.ContentType(flashcards.FORMAT_CSV), w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename="graphs.csv"`)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "front,back,deck,tags,reverse\n"))
+}
+
+func TestHandleQuizExportUnknownFormat(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/graphs/export?format=apkg", nil)
+	s.HandleQuizExport(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: "graphs"}})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleQuizExportUnknownQuiz(t *testing.T) {
+	s := testExportServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/quiz/nonexistent/export?format=anki", nil)
+	s.HandleQuizExport(w, r, httprouter.Params{{Key: PATH_PARAM_QUIZ_ID, Value: "nonexistent"}})
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
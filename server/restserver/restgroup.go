@@ -0,0 +1,454 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restgroup "github.com/murraycu/go-bigoquiz-server/server/restserver/group"
+)
+
+const PATH_PARAM_GROUP_ID = "groupId"
+
+// readJsonBodyOrHttpError reads the request's JSON body into v,
+// or writes an HTTP error, and returns false, if it cannot.
+func readJsonBodyOrHttpError(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func convertDomainGroupToRestGroup(group *domaingroup.Group, membership *domaingroup.Membership) *restgroup.Group {
+	return &restgroup.Group{
+		Id:                   group.Id,
+		Name:                 group.Name,
+		InviteCode:           group.InviteCode,
+		IsOwner:              group.OwnerUserId == membership.UserId,
+		SharesProgress:       membership.SharesProgress,
+		SharesWithInstructor: membership.SharesWithInstructor,
+	}
+}
+
+// getGroupForMemberOrHttpError returns the group, and the user's membership of it,
+// or writes an HTTP error, and returns false, if the group does not exist or the user is not a member.
+// Users who are not members cannot tell whether the group exists.
+func (s *RestServer) getGroupForMemberOrHttpError(w http.ResponseWriter, r *http.Request, ps httprouter.Params, userId string) (*domaingroup.Group, *domaingroup.Membership, bool) {
+	groupId := ps.ByName(PATH_PARAM_GROUP_ID)
+	if len(groupId) == 0 {
+		handleMissingParameterAsHttpError(w, PATH_PARAM_GROUP_ID)
+		return nil, nil, false
+	}
+
+	c := r.Context()
+	membership, err := s.userDataClient.GetGroupMembership(c, groupId, userId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupMembership() failed: %v", err)
+		return nil, nil, false
+	}
+
+	var group *domaingroup.Group
+	if membership != nil {
+		group, err = s.userDataClient.GetGroup(c, groupId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroup() failed: %v", err)
+			return nil, nil, false
+		}
+	}
+
+	if group == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_GROUP_NOT_FOUND, "group not found")
+		return nil, nil, false
+	}
+
+	return group, membership, true
+}
+
+// HandleCreateGroup creates a group, with the user as its owner and first member.
+func (s *RestServer) HandleCreateGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var request restgroup.CreateRequest
+	if !readJsonBodyOrHttpError(w, r, &request) {
+		return
+	}
+
+	name, ok := domaingroup.NormalizeName(request.Name)
+	if !ok {
+		handleInvalidParameterAsHttpError(w, "name", "the name must not be empty, or longer than %v characters", domaingroup.MaxNameLength)
+		return
+	}
+
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if profileResult.Profile == nil || len(profileResult.UserId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return
+	}
+
+	now := time.Now().UTC()
+	group, err := domaingroup.NewGroup(name, profileResult.UserId, now)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "NewGroup() failed: %v", err)
+		return
+	}
+
+	c := r.Context()
+	if err := s.userDataClient.StoreGroup(c, group); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroup() failed: %v", err)
+		return
+	}
+
+	membership := &domaingroup.Membership{
+		GroupId:        group.Id,
+		UserId:         profileResult.UserId,
+		UserName:       profileResult.Profile.Name,
+		SharesProgress: request.SharesProgress,
+		Joined:         now,
+	}
+
+	if err := s.userDataClient.StoreGroupMembership(c, membership); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroupMembership() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertDomainGroupToRestGroup(group, membership))
+}
+
+// HandleJoinGroup adds the user to the group with the invite code.
+// If the user is already a member, this just changes whether they share their progress.
+func (s *RestServer) HandleJoinGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var request restgroup.JoinRequest
+	if !readJsonBodyOrHttpError(w, r, &request) {
+		return
+	}
+
+	inviteCode := domaingroup.NormalizeInviteCode(request.InviteCode)
+	if len(inviteCode) == 0 {
+		handleInvalidParameterAsHttpError(w, "inviteCode", "inviteCode not specified")
+		return
+	}
+
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if profileResult.Profile == nil || len(profileResult.UserId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return
+	}
+
+	userId := profileResult.UserId
+
+	c := r.Context()
+	group, err := s.userDataClient.GetGroupByInviteCode(c, inviteCode)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupByInviteCode() failed: %v", err)
+		return
+	}
+
+	if group == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_GROUP_NOT_FOUND, "no group has this invite code")
+		return
+	}
+
+	membership, err := s.userDataClient.GetGroupMembership(c, group.Id, userId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupMembership() failed: %v", err)
+		return
+	}
+
+	if membership == nil {
+		members, err := s.userDataClient.GetGroupMemberships(c, group.Id)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupMemberships() failed: %v", err)
+			return
+		}
+
+		// Users joining at the same time could go over the limit, but only by a few.
+		if len(members) >= domaingroup.MaxMembers {
+			handleErrorAsHttpError(w, http.StatusConflict, apierror.CODE_GROUP_FULL, "the group already has %v members", domaingroup.MaxMembers)
+			return
+		}
+
+		membership = &domaingroup.Membership{
+			GroupId:  group.Id,
+			UserId:   userId,
+			UserName: profileResult.Profile.Name,
+			Joined:   time.Now().UTC(),
+		}
+	}
+
+	membership.SharesProgress = request.SharesProgress
+	if err := s.userDataClient.StoreGroupMembership(c, membership); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroupMembership() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertDomainGroupToRestGroup(group, membership))
+}
+
+// HandleUserGroups returns the groups that the user is a member of, sorted by name, without their members.
+func (s *RestServer) HandleUserGroups(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	c := r.Context()
+	memberships, err := s.userDataClient.GetUserGroupMemberships(c, userId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserGroupMemberships() failed: %v", err)
+		return
+	}
+
+	result := make([]*restgroup.Group, 0, len(memberships))
+	for _, membership := range memberships {
+		group, err := s.userDataClient.GetGroup(c, membership.GroupId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroup() failed: %v", err)
+			return
+		}
+
+		// Groups are not deleted, but just in case.
+		if group == nil {
+			continue
+		}
+
+		result = append(result, convertDomainGroupToRestGroup(group, membership))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// HandleGroupById returns the group, with its members, if the user is a member.
+func (s *RestServer) HandleGroupById(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, membership, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	members, err := s.userDataClient.GetGroupMemberships(r.Context(), group.Id)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetGroupMemberships() failed: %v", err)
+		return
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Joined.Before(members[j].Joined)
+	})
+
+	result := convertDomainGroupToRestGroup(group, membership)
+	for _, member := range members {
+		result.Members = append(result.Members, &restgroup.Member{
+			UserName:             member.UserName,
+			IsOwner:              member.UserId == group.OwnerUserId,
+			SharesProgress:       member.SharesProgress,
+			SharesWithInstructor: member.SharesWithInstructor,
+			Joined:               member.Joined.UTC().Format(time.RFC3339),
+		})
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// HandleGroupMembership changes whether the user shares their progress with the group,
+// and whether they share it with the group's owner.
+func (s *RestServer) HandleGroupMembership(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var request restgroup.MembershipRequest
+	if !readJsonBodyOrHttpError(w, r, &request) {
+		return
+	}
+
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, membership, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	membership.SharesProgress = request.SharesProgress
+	membership.SharesWithInstructor = request.SharesWithInstructor
+	if err := s.userDataClient.StoreGroupMembership(r.Context(), membership); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroupMembership() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertDomainGroupToRestGroup(group, membership))
+}
+
+// HandleLeaveGroup removes the user from the group. The group remains, even if its owner leaves.
+func (s *RestServer) HandleLeaveGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, _, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	if err := s.userDataClient.DeleteGroupMembership(r.Context(), group.Id, userId); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "DeleteGroupMembership() failed: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleRotateGroupInviteCode lets the group's owner replace the invite code, such as when it has been shared too widely.
+// The members stay in the group, but nobody else can join with the old code.
+func (s *RestServer) HandleRotateGroupInviteCode(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	// Like getGroupForOwnerOrHttpError(), but with the owner's membership, for the response.
+	group, membership, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	if group.OwnerUserId != userId {
+		handleErrorAsHttpError(w, http.StatusForbidden, apierror.CODE_FORBIDDEN, "only the group's owner may do this")
+		return
+	}
+
+	inviteCode, err := domaingroup.NewInviteCode()
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "NewInviteCode() failed: %v", err)
+		return
+	}
+
+	group.InviteCode = inviteCode
+	if err := s.userDataClient.StoreGroup(r.Context(), group); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreGroup() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, convertDomainGroupToRestGroup(group, membership))
+}
+
+// HandleGroupProgress returns the total of the sharing members' stats for each section of the quiz,
+// so the members can see which sections the group finds difficult.
+func (s *RestServer) HandleGroupProgress(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	quizId := r.URL.Query().Get(QUERY_PARAM_QUIZ_ID)
+	if len(quizId) == 0 {
+		handleMissingParameterAsHttpError(w, QUERY_PARAM_QUIZ_ID)
+		return
+	}
+
+	quizCache, ok := s.quizCacheMap[quizId]
+	if !ok {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+		return
+	}
+
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	group, _, ok := s.getGroupForMemberOrHttpError(w, r, ps, userId)
+	if !ok {
+		return
+	}
+
+	result, err := s.buildGroupProgress(r.Context(), group, quizCache)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildGroupProgress() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// buildGroupProgress only reads the stats of the members who share their progress.
+func (s *RestServer) buildGroupProgress(c context.Context, group *domaingroup.Group, quizCache *QuizCache) (*restgroup.Progress, error) {
+	members, err := s.userDataClient.GetGroupMemberships(c, group.Id)
+	if err != nil {
+		return nil, fmt.Errorf("GetGroupMemberships() failed: %v", err)
+	}
+
+	quiz := quizCache.Quiz
+	progress := domaingroup.NewProgress(quiz.Id)
+	countNotSharing := 0
+	for _, member := range members {
+		if !member.SharesProgress {
+			countNotSharing++
+			continue
+		}
+
+		statsBySection, err := s.userDataClient.GetUserStatsForQuiz(c, member.UserId, quiz.Id)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+		}
+
+		progress.AddMember(statsBySection)
+	}
+
+	result := &restgroup.Progress{
+		GroupId:                group.Id,
+		QuizId:                 quiz.Id,
+		QuizTitle:              quiz.Title,
+		CountMembersSharing:    progress.CountMembers,
+		CountMembersNotSharing: countNotSharing,
+		Sections:               make([]*restgroup.SectionProgress, 0, len(quiz.Sections)),
+	}
+
+	// Only the quiz's current sections, in the quiz's order.
+	for _, section := range quiz.Sections {
+		sectionProgress, ok := progress.Sections[section.Id]
+		if !ok {
+			sectionProgress = &domaingroup.SectionProgress{SectionId: section.Id}
+		}
+
+		countQuestions := quizCache.GetSectionQuestionsCount(section.Id)
+		result.Sections = append(result.Sections, &restgroup.SectionProgress{
+			SectionId:              section.Id,
+			SectionTitle:           section.Title,
+			CountQuestions:         countQuestions,
+			CountMembersStarted:    sectionProgress.CountMembersStarted,
+			Answered:               sectionProgress.Answered,
+			Correct:                sectionProgress.Correct,
+			CountQuestionsMastered: sectionProgress.CountQuestionsMastered,
+			CorrectRate:            sectionProgress.CorrectRate(),
+			CompletionRate:         sectionProgress.CompletionRate(progress.CountMembers, countQuestions),
+		})
+	}
+
+	return result, nil
+}
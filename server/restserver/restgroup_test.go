@@ -0,0 +1,95 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// groupsUserDataRepository has one group's members, and their stats for one quiz.
+type groupsUserDataRepository struct {
+	MockUserDataRepository
+
+	members []*domaingroup.Membership
+
+	// By user ID.
+	stats map[string]map[string]*domainuser.Stats
+
+	// The users whose stats were read.
+	readUserIds []string
+}
+
+func (db *groupsUserDataRepository) GetGroupMemberships(c context.Context, groupId string) ([]*domaingroup.Membership, error) {
+	return db.members, nil
+}
+
+func (db *groupsUserDataRepository) GetUserStatsForQuiz(c context.Context, strUserId string, quizId string) (map[string]*domainuser.Stats, error) {
+	db.readUserIds = append(db.readUserIds, strUserId)
+	return db.stats[strUserId], nil
+}
+
+func TestBuildGroupProgress(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	quizCache := testQuizCacheFor(t, quiz)
+	section := quiz.Sections[0]
+
+	repository := &groupsUserDataRepository{
+		members: []*domaingroup.Membership{
+			{GroupId: "some-group", UserId: "user-1", SharesProgress: true},
+			{GroupId: "some-group", UserId: "user-2", SharesProgress: true},
+			{GroupId: "some-group", UserId: "user-3", SharesProgress: false},
+		},
+		stats: map[string]map[string]*domainuser.Stats{
+			"user-1": {section.Id: answerAllCorrectly(quiz, section)},
+			"user-2": {section.Id: {SectionId: section.Id, Answered: 4, Correct: 1, CountQuestionsCorrectOnce: 1}},
+			"user-3": {section.Id: answerAllCorrectly(quiz, section)},
+		},
+	}
+
+	s := &RestServer{userDataClient: repository}
+	group := &domaingroup.Group{Id: "some-group", OwnerUserId: "user-1"}
+
+	progress, err := s.buildGroupProgress(context.Background(), group, quizCache)
+	assert.Nil(t, err)
+
+	// The stats of members who have not opted in are not even read.
+	assert.Equal(t, []string{"user-1", "user-2"}, repository.readUserIds)
+
+	assert.Equal(t, "some-group", progress.GroupId)
+	assert.Equal(t, quiz.Id, progress.QuizId)
+	assert.Equal(t, 2, progress.CountMembersSharing)
+	assert.Equal(t, 1, progress.CountMembersNotSharing)
+	assert.Len(t, progress.Sections, len(quiz.Sections))
+
+	countQuestions := quizCache.GetSectionQuestionsCount(section.Id)
+	first := progress.Sections[0]
+	assert.Equal(t, section.Id, first.SectionId)
+	assert.Equal(t, section.Title, first.SectionTitle)
+	assert.Equal(t, countQuestions, first.CountQuestions)
+	assert.Equal(t, 2, first.CountMembersStarted)
+	assert.Equal(t, countQuestions+4, first.Answered)
+	assert.Equal(t, countQuestions+1, first.Correct)
+	assert.InDelta(t, float64(countQuestions+1)/float64(2*countQuestions), first.CompletionRate, 0.001)
+
+	// Sections that nobody has started are still listed.
+	last := progress.Sections[len(progress.Sections)-1]
+	assert.Zero(t, last.CountMembersStarted)
+	assert.Zero(t, last.CompletionRate)
+}
+
+func TestConvertDomainGroupToRestGroup(t *testing.T) {
+	group := &domaingroup.Group{Id: "some-group", Name: "Some Team", OwnerUserId: "user-1", InviteCode: "ABCD2345"}
+
+	result := convertDomainGroupToRestGroup(group, &domaingroup.Membership{UserId: "user-1", SharesProgress: true})
+	assert.Equal(t, "Some Team", result.Name)
+	assert.Equal(t, "ABCD2345", result.InviteCode)
+	assert.True(t, result.IsOwner)
+	assert.True(t, result.SharesProgress)
+
+	result = convertDomainGroupToRestGroup(group, &domaingroup.Membership{UserId: "user-2"})
+	assert.False(t, result.IsOwner)
+	assert.False(t, result.SharesProgress)
+}
@@ -0,0 +1,361 @@
+package restserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+)
+
+const (
+	// The maximum number of answers in one sync request.
+	maxSyncAnswers = 500
+
+	// How far in the future an offline answer's time may be, to allow for wrong client clocks.
+	syncMaxClockSkew = 5 * time.Minute
+)
+
+// HandleQuizBundle returns the quiz, with its answers, and the user's current stats for the quiz,
+// so the client can study offline, and later send the answers to HandleUserHistorySync().
+// The response has an ETag, so the client can cheaply check whether its bundle is still current.
+func (s *RestServer) HandleQuizBundle(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
+	if quizId == "" {
+		// This makes no sense.
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
+		return
+	}
+
+	q := s.getQuiz(quizId)
+	if q == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+		return
+	}
+
+	loginInfoResult, err := s.getLoginInfoFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getLoginInfoFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	loginInfo := loginInfoResult.LoginInfo
+	userId := loginInfoResult.UserId
+
+	var mapUserStats map[string]*domainuser.Stats
+	if loginInfo.LoggedIn && len(userId) != 0 {
+		mapUserStats, err = s.userDataClient.GetUserStatsForQuiz(r.Context(), userId, quizId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserStatsForQuiz() failed: %v", err)
+			return
+		}
+	}
+
+	history, err := s.buildRestUserHistorySections(loginInfo, q, mapUserStats)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildRestUserHistorySections() failed: %v", err)
+		return
+	}
+
+	bundle := restuser.StudyBundle{
+		Quiz:    q,
+		History: history,
+	}
+
+	jsonStr, err := json.Marshal(&bundle)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "json.Marshal() failed: %v", err)
+		return
+	}
+
+	etag := generateETag(jsonStr)
+
+	// The bundle depends on the logged-in user, so it must not be shared between users.
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", "Cookie")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	// The response has started, so it is too late to respond with an error.
+	if _, err := w.Write(jsonStr); err != nil {
+		slog.ErrorContext(r.Context(), "Write() failed", "quizId", quizId, "error", err)
+	}
+}
+
+// generateETag returns a strong ETag, including its quotes, for the content.
+func generateETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches returns true if the If-None-Match header value matches the ETag,
+// using the weak comparison that If-None-Match requires.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if len(ifNoneMatch) == 0 {
+		return false
+	}
+
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncAnswer is an OfflineAnswer that has been checked.
+type syncAnswer struct {
+	answer *restuser.OfflineAnswer
+	time   time.Time
+	qa     *restquiz.QuestionAndAnswer
+}
+
+// HandleUserHistorySync adds answers, given while offline, to the user's stats,
+// in the order that they were answered.
+// Each answer is only added once, so the client may safely send the same answers again,
+// for instance if it did not receive the response.
+// This returns the current stats for each section with any of the answers.
+func (s *RestServer) HandleUserHistorySync(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if profileResult.Profile == nil || len(profileResult.UserId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return
+	}
+
+	userId := profileResult.UserId
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
+		return
+	}
+
+	var request restuser.SyncRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
+		return
+	}
+
+	if len(request.Answers) > maxSyncAnswers {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_TOO_MANY_ITEMS, "too many answers: %v. The maximum is %v", len(request.Answers), maxSyncAnswers)
+		return
+	}
+
+	// Each answer costs as much as a submitted answer, so each takes a token from the answer rate limits.
+	if s.answersLimiter != nil && !s.answersLimiter.Allow(w, r, len(request.Answers)) {
+		return
+	}
+
+	var result restuser.SyncResult
+	answers := s.checkSyncAnswers(request.Answers, time.Now(), &result)
+
+	c := r.Context()
+
+	// The latest stats for each section, by quiz ID and section ID, in the order that they were first changed.
+	type sectionKey struct {
+		quizId    string
+		sectionId string
+	}
+	var sectionKeys []sectionKey
+	latestStats := make(map[sectionKey]*domainuser.Stats)
+
+	for _, a := range answers {
+		quizId := a.answer.QuizId
+		question := &a.qa.Question
+		correct := !a.answer.DontKnow && answerIsCorrect(a.answer.Answer, &a.qa.Answer)
+
+		// Count the answer on the day that the user answered it.
+		event := domainuser.SyncEvent{
+			EventId:    a.answer.EventId,
+			QuizId:     quizId,
+			QuestionId: question.Id,
+			Time:       a.time,
+			Synced:     time.Now().UTC(),
+			Date:       domainuser.Today(a.time, profileResult.Profile.TimeZone),
+			Correct:    correct,
+		}
+
+		var sectionQuestionsCount int
+		if quizCache, err := s.getQuizCache(quizId); err == nil {
+			sectionQuestionsCount = quizCache.GetSectionQuestionsCount(question.SectionId)
+		}
+
+		// These are set again if the transaction is retried.
+		var learned, mastered bool
+		stats, applied, err := s.userDataClient.UpdateUserStatsForSectionOnce(c, userId, quizId, question.SectionId, &event, func(stats *domainuser.Stats) error {
+			countMasteredBefore := stats.CountQuestionsMastered
+			learned = updateStatsForAnswer(stats, question, a.answer.QuizVersion, correct)
+			mastered = masteredSection(countMasteredBefore, stats, sectionQuestionsCount)
+			return nil
+		})
+		if err != nil {
+			// The client may send all the answers again, because the applied ones will be ignored.
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "UpdateUserStatsForSectionOnce() failed: %v", err)
+			return
+		}
+
+		key := sectionKey{quizId: quizId, sectionId: question.SectionId}
+		if _, ok := latestStats[key]; !ok {
+			sectionKeys = append(sectionKeys, key)
+		}
+		latestStats[key] = stats
+
+		if !applied {
+			result.Duplicates = append(result.Duplicates, a.answer.EventId)
+			continue
+		}
+
+		result.Applied = append(result.Applied, a.answer.EventId)
+
+		s.storeAnswerEvent(c, quizId, question.Id, a.answer.Answer, correct, a.answer.DontKnow)
+
+		if learned {
+			s.issueCertificates(c, userId, quizId, stats)
+		}
+
+		s.enqueueAnswerWebhookEvents(c, userId, quizId, stats, mastered, learned)
+	}
+
+	for _, key := range sectionKeys {
+		quizCache, err := s.getQuizCache(key.quizId)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getQuizCache() failed: %v", err)
+			return
+		}
+
+		restStats, err := convertDomainStatsToRestStats(latestStats[key], quizCache)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "convertDomainStatsToRestStats() failed: %v", err)
+			return
+		}
+
+		err = s.fillUserStatsWithExtras(restStats, quizCache.Quiz)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "fillUserStatsWithExtras() failed: %v", err)
+			return
+		}
+
+		result.Stats = append(result.Stats, restStats)
+	}
+
+	marshalAndWriteOrHttpError(w, &result)
+}
+
+// RunSyncEventExpiry deletes the SyncEvents that are older than domainuser.SyncEventRetention,
+// once immediately and then after each interval, until the context is cancelled.
+func (s *RestServer) RunSyncEventExpiry(c context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.userDataClient.DeleteOldSyncEvents(c, time.Now().Add(-domainuser.SyncEventRetention)); err != nil {
+			slog.ErrorContext(c, "DeleteOldSyncEvents() failed", "error", err)
+		}
+
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSyncAnswers returns the valid answers, sorted by the time that they were answered,
+// adding the invalid ones to the result's Rejected list,
+// and any repeated answers, in the same request, to its Duplicates list.
+func (s *RestServer) checkSyncAnswers(answers []*restuser.OfflineAnswer, now time.Time, result *restuser.SyncResult) []*syncAnswer {
+	reject := func(eventId string, format string, a ...interface{}) {
+		result.Rejected = append(result.Rejected, &restuser.SyncRejection{
+			EventId: eventId,
+			Reason:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	var valid []*syncAnswer
+	seen := make(map[string]bool)
+	for _, answer := range answers {
+		if answer == nil {
+			continue
+		}
+
+		eventId := answer.EventId
+		if !domainuser.IsValidSyncEventId(eventId) {
+			reject(eventId, "invalid event ID")
+			continue
+		}
+
+		if seen[eventId] {
+			result.Duplicates = append(result.Duplicates, eventId)
+			continue
+		}
+
+		seen[eventId] = true
+
+		t, err := time.Parse(time.RFC3339, answer.Time)
+		if err != nil {
+			reject(eventId, "invalid time: %v", answer.Time)
+			continue
+		}
+
+		if t.After(now.Add(syncMaxClockSkew)) {
+			reject(eventId, "time is in the future: %v", answer.Time)
+			continue
+		}
+
+		// We might have deleted its SyncEvent, so it might be added again.
+		if t.Before(now.Add(-domainuser.SyncEventRetention)) {
+			reject(eventId, "time is too old: %v", answer.Time)
+			continue
+		}
+
+		qa, err := s.getQuestionAndAnswer(answer.QuizId, answer.QuestionId)
+		if err != nil || qa == nil {
+			reject(eventId, "question not found")
+			continue
+		}
+
+		valid = append(valid, &syncAnswer{
+			answer: answer,
+			time:   t.UTC(),
+			qa:     qa,
+		})
+	}
+
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].time.Before(valid[j].time)
+	})
+
+	return valid
+}
@@ -0,0 +1,96 @@
+package restserver
+
+import (
+	"testing"
+	"time"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateETag(t *testing.T) {
+	etag := generateETag([]byte("some-content"))
+	assert.Equal(t, etag, generateETag([]byte("some-content")))
+	assert.NotEqual(t, etag, generateETag([]byte("some-other-content")))
+
+	// A strong ETag, with quotes.
+	assert.True(t, etag[0] == '"' && etag[len(etag)-1] == '"')
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+	assert.False(t, etagMatches("", etag))
+	assert.False(t, etagMatches(`"def"`, etag))
+	assert.True(t, etagMatches(`"abc"`, etag))
+	assert.True(t, etagMatches(`W/"abc"`, etag))
+	assert.True(t, etagMatches(`"def", "abc"`, etag))
+	assert.True(t, etagMatches("*", etag))
+}
+
+func TestUpdateStatsForAnswer(t *testing.T) {
+	var stats domainuser.Stats
+	question := restquiz.Question{Id: "some-question-id", QuizVersion: "2", ContentHash: "some-hash"}
+
+	assert.False(t, updateStatsForAnswer(&stats, &question, "", false))
+	assert.True(t, updateStatsForAnswer(&stats, &question, "", true))
+	assert.False(t, updateStatsForAnswer(&stats, &question, "2", true))
+	assert.Equal(t, 3, stats.Answered)
+
+	qh := stats.QuestionHistories[0]
+	assert.Equal(t, "2", qh.QuizVersion)
+	assert.Equal(t, "some-hash", qh.ContentHash)
+	assert.False(t, stats.GetQuestionContentChanged(question.Id, "2", "some-hash"))
+	assert.True(t, stats.GetQuestionContentChanged(question.Id, "3", "some-other-hash"))
+
+	// Answered offline, in an older version, so we don't know the question's hash then.
+	updateStatsForAnswer(&stats, &question, "1", true)
+	qh = stats.QuestionHistories[0]
+	assert.Equal(t, "1", qh.QuizVersion)
+	assert.Empty(t, qh.ContentHash)
+	assert.True(t, stats.GetQuestionContentChanged(question.Id, "2", "some-hash"))
+}
+
+func TestCheckSyncAnswers(t *testing.T) {
+	quiz := testRestQuiz()
+	s := RestServer{
+		quizCacheMap: restQuizCacheMap{quiz.Id: testQuizCacheFor(t, quiz)},
+	}
+
+	question0 := quiz.Sections[1].Questions[0].Question
+	question1 := quiz.Sections[1].Questions[1].Question
+
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	answers := []*restuser.OfflineAnswer{
+		{EventId: "later", QuizId: quiz.Id, QuestionId: question0.Id, Time: "2026-03-04T11:00:00Z"},
+		{EventId: "earlier", QuizId: quiz.Id, QuestionId: question1.Id, Time: "2026-03-04T10:00:00+01:00"},
+		{EventId: "later", QuizId: quiz.Id, QuestionId: question0.Id, Time: "2026-03-04T11:00:00Z"},
+		{EventId: "", QuizId: quiz.Id, QuestionId: question0.Id, Time: "2026-03-04T11:00:00Z"},
+		{EventId: "bad-time", QuizId: quiz.Id, QuestionId: question0.Id, Time: "yesterday"},
+		{EventId: "future", QuizId: quiz.Id, QuestionId: question0.Id, Time: "2026-03-04T13:00:00Z"},
+		{EventId: "too-old", QuizId: quiz.Id, QuestionId: question0.Id, Time: "2026-01-04T11:00:00Z"},
+		{EventId: "unknown-question", QuizId: quiz.Id, QuestionId: "some-nonexistent-question-id", Time: "2026-03-04T11:00:00Z"},
+		{EventId: "unknown-quiz", QuizId: "some-nonexistent-quiz-id", QuestionId: question0.Id, Time: "2026-03-04T11:00:00Z"},
+	}
+
+	var result restuser.SyncResult
+	valid := s.checkSyncAnswers(answers, now, &result)
+
+	// Sorted by time.
+	assert.Len(t, valid, 2)
+	assert.Equal(t, "earlier", valid[0].answer.EventId)
+	assert.Equal(t, time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC), valid[0].time)
+	assert.Equal(t, question1.Id, valid[0].qa.Id)
+	assert.Equal(t, "later", valid[1].answer.EventId)
+
+	assert.Equal(t, []string{"later"}, result.Duplicates)
+
+	var rejected []string
+	for _, rejection := range result.Rejected {
+		rejected = append(rejected, rejection.EventId)
+		assert.NotEmpty(t, rejection.Reason)
+	}
+
+	assert.Equal(t, []string{"", "bad-time", "future", "too-old", "unknown-question", "unknown-quiz"}, rejected)
+}
@@ -4,41 +4,47 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
 	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
 )
 
 func (s *RestServer) HandleQuestionNext(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var quizId string
 	var sectionId string
-	// var sectionId string
+	var tag string
 	queryValues := r.URL.Query()
 	if queryValues != nil {
 		quizId = queryValues.Get(QUERY_PARAM_QUIZ_ID)
 		sectionId = queryValues.Get(QUERY_PARAM_SECTION_ID)
+		tag = queryValues.Get(QUERY_PARAM_TAG)
 	}
 
 	if len(quizId) == 0 {
-		// TODO: One day we might let the user answer questions from a
-		// random quiz, so they wouldn't have to specify a quiz-id.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "No quiz-id specified")
+		if len(tag) != 0 {
+			// Choose a question from any quiz with this tag.
+			s.handleQuestionNextForTag(w, r, tag)
+			return
+		}
+
+		apierror.Write(w, http.StatusBadRequest, apierror.CODE_MISSING_PARAMETER, "no quiz-id or tag specified", map[string]string{"parameter": QUERY_PARAM_QUIZ_ID})
 		return
 	}
 
 	q := s.getQuiz(quizId)
 	if q == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
 	quizCache, err := s.getQuizCache(q.Id)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz cache not found")
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "quiz cache not found")
 		return
 	}
 
 	userId, err := s.getUserIdFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
 		return
 	}
 
@@ -53,34 +59,74 @@ func (s *RestServer) HandleQuestionNext(w http.ResponseWriter, r *http.Request,
 		if len(sectionId) == 0 {
 			mapUserStats, err := s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "failed getting stats for user. GetUserStatsForQuiz() failed: %v", err)
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "failed getting stats for user. GetUserStatsForQuiz() failed: %v", err)
 				return
 			}
 
-			question, err = s.getNextQuestionFromUserStats("", q, mapUserStats)
+			question, err = s.getNextQuestionFromUserStats(c, "", q, mapUserStats)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "getNextQuestionFromUserStats() failed")
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getNextQuestionFromUserStats() failed")
 				return
 			}
 		} else {
 			//This special case is a bit copy-and-pasty of the general case with the
 			//map, but it seems more efficient to avoid an unnecessary Map.
-			userStats, err := s.userDataClient.GetUserStatsForSection(c, userId, sectionId, quizId)
+			userStats, err := s.userDataClient.GetUserStatsForSection(c, userId, quizId, sectionId)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "failed getting stats for user for section. GetUserStatsForSection() failed: %v", err)
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "failed getting stats for user for section. GetUserStatsForSection() failed: %v", err)
 				return
 			}
 
-			question, err = s.getNextQuestionFromUserStatsForSection(sectionId, q, userStats)
+			question, err = s.getNextQuestionFromUserStatsForSection(c, sectionId, q, userStats)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "getNextQuestionFromUserStatsForSection() failed")
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getNextQuestionFromUserStatsForSection() failed")
 				return
 			}
 		}
 	}
 
 	if question == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_NO_QUESTION_AVAILABLE, "no question available")
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, &question)
+}
+
+func (s *RestServer) handleQuestionNextForTag(w http.ResponseWriter, r *http.Request, tag string) {
+	collection := s.getTagCollection(tag)
+	if collection == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_COLLECTION_NOT_FOUND, "collection not found")
+		return
+	}
+
+	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	var question *restquiz.Question
+	if len(userId) == 0 {
+		//The user is not logged in,
+		//so just return a random question:
+		question = collection.GetRandomQuestion()
+	} else {
+		statsByQuiz, err := s.getUserStatsForQuizzes(r.Context(), userId, collection.GetQuizIds())
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "failed getting stats for user. getUserStatsForQuizzes() failed: %v", err)
+			return
+		}
+
+		question, err = s.getNextQuestionFromUserStatsForTag(r.Context(), collection, statsByQuiz)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getNextQuestionFromUserStatsForTag() failed")
+			return
+		}
+	}
+
+	if question == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_NO_QUESTION_AVAILABLE, "no question available")
 		return
 	}
 
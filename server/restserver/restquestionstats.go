@@ -0,0 +1,285 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	restadmin "github.com/murraycu/go-bigoquiz-server/server/restserver/admin"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+)
+
+const (
+	// The maximum number of AnswerEvents to aggregate in each call to AggregateAnswerEvents().
+	answerEventsAggregationBatchSize = 1000
+
+	// How often to read all of the QuestionStats again, to get the changes from the other instances' aggregations.
+	// In between, the difficulties are just updated from this instance's aggregations.
+	questionStatsReloadInterval = time.Hour
+
+	// The number of common wrong answers to show for each question.
+	countCommonWrongAnswers = 5
+)
+
+// A map of quiz IDs to maps of question IDs to question difficulties.
+type questionDifficultyMap map[string]map[string]float64
+
+// HandleAdminQuestionStats returns the statistics, from all users, for each question,
+// hardest questions first, optionally only for the quiz-id quiz.
+// Only the users listed in the config's AdminEmails may use this.
+func (s *RestServer) HandleAdminQuestionStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var quizId string
+	queryValues := r.URL.Query()
+	if queryValues != nil {
+		quizId = queryValues.Get(QUERY_PARAM_QUIZ_ID)
+	}
+
+	if len(quizId) != 0 && s.getQuiz(quizId) == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
+		return
+	}
+
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if !s.isAdmin(profileResult.Profile) {
+		handleErrorAsHttpError(w, http.StatusForbidden, apierror.CODE_FORBIDDEN, "not an admin")
+		return
+	}
+
+	stats, err := s.questionStatsClient.GetQuestionStats(r.Context(), quizId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetQuestionStats() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, s.buildRestQuestionStats(stats))
+}
+
+// isAdmin returns true if the user's email address is in the config's AdminEmails.
+// profile may be nil.
+func (s *RestServer) isAdmin(profile *domainuser.Profile) bool {
+	if profile == nil || len(profile.Email) == 0 {
+		return false
+	}
+
+	for _, email := range s.adminEmails {
+		if strings.EqualFold(email, profile.Email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildRestQuestionStats converts the stats, ignoring questions that are no longer in the quizzes,
+// and sorts them by difficulty, hardest first.
+func (s *RestServer) buildRestQuestionStats(stats []*domainquestionstats.QuestionStats) []*restadmin.QuestionStats {
+	result := make([]*restadmin.QuestionStats, 0, len(stats))
+
+	for _, questionStats := range stats {
+		quizCache, err := s.getQuizCache(questionStats.QuizId)
+		if err != nil {
+			continue
+		}
+
+		qa := quizCache.GetQuestionAndAnswer(questionStats.QuestionId)
+		if qa == nil {
+			continue
+		}
+
+		result = append(result, convertDomainQuestionStatsToRestQuestionStats(questionStats, &qa.Question))
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Difficulty > result[j].Difficulty
+	})
+
+	return result
+}
+
+func convertDomainQuestionStatsToRestQuestionStats(stats *domainquestionstats.QuestionStats, question *restquiz.Question) *restadmin.QuestionStats {
+	result := &restadmin.QuestionStats{
+		QuizId:      stats.QuizId,
+		QuestionId:  stats.QuestionId,
+		Answered:    stats.Answered,
+		Correct:     stats.Correct,
+		DontKnow:    stats.DontKnow,
+		CorrectRate: stats.GetCorrectRate(),
+		Difficulty:  stats.GetDifficulty(),
+	}
+
+	if stats.Answered > 0 {
+		result.WrongRate = 1 - result.CorrectRate
+	}
+
+	for _, wrongAnswer := range stats.GetMostCommonWrongAnswers(countCommonWrongAnswers) {
+		result.CommonWrongAnswers = append(result.CommonWrongAnswers, restadmin.WrongAnswer{
+			Answer: wrongAnswer.Answer,
+			Count:  wrongAnswer.Count,
+		})
+	}
+
+	if question != nil {
+		result.SectionId = question.SectionId
+		result.QuestionTitle = &question.Text
+	}
+
+	return result
+}
+
+// storeAnswerEvent logs the answer, from any user, for the question statistics.
+// answer is ignored if it is correct.
+func (s *RestServer) storeAnswerEvent(c context.Context, quizId string, questionId string, answer string, result bool, dontKnow bool) {
+	metrics.ObserveAnswer(result, dontKnow)
+
+	if s.questionStatsClient == nil {
+		return
+	}
+
+	event := domainquestionstats.NewAnswerEvent(quizId, questionId, answer, result, dontKnow, time.Now().UTC())
+
+	// The user's own stats are more important, so just log any failure.
+	if err := s.questionStatsClient.StoreAnswerEvent(c, event); err != nil {
+		slog.ErrorContext(c, "StoreAnswerEvent() failed", "error", err)
+	}
+}
+
+// RunQuestionStatsAggregation aggregates new AnswerEvents into the question statistics,
+// and then updates the question difficulties used when choosing the next question,
+// once immediately and then after each interval, until the context is cancelled.
+func (s *RestServer) RunQuestionStatsAggregation(c context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastLoaded time.Time
+	for {
+		reload := time.Since(lastLoaded) >= questionStatsReloadInterval
+		if err := s.aggregateQuestionStats(c, reload); err != nil {
+			slog.ErrorContext(c, "aggregateQuestionStats() failed", "error", err)
+		} else if reload {
+			lastLoaded = time.Now()
+		}
+
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// aggregateQuestionStats aggregates the AnswerEvents, and updates the question difficulties
+// from the changed QuestionStats, or from all of them if reload is true.
+func (s *RestServer) aggregateQuestionStats(c context.Context, reload bool) error {
+	if s.questionStatsClient == nil {
+		return nil
+	}
+
+	// The events are deleted once they are aggregated.
+	var updated []*domainquestionstats.QuestionStats
+	for {
+		count, stats, err := s.questionStatsClient.AggregateAnswerEvents(c, answerEventsAggregationBatchSize)
+		if err != nil {
+			return fmt.Errorf("AggregateAnswerEvents() failed: %v", err)
+		}
+
+		updated = append(updated, stats...)
+
+		if count < answerEventsAggregationBatchSize {
+			break
+		}
+	}
+
+	if !reload {
+		s.updateQuestionDifficulties(updated)
+		return nil
+	}
+
+	stats, err := s.questionStatsClient.GetQuestionStats(c, "")
+	if err != nil {
+		return fmt.Errorf("GetQuestionStats() failed: %v", err)
+	}
+
+	s.setQuestionDifficulties(buildQuestionDifficulties(stats))
+
+	return nil
+}
+
+func buildQuestionDifficulties(stats []*domainquestionstats.QuestionStats) questionDifficultyMap {
+	result := make(questionDifficultyMap)
+
+	for _, questionStats := range stats {
+		difficulties, ok := result[questionStats.QuizId]
+		if !ok {
+			difficulties = make(map[string]float64)
+			result[questionStats.QuizId] = difficulties
+		}
+
+		difficulties[questionStats.QuestionId] = questionStats.GetDifficulty()
+	}
+
+	return result
+}
+
+func (s *RestServer) setQuestionDifficulties(difficulties questionDifficultyMap) {
+	s.questionDifficultiesMutex.Lock()
+	defer s.questionDifficultiesMutex.Unlock()
+
+	s.questionDifficulties = difficulties
+}
+
+// updateQuestionDifficulties changes the difficulties of just these questions.
+func (s *RestServer) updateQuestionDifficulties(stats []*domainquestionstats.QuestionStats) {
+	if len(stats) == 0 {
+		return
+	}
+
+	s.questionDifficultiesMutex.Lock()
+	defer s.questionDifficultiesMutex.Unlock()
+
+	if s.questionDifficulties == nil {
+		s.questionDifficulties = make(questionDifficultyMap)
+	}
+
+	for _, questionStats := range stats {
+		difficulties, ok := s.questionDifficulties[questionStats.QuizId]
+		if !ok {
+			difficulties = make(map[string]float64)
+			s.questionDifficulties[questionStats.QuizId] = difficulties
+		}
+
+		difficulties[questionStats.QuestionId] = questionStats.GetDifficulty()
+	}
+}
+
+// getQuestionDifficulty returns the question's difficulty, from 0 (easy) to 1 (hard),
+// or domainquestionstats.DefaultDifficulty if we don't know it yet.
+func (s *RestServer) getQuestionDifficulty(question *restquiz.Question) float64 {
+	s.questionDifficultiesMutex.RLock()
+	defer s.questionDifficultiesMutex.RUnlock()
+
+	difficulties, ok := s.questionDifficulties[question.QuizId]
+	if !ok {
+		return domainquestionstats.DefaultDifficulty
+	}
+
+	difficulty, ok := difficulties[question.Id]
+	if !ok {
+		return domainquestionstats.DefaultDifficulty
+	}
+
+	return difficulty
+}
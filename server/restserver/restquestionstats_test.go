@@ -0,0 +1,229 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAdmin(t *testing.T) {
+	s := RestServer{
+		adminEmails: []string{"admin@example.com"},
+	}
+
+	assert.False(t, s.isAdmin(nil))
+	assert.False(t, s.isAdmin(&domainuser.Profile{}))
+	assert.False(t, s.isAdmin(&domainuser.Profile{Email: "someone@example.com"}))
+	assert.True(t, s.isAdmin(&domainuser.Profile{Email: "admin@example.com"}))
+	assert.True(t, s.isAdmin(&domainuser.Profile{Email: "Admin@Example.com"}))
+}
+
+func TestBuildRestQuestionStats(t *testing.T) {
+	quiz := testRestQuiz()
+	quizCache := testQuizCacheFor(t, quiz)
+	s := RestServer{
+		quizCacheMap: restQuizCacheMap{quiz.Id: quizCache},
+	}
+
+	question0 := quiz.Sections[1].Questions[0].Question
+	question1 := quiz.Sections[1].Questions[1].Question
+
+	easy := &domainquestionstats.QuestionStats{
+		QuizId:     quiz.Id,
+		QuestionId: question0.Id,
+		Answered:   10,
+		Correct:    9,
+	}
+
+	hard := &domainquestionstats.QuestionStats{
+		QuizId:     quiz.Id,
+		QuestionId: question1.Id,
+		Answered:   10,
+		Correct:    2,
+		DontKnow:   3,
+		WrongAnswers: []domainquestionstats.WrongAnswer{
+			{Answer: "some-wrong-answer", Count: 5},
+		},
+	}
+
+	// A question that is no longer in the quiz:
+	removed := &domainquestionstats.QuestionStats{
+		QuizId:     quiz.Id,
+		QuestionId: "some-removed-question-id",
+		Answered:   10,
+	}
+
+	result := s.buildRestQuestionStats([]*domainquestionstats.QuestionStats{easy, removed, hard})
+	assert.Len(t, result, 2)
+
+	// The hardest question should be first:
+	assert.Equal(t, question1.Id, result[0].QuestionId)
+	assert.Equal(t, question1.SectionId, result[0].SectionId)
+	assert.Equal(t, question1.Text, *result[0].QuestionTitle)
+	assert.InDelta(t, 0.2, result[0].CorrectRate, 0.0001)
+	assert.InDelta(t, 0.8, result[0].WrongRate, 0.0001)
+	assert.Equal(t, hard.GetDifficulty(), result[0].Difficulty)
+	assert.Equal(t, 3, result[0].DontKnow)
+	assert.Len(t, result[0].CommonWrongAnswers, 1)
+	assert.Equal(t, "some-wrong-answer", result[0].CommonWrongAnswers[0].Answer)
+
+	assert.Equal(t, question0.Id, result[1].QuestionId)
+}
+
+func TestGetQuestionDifficulty(t *testing.T) {
+	var s RestServer
+
+	question := &restquiz.Question{
+		Id:     "some-question-id",
+		QuizId: "some-quiz-id",
+	}
+
+	assert.Equal(t, domainquestionstats.DefaultDifficulty, s.getQuestionDifficulty(question))
+
+	stats := &domainquestionstats.QuestionStats{
+		QuizId:     question.QuizId,
+		QuestionId: question.Id,
+		Answered:   20,
+	}
+
+	s.setQuestionDifficulties(buildQuestionDifficulties([]*domainquestionstats.QuestionStats{stats}))
+	assert.Equal(t, stats.GetDifficulty(), s.getQuestionDifficulty(question))
+}
+
+// aggregatingQuestionStatsRepository returns each of the batches from AggregateAnswerEvents(), in order.
+type aggregatingQuestionStatsRepository struct {
+	MockQuestionStatsRepository
+
+	counts  []int
+	batches [][]*domainquestionstats.QuestionStats
+
+	all                   []*domainquestionstats.QuestionStats
+	countGetQuestionStats int
+}
+
+func (m *aggregatingQuestionStatsRepository) AggregateAnswerEvents(c context.Context, maxEvents int) (int, []*domainquestionstats.QuestionStats, error) {
+	if len(m.counts) == 0 {
+		return 0, nil, nil
+	}
+
+	count, batch := m.counts[0], m.batches[0]
+	m.counts, m.batches = m.counts[1:], m.batches[1:]
+	return count, batch, nil
+}
+
+func (m *aggregatingQuestionStatsRepository) GetQuestionStats(c context.Context, quizId string) ([]*domainquestionstats.QuestionStats, error) {
+	m.countGetQuestionStats++
+	return m.all, nil
+}
+
+func TestAggregateQuestionStats(t *testing.T) {
+	question := &restquiz.Question{Id: "some-question-id", QuizId: "some-quiz-id"}
+	otherQuestion := &restquiz.Question{Id: "other-question-id", QuizId: "some-quiz-id"}
+
+	stats := &domainquestionstats.QuestionStats{QuizId: question.QuizId, QuestionId: question.Id, Answered: 20}
+	repository := &aggregatingQuestionStatsRepository{
+		all: []*domainquestionstats.QuestionStats{stats},
+	}
+
+	s := &RestServer{questionStatsClient: repository}
+	assert.Nil(t, s.aggregateQuestionStats(context.Background(), true))
+	assert.Equal(t, 1, repository.countGetQuestionStats)
+	assert.Equal(t, stats.GetDifficulty(), s.getQuestionDifficulty(question))
+
+	// Without reloading, only the aggregated questions change,
+	// and the aggregation continues while there are full batches of events.
+	changed := &domainquestionstats.QuestionStats{QuizId: question.QuizId, QuestionId: question.Id, Answered: 20, Correct: 20}
+	other := &domainquestionstats.QuestionStats{QuizId: otherQuestion.QuizId, QuestionId: otherQuestion.Id, Answered: 20, DontKnow: 20}
+	repository.counts = []int{answerEventsAggregationBatchSize, 5}
+	repository.batches = [][]*domainquestionstats.QuestionStats{{changed}, {other}}
+
+	assert.Nil(t, s.aggregateQuestionStats(context.Background(), false))
+	assert.Equal(t, 1, repository.countGetQuestionStats)
+	assert.Empty(t, repository.counts)
+	assert.Equal(t, changed.GetDifficulty(), s.getQuestionDifficulty(question))
+	assert.Equal(t, other.GetDifficulty(), s.getQuestionDifficulty(otherQuestion))
+	assert.NotEqual(t, stats.GetDifficulty(), changed.GetDifficulty())
+}
+
+func TestChooseNextQuestionPrefersHarderQuestions(t *testing.T) {
+	quiz := testRestQuiz()
+	section := quiz.Sections[1]
+	easy := &section.Questions[0].Question
+	hard := &section.Questions[1].Question
+
+	// The user has answered both questions correctly once.
+	stats := &domainuser.Stats{
+		QuizId:    quiz.Id,
+		SectionId: section.Id,
+	}
+	stats.UpdateStatsForAnswerCorrectness(easy.Id, true)
+	stats.UpdateStatsForAnswerCorrectness(hard.Id, true)
+
+	questions := []*restquiz.Question{easy, hard}
+	tries := 0
+	getRandomQuestion := func() (*restquiz.Question, error) {
+		tries += 1
+		return questions[tries%len(questions)], nil
+	}
+
+	getSectionStats := func(question *restquiz.Question) *domainuser.Stats {
+		return stats
+	}
+
+	getDifficulty := func(question *restquiz.Question) float64 {
+		if question == hard {
+			return 0.9
+		}
+
+		return 0.1
+	}
+
+	result, err := chooseNextQuestion(context.Background(), getRandomQuestion, getSectionStats, getDifficulty)
+	assert.Nil(t, err)
+	assert.Equal(t, hard.Id, result.Id)
+}
+
+func TestChooseNextQuestionPrefersChangedQuestions(t *testing.T) {
+	quiz := testRestQuiz()
+	section := quiz.Sections[1]
+	unchanged := section.Questions[0].Question
+	changed := section.Questions[1].Question
+	unchanged.QuizVersion = "2"
+	unchanged.ContentHash = "unchanged-hash"
+	changed.QuizVersion = "2"
+	changed.ContentHash = "new-hash"
+
+	// The user has answered both questions correctly, in the previous version of the quiz.
+	stats := &domainuser.Stats{
+		QuizId:    quiz.Id,
+		SectionId: section.Id,
+	}
+	stats.UpdateStatsForAnswerCorrectness(unchanged.Id, false)
+	stats.SetQuestionContentVersion(unchanged.Id, "1", "unchanged-hash")
+	stats.UpdateStatsForAnswerCorrectness(changed.Id, true)
+	stats.SetQuestionContentVersion(changed.Id, "1", "old-hash")
+
+	// The unchanged question would otherwise be chosen, because it was answered wrongly.
+	questions := []*restquiz.Question{&unchanged, &changed}
+	tries := 0
+	getRandomQuestion := func() (*restquiz.Question, error) {
+		tries += 1
+		return questions[tries%len(questions)], nil
+	}
+
+	getSectionStats := func(question *restquiz.Question) *domainuser.Stats {
+		return stats
+	}
+
+	getDifficulty := func(question *restquiz.Question) float64 {
+		return 0
+	}
+
+	result, err := chooseNextQuestion(context.Background(), getRandomQuestion, getSectionStats, getDifficulty)
+	assert.Nil(t, err)
+	assert.Equal(t, changed.Id, result.Id)
+}
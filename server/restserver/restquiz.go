@@ -1,12 +1,84 @@
 package restserver
 
 import (
-	"github.com/julienschmidt/httprouter"
-	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	"fmt"
 	"net/http"
 	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
 )
 
+// The serialized responses for one quiz.
+type quizCachedResponses struct {
+	quiz             *cachedResponse
+	sections         *cachedResponse
+	sectionsListOnly *cachedResponse
+}
+
+// buildQuizResponses serializes the responses for HandleQuizAll(), HandleQuizById(),
+// and HandleQuizSectionsByQuizId(), so that is not done again for every request.
+// Call this after the quizzes have been loaded.
+func (s *RestServer) buildQuizResponses() error {
+	var err error
+	s.quizzesListSimpleResponse, err = newCachedResponse(&s.quizzesListSimple)
+	if err != nil {
+		return fmt.Errorf("newCachedResponse() failed for the simple list: %v", err)
+	}
+
+	s.quizzesListFullResponse, err = newCachedResponse(&s.quizzesListFull)
+	if err != nil {
+		return fmt.Errorf("newCachedResponse() failed for the full list: %v", err)
+	}
+
+	s.quizResponses = make(map[string]*quizCachedResponses)
+	for quizId, q := range s.quizzes {
+		var responses quizCachedResponses
+		responses.quiz, err = newCachedResponse(q)
+		if err != nil {
+			return fmt.Errorf("newCachedResponse() failed for quiz: %v: %v", quizId, err)
+		}
+
+		responses.sections, err = newCachedResponse(&q.Sections)
+		if err != nil {
+			return fmt.Errorf("newCachedResponse() failed for the sections of quiz: %v: %v", quizId, err)
+		}
+
+		simpleSections := buildSectionsSimple(q.Sections)
+		responses.sectionsListOnly, err = newCachedResponse(&simpleSections)
+		if err != nil {
+			return fmt.Errorf("newCachedResponse() failed for the simple sections of quiz: %v: %v", quizId, err)
+		}
+
+		s.quizResponses[quizId] = &responses
+	}
+
+	s.observeCachedResponseBytes()
+
+	return nil
+}
+
+// observeCachedResponseBytes records the total size of the precomputed quiz responses, for each content encoding.
+func (s *RestServer) observeCachedResponseBytes() {
+	responses := []*cachedResponse{s.quizzesListSimpleResponse, s.quizzesListFullResponse}
+	for _, quizResponses := range s.quizResponses {
+		responses = append(responses, quizResponses.quiz, quizResponses.sections, quizResponses.sectionsListOnly)
+	}
+
+	sizes := make(map[string]int)
+	for _, response := range responses {
+		sizes[contentEncodingIdentity] += len(response.json)
+		sizes[contentEncodingGzip] += len(response.gzip)
+		sizes[contentEncodingBrotli] += len(response.brotli)
+	}
+
+	for encoding, size := range sizes {
+		metrics.SetCachedResponseBytes(encoding, size)
+	}
+}
+
 func (s *RestServer) HandleQuizAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	listOnly := false
 	queryValues := r.URL.Query()
@@ -15,17 +87,12 @@ func (s *RestServer) HandleQuizAll(w http.ResponseWriter, r *http.Request, _ htt
 		listOnly, _ = strconv.ParseBool(listOnlyStr)
 	}
 
-	var quizArray []*restquiz.Quiz = nil
+	response := s.quizzesListFullResponse
 	if listOnly {
-		quizArray = s.quizzesListSimple
-	} else {
-		quizArray = s.quizzesListFull
+		response = s.quizzesListSimpleResponse
 	}
 
-	w.Header().Set("Content-Type", "application/json") // normal header
-	w.WriteHeader(http.StatusOK)
-
-	marshalAndWriteOrHttpError(w, &quizArray)
+	response.write(w, r, quizzesCacheControl)
 }
 
 func (s *RestServer) getQuiz(quizId string) *restquiz.Quiz {
@@ -36,20 +103,17 @@ func (s *RestServer) HandleQuizById(w http.ResponseWriter, r *http.Request, ps h
 	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
 	if quizId == "" {
 		// This makes no sense. restHandleQuizAll() should have been called.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Empty quiz ID")
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
 		return
 	}
 
-	q := s.getQuiz(quizId)
-	if q == nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "quiz not found")
+	responses, ok := s.quizResponses[quizId]
+	if !ok {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json") // normal header
-	w.WriteHeader(http.StatusOK)
-
-	marshalAndWriteOrHttpError(w, &q)
+	responses.quiz.write(w, r, quizzesCacheControl)
 }
 
 func (s *RestServer) HandleQuizSectionsByQuizId(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -63,61 +127,66 @@ func (s *RestServer) HandleQuizSectionsByQuizId(w http.ResponseWriter, r *http.R
 	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
 	if quizId == "" {
 		// This makes no sense. restHandleQuizAll() should have been called.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Empty quiz ID")
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
 		return
 	}
 
-	q := s.getQuiz(quizId)
-	if q == nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "quiz not found")
+	responses, ok := s.quizResponses[quizId]
+	if !ok {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
-	sections := q.Sections
+	response := responses.sections
 	if listOnly {
-		simpleSections := make([]*restquiz.Section, 0, len(sections))
-		for _, s := range sections {
-			var simple restquiz.Section
-			s.CopyHasIdAndTitle(&simple.HasIdAndTitle)
-			simpleSections = append(simpleSections, &simple)
-		}
+		response = responses.sectionsListOnly
+	}
+
+	response.write(w, r, quizzesCacheControl)
+}
 
-		sections = simpleSections
+// buildSectionsSimple returns the sections with only their IDs and titles.
+func buildSectionsSimple(sections []*restquiz.Section) []*restquiz.Section {
+	result := make([]*restquiz.Section, 0, len(sections))
+	for _, s := range sections {
+		var simple restquiz.Section
+		s.CopyHasIdAndTitle(&simple.HasIdAndTitle)
+		result = append(result, &simple)
 	}
 
-	marshalAndWriteOrHttpError(w, &sections)
+	return result
 }
 
 func (s *RestServer) HandleQuizQuestionById(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
 	if quizId == "" {
 		// This makes no sense. restHandleQuizAll() should have been called.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Empty quiz ID")
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
 		return
 	}
 
 	questionId := ps.ByName(PATH_PARAM_QUESTION_ID)
 	if questionId == "" {
 		// This makes no sense.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Empty question ID")
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUESTION_ID)
 		return
 	}
 
 	q := s.getQuiz(quizId)
 	if q == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
 	quizCache, err := s.getQuizCache(q.Id)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz cache not found")
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "quiz cache not found")
 		return
 	}
 
 	qa := quizCache.GetQuestionAndAnswer(questionId)
 	if qa == nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found")
 		return
 	}
 
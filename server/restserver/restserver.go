@@ -1,18 +1,26 @@
 package restserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"slices"
 	"sort"
+	"sync"
 
 	"github.com/murraycu/go-bigoquiz-server/config"
 	"github.com/murraycu/go-bigoquiz-server/repositories/db"
 	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/certificates"
+	"github.com/murraycu/go-bigoquiz-server/server/csrf"
 	"github.com/murraycu/go-bigoquiz-server/server/loginserver"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	"github.com/murraycu/go-bigoquiz-server/server/ratelimit"
 	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
 	"github.com/murraycu/go-bigoquiz-server/server/usersessionstore"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
 )
 
 const QUERY_PARAM_QUIZ_ID = "quiz-id"
@@ -22,6 +30,10 @@ const QUERY_PARAM_LIST_ONLY = "list-only"
 const QUERY_PARAM_NEXT_QUESTION_SECTION_ID = "next-question-section-id"
 const PATH_PARAM_QUIZ_ID = "quizId"
 const PATH_PARAM_QUESTION_ID = "questionId"
+const PATH_PARAM_TAG = "tag"
+const QUERY_PARAM_TAG = "tag"
+const QUERY_PARAM_NEXT_QUESTION_TAG = "next-question-tag"
+const QUERY_PARAM_FORMAT = "format"
 
 type restQuizList []*restquiz.Quiz
 
@@ -33,22 +45,80 @@ type RestServer struct {
 	quizzesListSimple restQuizList
 	quizzesListFull   restQuizList
 
+	// The serialized responses for the quizzes, which do not change while the server runs.
+	quizzesListSimpleResponse *cachedResponse
+	quizzesListFullResponse   *cachedResponse
+	quizResponses             map[string]*quizCachedResponses
+
+	// The OpenAPI document, describing Routes().
+	openAPIResponse *cachedResponse
+
 	// Easier access to some quiz details.
 	quizCacheMap restQuizCacheMap
 
+	// Questions from all quizzes, by tag.
+	tagCollections restTagCollectionMap
+
 	userDataClient db.UserDataRepository
 
+	// Statistics for each question, from all users.
+	questionStatsClient db.QuestionStatsRepository
+
+	// Updated by RunQuestionStatsAggregation().
+	questionDifficulties      questionDifficultyMap
+	questionDifficultiesMutex sync.RWMutex
+
+	// Users who may use the admin API.
+	adminEmails []string
+
 	// Session cookie store.
 	userSessionStore usersessionstore.UserSessionStore
 
 	oauthClient *loginserver.OAuthClient
+
+	// Limits the answer submissions, for the Routes that are RateLimited.
+	answersLimiter *ratelimit.Limiter
+
+	// Limits joining groups, for the Routes that are JoinRateLimited.
+	joinsLimiter *ratelimit.Limiter
+
+	// Sends learning events to the configured webhooks. This is nil if there are no webhooks.
+	webhooks *webhooks.Dispatcher
+
+	// Rejects cross-site requests to the routes that are not GET routes.
+	csrfProtector *csrf.Protector
+
+	// Signs the completion certificates. Certificates are not issued if this is nil.
+	certificateSigner *certificates.Signer
+
+	// This server's URL, for the certificates' URLs.
+	baseApiUrl string
 }
 
-func NewRestServer(quizzesStore quizzes.QuizzesRepository, userSessionStore usersessionstore.UserSessionStore, userDataRepository db.UserDataRepository, conf *config.Config) (*RestServer, error) {
+func NewRestServer(quizzesStore quizzes.QuizzesRepository, userSessionStore usersessionstore.UserSessionStore, userDataRepository db.UserDataRepository, questionStatsRepository db.QuestionStatsRepository, webhookDispatcher *webhooks.Dispatcher, conf *config.Config) (*RestServer, error) {
 	result := &RestServer{}
 	result.userDataClient = userDataRepository
+	result.questionStatsClient = questionStatsRepository
+	result.webhooks = webhookDispatcher
+	result.adminEmails = conf.AdminEmails
+	result.baseApiUrl = conf.BaseApiUrl
+	result.answersLimiter = ratelimit.NewLimiter(RATE_LIMITER_ANSWERS, ratelimit.NewMemoryStore(),
+		ratelimit.FromConfig(conf.RateLimits.AnswersPerIp), ratelimit.FromConfig(conf.RateLimits.AnswersPerUser),
+		result.userIdFromSession, conf.RateLimits.ClientIpHeader)
+	result.joinsLimiter = ratelimit.NewLimiter(RATE_LIMITER_JOINS, ratelimit.NewMemoryStore(),
+		ratelimit.FromConfig(conf.RateLimits.JoinsPerIp), ratelimit.FromConfig(conf.RateLimits.JoinsPerUser),
+		result.userIdFromSession, conf.RateLimits.ClientIpHeader)
+
+	if len(conf.CertificateSigningKey) != 0 {
+		var err error
+		result.certificateSigner, err = certificates.NewSigner(conf.CertificateSigningKey, conf.CertificatePreviousPublicKeys)
+		if err != nil {
+			return nil, fmt.Errorf("certificates.NewSigner() failed: %v", err)
+		}
+	}
 
 	quizzes, err := quizzesStore.LoadQuizzes()
+	metrics.ObserveQuizLoad(len(quizzes), err)
 	if err != nil {
 		return nil, fmt.Errorf("LoadQuizzes() failed: %v", err)
 	}
@@ -75,16 +145,67 @@ func NewRestServer(quizzesStore quizzes.QuizzesRepository, userSessionStore user
 		}
 	}
 
+	result.tagCollections = buildTagCollections(result.quizCacheMap)
+
 	result.quizzesListSimple = buildQuizzesSimple(result.quizzes)
 	result.quizzesListFull = buildQuizzesFull(result.quizzes)
 
+	err = result.buildQuizResponses()
+	if err != nil {
+		return nil, fmt.Errorf("buildQuizResponses() failed: %v", err)
+	}
+
+	result.openAPIResponse, err = newCachedResponse(BuildOpenAPIDocument(result.Routes()))
+	if err != nil {
+		return nil, fmt.Errorf("newCachedResponse() failed for the OpenAPI document: %v", err)
+	}
+
 	result.userSessionStore = userSessionStore
+	// The origins whose Javascript may call the API, and the API itself.
+	trustedOrigins := append(slices.Clone(conf.CorsAllowedOrigins), conf.BaseUrl, conf.BaseApiUrl)
+	result.csrfProtector = csrf.NewProtector(trustedOrigins, userSessionStore)
 
-	result.oauthClient, err = loginserver.NewOAuthClient(result.userSessionStore, result.userDataClient, conf)
+	result.oauthClient, err = loginserver.NewOAuthClient(result.userSessionStore, result.userDataClient, result.webhooks, conf)
 
 	return result, nil
 }
 
+// userIdFromSession returns the logged-in user's ID from the session cookie, without checking the datastore,
+// or an empty string if the user is not logged in.
+// This is a ratelimit.UserIdFunc.
+func (s *RestServer) userIdFromSession(r *http.Request) string {
+	if s.userSessionStore == nil {
+		return ""
+	}
+
+	userIdAndToken, err := s.userSessionStore.GetUserIdAndOAuthTokenFromSession(r)
+	if err != nil || userIdAndToken == nil {
+		return ""
+	}
+
+	return userIdAndToken.UserId
+}
+
+// CheckQuizzesLoaded returns an error if there are no quizzes to serve.
+// This is a health.CheckFunc, for the readiness check.
+func (s *RestServer) CheckQuizzesLoaded(c context.Context) error {
+	if len(s.quizzes) == 0 {
+		return fmt.Errorf("no quizzes are loaded")
+	}
+
+	return nil
+}
+
+// Close closes the server's own connections to the datastore.
+// The repositories passed to NewRestServer() are not closed.
+func (s *RestServer) Close() error {
+	if s.oauthClient == nil {
+		return nil
+	}
+
+	return s.oauthClient.Close()
+}
+
 // See https://gobyexample.com/sorting-by-functions
 type quizListByTitle []*restquiz.Quiz
 
@@ -114,6 +235,7 @@ func buildQuizzesSimple(quizzes restQuizMap) restQuizList {
 		simple.Link = q.Link
 
 		simple.IsPrivate = q.IsPrivate
+		simple.Tags = q.Tags
 
 		result = append(result, &simple)
 	}
@@ -174,9 +296,11 @@ func setQuestionExtras(question *restquiz.Question, section *restquiz.Section, s
 	}
 
 	q := quizCache.Quiz
+	question.QuizId = q.Id
 	question.SetTitles(q.Title, briefSection, subSection)
 
 	question.QuizUsesMathML = q.UsesMathML
+	question.QuizVersion = q.Version
 
 	// Update the section and subSection,
 	// so we can return it in the JSON,
@@ -194,23 +318,35 @@ func setQuestionExtras(question *restquiz.Question, section *restquiz.Section, s
 	return nil
 }
 
-func handleErrorAsHttpError(w http.ResponseWriter, code int, format string, a ...interface{}) {
-	msg := fmt.Sprintf(format, a...)
-	log.Print(msg)
+// handleErrorAsHttpError writes the error as a problem+json response.
+// The message is only sent to the client for client errors, or if apierror.SetShowInternalErrors(true) was called,
+// so it should not contain private details, such as other users' details, for 4xx statuses.
+func handleErrorAsHttpError(w http.ResponseWriter, status int, code apierror.Code, format string, a ...interface{}) {
+	apierror.Writef(w, status, code, format, a...)
+}
 
-	http.Error(w, msg, code)
+// handleMissingParameterAsHttpError writes a 400 response for a missing query or path parameter.
+func handleMissingParameterAsHttpError(w http.ResponseWriter, parameter string) {
+	apierror.Write(w, http.StatusBadRequest, apierror.CODE_MISSING_PARAMETER, fmt.Sprintf("%v not specified", parameter), map[string]string{"parameter": parameter})
+}
+
+// handleInvalidParameterAsHttpError writes a 400 response for an invalid query parameter, or request body field.
+func handleInvalidParameterAsHttpError(w http.ResponseWriter, parameter string, format string, a ...interface{}) {
+	apierror.Write(w, http.StatusBadRequest, apierror.CODE_INVALID_PARAMETER, fmt.Sprintf(format, a...), map[string]string{"parameter": parameter})
 }
 
 // marshalAndWriteOrHttpError() writes the object to the writer as JSON.
 func marshalAndWriteOrHttpError(w http.ResponseWriter, v interface{}) {
 	jsonStr, err := json.Marshal(v)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "json.Marshal() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "json.Marshal() failed: %v", err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+
 	_, err = w.Write(jsonStr)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "w.Write() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "w.Write() failed: %v", err)
 	}
 }
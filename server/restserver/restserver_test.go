@@ -7,6 +7,8 @@ import (
 
 	"github.com/gorilla/sessions"
 	"github.com/murraycu/go-bigoquiz-server/config"
+	domaingroup "github.com/murraycu/go-bigoquiz-server/domain/group"
+	domainquestionstats "github.com/murraycu/go-bigoquiz-server/domain/questionstats"
 	domainquiz "github.com/murraycu/go-bigoquiz-server/domain/quiz"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
 	"github.com/murraycu/go-bigoquiz-server/server/loginserver/oauthparsers"
@@ -14,6 +16,7 @@ import (
 
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/murraycu/go-bigoquiz-server/repositories/db"
 	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes"
@@ -32,6 +35,14 @@ func (m MockUserSessionStore) GetUserIdAndOAuthTokenFromSession(r *http.Request)
 	panic("Unimplemented")
 }
 
+func (m MockUserSessionStore) GetCSRFToken(r *http.Request) (string, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserSessionStore) GetOrCreateCSRFToken(r *http.Request, w http.ResponseWriter) (string, error) {
+	panic("Unimplemented")
+}
+
 type MockUserDataRepository struct{}
 
 func (m MockUserDataRepository) GetUserProfileById(c context.Context, strUserId string) (*domainuser.Profile, error) {
@@ -54,19 +65,47 @@ func (m MockUserDataRepository) StoreUserStats(c context.Context, userID string,
 	panic("Unimplemented")
 }
 
+func (m MockUserDataRepository) UpdateUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string, update func(stats *domainuser.Stats) error) (*domainuser.Stats, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) UpdateUserStatsForSectionOnce(c context.Context, strUserId string, quizId string, sectionId string, event *domainuser.SyncEvent, update func(stats *domainuser.Stats) error) (*domainuser.Stats, bool, error) {
+	panic("Unimplemented")
+}
+
 func (m MockUserDataRepository) DeleteUserStatsForQuiz(c context.Context, strUserId string, quizId string) error {
 	panic("Unimplemented")
 }
 
-func (m MockUserDataRepository) StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (m MockUserDataRepository) DeleteUserStatsForSection(c context.Context, strUserId string, quizId string, sectionId string) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) UpdateUserStatsForSections(c context.Context, strUserId string, quizId string, sectionIds []string, update func(statsBySection map[string]*domainuser.Stats) error) error {
 	panic("Unimplemented")
 }
 
-func (m MockUserDataRepository) StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (m MockUserDataRepository) StoreUserStatsUndo(c context.Context, strUserId string, undo *domainuser.StatsUndo) error {
 	panic("Unimplemented")
 }
 
-func (m MockUserDataRepository) StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, error) {
+func (m MockUserDataRepository) GetUserStatsUndo(c context.Context, strUserId string) (*domainuser.StatsUndo, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) DeleteUserStatsUndo(c context.Context, strUserId string) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreGoogleLoginInUserProfile(c context.Context, userInfo oauthparsers.GoogleUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreGitHubLoginInUserProfile(c context.Context, userInfo oauthparsers.GitHubUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreFacebookLoginInUserProfile(c context.Context, userInfo oauthparsers.FacebookUserInfo, strUserId string, token *oauth2.Token) (string, bool, error) {
 	panic("Unimplemented")
 }
 
@@ -82,6 +121,124 @@ func (m MockUserDataRepository) StoreFacebookTokenInUserProfile(c context.Contex
 	panic("Unimplemented")
 }
 
+func (m MockUserDataRepository) StoreUserCertificateIfNew(c context.Context, strUserId string, certificate *domainuser.Certificate) (*domainuser.Certificate, bool, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserCertificates(c context.Context, strUserId string) ([]*domainuser.Certificate, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetCertificateById(c context.Context, certificateId string) (*domainuser.Certificate, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreGroup(c context.Context, group *domaingroup.Group) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroup(c context.Context, groupId string) (*domaingroup.Group, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroupByInviteCode(c context.Context, inviteCode string) (*domaingroup.Group, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreGroupMembership(c context.Context, membership *domaingroup.Membership) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroupMembership(c context.Context, groupId string, strUserId string) (*domaingroup.Membership, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroupMemberships(c context.Context, groupId string) ([]*domaingroup.Membership, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserGroupMemberships(c context.Context, strUserId string) ([]*domaingroup.Membership, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) DeleteGroupMembership(c context.Context, groupId string, strUserId string) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreGroupAssignment(c context.Context, assignment *domaingroup.Assignment) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroupAssignment(c context.Context, groupId string, assignmentId string) (*domaingroup.Assignment, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetGroupAssignments(c context.Context, groupId string) ([]*domaingroup.Assignment, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) StoreUserDailyGoal(c context.Context, strUserId string, timeZone string, goal domainuser.DailyGoal) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) DeleteOldSyncEvents(c context.Context, before time.Time) (int, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) UpdateUserDailyActivity(c context.Context, strUserId string, date string, answerIsCorrect bool, learned bool) (bool, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserDailyActivities(c context.Context, strUserId string) ([]*domainuser.DailyActivity, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserIds(c context.Context) ([]string, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserIdsByEmail(c context.Context, email string) ([]string, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) GetUserIdByLoginId(c context.Context, provider string, loginId string) (string, error) {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) DeleteUser(c context.Context, strUserId string) error {
+	panic("Unimplemented")
+}
+
+func (m MockUserDataRepository) Ping(c context.Context) error {
+	return nil
+}
+
+func (m MockUserDataRepository) Close() error {
+	return nil
+}
+
+type MockQuestionStatsRepository struct{}
+
+func (m MockQuestionStatsRepository) StoreAnswerEvent(c context.Context, event *domainquestionstats.AnswerEvent) error {
+	panic("Unimplemented")
+}
+
+func (m MockQuestionStatsRepository) AggregateAnswerEvents(c context.Context, maxEvents int) (int, []*domainquestionstats.QuestionStats, error) {
+	panic("Unimplemented")
+}
+
+func (m MockQuestionStatsRepository) GetQuestionStats(c context.Context, quizId string) ([]*domainquestionstats.QuestionStats, error) {
+	panic("Unimplemented")
+}
+
+func (m MockQuestionStatsRepository) Ping(c context.Context) error {
+	return nil
+}
+
+func (m MockQuestionStatsRepository) Close() error {
+	return nil
+}
+
 type MockQuizzesRepository struct{}
 
 func (m MockQuizzesRepository) LoadQuizzes() (quizzes.MapQuizzes, error) {
@@ -94,10 +251,11 @@ func (m MockQuizzesRepository) LoadQuizzes() (quizzes.MapQuizzes, error) {
 func TestNewRestServer(t *testing.T) {
 	userSessionStore := &MockUserSessionStore{}
 	userDataRepository := &MockUserDataRepository{}
+	questionStatsRepository := &MockQuestionStatsRepository{}
 	quizzesStore := &MockQuizzesRepository{}
 	conf := &config.Config{}
 
-	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataRepository, conf)
+	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataRepository, questionStatsRepository, nil, conf)
 	assert.Nil(t, err)
 	assert.NotNil(t, restServer)
 }
@@ -105,10 +263,11 @@ func TestNewRestServer(t *testing.T) {
 func TestHasQuizzes(t *testing.T) {
 	userSessionStore := &MockUserSessionStore{}
 	userDataRepository := &MockUserDataRepository{}
+	questionStatsRepository := &MockQuestionStatsRepository{}
 	quizzesStore := &MockQuizzesRepository{}
 	conf := &config.Config{}
 
-	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataRepository, conf)
+	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataRepository, questionStatsRepository, nil, conf)
 	assert.Nil(t, err)
 
 	assert.NotEmpty(t, restServer.quizzesListSimple)
@@ -120,14 +279,18 @@ func TestNewRestServerWithDataStore(t *testing.T) {
 		t.Skip("Skipping test which requires more setup.")
 	}
 
-	userSessionStore, err := usersessionstore.NewUserSessionStore("some-test-value")
+	userSessionStore, err := usersessionstore.NewUserSessionStore(&config.Config{CookieKey: "some-test-value"})
 	assert.Nil(t, err)
 	assert.NotNil(t, userSessionStore)
 
-	userDataClient, err := db.NewUserDataRepository()
+	userDataClient, err := db.NewUserDataRepository("bigoquiz")
 	assert.Nil(t, err)
 	assert.NotNil(t, userDataClient)
 
+	questionStatsClient, err := db.NewQuestionStatsRepository("bigoquiz")
+	assert.Nil(t, err)
+	assert.NotNil(t, questionStatsClient)
+
 	// TODO: Mock the QuizzesRepository.
 	directoryFilepath, err := filepath.Abs("../../quizzes")
 	if err != nil {
@@ -141,7 +304,7 @@ func TestNewRestServerWithDataStore(t *testing.T) {
 
 	conf := &config.Config{}
 
-	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataClient, conf)
+	restServer, err := NewRestServer(quizzesStore, userSessionStore, userDataClient, questionStatsClient, nil, conf)
 	assert.Nil(t, err)
 	assert.NotNil(t, restServer)
 
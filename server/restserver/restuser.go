@@ -6,16 +6,25 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
 	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
 )
 
 func (s *RestServer) HandleUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	result, err := s.getLoginInfoFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "getLoginInfoFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getLoginInfoFromSessionAndDb() failed: %v", err)
 		return
 	}
 
+	if result.LoginInfo.LoggedIn {
+		result.LoginInfo.CsrfToken, err = s.userSessionStore.GetOrCreateCSRFToken(r, w)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetOrCreateCSRFToken() failed: %v", err)
+			return
+		}
+	}
+
 	marshalAndWriteOrHttpError(w, result.LoginInfo)
 }
 
@@ -5,16 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"sort"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
 	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
 	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// How long a reset can be undone with HandleUserHistoryUndoReset().
+const statsUndoWindow = 15 * time.Minute
+
 // See https://gobyexample.com/sorting-by-functions
 type StatsListByTitle []*restuser.Stats
 
@@ -33,7 +42,7 @@ func (s StatsListByTitle) Less(i, j int) bool {
 func (s *RestServer) HandleUserHistoryAll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	loginInfoResult, err := s.getLoginInfoFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "getLoginInfoFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getLoginInfoFromSessionAndDb() failed: %v", err)
 		return
 	}
 
@@ -50,7 +59,7 @@ func (s *RestServer) HandleUserHistoryAll(w http.ResponseWriter, r *http.Request
 
 		mapUserStats, err := s.userDataClient.GetUserStats(c, userId)
 		if err != nil {
-			handleErrorAsHttpError(w, http.StatusInternalServerError, "GetUserStats() failed: %v", err)
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserStats() failed: %v", err)
 			return
 		}
 
@@ -66,13 +75,13 @@ func (s *RestServer) HandleUserHistoryAll(w http.ResponseWriter, r *http.Request
 
 			quizCache, err := s.getQuizCache(q.Id)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "getQuizCache() failed: %v", err)
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getQuizCache() failed: %v", err)
 				return
 			}
 
 			restStats, err := convertDomainStatsToRestStats(stats, quizCache)
 			if err != nil {
-				handleErrorAsHttpError(w, http.StatusInternalServerError, "convertDomainStatsToRestStats() failed: %v", err)
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "convertDomainStatsToRestStats() failed: %v", err)
 				return
 			}
 
@@ -91,19 +100,19 @@ func (s *RestServer) HandleUserHistoryByQuizId(w http.ResponseWriter, r *http.Re
 	quizId := ps.ByName(PATH_PARAM_QUIZ_ID)
 	if quizId == "" {
 		// This makes no sense. restHandleQuizAll() should have been called.
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Empty quiz ID")
+		handleMissingParameterAsHttpError(w, PATH_PARAM_QUIZ_ID)
 		return
 	}
 
 	q := s.getQuiz(quizId)
 	if q == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
 	loginInfoResult, err := s.getLoginInfoFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "getLoginInfoFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getLoginInfoFromSessionAndDb() failed: %v", err)
 		return
 	}
 
@@ -116,14 +125,14 @@ func (s *RestServer) HandleUserHistoryByQuizId(w http.ResponseWriter, r *http.Re
 
 		mapUserStats, err = s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
 		if err != nil {
-			handleErrorAsHttpError(w, http.StatusInternalServerError, "GetUserStatsForQuiz() falied: %v", err)
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserStatsForQuiz() failed: %v", err)
 			return
 		}
 	}
 
 	info, err := s.buildRestUserHistorySections(loginInfo, q, mapUserStats)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "buildRestUserHistorySections() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildRestUserHistorySections() failed: %v", err)
 		return
 	}
 
@@ -138,50 +147,56 @@ func (s *RestServer) HandleUserHistorySubmitAnswer(w http.ResponseWriter, r *htt
 	var quizId string
 	var questionId string
 	var nextQuestionSectionId string
+	var nextQuestionTag string
 
 	queryValues := r.URL.Query()
 	if queryValues != nil {
 		quizId = queryValues.Get(QUERY_PARAM_QUIZ_ID)
 		questionId = queryValues.Get(QUERY_PARAM_QUESTION_ID)
 		nextQuestionSectionId = queryValues.Get(QUERY_PARAM_NEXT_QUESTION_SECTION_ID)
+		nextQuestionTag = queryValues.Get(QUERY_PARAM_NEXT_QUESTION_TAG)
 	}
 
 	qa, err := s.getQuestionAndAnswer(quizId, questionId)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found")
 		return
 	}
 
 	if qa == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found")
 		return
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Could not parse body. ioutil.ReadAll() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
 		return
 	}
 
 	var submission Submission
 	err = json.Unmarshal(body, &submission)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "Could not parse JSON. json.Unmarshal() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
 		return
 	}
 
-	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	// The profile has the user's time zone, for the daily activity.
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "getUserIdFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
 	}
 
 	result := answerIsCorrect(submission.Answer, &qa.Answer)
-	submissionResult, err := s.storeAnswerCorrectnessAndGetSubmissionResult(r.Context(), userId, quizId, nextQuestionSectionId, qa, result)
+	submissionResult, err := s.storeAnswerCorrectnessAndGetSubmissionResult(r.Context(), profileResult.UserId, profileResult.Profile, quizId, nextQuestionSectionId, nextQuestionTag, qa, result)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "storeAnswerCorrectnessAndGetSubmissionResult() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "storeAnswerCorrectnessAndGetSubmissionResult() failed: %v", err)
 		return
 	}
 
+	s.storeAnswerEvent(r.Context(), quizId, questionId, submission.Answer, result, false)
+
 	marshalAndWriteOrHttpError(w, &submissionResult)
 }
 
@@ -189,99 +204,281 @@ func (s *RestServer) HandleUserHistorySubmitDontKnowAnswer(w http.ResponseWriter
 	var quizId string
 	var questionId string
 	var nextQuestionSectionId string
+	var nextQuestionTag string
 
 	queryValues := r.URL.Query()
 	if queryValues != nil {
 		quizId = queryValues.Get(QUERY_PARAM_QUIZ_ID)
 		questionId = queryValues.Get(QUERY_PARAM_QUESTION_ID)
 		nextQuestionSectionId = queryValues.Get(QUERY_PARAM_NEXT_QUESTION_SECTION_ID)
+		nextQuestionTag = queryValues.Get(QUERY_PARAM_NEXT_QUESTION_TAG)
 	}
 
 	qa, err := s.getQuestionAndAnswer(quizId, questionId)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found")
 		return
 	}
 
 	if qa == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "question not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found")
 		return
 	}
 
-	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	// The profile has the user's time zone, for the daily activity.
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "getUserIdFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
 	}
 
 	//Store this like a don't know answer:
-	submissionResult, err := s.storeAnswerCorrectnessAndGetSubmissionResult(r.Context(), userId, quizId, nextQuestionSectionId, qa, false)
+	submissionResult, err := s.storeAnswerCorrectnessAndGetSubmissionResult(r.Context(), profileResult.UserId, profileResult.Profile, quizId, nextQuestionSectionId, nextQuestionTag, qa, false)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "storeAnswerCorrectnessAndGetSubmissionResult() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "storeAnswerCorrectnessAndGetSubmissionResult() failed: %v", err)
 		return
 	}
 
+	s.storeAnswerEvent(r.Context(), quizId, questionId, "", false, true)
+
 	marshalAndWriteOrHttpError(w, &submissionResult)
 }
 
+// HandleUserHistoryResetSections resets the user's history for the whole quiz,
+// or just for the section-id section, or just for the question-id questions.
+// The previous history is kept for a while, so HandleUserHistoryUndoReset() can restore it.
 func (s *RestServer) HandleUserHistoryResetSections(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var quizId string
+	var sectionId string
+	var questionIds []string
 
 	queryValues := r.URL.Query()
 	if queryValues != nil {
 		quizId = queryValues.Get(QUERY_PARAM_QUIZ_ID)
+		sectionId = queryValues.Get(QUERY_PARAM_SECTION_ID)
+		questionIds = queryValues[QUERY_PARAM_QUESTION_ID]
 	}
 
 	if len(quizId) == 0 {
-		handleErrorAsHttpError(w, http.StatusBadRequest, "quiz-id not specified")
+		handleMissingParameterAsHttpError(w, QUERY_PARAM_QUIZ_ID)
 		return
 	}
 
 	q := s.getQuiz(quizId)
 	if q == nil {
-		handleErrorAsHttpError(w, http.StatusNotFound, "quiz not found")
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUIZ_NOT_FOUND, "quiz not found")
 		return
 	}
 
-	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	quizCache, err := s.getQuizCache(quizId)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getQuizCache() failed: %v", err)
 		return
 	}
 
-	if len(userId) == 0 {
-		loginInfoResult, err := s.getLoginInfoFromSessionAndDb(w, r)
-		if err != nil {
-			handleErrorAsHttpError(w, http.StatusForbidden, "not logged in. getLoginInfoFromSessionAndDb() failed: %v", err)
+	if len(sectionId) != 0 {
+		if _, err := quizCache.GetSection(sectionId); err != nil {
+			handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_SECTION_NOT_FOUND, "section not found")
+			return
+		}
+	}
+
+	// The questions to forget, by section ID.
+	var questionIdsBySection map[string][]string
+	if len(questionIds) != 0 {
+		questionIdsBySection = make(map[string][]string)
+		for _, questionId := range questionIds {
+			qa := quizCache.GetQuestionAndAnswer(questionId)
+			if qa == nil {
+				handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_QUESTION_NOT_FOUND, "question not found: %v", questionId)
+				return
+			}
+
+			if len(sectionId) != 0 && qa.SectionId != sectionId {
+				handleInvalidParameterAsHttpError(w, QUERY_PARAM_QUESTION_ID, "question is not in the section: %v", questionId)
+				return
+			}
+
+			questionIdsBySection[qa.SectionId] = append(questionIdsBySection[qa.SectionId], questionId)
+		}
+	}
+
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
+		return
+	}
+
+	c := r.Context()
+
+	stats, err := s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserStatsForQuiz() failed: %v", err)
+		return
+	}
+
+	statsToReset := chooseStatsToReset(stats, sectionId, questionIdsBySection)
+
+	var result restuser.ResetResult
+	if len(statsToReset) != 0 {
+		// Store the undo before changing anything.
+		undo := &domainuser.StatsUndo{
+			QuizId:  quizId,
+			Stats:   statsToReset,
+			Expires: time.Now().UTC().Add(statsUndoWindow),
+		}
+
+		if err := s.userDataClient.StoreUserStatsUndo(c, userId, undo); err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreUserStatsUndo() failed: %v", err)
 			return
 		}
 
-		msg := fmt.Sprintf("not logged in. loginInfo=%v", loginInfoResult.LoginInfo)
-		handleErrorAsHttpError(w, http.StatusForbidden, msg)
+		result.CanUndo = true
+		result.UndoExpires = undo.Expires.Format(time.RFC3339)
+	}
+
+	switch {
+	case questionIdsBySection != nil:
+		for _, sectionStats := range statsToReset {
+			questionIds := questionIdsBySection[sectionStats.SectionId]
+			_, err := s.userDataClient.UpdateUserStatsForSection(c, userId, quizId, sectionStats.SectionId, func(stats *domainuser.Stats) error {
+				stats.ForgetQuestions(questionIds)
+				return nil
+			})
+			if err != nil {
+				handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "UpdateUserStatsForSection() failed: %v", err)
+				return
+			}
+		}
+	case len(sectionId) != 0:
+		err = s.userDataClient.DeleteUserStatsForSection(c, userId, quizId, sectionId)
+	default:
+		err = s.userDataClient.DeleteUserStatsForQuiz(c, userId, quizId)
+	}
+
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "deletion of stats failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, &result)
+}
+
+// chooseStatsToReset returns the user's stats for the sections that would be changed by a reset:
+// Either the sections containing the questions, if questionIdsBySection is not nil,
+// or the section, if sectionId is not empty,
+// or all sections.
+// stats is a map of section IDs to stats, and may be nil.
+func chooseStatsToReset(stats map[string]*domainuser.Stats, sectionId string, questionIdsBySection map[string][]string) []*domainuser.Stats {
+	var result []*domainuser.Stats
+
+	for _, sectionStats := range stats {
+		if sectionStats == nil {
+			continue
+		}
+
+		if questionIdsBySection != nil {
+			questionIds, ok := questionIdsBySection[sectionStats.SectionId]
+			if !ok || !slices.ContainsFunc(questionIds, sectionStats.GetQuestionWasAnswered) {
+				continue
+			}
+		} else if len(sectionId) != 0 && sectionStats.SectionId != sectionId {
+			continue
+		}
+
+		result = append(result, sectionStats)
+	}
+
+	// Sort them so the undo is stored predictably.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SectionId < result[j].SectionId
+	})
+
+	return result
+}
+
+// HandleUserHistoryUndoReset restores the user's history from before the last reset,
+// replacing any answers since then, for the same sections.
+func (s *RestServer) HandleUserHistoryUndoReset(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userId, ok := s.getLoggedInUserIdOrHttpError(w, r)
+	if !ok {
 		return
 	}
 
 	c := r.Context()
 
-	err = s.userDataClient.DeleteUserStatsForQuiz(c, userId, quizId)
+	undo, err := s.userDataClient.GetUserStatsUndo(c, userId)
 	if err != nil {
-		handleErrorAsHttpError(w, http.StatusInternalServerError, "deletion of stats failed: %v", err)
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserStatsUndo() failed: %v", err)
+		return
+	}
+
+	if undo == nil {
+		handleErrorAsHttpError(w, http.StatusNotFound, apierror.CODE_NOTHING_TO_UNDO, "nothing to undo")
+		return
+	}
+
+	if undo.IsExpired(time.Now()) {
+		if err := s.userDataClient.DeleteUserStatsUndo(c, userId); err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "DeleteUserStatsUndo() failed: %v", err)
+			return
+		}
+
+		handleErrorAsHttpError(w, http.StatusGone, apierror.CODE_UNDO_EXPIRED, "the undo has expired")
+		return
+	}
+
+	for _, sectionStats := range undo.Stats {
+		if err := s.userDataClient.StoreUserStats(c, userId, sectionStats); err != nil {
+			handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreUserStats() failed: %v", err)
+			return
+		}
+	}
+
+	// So it cannot be undone twice, which could replace newer answers.
+	if err := s.userDataClient.DeleteUserStatsUndo(c, userId); err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "DeleteUserStatsUndo() failed: %v", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+/** Get the user ID,
+ * or write an HTTP error, and return false, if the user is not logged in.
+ */
+func (s *RestServer) getLoggedInUserIdOrHttpError(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
+		return "", false
+	}
+
+	if len(userId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return "", false
+	}
+
+	return userId, true
+}
+
 type SubmissionResult struct {
 	Result        bool              `json:"result"`
 	CorrectAnswer restquiz.Text     `json:"correctAnswer,omitempty"`
 	NextQuestion  restquiz.Question `json:"nextQuestion,omitempty"`
 }
 
-func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResult(c context.Context, userId string, quizId string, nextQuestionSectionId string, qa *restquiz.QuestionAndAnswer, result bool) (*SubmissionResult, error) {
+// storeAnswerCorrectnessAndGetSubmissionResult stores the answer in the user's stats, and chooses the next question,
+// either from nextQuestionTag's collection, if specified, or from the quiz.
+// profile may be nil, as for storeDailyActivity().
+func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResult(c context.Context, userId string, profile *domainuser.Profile, quizId string, nextQuestionSectionId string, nextQuestionTag string, qa *restquiz.QuestionAndAnswer, result bool) (*SubmissionResult, error) {
+	if len(nextQuestionTag) != 0 {
+		return s.storeAnswerCorrectnessAndGetSubmissionResultForTag(c, userId, profile, quizId, nextQuestionTag, qa, result)
+	}
+
 	sectionId := qa.Question.SectionId
 	questionId := qa.Question.Id
 
-	// Get the Stats (or a map of them), and use it for both storing the answer and getting the next question,
+	// Use the updated Stats (or a map of them) for getting the next question,
 	// to avoid getting the UserStats twice from the datastore.
 	//
 	// Call different methods depending on whether nextQuestionSectionId is specified and is the same as the
@@ -290,18 +487,13 @@ func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResult(c context.Cont
 		var stats *domainuser.Stats
 		if len(userId) != 0 {
 			var err error
-			stats, err = s.userDataClient.GetUserStatsForSection(c, userId, quizId, nextQuestionSectionId)
-			if err != nil {
-				return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
-			}
-
-			err = s.storeAnswerForSection(c, result, quizId, &qa.Question, userId, stats)
+			stats, err = s.storeAnswerForSection(c, result, quizId, &qa.Question, userId, profile)
 			if err != nil {
 				return nil, fmt.Errorf("storeAnswerForSection() failed: %v", err)
 			}
 		}
 
-		result, err := s.createSubmissionResultForSection(result, quizId, questionId, nextQuestionSectionId, stats)
+		result, err := s.createSubmissionResultForSection(c, result, quizId, questionId, nextQuestionSectionId, stats)
 		if err != nil {
 			return nil, fmt.Errorf("createSubmissionResultForSection() failed: %v", err)
 		}
@@ -310,18 +502,19 @@ func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResult(c context.Cont
 	} else {
 		var stats map[string]*domainuser.Stats
 		if len(userId) != 0 {
-			stats, err := s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+			var err error
+			stats, err = s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
 			if err != nil {
 				return nil, fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
 			}
 
-			err = s.storeAnswer(c, result, quizId, &qa.Question, userId, stats)
+			err = s.storeAnswer(c, result, quizId, &qa.Question, userId, profile, stats)
 			if err != nil {
 				return nil, fmt.Errorf("storeAnswer() failed: %v", err)
 			}
 		}
 
-		result, err := s.createSubmissionResult(result, quizId, questionId, nextQuestionSectionId, stats)
+		result, err := s.createSubmissionResult(c, result, quizId, questionId, nextQuestionSectionId, stats)
 		if err != nil {
 			return nil, fmt.Errorf("createSubmissionResultForSection() failed: %v", err)
 		}
@@ -330,10 +523,54 @@ func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResult(c context.Cont
 	}
 }
 
+// storeAnswerCorrectnessAndGetSubmissionResultForTag stores the answer in the user's stats for the question's quiz,
+// and chooses the next question from any quiz in the tag's collection.
+func (s *RestServer) storeAnswerCorrectnessAndGetSubmissionResultForTag(c context.Context, userId string, profile *domainuser.Profile, quizId string, nextQuestionTag string, qa *restquiz.QuestionAndAnswer, result bool) (*SubmissionResult, error) {
+	collection := s.getTagCollection(nextQuestionTag)
+	if collection == nil {
+		return nil, fmt.Errorf("could not find collection for tag: %v", nextQuestionTag)
+	}
+
+	quizCache, err := s.getQuizCache(quizId)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find quiz in quizCacheMap with quiz ID: %v: %v", quizId, err)
+	}
+
+	var statsByQuiz map[string]map[string]*domainuser.Stats
+	if len(userId) != 0 {
+		statsByQuiz, err = s.getUserStatsForQuizzes(c, userId, collection.GetQuizIds())
+		if err != nil {
+			return nil, fmt.Errorf("getUserStatsForQuizzes() failed: %v", err)
+		}
+
+		// The answered question's quiz might not be in the collection,
+		// so this might be nil.
+		stats := statsByQuiz[quizId]
+
+		err = s.storeAnswer(c, result, quizId, &qa.Question, userId, profile, stats)
+		if err != nil {
+			return nil, fmt.Errorf("storeAnswer() failed: %v", err)
+		}
+	}
+
+	//We only provide the correct answer if the supplied answer was wrong:
+	var correctAnswer *restquiz.Text
+	if !result {
+		correctAnswer = quizCache.GetAnswer(qa.Question.Id)
+	}
+
+	nextQuestion, err := s.getNextQuestionFromUserStatsForTag(c, collection, statsByQuiz)
+	if err != nil {
+		return nil, fmt.Errorf("getNextQuestionFromUserStatsForTag() failed: %v", err)
+	}
+
+	return s.generateSubmissionResult(result, quizCache, correctAnswer, nextQuestion)
+}
+
 /**
  * stats may be nil.
  */
-func (s *RestServer) createSubmissionResult(result bool, quizId string, questionId string, nextQuestionSectionId string, stats map[string]*domainuser.Stats) (*SubmissionResult, error) {
+func (s *RestServer) createSubmissionResult(c context.Context, result bool, quizId string, questionId string, nextQuestionSectionId string, stats map[string]*domainuser.Stats) (*SubmissionResult, error) {
 	quizCache, err := s.getQuizCache(quizId)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't find quiz in quizCacheMap with quiz ID: %v: %v", quizId, err)
@@ -350,7 +587,7 @@ func (s *RestServer) createSubmissionResult(result bool, quizId string, question
 		return nil, fmt.Errorf("couldn't find quiz with quiz ID: %v", quizId)
 	}
 
-	nextQuestion, err := s.getNextQuestionFromUserStats(nextQuestionSectionId, q, stats)
+	nextQuestion, err := s.getNextQuestionFromUserStats(c, nextQuestionSectionId, q, stats)
 	if err != nil {
 		return nil, fmt.Errorf("getNextQuestionFromUserStats() failed: %v", err)
 	}
@@ -358,7 +595,7 @@ func (s *RestServer) createSubmissionResult(result bool, quizId string, question
 	return s.generateSubmissionResult(result, quizCache, correctAnswer, nextQuestion)
 }
 
-func (s *RestServer) createSubmissionResultForSection(result bool, quizId string, questionId string, nextQuestionSectionId string, stats *domainuser.Stats) (*SubmissionResult, error) {
+func (s *RestServer) createSubmissionResultForSection(c context.Context, result bool, quizId string, questionId string, nextQuestionSectionId string, stats *domainuser.Stats) (*SubmissionResult, error) {
 	quizCache, err := s.getQuizCache(quizId)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't find quiz in quizCacheMap with quiz ID: %v: %v", quizId, err)
@@ -375,7 +612,7 @@ func (s *RestServer) createSubmissionResultForSection(result bool, quizId string
 		return nil, fmt.Errorf("couldn't find quiz with quiz ID: %v", quizId)
 	}
 
-	nextQuestion, err := s.getNextQuestionFromUserStatsForSection(nextQuestionSectionId, q, stats)
+	nextQuestion, err := s.getNextQuestionFromUserStatsForSection(c, nextQuestionSectionId, q, stats)
 	if err != nil {
 		return nil, fmt.Errorf("getNextQuestionFromUserStatsForSection() failed: %v", err)
 	}
@@ -403,18 +640,74 @@ func (s *RestServer) generateSubmissionResult(result bool, quizCache *QuizCache,
 	return &submissionResult, nil
 }
 
-func (s *RestServer) getNextQuestionFromUserStats(sectionId string, q *restquiz.Quiz, stats map[string]*domainuser.Stats) (*restquiz.Question, error) {
+func (s *RestServer) getNextQuestionFromUserStats(c context.Context, sectionId string, q *restquiz.Quiz, stats map[string]*domainuser.Stats) (*restquiz.Question, error) {
+	getRandomQuestion := func() (*restquiz.Question, error) {
+		return s.GetRandomQuestion(q, sectionId)
+	}
+
+	getSectionStats := func(question *restquiz.Question) *domainuser.Stats {
+		if stats == nil {
+			//Assume this means the user has never answered any question in any section.
+			return nil
+		}
+
+		return stats[question.SectionId]
+	}
+
+	c, span := tracing.Tracer().Start(c, "chooseNextQuestion", trace.WithAttributes(
+		attribute.String(tracing.KEY_QUIZ_ID, q.Id),
+		attribute.String(tracing.KEY_SECTION_ID, sectionId)))
+	question, err := chooseNextQuestion(c, getRandomQuestion, getSectionStats, s.getQuestionDifficulty)
+	tracing.EndSpan(span, err)
+
+	return question, err
+}
+
+/** statsByQuiz is a map of quiz IDs to maps of section IDs to stats.
+ * statsByQuiz may be nil.
+ */
+func (s *RestServer) getNextQuestionFromUserStatsForTag(c context.Context, collection *TagCollection, statsByQuiz map[string]map[string]*domainuser.Stats) (*restquiz.Question, error) {
+	getRandomQuestion := func() (*restquiz.Question, error) {
+		return collection.GetRandomQuestion(), nil
+	}
+
+	getSectionStats := func(question *restquiz.Question) *domainuser.Stats {
+		stats, ok := statsByQuiz[question.QuizId]
+		if !ok || stats == nil {
+			//Assume this means the user has never answered any question in the quiz.
+			return nil
+		}
+
+		return stats[question.SectionId]
+	}
+
+	c, span := tracing.Tracer().Start(c, "chooseNextQuestion", trace.WithAttributes(
+		attribute.String(tracing.KEY_TAG, collection.Tag)))
+	question, err := chooseNextQuestion(c, getRandomQuestion, getSectionStats, s.getQuestionDifficulty)
+	tracing.EndSpan(span, err)
+
+	return question, err
+}
+
+/** chooseNextQuestion() tries several random questions,
+ * preferring questions that have never been answered,
+ * and then questions that have been answered wrongly most often,
+ * and then questions that are harder for all users.
+ * getSectionStats() should return nil if the user has no stats for the question's section.
+ * getDifficulty() should return a value from 0 (easy) to 1 (hard).
+ */
+func chooseNextQuestion(c context.Context, getRandomQuestion func() (*restquiz.Question, error), getSectionStats func(question *restquiz.Question) *domainuser.Stats, getDifficulty func(question *restquiz.Question) float64) (*restquiz.Question, error) {
 	const MAX_TRIES int = 10
 	var tries int
 	var question *restquiz.Question
 	var questionBestSoFar *restquiz.Question
-	var questionBestCountAnsweredWrong int
+	var questionBestScore float64
 
 	for tries < MAX_TRIES {
 		tries += 1
 
 		var err error
-		question, err = s.GetRandomQuestion(q, sectionId)
+		question, err = getRandomQuestion()
 		if err != nil {
 			return nil, fmt.Errorf("GetRandomQuestion() failed: %v", err)
 		}
@@ -427,21 +720,20 @@ func (s *RestServer) getNextQuestionFromUserStats(sectionId string, q *restquiz.
 			questionBestSoFar = question
 		}
 
-		if stats == nil {
-			//Assume this means the user has never answered any question in any section.
-			return question, nil
-		}
-
-		userStats, ok := stats[question.SectionId]
-		if !ok || userStats == nil {
+		userStats := getSectionStats(question)
+		if userStats == nil {
 			//Assume this means the user has never answered any question in the section.
+			recordTries(c, tries)
 			return question, nil
 		}
 
 		questionId := question.Id
 
-		//Prioritize questions that have never been asked.
-		if !userStats.GetQuestionWasAnswered(questionId) {
+		//Prioritize questions that have never been asked,
+		//or that have changed since they were last asked.
+		if !userStats.GetQuestionWasAnswered(questionId) ||
+			userStats.GetQuestionContentChanged(questionId, question.QuizVersion, question.ContentHash) {
+			recordTries(c, tries)
 			return question, nil
 		}
 
@@ -449,20 +741,28 @@ func (s *RestServer) getNextQuestionFromUserStats(sectionId string, q *restquiz.
 		//we have got wrong many times:
 		//We could just get the most-wrong answer directly,
 		//but we want some randomness.
-		countAnsweredWrong := userStats.GetQuestionCountAnsweredWrong(questionId)
-		if countAnsweredWrong > questionBestCountAnsweredWrong {
+		//The difficulty is less than 1, so it only chooses between questions
+		//that the user has got wrong the same number of times.
+		score := float64(userStats.GetQuestionCountAnsweredWrong(questionId)) + getDifficulty(question)
+		if score > questionBestScore {
 			questionBestSoFar = question
-			questionBestCountAnsweredWrong = countAnsweredWrong
+			questionBestScore = score
 		}
 	}
 
+	recordTries(c, tries)
 	return questionBestSoFar, nil
 }
 
+// recordTries records, on the context's span, how many random questions were tried.
+func recordTries(c context.Context, tries int) {
+	trace.SpanFromContext(c).SetAttributes(attribute.Int(tracing.KEY_TRIES, tries))
+}
+
 /** stats may be nil
  */
 func (s *RestServer) getNextQuestionFromUserStatsForSection(
-	sectionId string, quiz *restquiz.Quiz, stats *domainuser.Stats) (*restquiz.Question, error) {
+	c context.Context, sectionId string, quiz *restquiz.Quiz, stats *domainuser.Stats) (*restquiz.Question, error) {
 	//TODO: Avoid this temporary map:
 	m := make(map[string]*domainuser.Stats)
 
@@ -470,7 +770,7 @@ func (s *RestServer) getNextQuestionFromUserStatsForSection(
 		m[stats.SectionId] = stats
 	}
 
-	result, err := s.getNextQuestionFromUserStats(sectionId, quiz, m)
+	result, err := s.getNextQuestionFromUserStats(c, sectionId, quiz, m)
 	if err != nil {
 		return nil, fmt.Errorf("getNextQuestionFromUserStats() failed: %v", err)
 	}
@@ -479,10 +779,10 @@ func (s *RestServer) getNextQuestionFromUserStatsForSection(
 }
 
 /** Update the user.Stats for the question's quiz section, in the database,
- * storing a new user.Stats in the database if necessary.
- * To update an existing user.Stats in the database, via the stats parameter, its Key field must be set.
+ * storing a new user.Stats in the database if necessary,
+ * and replace the section's user.Stats in the stats map, if it is not nil.
  */
-func (s *RestServer) storeAnswer(c context.Context, result bool, quizId string, question *restquiz.Question, userId string, stats map[string]*domainuser.Stats) error {
+func (s *RestServer) storeAnswer(c context.Context, result bool, quizId string, question *restquiz.Question, userId string, profile *domainuser.Profile, stats map[string]*domainuser.Stats) error {
 	if len(userId) == 0 {
 		return fmt.Errorf("storeAnswer(): userId is empty")
 	}
@@ -496,48 +796,105 @@ func (s *RestServer) storeAnswer(c context.Context, result bool, quizId string,
 		return fmt.Errorf("storeAnswer(): question's section ID is empty")
 	}
 
-	sectionStats, ok := stats[sectionId]
-	if !ok {
-		// It's not in the map yet, so we add it.
-		sectionStats = new(domainuser.Stats)
-		sectionStats.QuizId = quizId
-		sectionStats.SectionId = sectionId
+	sectionStats, err := s.storeAnswerForSection(c, result, quizId, question, userId, profile)
+	if err != nil {
+		return fmt.Errorf("storeAnswerForSection() failed: %v", err)
 	}
 
-	return s.storeAnswerForSection(c, result, quizId, question, userId, sectionStats)
+	if stats != nil {
+		stats[sectionId] = sectionStats
+	}
+
+	return nil
 }
 
 /** Update the user.Stats for the section, for the quiz, in the database,
  * storing a new user.Stats in the database if necessary.
- * To update an existing user.Stats in the database, its Key field must be set.
+ * This changes the latest user.Stats in the database, in a transaction,
+ * so answers submitted at the same time, for instance from other browser tabs, are not lost.
+ * Returns the updated user.Stats.
  */
-func (s *RestServer) storeAnswerForSection(c context.Context, result bool, quizId string, question *restquiz.Question, userId string, sectionStats *domainuser.Stats) error {
+func (s *RestServer) storeAnswerForSection(c context.Context, result bool, quizId string, question *restquiz.Question, userId string, profile *domainuser.Profile) (*domainuser.Stats, error) {
 	if len(userId) == 0 {
-		return fmt.Errorf("storeAnswerForSection(): userId is empty")
+		return nil, fmt.Errorf("storeAnswerForSection(): userId is empty")
 	}
 
 	if question == nil {
-		return fmt.Errorf("storeAnswerForSection(): question is nil")
+		return nil, fmt.Errorf("storeAnswerForSection(): question is nil")
 	}
 
 	sectionId := question.SectionId
 	if len(sectionId) == 0 {
-		return fmt.Errorf("storeAnswerForSection(): question's section ID is empty")
+		return nil, fmt.Errorf("storeAnswerForSection(): question's section ID is empty")
 	}
 
-	if sectionStats == nil {
-		sectionStats = new(domainuser.Stats)
-		sectionStats.QuizId = quizId
-		sectionStats.SectionId = sectionId
+	var sectionQuestionsCount int
+	if quizCache, err := s.getQuizCache(quizId); err == nil {
+		sectionQuestionsCount = quizCache.GetSectionQuestionsCount(sectionId)
 	}
 
-	sectionStats.UpdateStatsForAnswerCorrectness(question.Id, result)
+	// These are set again if the transaction is retried.
+	var learned, mastered bool
+	sectionStats, err := s.userDataClient.UpdateUserStatsForSection(c, userId, quizId, sectionId, func(stats *domainuser.Stats) error {
+		countMasteredBefore := stats.CountQuestionsMastered
+		learned = updateStatsForAnswer(stats, question, "", result)
+		mastered = masteredSection(countMasteredBefore, stats, sectionQuestionsCount)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("UpdateUserStatsForSection() failed: %v", err)
+	}
 
-	if err := s.userDataClient.StoreUserStats(c, userId, sectionStats); err != nil {
-		return fmt.Errorf("db.StoreUserStat() failed for: %v: %v", sectionStats, err)
+	if err := s.storeDailyActivity(c, userId, profile, result, learned); err != nil {
+		return nil, fmt.Errorf("storeDailyActivity() failed: %v", err)
 	}
 
-	return nil
+	// Answering a question correctly for the first time may complete the section.
+	if learned {
+		s.issueCertificates(c, userId, quizId, sectionStats)
+	}
+
+	s.enqueueAnswerWebhookEvents(c, userId, quizId, sectionStats, mastered, learned)
+
+	return sectionStats, nil
+}
+
+// updateStatsForAnswer adds the answer to the stats,
+// returning true if this was the first time that the question was answered correctly.
+// quizVersion is the version of the quiz that the question was answered in,
+// or empty for the current version.
+func updateStatsForAnswer(stats *domainuser.Stats, question *restquiz.Question, quizVersion string, result bool) bool {
+	countQuestionsCorrectOnceBefore := stats.CountQuestionsCorrectOnce
+	stats.UpdateStatsForAnswerCorrectness(question.Id, result)
+
+	// We only know the hash of the current version of the question.
+	contentHash := question.ContentHash
+	if len(quizVersion) == 0 {
+		quizVersion = question.QuizVersion
+	} else if quizVersion != question.QuizVersion {
+		contentHash = ""
+	}
+
+	stats.SetQuestionContentVersion(question.Id, quizVersion, contentHash)
+
+	return stats.CountQuestionsCorrectOnce > countQuestionsCorrectOnceBefore
+}
+
+/** Get a map of quiz IDs to maps of section IDs to stats, for each of the quizzes.
+ */
+func (s *RestServer) getUserStatsForQuizzes(c context.Context, userId string, quizIds []string) (map[string]map[string]*domainuser.Stats, error) {
+	result := make(map[string]map[string]*domainuser.Stats)
+
+	for _, quizId := range quizIds {
+		stats, err := s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserStatsForQuiz() failed for quiz ID: %v: %v", quizId, err)
+		}
+
+		result[quizId] = stats
+	}
+
+	return result, nil
 }
 
 func answerIsCorrect(answer string, correctAnswer *restquiz.Text) bool {
@@ -602,7 +959,8 @@ func (s *RestServer) buildRestUserHistorySections(loginInfo *restuser.LoginInfo,
 		restStats, err := convertDomainStatsToRestStats(userStats, quizCache)
 		if err != nil {
 			// Log this, but forgive it. Maybe the quiz has changed.
-			log.Printf("convertDomainStatsToRestStats() failed: %v", err)
+			// See the quiz's idMigrations, and bigoquizctl stats migrate.
+			slog.Warn("convertDomainStatsToRestStats() failed", "quizId", quizId, "error", err)
 			continue
 		}
 
@@ -0,0 +1,60 @@
+package restserver
+
+import (
+	"testing"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStatsForSections() map[string]*domainuser.Stats {
+	result := make(map[string]*domainuser.Stats)
+
+	for _, sectionId := range []string{"some-section-1", "some-section-2", "some-section-3"} {
+		stats := &domainuser.Stats{
+			QuizId:    "some-quiz",
+			SectionId: sectionId,
+		}
+		stats.UpdateStatsForAnswerCorrectness(sectionId+"-question-1", true)
+		stats.UpdateStatsForAnswerCorrectness(sectionId+"-question-2", false)
+
+		result[sectionId] = stats
+	}
+
+	return result
+}
+
+func testSectionIds(stats []*domainuser.Stats) []string {
+	var result []string
+	for _, sectionStats := range stats {
+		result = append(result, sectionStats.SectionId)
+	}
+
+	return result
+}
+
+func TestChooseStatsToResetForQuiz(t *testing.T) {
+	result := chooseStatsToReset(testStatsForSections(), "", nil)
+	assert.Equal(t, []string{"some-section-1", "some-section-2", "some-section-3"}, testSectionIds(result))
+
+	assert.Empty(t, chooseStatsToReset(nil, "", nil))
+}
+
+func TestChooseStatsToResetForSection(t *testing.T) {
+	result := chooseStatsToReset(testStatsForSections(), "some-section-2", nil)
+	assert.Equal(t, []string{"some-section-2"}, testSectionIds(result))
+
+	// A section with no stats:
+	assert.Empty(t, chooseStatsToReset(testStatsForSections(), "some-other-section", nil))
+}
+
+func TestChooseStatsToResetForQuestions(t *testing.T) {
+	questionIdsBySection := map[string][]string{
+		"some-section-1": {"some-section-1-question-2"},
+		// This question has never been answered, so this section should not be reset.
+		"some-section-3": {"some-section-3-question-3"},
+	}
+
+	result := chooseStatsToReset(testStatsForSections(), "", questionIdsBySection)
+	assert.Equal(t, []string{"some-section-1"}, testSectionIds(result))
+}
@@ -0,0 +1,197 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+)
+
+const QUERY_PARAM_DAYS = "days"
+
+// The default number of days of activity to return in the Streak's calendar.
+const defaultStreakCalendarDays = 365
+
+func (s *RestServer) HandleUserStreak(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	days := defaultStreakCalendarDays
+	queryValues := r.URL.Query()
+	if queryValues != nil {
+		daysStr := queryValues.Get(QUERY_PARAM_DAYS)
+		if len(daysStr) != 0 {
+			var err error
+			days, err = strconv.Atoi(daysStr)
+			if err != nil || days < 0 {
+				handleInvalidParameterAsHttpError(w, QUERY_PARAM_DAYS, "invalid days: %v", daysStr)
+				return
+			}
+		}
+	}
+
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if profileResult.Profile == nil || len(profileResult.UserId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return
+	}
+
+	activities, err := s.userDataClient.GetUserDailyActivities(r.Context(), profileResult.UserId)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetUserDailyActivities() failed: %v", err)
+		return
+	}
+
+	streak, err := buildRestStreak(profileResult.Profile, activities, time.Now(), days)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "buildRestStreak() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, streak)
+}
+
+func (s *RestServer) HandleUserDailyGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
+		return
+	}
+
+	var goal restuser.DailyGoal
+	err = json.Unmarshal(body, &goal)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
+		return
+	}
+
+	if len(goal.Type) == 0 {
+		goal.Type = domainuser.DailyGoalTypeAnswered
+	}
+
+	if !domainuser.IsValidDailyGoalType(goal.Type) {
+		handleInvalidParameterAsHttpError(w, "type", "invalid daily goal type: %v", goal.Type)
+		return
+	}
+
+	if goal.Target < 0 {
+		handleInvalidParameterAsHttpError(w, "target", "invalid daily goal target: %v", goal.Target)
+		return
+	}
+
+	if !domainuser.IsValidTimeZone(goal.TimeZone) {
+		handleInvalidParameterAsHttpError(w, "timeZone", "invalid time zone: %v", goal.TimeZone)
+		return
+	}
+
+	userId, err := s.getUserIdFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "logged-in check failed. getUserIdFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if len(userId) == 0 {
+		handleErrorAsHttpError(w, http.StatusUnauthorized, apierror.CODE_NOT_LOGGED_IN, "not logged in")
+		return
+	}
+
+	domainGoal := domainuser.DailyGoal{
+		Type:   goal.Type,
+		Target: goal.Target,
+	}
+
+	err = s.userDataClient.StoreUserDailyGoal(r.Context(), userId, goal.TimeZone, domainGoal)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "StoreUserDailyGoal() failed: %v", err)
+		return
+	}
+
+	marshalAndWriteOrHttpError(w, &goal)
+}
+
+/** buildRestStreak() calculates the streak, and builds the calendar of the most recent days of activity.
+ * profile must not be nil.
+ */
+func buildRestStreak(profile *domainuser.Profile, activities []*domainuser.DailyActivity, now time.Time, days int) (*restuser.Streak, error) {
+	goal := profile.DailyGoal
+	if len(goal.Type) == 0 {
+		goal.Type = domainuser.DailyGoalTypeAnswered
+	}
+
+	today := domainuser.Today(now, profile.TimeZone)
+
+	streak, err := domainuser.CalculateStreak(activities, goal, today)
+	if err != nil {
+		return nil, fmt.Errorf("CalculateStreak() failed: %v", err)
+	}
+
+	result := &restuser.Streak{
+		DailyGoal: restuser.DailyGoal{
+			Type:     goal.Type,
+			Target:   goal.Target,
+			TimeZone: profile.TimeZone,
+		},
+		CurrentStreak: streak.Current,
+		LongestStreak: streak.Longest,
+		TodayGoalMet:  streak.TodayGoalMet,
+	}
+
+	// The dates all have the same format, so we can compare them as strings.
+	firstDate := now.In(domainuser.LoadTimeZone(profile.TimeZone)).AddDate(0, 0, -days+1).Format(domainuser.DailyActivityDateLayout)
+	for _, activity := range activities {
+		if activity.Date < firstDate || activity.Date > today {
+			continue
+		}
+
+		result.Days = append(result.Days, restuser.DailyActivity{
+			Date:     activity.Date,
+			Answered: activity.Answered,
+			Correct:  activity.Correct,
+			Learned:  activity.Learned,
+			GoalMet:  goal.IsMet(activity),
+		})
+	}
+
+	sort.Slice(result.Days, func(i, j int) bool {
+		return result.Days[i].Date < result.Days[j].Date
+	})
+
+	return result, nil
+}
+
+/** Add the answer to the user's activity for today, in the user's time zone.
+ * profile is the user's profile, which the caller has already read. If it is nil, UTC is used.
+ * learned should be true if this was the first time that the question was answered correctly.
+ */
+func (s *RestServer) storeDailyActivity(c context.Context, userId string, profile *domainuser.Profile, answerIsCorrect bool, learned bool) error {
+	var timeZone string
+	if profile != nil {
+		timeZone = profile.TimeZone
+	}
+
+	today := domainuser.Today(time.Now(), timeZone)
+
+	first, err := s.userDataClient.UpdateUserDailyActivity(c, userId, today, answerIsCorrect, learned)
+	if err != nil {
+		return fmt.Errorf("UpdateUserDailyActivity() failed: %v", err)
+	}
+
+	// Only the first answer of the day can follow a broken streak,
+	// so we don't read the user's whole history for every answer.
+	if first {
+		s.enqueueStreakBrokenWebhookEvent(c, userId, profile, today)
+	}
+
+	return nil
+}
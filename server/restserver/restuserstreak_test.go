@@ -0,0 +1,45 @@
+package restserver
+
+import (
+	"testing"
+	"time"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRestStreak(t *testing.T) {
+	profile := &domainuser.Profile{
+		TimeZone: "Europe/Berlin",
+		DailyGoal: domainuser.DailyGoal{
+			Type:   domainuser.DailyGoalTypeAnswered,
+			Target: 2,
+		},
+	}
+
+	activities := []*domainuser.DailyActivity{
+		{Date: "2024-03-11", Answered: 2},
+		{Date: "2024-03-09", Answered: 1},
+		{Date: "2024-03-10", Answered: 3},
+		{Date: "2024-01-01", Answered: 3},
+	}
+
+	// This is already 2024-03-11 in Berlin.
+	now := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+
+	result, err := buildRestStreak(profile, activities, now, 7)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+
+	assert.Equal(t, 2, result.CurrentStreak)
+	assert.Equal(t, 2, result.LongestStreak)
+	assert.True(t, result.TodayGoalMet)
+	assert.Equal(t, "Europe/Berlin", result.DailyGoal.TimeZone)
+
+	// Only the recent days, in order:
+	assert.Len(t, result.Days, 3)
+	assert.Equal(t, "2024-03-09", result.Days[0].Date)
+	assert.False(t, result.Days[0].GoalMet)
+	assert.Equal(t, "2024-03-11", result.Days[2].Date)
+	assert.True(t, result.Days[2].GoalMet)
+}
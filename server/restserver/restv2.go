@@ -0,0 +1,113 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+)
+
+// The v2 API has resource-oriented paths, but shares the v1 handlers,
+// so these adapt the v2 requests to the v1 handlers' query parameters and bodies.
+
+// withV1Query calls the handler with a copy of the request that has the extra query parameters.
+func withV1Query(h httprouter.Handle, w http.ResponseWriter, r *http.Request, ps httprouter.Params, extra url.Values) {
+	query := r.URL.Query()
+	for name, values := range extra {
+		query[name] = values
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = query.Encode()
+	h(w, r2, ps)
+}
+
+// withPathParamsAsQuery returns a handler that passes the path parameters to the handler
+// as query parameters, using the map of path parameter names to query parameter names.
+func withPathParamsAsQuery(h httprouter.Handle, queryParamsByPathParam map[string]string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		extra := make(url.Values)
+		for pathParam, queryParam := range queryParamsByPathParam {
+			extra.Set(queryParam, ps.ByName(pathParam))
+		}
+
+		withV1Query(h, w, r, ps, extra)
+	}
+}
+
+// HandleV2SubmitAnswer adds an answer, or a "don't know" answer, to the user's history,
+// like HandleUserHistorySubmitAnswer() and HandleUserHistorySubmitDontKnowAnswer().
+func (s *RestServer) HandleV2SubmitAnswer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
+		return
+	}
+
+	var submission restuser.AnswerSubmission
+	err = json.Unmarshal(body, &submission)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
+		return
+	}
+
+	extra := make(url.Values)
+	extra.Set(QUERY_PARAM_QUIZ_ID, ps.ByName(PATH_PARAM_QUIZ_ID))
+	extra.Set(QUERY_PARAM_QUESTION_ID, ps.ByName(PATH_PARAM_QUESTION_ID))
+	if len(submission.NextQuestionSectionId) != 0 {
+		extra.Set(QUERY_PARAM_NEXT_QUESTION_SECTION_ID, submission.NextQuestionSectionId)
+	}
+	if len(submission.NextQuestionTag) != 0 {
+		extra.Set(QUERY_PARAM_NEXT_QUESTION_TAG, submission.NextQuestionTag)
+	}
+
+	if submission.DontKnow {
+		withV1Query(s.HandleUserHistorySubmitDontKnowAnswer, w, r, ps, extra)
+		return
+	}
+
+	v1Body, err := json.Marshal(&Submission{Answer: submission.Answer})
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "json.Marshal() failed: %v", err)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(v1Body))
+	withV1Query(s.HandleUserHistorySubmitAnswer, w, r, ps, extra)
+}
+
+// HandleV2ResetHistory resets the user's history for the quiz, a section, or some questions,
+// like HandleUserHistoryResetSections().
+func (s *RestServer) HandleV2ResetHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_REQUEST, "Could not read body: %v", err)
+		return
+	}
+
+	// An empty body resets the whole quiz.
+	var request restuser.ResetRequest
+	if len(bytes.TrimSpace(body)) != 0 {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			handleErrorAsHttpError(w, http.StatusBadRequest, apierror.CODE_INVALID_JSON, "Could not parse JSON: %v", err)
+			return
+		}
+	}
+
+	extra := make(url.Values)
+	extra.Set(QUERY_PARAM_QUIZ_ID, ps.ByName(PATH_PARAM_QUIZ_ID))
+	if len(request.SectionId) != 0 {
+		extra.Set(QUERY_PARAM_SECTION_ID, request.SectionId)
+	}
+	if len(request.QuestionIds) != 0 {
+		extra[QUERY_PARAM_QUESTION_ID] = request.QuestionIds
+	}
+
+	withV1Query(s.HandleUserHistoryResetSections, w, r, ps, extra)
+}
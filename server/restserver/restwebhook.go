@@ -0,0 +1,227 @@
+package restserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	restadmin "github.com/murraycu/go-bigoquiz-server/server/restserver/admin"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
+)
+
+// The maximum number of deliveries in the webhook delivery log.
+const maxWebhookDeliveriesInLog = 200
+
+func (s *RestServer) HandleAdminWebhookDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	profileResult, err := s.getProfileFromSessionAndDb(w, r)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "getProfileFromSessionAndDb() failed: %v", err)
+		return
+	}
+
+	if !s.isAdmin(profileResult.Profile) {
+		handleErrorAsHttpError(w, http.StatusForbidden, apierror.CODE_FORBIDDEN, "not an admin")
+		return
+	}
+
+	result := make([]*restadmin.WebhookDelivery, 0)
+	if s.webhooks == nil {
+		// No webhooks are configured.
+		marshalAndWriteOrHttpError(w, result)
+		return
+	}
+
+	deliveries, err := s.webhooks.GetDeliveries(r.Context(), maxWebhookDeliveriesInLog)
+	if err != nil {
+		handleErrorAsHttpError(w, http.StatusInternalServerError, apierror.CODE_INTERNAL_ERROR, "GetDeliveries() failed: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		result = append(result, convertDomainDeliveryToRestWebhookDelivery(delivery))
+	}
+
+	marshalAndWriteOrHttpError(w, result)
+}
+
+// convertDomainDeliveryToRestWebhookDelivery does not include the payload,
+// which the receivers can log if necessary.
+func convertDomainDeliveryToRestWebhookDelivery(delivery *domainwebhook.Delivery) *restadmin.WebhookDelivery {
+	result := &restadmin.WebhookDelivery{
+		Id:             delivery.Id,
+		WebhookId:      delivery.WebhookId,
+		Event:          delivery.Event,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		Created:        delivery.Created.UTC().Format(time.RFC3339),
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+	}
+
+	if delivery.Status == domainwebhook.DELIVERY_STATUS_PENDING {
+		result.NextAttempt = delivery.NextAttempt.UTC().Format(time.RFC3339)
+	}
+
+	if !delivery.LastAttempt.IsZero() {
+		result.LastAttempt = delivery.LastAttempt.UTC().Format(time.RFC3339)
+	}
+
+	return result
+}
+
+// isWebhookEventSubscribed returns whether any webhook subscribes to the event,
+// so we can avoid the work of detecting events that nobody wants.
+func (s *RestServer) isWebhookEventSubscribed(event string) bool {
+	return s.webhooks != nil && s.webhooks.IsSubscribed(event)
+}
+
+// enqueueWebhookEvent queues the event for the webhooks that subscribe to it.
+// Webhooks are not important enough to fail the request, so any failure is just logged.
+func (s *RestServer) enqueueWebhookEvent(c context.Context, event string, data *webhooks.Data) {
+	if s.webhooks == nil {
+		return
+	}
+
+	if err := s.webhooks.Enqueue(c, event, data); err != nil {
+		slog.ErrorContext(c, "Enqueue() failed", "event", event, "error", err)
+	}
+}
+
+// masteredSection returns whether an answer has just mastered all of the section's questions.
+// countMasteredBefore is the stats' CountQuestionsMastered before the answer.
+// A section may be mastered again, after a wrong answer, if one of its questions is forgotten.
+func masteredSection(countMasteredBefore int, stats *domainuser.Stats, sectionQuestionsCount int) bool {
+	return sectionQuestionsCount > 0 && countMasteredBefore < sectionQuestionsCount && stats.CountQuestionsMastered >= sectionQuestionsCount
+}
+
+// enqueueAnswerWebhookEvents queues the "section.mastered" and "quiz.completed" events, if the answer caused them.
+// mastered is the result of masteredSection(), and learned is true if this was the first time that the question was answered correctly.
+// sectionStats is the user's latest stats for the section.
+func (s *RestServer) enqueueAnswerWebhookEvents(c context.Context, userId string, quizId string, sectionStats *domainuser.Stats, mastered bool, learned bool) {
+	mastered = mastered && s.isWebhookEventSubscribed(domainwebhook.EVENT_SECTION_MASTERED)
+	learned = learned && s.isWebhookEventSubscribed(domainwebhook.EVENT_QUIZ_COMPLETED)
+	if (!mastered && !learned) || sectionStats == nil {
+		return
+	}
+
+	if err := s.enqueueAnswerWebhookEventsOrError(c, userId, quizId, sectionStats, mastered, learned); err != nil {
+		slog.ErrorContext(c, "enqueueAnswerWebhookEvents() failed", "quizId", quizId, "sectionId", sectionStats.SectionId, "error", err)
+	}
+}
+
+func (s *RestServer) enqueueAnswerWebhookEventsOrError(c context.Context, userId string, quizId string, sectionStats *domainuser.Stats, mastered bool, learned bool) error {
+	quizCache, err := s.getQuizCache(quizId)
+	if err != nil {
+		return fmt.Errorf("getQuizCache() failed: %v", err)
+	}
+
+	sectionId := sectionStats.SectionId
+
+	// Only answering a question correctly for the first time can complete the quiz,
+	// and only if it also completes the section, as for the certificates.
+	completed := false
+	statsBySection := map[string]*domainuser.Stats{sectionId: sectionStats}
+	if learned && len(earnedCertificates(quizCache, sectionId, statsBySection)) != 0 {
+		statsBySection, err = s.userDataClient.GetUserStatsForQuiz(c, userId, quizId)
+		if err != nil {
+			return fmt.Errorf("GetUserStatsForQuiz() failed: %v", err)
+		}
+
+		// The latest stats for the section, in case the others were read before the change was visible.
+		statsBySection[sectionId] = sectionStats
+
+		for _, certificate := range earnedCertificates(quizCache, sectionId, statsBySection) {
+			if !certificate.IsForSection() {
+				completed = true
+			}
+		}
+	}
+
+	if !mastered && !completed {
+		return nil
+	}
+
+	profile, err := s.userDataClient.GetUserProfileById(c, userId)
+	if err != nil {
+		return fmt.Errorf("GetUserProfileById() failed: %v", err)
+	}
+
+	if profile == nil {
+		return fmt.Errorf("no profile for the user")
+	}
+
+	if mastered {
+		data := &webhooks.Data{
+			UserId:         userId,
+			UserName:       profile.Name,
+			QuizId:         quizId,
+			QuizTitle:      quizCache.Quiz.Title,
+			SectionId:      sectionId,
+			CountQuestions: quizCache.GetSectionQuestionsCount(sectionId),
+		}
+
+		if section, err := quizCache.GetSection(sectionId); err == nil && section != nil {
+			data.SectionTitle = section.Title
+		}
+
+		s.enqueueWebhookEvent(c, domainwebhook.EVENT_SECTION_MASTERED, data)
+	}
+
+	if completed {
+		s.enqueueWebhookEvent(c, domainwebhook.EVENT_QUIZ_COMPLETED, &webhooks.Data{
+			UserId:         userId,
+			UserName:       profile.Name,
+			QuizId:         quizId,
+			QuizTitle:      quizCache.Quiz.Title,
+			CountQuestions: quizCache.GetQuestionsCount(),
+		})
+	}
+
+	return nil
+}
+
+// enqueueStreakBrokenWebhookEvent queues the "streak.broken" event,
+// if this is the user's first answer since their streak was broken.
+// It should only be called after the user's first answer today has been added to today's activity.
+// today is the current day, in the user's time zone.
+func (s *RestServer) enqueueStreakBrokenWebhookEvent(c context.Context, userId string, profile *domainuser.Profile, today string) {
+	if profile == nil || !s.isWebhookEventSubscribed(domainwebhook.EVENT_STREAK_BROKEN) {
+		return
+	}
+
+	activities, err := s.userDataClient.GetUserDailyActivities(c, userId)
+	if err != nil {
+		slog.ErrorContext(c, "GetUserDailyActivities() failed", "error", err)
+		return
+	}
+
+	// BrokenStreakLength() needs the activities from before today's first answer.
+	previous := make([]*domainuser.DailyActivity, 0, len(activities))
+	for _, activity := range activities {
+		if activity.Date != today {
+			previous = append(previous, activity)
+		}
+	}
+
+	length, err := domainuser.BrokenStreakLength(previous, profile.DailyGoal, today)
+	if err != nil {
+		slog.ErrorContext(c, "BrokenStreakLength() failed", "error", err)
+		return
+	}
+
+	if length == 0 {
+		return
+	}
+
+	s.enqueueWebhookEvent(c, domainwebhook.EVENT_STREAK_BROKEN, &webhooks.Data{
+		UserId:       userId,
+		UserName:     profile.Name,
+		StreakLength: length,
+	})
+}
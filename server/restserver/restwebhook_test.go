@@ -0,0 +1,134 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/murraycu/go-bigoquiz-server/server/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+// queueWebhookRepository just keeps the queued deliveries.
+type queueWebhookRepository struct {
+	db.WebhookRepository
+
+	deliveries []*domainwebhook.Delivery
+}
+
+func (db *queueWebhookRepository) StoreWebhookDeliveries(c context.Context, deliveries []*domainwebhook.Delivery) error {
+	db.deliveries = append(db.deliveries, deliveries...)
+	return nil
+}
+
+// queuedWebhookPayloads returns the payloads of the queued deliveries, in order.
+func (db *queueWebhookRepository) queuedWebhookPayloads(t *testing.T) []*webhooks.Payload {
+	var result []*webhooks.Payload
+	for _, delivery := range db.deliveries {
+		var payload webhooks.Payload
+		assert.Nil(t, json.Unmarshal(delivery.Payload, &payload))
+		result = append(result, &payload)
+	}
+
+	return result
+}
+
+func TestMasteredSection(t *testing.T) {
+	stats := &domainuser.Stats{CountQuestionsMastered: 10}
+	assert.True(t, masteredSection(9, stats, 10))
+
+	// Already mastered.
+	assert.False(t, masteredSection(10, stats, 10))
+
+	// Not all mastered yet.
+	assert.False(t, masteredSection(8, &domainuser.Stats{CountQuestionsMastered: 9}, 10))
+
+	// The section is unknown.
+	assert.False(t, masteredSection(0, stats, 0))
+}
+
+func TestEnqueueAnswerWebhookEvents(t *testing.T) {
+	quiz := loadRealRestQuiz(t, "graphs")
+	repository := &certificatesUserDataRepository{
+		statsBySection: make(map[string]*domainuser.Stats),
+		certificates:   make(map[string]*domainuser.Certificate),
+	}
+	s := testCertificatesServer(t, quiz, repository)
+
+	queue := &queueWebhookRepository{}
+	s.webhooks = webhooks.NewDispatcher([]config.Webhook{{Id: "chat", Url: "https://chat.example.com", Secret: "some-secret"}}, queue)
+
+	c := context.Background()
+	first := quiz.Sections[0]
+	stats := answerAllCorrectly(quiz, first)
+	repository.statsBySection[first.Id] = stats
+
+	// Mastering the section, but not the whole quiz.
+	s.enqueueAnswerWebhookEvents(c, "some-user", quiz.Id, stats, true, true)
+	payloads := queue.queuedWebhookPayloads(t)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, domainwebhook.EVENT_SECTION_MASTERED, payloads[0].Event)
+	assert.Equal(t, "Some User", payloads[0].Data.UserName)
+	assert.Equal(t, first.Id, payloads[0].Data.SectionId)
+	assert.Equal(t, first.Title, payloads[0].Data.SectionTitle)
+	assert.Equal(t, s.quizCacheMap[quiz.Id].GetSectionQuestionsCount(first.Id), payloads[0].Data.CountQuestions)
+
+	// Completing the whole quiz, with the last section.
+	for _, section := range quiz.Sections {
+		repository.statsBySection[section.Id] = answerAllCorrectly(quiz, section)
+	}
+
+	last := quiz.Sections[len(quiz.Sections)-1]
+	queue.deliveries = nil
+	s.enqueueAnswerWebhookEvents(c, "some-user", quiz.Id, repository.statsBySection[last.Id], false, true)
+	payloads = queue.queuedWebhookPayloads(t)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, domainwebhook.EVENT_QUIZ_COMPLETED, payloads[0].Event)
+	assert.Equal(t, quiz.Title, payloads[0].Data.QuizTitle)
+	assert.Empty(t, payloads[0].Data.SectionId)
+	assert.Equal(t, s.quizCacheMap[quiz.Id].GetQuestionsCount(), payloads[0].Data.CountQuestions)
+
+	// Only a question answered correctly for the first time can complete the quiz.
+	queue.deliveries = nil
+	s.enqueueAnswerWebhookEvents(c, "some-user", quiz.Id, repository.statsBySection[last.Id], false, false)
+	assert.Empty(t, queue.deliveries)
+
+	// Without webhooks, nothing is queued.
+	s.webhooks = nil
+	s.enqueueAnswerWebhookEvents(c, "some-user", quiz.Id, repository.statsBySection[last.Id], true, true)
+	assert.Empty(t, queue.deliveries)
+}
+
+func TestConvertDomainDeliveryToRestWebhookDelivery(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	delivery, err := domainwebhook.NewDelivery("chat", domainwebhook.EVENT_USER_CREATED, []byte(`{"secret":"payload"}`), created)
+	assert.Nil(t, err)
+
+	delivery.Attempts = 1
+	delivery.RecordAttempt(created.Add(time.Second), 500, errors.New("unexpected status: 500 Internal Server Error"))
+
+	result := convertDomainDeliveryToRestWebhookDelivery(delivery)
+	assert.Equal(t, delivery.Id, result.Id)
+	assert.Equal(t, "chat", result.WebhookId)
+	assert.Equal(t, domainwebhook.EVENT_USER_CREATED, result.Event)
+	assert.Equal(t, domainwebhook.DELIVERY_STATUS_PENDING, result.Status)
+	assert.Equal(t, 1, result.Attempts)
+	assert.Equal(t, "2024-03-01T12:00:00Z", result.Created)
+	assert.Equal(t, "2024-03-01T12:00:01Z", result.LastAttempt)
+	assert.Equal(t, delivery.NextAttempt.Format(time.RFC3339), result.NextAttempt)
+	assert.Equal(t, 500, result.LastStatusCode)
+	assert.Contains(t, result.LastError, "500")
+
+	delivery.Attempts = 2
+	delivery.RecordAttempt(created.Add(time.Minute), 200, nil)
+	result = convertDomainDeliveryToRestWebhookDelivery(delivery)
+	assert.Equal(t, domainwebhook.DELIVERY_STATUS_DELIVERED, result.Status)
+	assert.Empty(t, result.NextAttempt)
+	assert.Empty(t, result.LastError)
+}
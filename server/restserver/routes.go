@@ -0,0 +1,511 @@
+package restserver
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/repositories/quizzes/flashcards"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/certificates"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	"github.com/murraycu/go-bigoquiz-server/server/openapi"
+	restadmin "github.com/murraycu/go-bigoquiz-server/server/restserver/admin"
+	restgroup "github.com/murraycu/go-bigoquiz-server/server/restserver/group"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	restuser "github.com/murraycu/go-bigoquiz-server/server/restserver/user"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
+)
+
+// The version of the API described by the OpenAPI document.
+const API_VERSION = "2.0.0"
+
+const OPENAPI_PATH = "/api/openapi.json"
+
+// The name of the rate limiter for the answer submissions, in the metrics.
+const RATE_LIMITER_ANSWERS = "answers"
+
+// The name of the rate limiter for joining groups, in the metrics.
+const RATE_LIMITER_JOINS = "joins"
+
+// QueryParam documents a query parameter of a Route.
+type QueryParam struct {
+	Name        string
+	Description string
+	Required    bool
+
+	// Whether the parameter may be repeated.
+	Multiple bool
+}
+
+// Route describes one API endpoint,
+// both for registering it with the router and for describing it in the OpenAPI document.
+type Route struct {
+	Method string
+
+	// In httprouter syntax, such as /api/v2/quizzes/:quizId.
+	Path string
+
+	Handler httprouter.Handle
+
+	OperationId string
+	Summary     string
+	Tag         string
+
+	// The v1 routes are deprecated in favor of the v2 routes.
+	Deprecated bool
+
+	QueryParams []QueryParam
+
+	// A value of the JSON request body's type, or nil if there is no request body.
+	Request interface{}
+
+	// A value of the JSON response body's type, or nil if there is no response body.
+	Response interface{}
+
+	// The content types of a response that is not JSON.
+	// The response body is then described as a string.
+	ResponseContentTypes []string
+
+	// Whether the route is limited by the answer submission rate limits.
+	// The rate limited routes share the same limits.
+	RateLimited bool
+
+	// Whether the handler takes the rate limits' tokens itself, one for each answer in the request,
+	// instead of one for the request, because a request may have many answers.
+	RateLimitedPerAnswer bool
+
+	// Whether the route is limited by the group join rate limits, so the invite codes cannot easily be guessed.
+	JoinRateLimited bool
+}
+
+var (
+	queryParamListOnly = QueryParam{
+		Name:        QUERY_PARAM_LIST_ONLY,
+		Description: "Only return the IDs and titles.",
+	}
+
+	queryParamSectionId = QueryParam{
+		Name:        QUERY_PARAM_SECTION_ID,
+		Description: "Choose the question from this section.",
+	}
+)
+
+// Routes returns all the API routes, the v2 routes followed by the deprecated v1 routes.
+func (s *RestServer) Routes() []Route {
+	v2 := []Route{
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes", Handler: s.HandleQuizAll,
+			OperationId: "listQuizzes", Summary: "List the quizzes.", Tag: "quizzes",
+			QueryParams: []QueryParam{queryParamListOnly},
+			Response:    []*restquiz.Quiz{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID, Handler: s.HandleQuizById,
+			OperationId: "getQuiz", Summary: "Get a quiz, with its sections and questions.", Tag: "quizzes",
+			Response: &restquiz.Quiz{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID + "/sections", Handler: s.HandleQuizSectionsByQuizId,
+			OperationId: "listQuizSections", Summary: "List a quiz's sections.", Tag: "quizzes",
+			QueryParams: []QueryParam{queryParamListOnly},
+			Response:    []*restquiz.Section{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID + "/questions/:" + PATH_PARAM_QUESTION_ID, Handler: s.HandleQuizQuestionById,
+			OperationId: "getQuizQuestion", Summary: "Get a question, without its answer.", Tag: "quizzes",
+			Response: &restquiz.Question{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID + "/next-question",
+			Handler:     withPathParamsAsQuery(s.HandleQuestionNext, map[string]string{PATH_PARAM_QUIZ_ID: QUERY_PARAM_QUIZ_ID}),
+			OperationId: "getQuizNextQuestion", Summary: "Choose the next question for the user to answer.", Tag: "quizzes",
+			QueryParams: []QueryParam{queryParamSectionId},
+			Response:    &restquiz.Question{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID + "/export", Handler: s.HandleQuizExport,
+			OperationId: "exportQuiz", Summary: "Export a quiz as flashcards.", Tag: "quizzes",
+			QueryParams: []QueryParam{{
+				Name:        QUERY_PARAM_FORMAT,
+				Description: "anki, csv, or tsv.",
+				Required:    true,
+			}},
+			ResponseContentTypes: []string{
+				flashcards.ContentType(flashcards.FORMAT_ANKI),
+				flashcards.ContentType(flashcards.FORMAT_CSV),
+				flashcards.ContentType(flashcards.FORMAT_TSV),
+			},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/quizzes/:" + PATH_PARAM_QUIZ_ID + "/bundle", Handler: s.HandleQuizBundle,
+			OperationId: "getQuizBundle", Summary: "Get a quiz and the user's stats for it, to study offline.", Tag: "quizzes",
+			Response: &restuser.StudyBundle{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/collections", Handler: s.HandleCollectionAll,
+			OperationId: "listCollections", Summary: "List the tags, with the questions from all quizzes.", Tag: "collections",
+			Response: []*restquiz.Collection{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/collections/:" + PATH_PARAM_TAG, Handler: s.HandleCollectionByTag,
+			OperationId: "getCollection", Summary: "Get a tag's collection.", Tag: "collections",
+			Response: &restquiz.Collection{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/collections/:" + PATH_PARAM_TAG + "/next-question",
+			Handler:     withPathParamsAsQuery(s.HandleQuestionNext, map[string]string{PATH_PARAM_TAG: QUERY_PARAM_TAG}),
+			OperationId: "getCollectionNextQuestion", Summary: "Choose the next question, from any quiz, with the tag.", Tag: "collections",
+			Response: &restquiz.Question{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user", Handler: s.HandleUser,
+			OperationId: "getUser", Summary: "Get the user's login details.", Tag: "user",
+			Response: &restuser.LoginInfo{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/streak", Handler: s.HandleUserStreak,
+			OperationId: "getUserStreak", Summary: "Get the user's daily activity and streaks.", Tag: "user",
+			QueryParams: []QueryParam{{
+				Name:        QUERY_PARAM_DAYS,
+				Description: "How many days of activity to return.",
+			}},
+			Response: &restuser.Streak{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v2/user/daily-goal", Handler: s.HandleUserDailyGoal,
+			OperationId: "setUserDailyGoal", Summary: "Set the user's daily goal.", Tag: "user",
+			Request:  &restuser.DailyGoal{},
+			Response: &restuser.DailyGoal{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/history", Handler: s.HandleUserHistoryAll,
+			OperationId: "listUserHistory", Summary: "Get the user's stats for all quizzes.", Tag: "user",
+			Response: &restuser.HistoryOverall{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/history/:" + PATH_PARAM_QUIZ_ID, Handler: s.HandleUserHistoryByQuizId,
+			OperationId: "getUserHistory", Summary: "Get the user's stats for each section of a quiz.", Tag: "user",
+			Response: &restuser.HistorySections{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/history/:" + PATH_PARAM_QUIZ_ID + "/questions/:" + PATH_PARAM_QUESTION_ID + "/answers", Handler: s.HandleV2SubmitAnswer,
+			OperationId: "submitAnswer", Summary: "Answer a question, and get the next question.", Tag: "user",
+			Request:     &restuser.AnswerSubmission{},
+			Response:    &SubmissionResult{},
+			RateLimited: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/history/:" + PATH_PARAM_QUIZ_ID + "/reset", Handler: s.HandleV2ResetHistory,
+			OperationId: "resetUserHistory", Summary: "Forget the user's answers for a quiz, section, or questions.", Tag: "user",
+			Request:  &restuser.ResetRequest{},
+			Response: &restuser.ResetResult{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/undo-reset", Handler: s.HandleUserHistoryUndoReset,
+			OperationId: "undoResetUserHistory", Summary: "Restore the user's answers from before the latest reset.", Tag: "user",
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/sync", Handler: s.HandleUserHistorySync,
+			OperationId: "syncUserHistory", Summary: "Add the answers that the user gave while offline.", Tag: "user",
+			Request:              &restuser.SyncRequest{},
+			Response:             &restuser.SyncResult{},
+			RateLimited:          true,
+			RateLimitedPerAnswer: true,
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/certificates", Handler: s.HandleUserCertificates,
+			OperationId: "listUserCertificates", Summary: "List the user's completion certificates.", Tag: "user",
+			Response: []*restuser.Certificate{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/certificates", Handler: s.HandleIssueUserCertificates,
+			OperationId: "issueUserCertificates", Summary: "Issue any completion certificates that the user has earned but not yet received, and list all of them.", Tag: "user",
+			QueryParams: []QueryParam{{
+				Name:        QUERY_PARAM_QUIZ_ID,
+				Description: "Only issue the certificates for this quiz.",
+			}},
+			Response: []*restuser.Certificate{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/groups", Handler: s.HandleUserGroups,
+			OperationId: "listUserGroups", Summary: "List the groups that the user is a member of.", Tag: "user",
+			Response: []*restgroup.Group{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/user/assignments", Handler: s.HandleUserAssignments,
+			OperationId: "listUserAssignments", Summary: "List the assignments of the user's groups, with the user's progress.", Tag: "user",
+			Response: []*restgroup.Assignment{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/user/groups", Handler: s.HandleJoinGroup,
+			OperationId: "joinGroup", Summary: "Join a group with its invite code.", Tag: "user",
+			Request:         &restgroup.JoinRequest{},
+			Response:        &restgroup.Group{},
+			JoinRateLimited: true,
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/groups", Handler: s.HandleCreateGroup,
+			OperationId: "createGroup", Summary: "Create a group, with the user as its owner.", Tag: "groups",
+			Request:  &restgroup.CreateRequest{},
+			Response: &restgroup.Group{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID, Handler: s.HandleGroupById,
+			OperationId: "getGroup", Summary: "Get a group that the user is a member of, with its members.", Tag: "groups",
+			Response: &restgroup.Group{},
+		},
+		{
+			Method: http.MethodPut, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/membership", Handler: s.HandleGroupMembership,
+			OperationId: "setGroupMembership", Summary: "Choose whether to share the user's progress with the group.", Tag: "groups",
+			Request:  &restgroup.MembershipRequest{},
+			Response: &restgroup.Group{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/leave", Handler: s.HandleLeaveGroup,
+			OperationId: "leaveGroup", Summary: "Leave a group.", Tag: "groups",
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/invite-code", Handler: s.HandleRotateGroupInviteCode,
+			OperationId: "rotateGroupInviteCode", Summary: "Replace the group's invite code with a new one, so the old code no longer works. Only for the group's owner.", Tag: "groups",
+			Response: &restgroup.Group{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/progress", Handler: s.HandleGroupProgress,
+			OperationId: "getGroupProgress", Summary: "Get the total stats, for each section of a quiz, of the members who share their progress.", Tag: "groups",
+			QueryParams: []QueryParam{{
+				Name:        QUERY_PARAM_QUIZ_ID,
+				Description: "The quiz.",
+				Required:    true,
+			}},
+			Response: &restgroup.Progress{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/assignments", Handler: s.HandleGroupAssignments,
+			OperationId: "listGroupAssignments", Summary: "List a group's assignments, with the user's progress.", Tag: "groups",
+			Response: []*restgroup.Assignment{},
+		},
+		{
+			Method: http.MethodPost, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/assignments", Handler: s.HandleCreateAssignment,
+			OperationId: "createGroupAssignment", Summary: "Assign a quiz, or some of its sections, to the group's members. Only for the group's owner.", Tag: "groups",
+			Request:  &restgroup.AssignmentRequest{},
+			Response: &restgroup.Assignment{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/groups/:" + PATH_PARAM_GROUP_ID + "/assignments/:" + PATH_PARAM_ASSIGNMENT_ID + "/report", Handler: s.HandleAssignmentReport,
+			OperationId: "getGroupAssignmentReport", Summary: "Get the status of each learner who shares their progress. Only for the group's owner.", Tag: "groups",
+			Response: &restgroup.AssignmentReport{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/certificates/:" + PATH_PARAM_CERTIFICATE_ID, Handler: s.HandleCertificateById,
+			OperationId: "getCertificate", Summary: "Get a completion certificate, and whether its signature is valid.", Tag: "certificates",
+			Response: &restuser.Certificate{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/certificates/:" + PATH_PARAM_CERTIFICATE_ID + "/svg", Handler: s.HandleCertificateSvg,
+			OperationId: "getCertificateSvg", Summary: "Get a completion certificate as an SVG image.", Tag: "certificates",
+			ResponseContentTypes: []string{certificates.CONTENT_TYPE_SVG},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/admin/question-stats", Handler: s.HandleAdminQuestionStats,
+			OperationId: "listQuestionStats", Summary: "Get the statistics for each question, from all users.", Tag: "admin",
+			QueryParams: []QueryParam{{
+				Name:        QUERY_PARAM_QUIZ_ID,
+				Description: "Only return the statistics for this quiz.",
+			}},
+			Response: []*restadmin.QuestionStats{},
+		},
+		{
+			Method: http.MethodGet, Path: "/api/v2/admin/webhook-deliveries", Handler: s.HandleAdminWebhookDeliveries,
+			OperationId: "listWebhookDeliveries", Summary: "Get the most recent webhook deliveries, newest first.", Tag: "admin",
+			Response: []*restadmin.WebhookDelivery{},
+		},
+	}
+
+	v1 := []Route{
+		{Method: http.MethodGet, Path: "/api/quiz", Handler: s.HandleQuizAll, OperationId: "v1ListQuizzes", QueryParams: []QueryParam{queryParamListOnly}, Response: []*restquiz.Quiz{}},
+		{Method: http.MethodGet, Path: "/api/quiz/:" + PATH_PARAM_QUIZ_ID, Handler: s.HandleQuizById, OperationId: "v1GetQuiz", Response: &restquiz.Quiz{}},
+		{Method: http.MethodGet, Path: "/api/quiz/:" + PATH_PARAM_QUIZ_ID + "/section", Handler: s.HandleQuizSectionsByQuizId, OperationId: "v1ListQuizSections", QueryParams: []QueryParam{queryParamListOnly}, Response: []*restquiz.Section{}},
+		{Method: http.MethodGet, Path: "/api/quiz/:" + PATH_PARAM_QUIZ_ID + "/question/:" + PATH_PARAM_QUESTION_ID, Handler: s.HandleQuizQuestionById, OperationId: "v1GetQuizQuestion", Response: &restquiz.Question{}},
+		{Method: http.MethodGet, Path: "/api/quiz/:" + PATH_PARAM_QUIZ_ID + "/export", Handler: s.HandleQuizExport, OperationId: "v1ExportQuiz", QueryParams: []QueryParam{{Name: QUERY_PARAM_FORMAT, Required: true}}, ResponseContentTypes: []string{flashcards.ContentType(flashcards.FORMAT_ANKI), flashcards.ContentType(flashcards.FORMAT_CSV), flashcards.ContentType(flashcards.FORMAT_TSV)}},
+		{Method: http.MethodGet, Path: "/api/quiz/:" + PATH_PARAM_QUIZ_ID + "/bundle", Handler: s.HandleQuizBundle, OperationId: "v1GetQuizBundle", Response: &restuser.StudyBundle{}},
+		{Method: http.MethodGet, Path: "/api/question/next", Handler: s.HandleQuestionNext, OperationId: "v1GetNextQuestion", QueryParams: []QueryParam{{Name: QUERY_PARAM_QUIZ_ID}, queryParamSectionId, {Name: QUERY_PARAM_TAG}}, Response: &restquiz.Question{}},
+		{Method: http.MethodGet, Path: "/api/collection", Handler: s.HandleCollectionAll, OperationId: "v1ListCollections", Response: []*restquiz.Collection{}},
+		{Method: http.MethodGet, Path: "/api/collection/:" + PATH_PARAM_TAG, Handler: s.HandleCollectionByTag, OperationId: "v1GetCollection", Response: &restquiz.Collection{}},
+		{Method: http.MethodGet, Path: "/api/user", Handler: s.HandleUser, OperationId: "v1GetUser", Response: &restuser.LoginInfo{}},
+		{Method: http.MethodGet, Path: "/api/user/streak", Handler: s.HandleUserStreak, OperationId: "v1GetUserStreak", QueryParams: []QueryParam{{Name: QUERY_PARAM_DAYS}}, Response: &restuser.Streak{}},
+		{Method: http.MethodPost, Path: "/api/user/daily-goal", Handler: s.HandleUserDailyGoal, OperationId: "v1SetUserDailyGoal", Request: &restuser.DailyGoal{}, Response: &restuser.DailyGoal{}},
+		{Method: http.MethodGet, Path: "/api/user-history", Handler: s.HandleUserHistoryAll, OperationId: "v1ListUserHistory", Response: &restuser.HistoryOverall{}},
+		{Method: http.MethodGet, Path: "/api/user-history/:" + PATH_PARAM_QUIZ_ID, Handler: s.HandleUserHistoryByQuizId, OperationId: "v1GetUserHistory", Response: &restuser.HistorySections{}},
+		{Method: http.MethodPost, Path: "/api/user-history/submit-answer", Handler: s.HandleUserHistorySubmitAnswer, OperationId: "v1SubmitAnswer", QueryParams: v1SubmitQueryParams(), Request: &Submission{}, Response: &SubmissionResult{}, RateLimited: true},
+		{Method: http.MethodPost, Path: "/api/user-history/submit-dont-know-answer", Handler: s.HandleUserHistorySubmitDontKnowAnswer, OperationId: "v1SubmitDontKnowAnswer", QueryParams: v1SubmitQueryParams(), Response: &SubmissionResult{}, RateLimited: true},
+		{Method: http.MethodPost, Path: "/api/user-history/reset-sections", Handler: s.HandleUserHistoryResetSections, OperationId: "v1ResetUserHistory", QueryParams: []QueryParam{{Name: QUERY_PARAM_QUIZ_ID, Required: true}, {Name: QUERY_PARAM_SECTION_ID}, {Name: QUERY_PARAM_QUESTION_ID, Multiple: true}}, Response: &restuser.ResetResult{}},
+		{Method: http.MethodPost, Path: "/api/user-history/undo-reset", Handler: s.HandleUserHistoryUndoReset, OperationId: "v1UndoResetUserHistory"},
+		{Method: http.MethodPost, Path: "/api/user-history/sync", Handler: s.HandleUserHistorySync, OperationId: "v1SyncUserHistory", Request: &restuser.SyncRequest{}, Response: &restuser.SyncResult{}, RateLimited: true, RateLimitedPerAnswer: true},
+		{Method: http.MethodGet, Path: "/api/admin/question-stats", Handler: s.HandleAdminQuestionStats, OperationId: "v1ListQuestionStats", QueryParams: []QueryParam{{Name: QUERY_PARAM_QUIZ_ID}}, Response: []*restadmin.QuestionStats{}},
+	}
+
+	for i := range v1 {
+		v1[i].Tag = "v1"
+		v1[i].Deprecated = true
+	}
+
+	return append(v2, v1...)
+}
+
+func v1SubmitQueryParams() []QueryParam {
+	return []QueryParam{
+		{Name: QUERY_PARAM_QUIZ_ID, Required: true},
+		{Name: QUERY_PARAM_QUESTION_ID, Required: true},
+		{Name: QUERY_PARAM_NEXT_QUESTION_SECTION_ID},
+		{Name: QUERY_PARAM_NEXT_QUESTION_TAG},
+	}
+}
+
+// RegisterRoutes registers all the API routes, and the OpenAPI document, with the router.
+func (s *RestServer) RegisterRoutes(router *httprouter.Router) {
+	for _, route := range s.Routes() {
+		handler := route.Handler
+		if route.RateLimited && !route.RateLimitedPerAnswer && s.answersLimiter != nil {
+			handler = s.answersLimiter.Handle(handler)
+		}
+
+		if route.JoinRateLimited && s.joinsLimiter != nil {
+			handler = s.joinsLimiter.Handle(handler)
+		}
+
+		if route.Method != http.MethodGet && s.csrfProtector != nil {
+			handler = s.csrfProtector.Handle(handler)
+		}
+
+		router.Handle(route.Method, route.Path, instrumentHandle(route.Method, route.Path, handler))
+	}
+
+	router.GET(OPENAPI_PATH, instrumentHandle(http.MethodGet, OPENAPI_PATH, s.HandleOpenAPI))
+}
+
+// instrumentHandle records metrics and a tracing span for each request to the route.
+// The metrics include the time spent on the span.
+func instrumentHandle(method string, route string, h httprouter.Handle) httprouter.Handle {
+	return metrics.InstrumentHandle(method, route, tracing.InstrumentHandle(method, route, h))
+}
+
+// HandleOpenAPI returns the OpenAPI document that describes the API.
+func (s *RestServer) HandleOpenAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s.openAPIResponse.write(w, r, quizzesCacheControl)
+}
+
+// openAPIPath converts an httprouter path, such as /api/quiz/:quizId, to an OpenAPI path, such as /api/quiz/{quizId},
+// also returning the names of the path parameters.
+func openAPIPath(routerPath string) (string, []string) {
+	var params []string
+	parts := strings.Split(routerPath, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			name := part[1:]
+			params = append(params, name)
+			parts[i] = "{" + name + "}"
+		}
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+// BuildOpenAPIDocument describes the routes in an OpenAPI document,
+// with schemas generated from the REST types.
+func BuildOpenAPIDocument(routes []Route) *openapi.Document {
+	doc := openapi.NewDocument("BigOQuiz API", API_VERSION)
+
+	stringSchema := &openapi.Schema{Type: "string"}
+	problemSchema := doc.SchemaFor(reflect.TypeOf(apierror.Problem{}))
+
+	for _, route := range routes {
+		path, pathParams := openAPIPath(route.Path)
+
+		operation := &openapi.Operation{
+			OperationId: route.OperationId,
+			Summary:     route.Summary,
+			Deprecated:  route.Deprecated,
+			Responses:   make(map[string]*openapi.Response),
+		}
+
+		if len(route.Tag) != 0 {
+			operation.Tags = []string{route.Tag}
+		}
+
+		for _, name := range pathParams {
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   stringSchema,
+			})
+		}
+
+		for _, param := range route.QueryParams {
+			schema := stringSchema
+			if param.Multiple {
+				schema = &openapi.Schema{Type: "array", Items: stringSchema}
+			}
+
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:        param.Name,
+				In:          "query",
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      schema,
+			})
+		}
+
+		if route.Request != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					"application/json": {Schema: doc.SchemaFor(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		response := &openapi.Response{Description: "OK"}
+		if route.Response != nil {
+			response.Content = map[string]*openapi.MediaType{
+				"application/json": {Schema: doc.SchemaFor(reflect.TypeOf(route.Response))},
+			}
+		} else if len(route.ResponseContentTypes) != 0 {
+			response.Content = make(map[string]*openapi.MediaType)
+			for _, contentType := range route.ResponseContentTypes {
+				// Without parameters such as charset.
+				mediaType, _, _ := strings.Cut(contentType, ";")
+				response.Content[mediaType] = &openapi.MediaType{Schema: stringSchema}
+			}
+		}
+
+		operation.Responses["200"] = response
+		operation.Responses["default"] = &openapi.Response{
+			Description: "An error",
+			Content: map[string]*openapi.MediaType{
+				apierror.CONTENT_TYPE: {Schema: problemSchema},
+			},
+		}
+
+		if route.RateLimited || route.JoinRateLimited {
+			operation.Responses["429"] = &openapi.Response{
+				Description: "Too many requests",
+				Headers: map[string]*openapi.Header{
+					"Retry-After": {
+						Description: "How many seconds to wait before trying again.",
+						Schema:      &openapi.Schema{Type: "integer"},
+					},
+				},
+				Content: map[string]*openapi.MediaType{
+					apierror.CONTENT_TYPE: {Schema: problemSchema},
+				},
+			}
+		}
+
+		doc.AddOperation(route.Method, path, operation)
+	}
+
+	return doc
+}
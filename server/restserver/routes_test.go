@@ -0,0 +1,479 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/apierror"
+	"github.com/murraycu/go-bigoquiz-server/server/csrf"
+	"github.com/murraycu/go-bigoquiz-server/server/logging"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+	"github.com/murraycu/go-bigoquiz-server/server/openapi"
+	"github.com/murraycu/go-bigoquiz-server/server/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateOpenAPI = flag.Bool("update", false, "Update testdata/openapi.json from the routes.")
+
+const openAPIGoldenFilepath = "testdata/openapi.json"
+
+// testRoutesServer returns a server with the real quizzes, but without a database.
+func testRoutesServer(t *testing.T) *RestServer {
+	s := &RestServer{
+		quizzes:      loadRealRestQuizzes(t),
+		quizCacheMap: make(restQuizCacheMap),
+	}
+
+	for _, q := range s.quizzes {
+		quizCache, err := NewQuizCache(q)
+		assert.Nil(t, err)
+		s.quizCacheMap[q.Id] = quizCache
+
+		err = fillRestQuizExtrasFromQuizCache(q, quizCache)
+		assert.Nil(t, err)
+	}
+
+	s.tagCollections = buildTagCollections(s.quizCacheMap)
+	s.quizzesListSimple = buildQuizzesSimple(s.quizzes)
+	s.quizzesListFull = buildQuizzesFull(s.quizzes)
+
+	err := s.buildQuizResponses()
+	assert.Nil(t, err)
+
+	s.openAPIResponse, err = newCachedResponse(BuildOpenAPIDocument(s.Routes()))
+	assert.Nil(t, err)
+
+	return s
+}
+
+func marshalOpenAPIDocument(t *testing.T, doc *openapi.Document) []byte {
+	result, err := json.MarshalIndent(doc, "", "  ")
+	assert.Nil(t, err)
+
+	return append(result, '\n')
+}
+
+// TestOpenAPIDocumentIsCurrent fails if the routes, or the REST types, change without the document in testdata changing too,
+// so changes to the API are visible in reviews.
+// Run "go test ./server/restserver/ -run TestOpenAPIDocumentIsCurrent -update" to update it.
+func TestOpenAPIDocumentIsCurrent(t *testing.T) {
+	s := testQuizResponsesServer(t)
+	actual := marshalOpenAPIDocument(t, BuildOpenAPIDocument(s.Routes()))
+
+	if *updateOpenAPI {
+		err := os.MkdirAll(filepath.Dir(openAPIGoldenFilepath), 0755)
+		assert.Nil(t, err)
+
+		err = os.WriteFile(openAPIGoldenFilepath, actual, 0644)
+		assert.Nil(t, err)
+		return
+	}
+
+	expected, err := os.ReadFile(openAPIGoldenFilepath)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(actual), "The API has changed. Run the test with -update, and check the changes to %v", openAPIGoldenFilepath)
+}
+
+// TestOpenAPIDocumentPathsAreRouted checks that every operation in the document is handled by the router,
+// and that every route is in the document.
+func TestOpenAPIDocumentPathsAreRouted(t *testing.T) {
+	s := testQuizResponsesServer(t)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	doc := BuildOpenAPIDocument(s.Routes())
+	countOperations := 0
+	operationIds := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method, operation := range *item {
+			countOperations++
+
+			assert.NotEmpty(t, operation.OperationId)
+			assert.False(t, operationIds[operation.OperationId], "duplicate operation ID: %v", operation.OperationId)
+			operationIds[operation.OperationId] = true
+
+			// Replace each {param} with a value, and check that the router passes it to the handler.
+			expectedParams := make(map[string]string)
+			parts := strings.Split(path, "/")
+			for i, part := range parts {
+				if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+					name := part[1 : len(part)-1]
+					value := "some-" + strings.ToLower(name)
+					expectedParams[name] = value
+					parts[i] = value
+				}
+			}
+
+			handler, params, _ := router.Lookup(strings.ToUpper(method), strings.Join(parts, "/"))
+			assert.NotNil(t, handler, "%v %v is not routed", method, path)
+
+			for name, value := range expectedParams {
+				assert.Equal(t, value, params.ByName(name), "%v %v", method, path)
+			}
+
+			for _, param := range operation.Parameters {
+				if param.In == "path" {
+					_, ok := expectedParams[param.Name]
+					assert.True(t, ok, "%v %v has an unused path parameter: %v", method, path, param.Name)
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, len(s.Routes()), countOperations)
+
+	handler, _, _ := router.Lookup(http.MethodGet, OPENAPI_PATH)
+	assert.NotNil(t, handler)
+}
+
+func TestOpenAPIDocumentHasV2AndDeprecatedV1(t *testing.T) {
+	s := testQuizResponsesServer(t)
+
+	for _, route := range s.Routes() {
+		if strings.HasPrefix(route.Path, "/api/v2/") {
+			assert.False(t, route.Deprecated, route.Path)
+			assert.NotEmpty(t, route.Summary, route.Path)
+		} else {
+			assert.True(t, route.Deprecated, route.Path)
+		}
+	}
+}
+
+// checkValueMatchesSchema checks that the value, decoded from JSON, has only the properties, and types, in the schema.
+func checkValueMatchesSchema(t *testing.T, doc *openapi.Document, schema *openapi.Schema, value interface{}, path string) {
+	schema = doc.LookupSchema(schema)
+	if !assert.NotNil(t, schema, "%v: unknown schema", path) {
+		return
+	}
+
+	if value == nil {
+		// For instance, for nil pointers or slices.
+		return
+	}
+
+	switch schema.Type {
+	case "":
+		// Any value.
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !assert.True(t, ok, "%v: expected an object, but got %T", path, value) {
+			return
+		}
+
+		for key, propertyValue := range obj {
+			propertyPath := path + "." + key
+			if schema.AdditionalProperties != nil {
+				checkValueMatchesSchema(t, doc, schema.AdditionalProperties, propertyValue, propertyPath)
+				continue
+			}
+
+			property, ok := schema.Properties[key]
+			if !assert.True(t, ok, "%v: not in the schema", propertyPath) {
+				continue
+			}
+
+			checkValueMatchesSchema(t, doc, property, propertyValue, propertyPath)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !assert.True(t, ok, "%v: expected an array, but got %T", path, value) {
+			return
+		}
+
+		for i, item := range array {
+			checkValueMatchesSchema(t, doc, schema.Items, item, fmt.Sprintf("%v[%d]", path, i))
+		}
+	case "string":
+		_, ok := value.(string)
+		assert.True(t, ok, "%v: expected a string, but got %T", path, value)
+	case "integer":
+		number, ok := value.(float64)
+		assert.True(t, ok && number == math.Trunc(number), "%v: expected an integer, but got %v", path, value)
+	case "number":
+		_, ok := value.(float64)
+		assert.True(t, ok, "%v: expected a number, but got %T", path, value)
+	case "boolean":
+		_, ok := value.(bool)
+		assert.True(t, ok, "%v: expected a boolean, but got %T", path, value)
+	default:
+		t.Errorf("%v: unexpected schema type: %v", path, schema.Type)
+	}
+}
+
+// TestOpenAPIDocumentMatchesResponses checks that the responses of the handlers that don't need a database
+// match the document.
+func TestOpenAPIDocumentMatchesResponses(t *testing.T) {
+	s := testRoutesServer(t)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	doc := BuildOpenAPIDocument(s.Routes())
+
+	tests := []struct {
+		docPath string
+		url     string
+	}{
+		{"/api/v2/quizzes", "/api/v2/quizzes"},
+		{"/api/v2/quizzes", "/api/v2/quizzes?list-only=true"},
+		{"/api/v2/quizzes/{quizId}", "/api/v2/quizzes/graphs"},
+		{"/api/v2/quizzes/{quizId}/sections", "/api/v2/quizzes/graphs/sections"},
+		{"/api/v2/quizzes/{quizId}/sections", "/api/v2/quizzes/graphs/sections?list-only=true"},
+		{"/api/v2/quizzes/{quizId}/questions/{questionId}", "/api/v2/quizzes/graphs/questions/terminology-dag"},
+		{"/api/v2/quizzes/{quizId}/export", "/api/v2/quizzes/graphs/export?format=csv"},
+		{"/api/v2/collections", "/api/v2/collections"},
+		{"/api/quiz", "/api/quiz"},
+		{"/api/quiz/{quizId}", "/api/quiz/graphs"},
+		{"/api/quiz/{quizId}/section", "/api/quiz/graphs/section"},
+		{"/api/collection", "/api/collection"},
+	}
+
+	for _, test := range tests {
+		item, ok := doc.Paths[test.docPath]
+		if !assert.True(t, ok, test.docPath) {
+			continue
+		}
+
+		operation := (*item)["get"]
+		if !assert.NotNil(t, operation, test.docPath) {
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.url, nil)
+		router.ServeHTTP(w, r)
+		if !assert.Equal(t, http.StatusOK, w.Code, test.url) {
+			continue
+		}
+
+		response := operation.Responses["200"]
+		if !assert.NotNil(t, response, test.url) {
+			continue
+		}
+
+		contentType, _, _ := strings.Cut(w.Header().Get("Content-Type"), ";")
+		mediaType, ok := response.Content[contentType]
+		if !assert.True(t, ok, "%v: unexpected content type: %v", test.url, contentType) {
+			continue
+		}
+
+		if contentType != "application/json" {
+			continue
+		}
+
+		var value interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &value)
+		assert.Nil(t, err)
+
+		checkValueMatchesSchema(t, doc, mediaType.Schema, value, test.url)
+	}
+}
+
+func TestV2MatchesV1(t *testing.T) {
+	s := testRoutesServer(t)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	tests := []struct {
+		v1 string
+		v2 string
+	}{
+		{"/api/quiz", "/api/v2/quizzes"},
+		{"/api/quiz?list-only=true", "/api/v2/quizzes?list-only=true"},
+		{"/api/quiz/graphs", "/api/v2/quizzes/graphs"},
+		{"/api/quiz/graphs/section", "/api/v2/quizzes/graphs/sections"},
+		{"/api/quiz/graphs/export?format=tsv", "/api/v2/quizzes/graphs/export?format=tsv"},
+		{"/api/collection", "/api/v2/collections"},
+	}
+
+	for _, test := range tests {
+		w1 := httptest.NewRecorder()
+		router.ServeHTTP(w1, httptest.NewRequest(http.MethodGet, test.v1, nil))
+
+		w2 := httptest.NewRecorder()
+		router.ServeHTTP(w2, httptest.NewRequest(http.MethodGet, test.v2, nil))
+
+		assert.Equal(t, http.StatusOK, w1.Code, test.v1)
+		assert.Equal(t, w1.Code, w2.Code, test.v2)
+		assert.True(t, bytes.Equal(w1.Body.Bytes(), w2.Body.Bytes()), test.v2)
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	s := testRoutesServer(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, OPENAPI_PATH, nil)
+	s.HandleOpenAPI(w, r, nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc openapi.Document
+	err := json.Unmarshal(w.Body.Bytes(), &doc)
+	assert.Nil(t, err)
+	assert.Equal(t, openapi.VERSION, doc.OpenAPI)
+
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	assert.Contains(t, paths, "/api/v2/quizzes/{quizId}")
+	assert.Contains(t, paths, "/api/quiz/{quizId}")
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	path, params := openAPIPath("/api/v2/quizzes/:quizId/questions/:questionId")
+	assert.Equal(t, "/api/v2/quizzes/{quizId}/questions/{questionId}", path)
+	assert.Equal(t, []string{"quizId", "questionId"}, params)
+
+	path, params = openAPIPath("/api/quiz")
+	assert.Equal(t, "/api/quiz", path)
+	assert.Empty(t, params)
+}
+
+func TestRegisteredRoutesAreInstrumented(t *testing.T) {
+	s := testRoutesServer(t)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+	router.GET(metrics.PATH, metrics.Handler("some-token"))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/quizzes/nonexistent", nil))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, metrics.PATH, nil)
+	r.Header.Set("Authorization", "Bearer some-token")
+	router.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `bigoquiz_http_requests_total{method="GET",route="/api/v2/quizzes/:quizId",status="404"}`)
+	assert.Contains(t, w.Body.String(), `bigoquiz_cached_response_bytes{encoding="br"}`)
+}
+
+func TestRegisteredRoutesLogErrorsWithRequestId(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, logging.FORMAT_CLOUD_LOGGING, slog.LevelInfo)))
+	defer slog.SetDefault(previous)
+
+	s := testRoutesServer(t)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	// As in main.go, the handlers' response writers are wrapped by the metrics and tracing too.
+	w := httptest.NewRecorder()
+	logging.Middleware(router).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/quizzes/nonexistent", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	requestId := w.Header().Get(logging.HEADER_REQUEST_ID)
+	assert.NotEmpty(t, requestId)
+
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+
+		if record["code"] == string(apierror.CODE_QUIZ_NOT_FOUND) {
+			found = true
+			assert.Equal(t, requestId, record[logging.KEY_REQUEST_ID])
+		}
+	}
+
+	assert.True(t, found)
+}
+
+func TestRateLimitedRoutes(t *testing.T) {
+	s := testRoutesServer(t)
+	s.answersLimiter = ratelimit.NewLimiter(RATE_LIMITER_ANSWERS, ratelimit.NewMemoryStore(), ratelimit.PerMinute(1, 1), ratelimit.Limit{}, nil, "")
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w
+	}
+
+	// The rate limited routes share the limit.
+	assert.NotEqual(t, http.StatusTooManyRequests, post("/api/user-history/submit-dont-know-answer").Code)
+	w := post("/api/v2/user/history/bigo/questions/some-question/answers")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, apierror.CODE_RATE_LIMITED, decodeProblem(t, w).Code)
+
+	// Joining a group has its own limit.
+	s.joinsLimiter = ratelimit.NewLimiter(RATE_LIMITER_JOINS, ratelimit.NewMemoryStore(), ratelimit.PerMinute(1, 1), ratelimit.Limit{}, nil, "")
+	router = httprouter.New()
+	s.RegisterRoutes(router)
+	assert.NotEqual(t, http.StatusTooManyRequests, post("/api/v2/user/groups").Code)
+	assert.Equal(t, http.StatusTooManyRequests, post("/api/v2/user/groups").Code)
+
+	// Other routes are not limited.
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/quizzes", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	doc := BuildOpenAPIDocument(s.Routes())
+	assert.Contains(t, (*doc.Paths["/api/v2/user/history/{quizId}/questions/{questionId}/answers"])["post"].Responses, "429")
+	assert.Contains(t, (*doc.Paths["/api/v2/user/sync"])["post"].Responses, "429")
+	assert.Contains(t, (*doc.Paths["/api/v2/user/groups"])["post"].Responses, "429")
+	assert.NotContains(t, (*doc.Paths["/api/v2/user/undo-reset"])["post"].Responses, "429")
+}
+
+func TestHandleUserHistoryResetSectionsRejectsCrossSiteRequests(t *testing.T) {
+	s := testRoutesServer(t)
+	s.csrfProtector = csrf.NewProtector([]string{"https://bigoquiz.com"}, nil)
+	router := httprouter.New()
+	s.RegisterRoutes(router)
+
+	post := func(path string, header string, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set(header, value)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, path := range []string{"/api/user-history/reset-sections", "/api/v2/user/history/bigo/reset"} {
+		w := post(path, "Origin", "https://evil.example")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, apierror.CODE_CROSS_SITE_REQUEST, decodeProblem(t, w).Code)
+
+		w = post(path, "Origin", "null")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = post(path, "Sec-Fetch-Site", "cross-site")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, apierror.CODE_CROSS_SITE_REQUEST, decodeProblem(t, w).Code)
+
+		// Without a session, the token cannot be right.
+		w = post(path, csrf.HEADER_TOKEN, "some-token")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+
+	// Requests from the frontend reach the handler, which then rejects the missing quiz ID.
+	w := post("/api/user-history/reset-sections", "Origin", "https://bigoquiz.com")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, apierror.CODE_MISSING_PARAMETER, decodeProblem(t, w).Code)
+
+	// GET requests are not checked.
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/quizzes", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,118 @@
+package restserver
+
+import (
+	"sort"
+
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+)
+
+// A map of tags to the TagCollection for that tag.
+type restTagCollectionMap map[string]*TagCollection
+
+// TagCollection is a collection of questions, from any quiz, that have a tag,
+// either directly, or via their section or quiz.
+type TagCollection struct {
+	Tag string
+
+	// The IDs of the quizzes that contain questions in this collection, sorted.
+	quizIds []string
+
+	// Each Question's QuizId, SectionId, etc, identify where it came from,
+	// so we can store the user's stats against the original quiz and section.
+	questions restQuestionAndAnswerArray
+}
+
+// buildTagCollections() builds a TagCollection for each tag used by any quiz,
+// section, or question.
+// The questions must already have their extras set, via fillRestQuizExtrasFromQuizCache().
+func buildTagCollections(quizCacheMap restQuizCacheMap) restTagCollectionMap {
+	result := make(restTagCollectionMap)
+
+	// Iterate in a predictable order, so the collections are the same each time.
+	quizIds := make([]string, 0, len(quizCacheMap))
+	for quizId := range quizCacheMap {
+		quizIds = append(quizIds, quizId)
+	}
+	sort.Strings(quizIds)
+
+	for _, quizId := range quizIds {
+		quizCache := quizCacheMap[quizId]
+		if quizCache == nil || quizCache.Quiz == nil {
+			continue
+		}
+
+		for _, qa := range quizCache.questionsArray {
+			for _, tag := range quizCache.getQuestionTags(qa) {
+				collection, ok := result[tag]
+				if !ok {
+					collection = &TagCollection{Tag: tag}
+					result[tag] = collection
+				}
+
+				collection.addQuestion(quizId, qa)
+			}
+		}
+	}
+
+	return result
+}
+
+func (self *TagCollection) addQuestion(quizId string, qa *restquiz.QuestionAndAnswer) {
+	self.questions = append(self.questions, qa)
+
+	count := len(self.quizIds)
+	if count == 0 || self.quizIds[count-1] != quizId {
+		// The quizzes are added in order, so we only need to check the last one.
+		self.quizIds = append(self.quizIds, quizId)
+	}
+}
+
+// getQuestionTags returns the question's own tags,
+// plus the tags of its section and of the quiz, without duplicates.
+func (self *QuizCache) getQuestionTags(qa *restquiz.QuestionAndAnswer) []string {
+	var result []string
+	used := make(map[string]bool)
+
+	add := func(tags []string) {
+		for _, tag := range tags {
+			if len(tag) == 0 || used[tag] {
+				continue
+			}
+
+			used[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	add(self.Quiz.Tags)
+
+	if section, ok := self.sectionsMap[qa.SectionId]; ok && section != nil {
+		add(section.Tags)
+	}
+
+	add(qa.Tags)
+
+	return result
+}
+
+func (self *TagCollection) GetRandomQuestion() *restquiz.Question {
+	return getRandomQuestionFromSlice(self.questions)
+}
+
+// GetQuizIds returns the IDs of all quizzes that have questions in this collection.
+func (self *TagCollection) GetQuizIds() []string {
+	return self.quizIds
+}
+
+// GetQuestionsCount returns the number of questions, from all quizzes, in this collection.
+func (self *TagCollection) GetQuestionsCount() int {
+	return len(self.questions)
+}
+
+func (self *RestServer) getTagCollection(tag string) *TagCollection {
+	if self.tagCollections == nil {
+		return nil
+	}
+
+	return self.tagCollections[tag]
+}
@@ -0,0 +1,157 @@
+package restserver
+
+import (
+	"context"
+	"testing"
+
+	domainuser "github.com/murraycu/go-bigoquiz-server/domain/user"
+	restquiz "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+	"github.com/murraycu/go-bigoquiz-server/server/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func testQuizCacheMapWithTags(t *testing.T) restQuizCacheMap {
+	quiz1 := testRestQuiz()
+	quiz1.Id = "some-quiz-1"
+	quiz1.Tags = []string{"some-tag-quiz"}
+	quiz1.Sections[0].Tags = []string{"some-tag-section"}
+	quiz1.Sections[1].Questions[0].Tags = []string{"some-tag-question", "some-tag-section"}
+
+	quiz2 := testRestQuiz()
+	quiz2.Id = "some-quiz-2"
+	quiz2.Sections[1].Tags = []string{"some-tag-section"}
+
+	return restQuizCacheMap{
+		quiz1.Id: testQuizCacheFor(t, quiz1),
+		quiz2.Id: testQuizCacheFor(t, quiz2),
+	}
+}
+
+// testQuizCacheFor creates a QuizCache, and fills the quiz's extras, such as the questions' QuizId.
+func testQuizCacheFor(t *testing.T, quiz *restquiz.Quiz) *QuizCache {
+	quizCache, err := NewQuizCache(quiz)
+	assert.Nil(t, err)
+
+	err = fillRestQuizExtrasFromQuizCache(quiz, quizCache)
+	assert.Nil(t, err)
+
+	return quizCache
+}
+
+func TestBuildTagCollectionsFromQuizTags(t *testing.T) {
+	quizCacheMap := testQuizCacheMapWithTags(t)
+	collections := buildTagCollections(quizCacheMap)
+
+	collection, ok := collections["some-tag-quiz"]
+	assert.True(t, ok)
+	assert.NotNil(t, collection)
+
+	assert.Equal(t, []string{"some-quiz-1"}, collection.GetQuizIds())
+	assert.Equal(t, quizCacheMap["some-quiz-1"].GetQuestionsCount(), collection.GetQuestionsCount())
+}
+
+func TestBuildTagCollectionsFromSectionTagsAcrossQuizzes(t *testing.T) {
+	quizCacheMap := testQuizCacheMapWithTags(t)
+	collections := buildTagCollections(quizCacheMap)
+
+	collection, ok := collections["some-tag-section"]
+	assert.True(t, ok)
+	assert.NotNil(t, collection)
+
+	assert.Equal(t, []string{"some-quiz-1", "some-quiz-2"}, collection.GetQuizIds())
+
+	// The question that repeats its section's tag should only be counted once.
+	quiz1 := quizCacheMap["some-quiz-1"]
+	quiz2 := quizCacheMap["some-quiz-2"]
+	expectedCount := quiz1.GetSectionQuestionsCount(quiz1.Quiz.Sections[0].Id) +
+		1 + // The question with its own tag.
+		quiz2.GetSectionQuestionsCount(quiz2.Quiz.Sections[1].Id)
+	assert.Equal(t, expectedCount, collection.GetQuestionsCount())
+}
+
+func TestBuildTagCollectionsFromQuestionTags(t *testing.T) {
+	quizCacheMap := testQuizCacheMapWithTags(t)
+	collections := buildTagCollections(quizCacheMap)
+
+	collection, ok := collections["some-tag-question"]
+	assert.True(t, ok)
+	assert.NotNil(t, collection)
+
+	assert.Equal(t, 1, collection.GetQuestionsCount())
+
+	question := collection.GetRandomQuestion()
+	assert.NotNil(t, question)
+	assert.Equal(t, "some-quiz-1", question.QuizId)
+	assert.Equal(t, quizCacheMap["some-quiz-1"].Quiz.Sections[1].Id, question.SectionId)
+}
+
+func TestBuildTagCollectionsWithRealQuizzes(t *testing.T) {
+	restQuizzes := loadRealRestQuizzes(t)
+
+	quizCacheMap := make(restQuizCacheMap)
+	for _, quiz := range restQuizzes {
+		quizCacheMap[quiz.Id] = testQuizCacheFor(t, quiz)
+	}
+
+	collections := buildTagCollections(quizCacheMap)
+
+	// TODO: This depends on knowledge of the real quizzes.
+	collection, ok := collections["graphs"]
+	assert.True(t, ok)
+	assert.NotNil(t, collection)
+	assert.Contains(t, collection.GetQuizIds(), "graphs")
+	assert.Contains(t, collection.GetQuizIds(), "bigo")
+}
+
+func TestGetNextQuestionFromUserStatsForTagPrefersUnanswered(t *testing.T) {
+	quizCacheMap := testQuizCacheMapWithTags(t)
+	collections := buildTagCollections(quizCacheMap)
+	collection := collections["some-tag-question"]
+
+	var s RestServer
+	question := collection.GetRandomQuestion()
+
+	// The user has answered some other question in the same section.
+	stats := &domainuser.Stats{
+		QuizId:    question.QuizId,
+		SectionId: question.SectionId,
+	}
+	stats.UpdateStatsForAnswerCorrectness("some-other-question-id", true)
+
+	statsByQuiz := map[string]map[string]*domainuser.Stats{
+		question.QuizId: {
+			question.SectionId: stats,
+		},
+	}
+
+	result, err := s.getNextQuestionFromUserStatsForTag(context.Background(), collection, statsByQuiz)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, question.Id, result.Id)
+}
+
+func TestGetNextQuestionFromUserStatsForTagIsTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	quizCacheMap := testQuizCacheMapWithTags(t)
+	collections := buildTagCollections(quizCacheMap)
+	collection := collections["some-tag-question"]
+
+	var s RestServer
+	result, err := s.getNextQuestionFromUserStatsForTag(context.Background(), collection, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "chooseNextQuestion", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String(tracing.KEY_TAG, "some-tag-question"))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int(tracing.KEY_TRIES, 1))
+}
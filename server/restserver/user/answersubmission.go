@@ -0,0 +1,13 @@
+package user
+
+// AnswerSubmission is an answer to one question, for the v2 API.
+type AnswerSubmission struct {
+	// Ignored if DontKnow is true.
+	Answer   string `json:"answer,omitempty"`
+	DontKnow bool   `json:"dontKnow,omitempty"`
+
+	// Choose the next question from this section, or from this tag's collection,
+	// instead of from the whole quiz.
+	NextQuestionSectionId string `json:"nextQuestionSectionId,omitempty"`
+	NextQuestionTag       string `json:"nextQuestionTag,omitempty"`
+}
@@ -0,0 +1,36 @@
+package user
+
+// Certificate shows that the user answered every question of a quiz, or of a section, correctly at least once.
+// It does not include the user's ID, so it can be shown to anyone.
+type Certificate struct {
+	Id string `json:"id"`
+
+	UserName string `json:"userName"`
+
+	QuizId    string `json:"quizId"`
+	QuizTitle string `json:"quizTitle"`
+
+	// Empty if the certificate is for the whole quiz.
+	SectionId    string `json:"sectionId,omitempty"`
+	SectionTitle string `json:"sectionTitle,omitempty"`
+
+	QuizVersion    string `json:"quizVersion,omitempty"`
+	CountQuestions int    `json:"countQuestions"`
+
+	// In RFC 3339 format.
+	Issued string `json:"issued"`
+
+	// Whether the signature is valid, for a key that this server signs with, or has signed with.
+	Verified bool `json:"verified"`
+
+	// The base64 signed bytes, Ed25519 signature, and public key,
+	// so anyone can verify the certificate without trusting this server's Verified.
+	KeyId      string `json:"keyId"`
+	SignedData string `json:"signedData"`
+	Signature  string `json:"signature"`
+	PublicKey  string `json:"publicKey,omitempty"`
+
+	// The URLs of the public verification, and of the SVG image.
+	Url    string `json:"url"`
+	SvgUrl string `json:"svgUrl"`
+}
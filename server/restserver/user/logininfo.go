@@ -8,6 +8,10 @@ type LoginInfo struct {
 
 	Nickname string `json:"nickname,omitempty"`
 
+	// Requests that change the user's data may send this in the X-CSRF-Token header,
+	// instead of relying on the browser's Origin header.
+	CsrfToken string `json:"csrfToken,omitempty"`
+
 	// If the user account is linked to these oauth2 accounts:
 	GoogleLinked       bool   `json:"googleLinked"`
 	GoogleProfileUrl   string `json:"googleProfileUrl"`
@@ -0,0 +1,58 @@
+package user
+
+import "github.com/murraycu/go-bigoquiz-server/server/restserver/quiz"
+
+// StudyBundle is everything that a client needs to study a quiz offline.
+type StudyBundle struct {
+	// The quiz, including its answers.
+	Quiz *quiz.Quiz `json:"quiz"`
+
+	// The user's current stats for each section of the quiz.
+	History *HistorySections `json:"history,omitempty"`
+}
+
+// OfflineAnswer is an answer that the user gave while offline.
+type OfflineAnswer struct {
+	// An ID, chosen by the client, that is unique for the user's answers,
+	// so the answer is only added once, even if the client sends it again.
+	EventId string `json:"eventId"`
+
+	QuizId     string `json:"quizId"`
+	QuestionId string `json:"questionId"`
+
+	// Ignored if DontKnow is true.
+	Answer   string `json:"answer,omitempty"`
+	DontKnow bool   `json:"dontKnow,omitempty"`
+
+	// When the user answered, in RFC 3339 format.
+	// Answers from more than 30 days ago are rejected.
+	Time string `json:"time"`
+
+	// The quiz's version when the user answered, from the study bundle's quiz.
+	// If this is not the current version, we cannot tell whether the question has changed since,
+	// so the question will be asked again if the quiz has changed.
+	QuizVersion string `json:"quizVersion,omitempty"`
+}
+
+type SyncRequest struct {
+	Answers []*OfflineAnswer `json:"answers"`
+}
+
+// SyncRejection is an answer that could not be added, and should not be sent again.
+type SyncRejection struct {
+	EventId string `json:"eventId"`
+	Reason  string `json:"reason"`
+}
+
+type SyncResult struct {
+	// The event IDs of the answers that were added to the user's stats.
+	Applied []string `json:"applied,omitempty"`
+
+	// The event IDs of the answers that had already been added, by a previous sync.
+	Duplicates []string `json:"duplicates,omitempty"`
+
+	Rejected []*SyncRejection `json:"rejected,omitempty"`
+
+	// The current stats for each section with any of the answers.
+	Stats []*Stats `json:"stats,omitempty"`
+}
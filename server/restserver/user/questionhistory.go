@@ -11,6 +11,22 @@ type QuestionHistory struct {
 	//Increments once for each time the user answers it wrongly.
 	CountAnsweredWrong int `json:"countAnsweredWrong"`
 
+	CountAnswered int `json:"countAnswered"`
+	CountCorrect  int `json:"countCorrect"`
+
+	// The estimated probability, from 0 to 1, that the user knows the answer.
+	Mastery float64 `json:"mastery"`
+
+	// "new", "learning", or "mastered".
+	MasteryLevel string `json:"masteryLevel"`
+
+	// The quiz's version when the question was last answered, if known.
+	QuizVersion string `json:"quizVersion,omitempty"`
+
+	// Whether the question's text or answer has changed since it was last answered,
+	// so it should be asked again.
+	ContentChanged bool `json:"contentChanged"`
+
 	// TODO: Use a JSON struct.
 	// These are in the JSON for the convenience of the caller,
 	// but they should not be in the datastore:
@@ -0,0 +1,8 @@
+package user
+
+// ResetRequest chooses what to forget from the user's history for a quiz, for the v2 API.
+// If both are empty, the whole quiz is reset.
+type ResetRequest struct {
+	SectionId   string   `json:"sectionId,omitempty"`
+	QuestionIds []string `json:"questionIds,omitempty"`
+}
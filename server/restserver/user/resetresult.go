@@ -0,0 +1,10 @@
+package user
+
+type ResetResult struct {
+	// Whether the reset can be undone, until UndoExpires.
+	// This is false if there was nothing to reset.
+	CanUndo bool `json:"canUndo"`
+
+	// In RFC 3339 format.
+	UndoExpires string `json:"undoExpires,omitempty"`
+}
@@ -11,6 +11,19 @@ type Stats struct {
 	CountQuestionsAnsweredOnce int `json:"countQuestionsAnsweredOnce"`
 	CountQuestionsCorrectOnce  int `json:"countQuestionsCorrectOnce"`
 
+	// The number of questions in each mastery level.
+	// These add up to CountQuestions.
+	CountQuestionsMastered int `json:"countQuestionsMastered"`
+	CountQuestionsLearning int `json:"countQuestionsLearning"`
+	CountQuestionsNew      int `json:"countQuestionsNew"`
+
+	// The average estimated probability, from 0 to 1, that the user knows the answers,
+	// counting unanswered questions as 0.
+	Mastery float64 `json:"mastery"`
+
+	// The number of answered questions whose text or answer has changed since they were last answered.
+	CountQuestionsChanged int `json:"countQuestionsChanged"`
+
 	QuestionHistories []QuestionHistory `json:"questionHistories,omitEmpty"`
 
 	// These are from the quiz, for convenience
@@ -0,0 +1,32 @@
+package user
+
+type DailyGoal struct {
+	// "answered" or "learned".
+	Type   string `json:"type"`
+	Target int    `json:"target"`
+
+	// An IANA time zone name, such as "Europe/Berlin", used to decide when each day starts.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+type DailyActivity struct {
+	// The day, in the user's time zone, such as "2024-12-31".
+	Date string `json:"date"`
+
+	Answered int `json:"answered"`
+	Correct  int `json:"correct"`
+	Learned  int `json:"learned"`
+
+	GoalMet bool `json:"goalMet"`
+}
+
+type Streak struct {
+	DailyGoal DailyGoal `json:"dailyGoal"`
+
+	CurrentStreak int  `json:"currentStreak"`
+	LongestStreak int  `json:"longestStreak"`
+	TodayGoalMet  bool `json:"todayGoalMet"`
+
+	// Only the days with some activity, in date order.
+	Days []DailyActivity `json:"days,omitempty"`
+}
@@ -32,6 +32,23 @@ func convertDomainStatsToRestStats(stats *domainuser.Stats, quizCache *QuizCache
 		questionsCount = quizCache.GetSectionQuestionsCount(stats.SectionId)
 	}
 
+	// The questions might have changed since the stats were stored,
+	// so make sure that the counts are not negative.
+	countMastered := min(stats.CountQuestionsMastered, questionsCount)
+	countAnsweredOnce := max(min(stats.CountQuestionsAnsweredOnce, questionsCount), countMastered)
+
+	countChanged := 0
+	for _, qh := range questionHistories {
+		if qh.ContentChanged {
+			countChanged++
+		}
+	}
+
+	var mastery float64
+	if questionsCount > 0 {
+		mastery = min(stats.MasterySum/float64(questionsCount), 1)
+	}
+
 	return &restuser.Stats{
 		QuizId:                     stats.QuizId,
 		SectionId:                  stats.SectionId,
@@ -41,6 +58,12 @@ func convertDomainStatsToRestStats(stats *domainuser.Stats, quizCache *QuizCache
 		CountQuestionsCorrectOnce:  stats.CountQuestionsCorrectOnce,
 		QuestionHistories:          questionHistories,
 
+		CountQuestionsMastered: countMastered,
+		CountQuestionsLearning: countAnsweredOnce - countMastered,
+		CountQuestionsNew:      questionsCount - countAnsweredOnce,
+		Mastery:                mastery,
+		CountQuestionsChanged:  countChanged,
+
 		CountQuestions: questionsCount,
 		QuizTitle:      quizCache.Quiz.Title,
 		SectionTitle:   sectionTitle,
@@ -77,6 +100,12 @@ func convertDomainQuestionHistoryToRestQuestionHistory(obj domainuser.QuestionHi
 		QuestionId:            obj.QuestionId,
 		AnsweredCorrectlyOnce: obj.AnsweredCorrectlyOnce,
 		CountAnsweredWrong:    obj.CountAnsweredWrong,
+		CountAnswered:         obj.GetCountAnswered(),
+		CountCorrect:          obj.GetCountCorrect(),
+		Mastery:               obj.GetMastery(),
+		MasteryLevel:          domainuser.GetMasteryLevel(&obj),
+		QuizVersion:           obj.QuizVersion,
+		ContentChanged:        obj.ContentChanged(question.QuizVersion, question.ContentHash),
 
 		// Extras, which are in the REST struct, but not in the domain struct.
 		QuestionTitle:   &question.Text,
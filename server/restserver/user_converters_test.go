@@ -136,6 +136,18 @@ func TestConvertDomainQuestionHistoryToRestQuestionHistory(t *testing.T) {
 	assert.Equal(t, obj.QuestionId, result.QuestionId)
 	assert.Equal(t, obj.AnsweredCorrectlyOnce, result.AnsweredCorrectlyOnce)
 	assert.Equal(t, obj.CountAnsweredWrong, result.CountAnsweredWrong)
+	assert.Equal(t, obj.GetMastery(), result.Mastery)
+	assert.Equal(t, domainuser.MasteryLevelLearning, result.MasteryLevel)
+	assert.False(t, result.ContentChanged)
+
+	// The question has changed since it was answered.
+	question.QuizVersion = "2"
+	question.ContentHash = "new-hash"
+	obj.SetContentVersion("1", "old-hash")
+	result, err = convertDomainQuestionHistoryToRestQuestionHistory(obj, &question)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", result.QuizVersion)
+	assert.True(t, result.ContentChanged)
 }
 
 func TestConvertDomainStatsToRestStatsPerSection(t *testing.T) {
@@ -231,6 +243,32 @@ func TestConvertDomainStatsToRestStatsPerQuiz(t *testing.T) {
 	assert.Empty(t, result.SectionTitle)
 }
 
+func TestConvertDomainStatsToRestStatsMasteryLevels(t *testing.T) {
+	quiz := testRestQuiz()
+
+	obj := domainuser.Stats{
+		QuizId:                     quiz.Id,
+		CountQuestionsAnsweredOnce: 3,
+		CountQuestionsMastered:     1,
+		MasterySum:                 1.5,
+	}
+
+	quizCache, err := NewQuizCache(quiz)
+	assert.Nil(t, err)
+	assert.NotNil(t, quizCache)
+
+	result, err := convertDomainStatsToRestStats(&obj, quizCache)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+
+	countQuestions := quizCache.GetQuestionsCount()
+	assert.Equal(t, 1, result.CountQuestionsMastered)
+	assert.Equal(t, 2, result.CountQuestionsLearning)
+	assert.Equal(t, countQuestions-3, result.CountQuestionsNew)
+	assert.Equal(t, countQuestions, result.CountQuestionsMastered+result.CountQuestionsLearning+result.CountQuestionsNew)
+	assert.InDelta(t, 1.5/float64(countQuestions), result.Mastery, 0.0001)
+}
+
 func loadRealRestQuizWithExtras(t *testing.T, quizId string) (*restquiz.Quiz, *QuizCache) {
 	quiz := loadRealRestQuiz(t, quizId)
 	quizCache, err := NewQuizCache(quiz)
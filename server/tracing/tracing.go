@@ -0,0 +1,157 @@
+// Package tracing records OpenTelemetry spans for incoming requests, repository calls,
+// and other work that might be slow, such as OAuth token exchanges.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/murraycu/go-bigoquiz-server/server/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The exporters that can be specified in config.Config's TracingExporter.
+const (
+	// No spans are exported, so tracing costs almost nothing.
+	EXPORTER_NONE = ""
+
+	// The spans are written to stdout, as JSON, which is useful when running locally.
+	EXPORTER_STDOUT = "stdout"
+)
+
+const (
+	SERVICE_NAME = "bigoquiz-server"
+
+	tracerName = "github.com/murraycu/go-bigoquiz-server"
+)
+
+// The server's own span attribute keys.
+const (
+	KEY_REPOSITORY = "bigoquiz.repository"
+	KEY_QUIZ_ID    = "bigoquiz.quiz.id"
+	KEY_SECTION_ID = "bigoquiz.section.id"
+	KEY_TAG        = "bigoquiz.tag"
+	KEY_TRIES      = "bigoquiz.question.tries"
+)
+
+// Tracer returns the tracer for the server's spans, from the global TracerProvider,
+// so it records nothing until Setup() has been called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup sets the global TracerProvider, exporting the spans with the exporter,
+// sampling that ratio of the traces that are started here, from 0 to 1,
+// and sets the global propagator, so traces can continue from the callers' traceparent headers.
+// It returns a function that flushes the remaining spans, to call before exiting.
+func Setup(exporter string, sampleRatio float64) (func(c context.Context) error, error) {
+	return setup(exporter, sampleRatio, os.Stdout)
+}
+
+func setup(exporter string, sampleRatio float64, w io.Writer) (func(c context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case EXPORTER_NONE:
+		// Leave the global no-op TracerProvider.
+		return func(c context.Context) error { return nil }, nil
+	case EXPORTER_STDOUT:
+		var err error
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, fmt.Errorf("stdouttrace.New() failed: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %v", exporter)
+	}
+
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("the tracing sample ratio must be from 0 to 1: %v", sampleRatio)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(SERVICE_NAME)))
+	if err != nil {
+		return nil, fmt.Errorf("resource.Merge() failed: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		// Respect the caller's decision, if it sent a traceparent header.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// EndSpan records the error, if any, on the span, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// ObserveRepositoryCall starts a client span for a call to a repository method,
+// returning a function to call with the call's error, if any, to end the span.
+// This is a db.CallObserver, so it can be used with db.NewInstrumentedUserDataRepository().
+func ObserveRepositoryCall(c context.Context, repository string, method string) (context.Context, func(err error)) {
+	c, span := Tracer().Start(c, repository+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(KEY_REPOSITORY, repository),
+			semconv.DBOperation(method),
+		))
+
+	return c, func(err error) {
+		EndSpan(span, err)
+	}
+}
+
+// InstrumentHandle returns a handler that records a server span for each request to the route,
+// which should be the path as registered with the router, such as /api/quiz/:quizId,
+// continuing the caller's trace if the request has a traceparent header.
+// The span is in the request's context, so the handler's own spans are its children.
+func InstrumentHandle(method string, route string, h httprouter.Handle) httprouter.Handle {
+	spanName := method + " " + route
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		c := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		c, span := Tracer().Start(c, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			))
+		defer span.End()
+
+		recorder := logging.NewResponseWriter(w)
+		h(recorder, r.WithContext(c), ps)
+
+		status := recorder.Status()
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+
+		// Client errors are not errors of the server.
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
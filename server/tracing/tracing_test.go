@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useSpanRecorder sets the global TracerProvider to one that records the ended spans,
+// restoring the previous one at the end of the test.
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, a := range span.Attributes() {
+		if string(a.Key) == key {
+			return a.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func TestInstrumentHandle(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	router := httprouter.New()
+	router.GET("/api/test/:thingId", InstrumentHandle(http.MethodGet, "/api/test/:thingId", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		// The handler's own spans are children of the request's span.
+		c, done := ObserveRepositoryCall(r.Context(), "TestRepository", "GetThing")
+		assert.True(t, trace.SpanFromContext(c).SpanContext().IsValid())
+		done(nil)
+
+		if ps.ByName("thingId") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test/a", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test/broken", nil))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 4)
+
+	repositorySpan := spans[0]
+	serverSpan := spans[1]
+	assert.Equal(t, "TestRepository.GetThing", repositorySpan.Name())
+	assert.Equal(t, trace.SpanKindClient, repositorySpan.SpanKind())
+	assert.Equal(t, serverSpan.SpanContext().SpanID(), repositorySpan.Parent().SpanID())
+
+	assert.Equal(t, "GET /api/test/:thingId", serverSpan.Name())
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+	assert.Equal(t, "/api/test/:thingId", spanAttribute(serverSpan, "http.route").AsString())
+	assert.Equal(t, "/api/test/a", spanAttribute(serverSpan, "url.path").AsString())
+	assert.Equal(t, int64(http.StatusOK), spanAttribute(serverSpan, "http.response.status_code").AsInt64())
+	assert.Equal(t, codes.Unset, serverSpan.Status().Code)
+
+	brokenSpan := spans[3]
+	assert.Equal(t, int64(http.StatusInternalServerError), spanAttribute(brokenSpan, "http.response.status_code").AsInt64())
+	assert.Equal(t, codes.Error, brokenSpan.Status().Code)
+}
+
+func TestInstrumentHandleContinuesTrace(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	handler := InstrumentHandle(http.MethodGet, "/api/test", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {})
+
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	r.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), r, nil)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, traceId, spans[0].SpanContext().TraceID().String())
+	assert.True(t, spans[0].Parent().IsRemote())
+}
+
+func TestObserveRepositoryCallError(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	_, done := ObserveRepositoryCall(context.Background(), "TestRepository", "GetThing")
+	done(errors.New("some error"))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "TestRepository", spanAttribute(spans[0], KEY_REPOSITORY).AsString())
+	assert.Equal(t, "GetThing", spanAttribute(spans[0], "db.operation").AsString())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "some error", spans[0].Status().Description)
+	assert.Len(t, spans[0].Events(), 1)
+}
+
+func TestSetupStdout(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	var buf bytes.Buffer
+	shutdown, err := setup(EXPORTER_STDOUT, 1, &buf)
+	assert.Nil(t, err)
+
+	_, span := Tracer().Start(context.Background(), "some-span")
+	span.End()
+
+	// Shutting down exports the remaining spans.
+	assert.Nil(t, shutdown(context.Background()))
+	assert.Contains(t, buf.String(), `"Name":"some-span"`)
+	assert.Contains(t, buf.String(), SERVICE_NAME)
+}
+
+func TestSetupNone(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := setup(EXPORTER_NONE, 1, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, shutdown(context.Background()))
+	assert.Equal(t, previous, otel.GetTracerProvider())
+}
+
+func TestSetupInvalid(t *testing.T) {
+	_, err := setup("some-exporter", 1, nil)
+	assert.NotNil(t, err)
+
+	_, err = setup(EXPORTER_STDOUT, 1.5, &bytes.Buffer{})
+	assert.NotNil(t, err)
+}
@@ -1,11 +1,14 @@
 package usersessionstore
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 
 	"cloud.google.com/go/datastore"
 	"github.com/gorilla/sessions"
+	"github.com/murraycu/go-bigoquiz-server/config"
 	"golang.org/x/oauth2"
 )
 
@@ -22,6 +25,10 @@ const OAuthTokenTypeFacebook = "facebook"
 const DefaultSessionID = "default"
 const UserIdSessionKey = "id" // A generic user ID, not a google user ID.
 
+// The token that requests which change the user's data must send, in a header,
+// to show that they come from a page that could read it, such as our frontend, not from another site.
+const CSRFTokenSessionKey = "csrf_token"
+
 type UserIdAndOAuthToken struct {
 	UserId string
 	Token  *oauth2.Token
@@ -33,6 +40,12 @@ type UserIdAndOAuthToken struct {
 type UserSessionStore interface {
 	GetSession(r *http.Request) (*sessions.Session, error)
 	GetUserIdAndOAuthTokenFromSession(r *http.Request) (*UserIdAndOAuthToken, error)
+
+	// GetCSRFToken returns the session's CSRF token, or an empty string if it has none.
+	GetCSRFToken(r *http.Request) (string, error)
+
+	// GetOrCreateCSRFToken returns the session's CSRF token, storing a new one in the session if it has none.
+	GetOrCreateCSRFToken(r *http.Request, w http.ResponseWriter) (string, error)
 }
 
 type UserSessionStoreImpl struct {
@@ -40,14 +53,31 @@ type UserSessionStoreImpl struct {
 	store *sessions.CookieStore
 }
 
-func NewUserSessionStore(cookieKey string) (UserSessionStore, error) {
+func NewUserSessionStore(conf *config.Config) (UserSessionStore, error) {
 	result := &UserSessionStoreImpl{}
 
 	// Create the session cookie store,
-	// using the secret key from the configuration file.
-	result.store = sessions.NewCookieStore([]byte(cookieKey))
+	// using the secret key from the configuration.
+	result.store = sessions.NewCookieStore([]byte(conf.CookieKey))
 	result.store.Options.HttpOnly = true
-	result.store.Options.Secure = true // Only send via HTTPS connections, not HTTP.
+	result.store.Options.Secure = conf.Cookie.IsSecure() // Only send via HTTPS connections, not HTTP.
+	result.store.Options.Domain = conf.Cookie.Domain
+
+	if conf.Cookie.MaxAgeSeconds != 0 {
+		result.store.MaxAge(conf.Cookie.MaxAgeSeconds)
+	}
+
+	switch conf.Cookie.SameSite {
+	case config.COOKIE_SAME_SITE_STRICT:
+		result.store.Options.SameSite = http.SameSiteStrictMode
+	case config.COOKIE_SAME_SITE_NONE:
+		result.store.Options.SameSite = http.SameSiteNoneMode
+	default:
+		// Not sent with requests from other sites, such as a form posted from another site,
+		// but still sent to the OAuth callbacks, which are top-level navigations.
+		// The frontend, on bigoquiz.com, is the same site as the API, on api.bigoquiz.com.
+		result.store.Options.SameSite = http.SameSiteLaxMode
+	}
 
 	return result, nil
 }
@@ -137,3 +167,46 @@ func (s *UserSessionStoreImpl) GetUserIdAndOAuthTokenFromSession(r *http.Request
 		OAuthType: strOAuthType,
 	}, nil
 }
+
+// NewCSRFToken returns a new random token, to store in the session with CSRFTokenSessionKey.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read() failed: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *UserSessionStoreImpl) GetCSRFToken(r *http.Request) (string, error) {
+	session, err := s.GetSession(r)
+	if err != nil {
+		return "", fmt.Errorf("GetSession() failed: %v", err)
+	}
+
+	token, _ := session.Values[CSRFTokenSessionKey].(string)
+	return token, nil
+}
+
+func (s *UserSessionStoreImpl) GetOrCreateCSRFToken(r *http.Request, w http.ResponseWriter) (string, error) {
+	session, err := s.GetSession(r)
+	if err != nil {
+		return "", fmt.Errorf("GetSession() failed: %v", err)
+	}
+
+	if token, ok := session.Values[CSRFTokenSessionKey].(string); ok && len(token) != 0 {
+		return token, nil
+	}
+
+	token, err := NewCSRFToken()
+	if err != nil {
+		return "", fmt.Errorf("NewCSRFToken() failed: %v", err)
+	}
+
+	session.Values[CSRFTokenSessionKey] = token
+	if err := session.Save(r, w); err != nil {
+		return "", fmt.Errorf("session.Save() failed: %v", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,338 @@
+// Package webhooks sends learning events, such as a user mastering a section,
+// to the configured webhooks, in signed POST requests,
+// retrying failed deliveries with backoff from a queue in the datastore.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/murraycu/go-bigoquiz-server/server/metrics"
+)
+
+// The headers of each delivery.
+const (
+	// The HMAC-SHA256, with the webhook's secret, of the timestamp, a ".", and the body,
+	// as SIGNATURE_PREFIX followed by lowercase hex.
+	HEADER_SIGNATURE = "X-BigOQuiz-Signature"
+
+	// When the attempt was made, as a Unix time in seconds.
+	// Receivers should reject old timestamps, so deliveries cannot be replayed later.
+	HEADER_TIMESTAMP = "X-BigOQuiz-Timestamp"
+
+	// The event, such as "section.mastered".
+	HEADER_EVENT = "X-BigOQuiz-Event"
+
+	// The delivery's ID, which is the same for each attempt, so receivers can ignore repeats.
+	HEADER_DELIVERY = "X-BigOQuiz-Delivery"
+)
+
+const SIGNATURE_PREFIX = "sha256="
+
+const (
+	// How long each attempt may take.
+	attemptTimeout = 10 * time.Second
+
+	// How long other instances of the server wait before attempting a delivery that has been started,
+	// in case this instance stops during the attempt.
+	attemptLease = time.Minute
+
+	// The maximum number of due deliveries to attempt each time.
+	maxDueDeliveries = 100
+
+	// How long deliveries stay in the delivery log.
+	deliveryRetention = 30 * 24 * time.Hour
+
+	// How often to delete the deliveries that are older than deliveryRetention.
+	deleteOldDeliveriesInterval = time.Hour
+
+	// How much of each webhook's response to read, so the connection can be reused.
+	maxResponseBytes = 64 * 1024
+)
+
+// Payload is the JSON body of each delivery.
+type Payload struct {
+	// The delivery's ID.
+	Id string `json:"id"`
+
+	Event string `json:"event"`
+
+	// When the event happened, in RFC 3339 format.
+	Created string `json:"created"`
+
+	Data *Data `json:"data"`
+}
+
+// Data describes the event. Only the fields that apply to the event are set.
+type Data struct {
+	// Enqueue() replaces the user's ID with UserIdForWebhook(),
+	// so receivers get an ID that is stable for the webhook, but that is not the datastore's key,
+	// and that cannot be matched with the IDs that other webhooks get.
+	UserId   string `json:"userId"`
+	UserName string `json:"userName"`
+
+	QuizId       string `json:"quizId,omitempty"`
+	QuizTitle    string `json:"quizTitle,omitempty"`
+	SectionId    string `json:"sectionId,omitempty"`
+	SectionTitle string `json:"sectionTitle,omitempty"`
+
+	// The number of questions in the section, or in the quiz.
+	CountQuestions int `json:"countQuestions,omitempty"`
+
+	// The length, in days, of the streak that was broken.
+	StreakLength int `json:"streakLength,omitempty"`
+}
+
+// Dispatcher queues the events for the webhooks that subscribe to them, and delivers them.
+type Dispatcher struct {
+	// In the configuration's order.
+	webhooks []config.Webhook
+
+	repository db.WebhookRepository
+
+	client *http.Client
+
+	// Wakes Run() when there are new deliveries.
+	wake chan struct{}
+
+	now func() time.Time
+}
+
+func NewDispatcher(webhooks []config.Webhook, repository db.WebhookRepository) *Dispatcher {
+	return &Dispatcher{
+		webhooks:   webhooks,
+		repository: repository,
+		client:     &http.Client{Timeout: attemptTimeout},
+		wake:       make(chan struct{}, 1),
+		now:        time.Now,
+	}
+}
+
+// IsSubscribed returns whether any webhook subscribes to the event,
+// so callers can avoid the work of detecting events that nobody wants.
+func (self *Dispatcher) IsSubscribed(event string) bool {
+	for _, webhook := range self.webhooks {
+		if webhook.IsSubscribed(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enqueue stores a delivery of the event for each webhook that subscribes to it,
+// to be delivered soon by Run().
+func (self *Dispatcher) Enqueue(c context.Context, event string, data *Data) error {
+	now := self.now().UTC()
+
+	var deliveries []*domainwebhook.Delivery
+	for _, webhook := range self.webhooks {
+		if !webhook.IsSubscribed(event) {
+			continue
+		}
+
+		delivery, err := domainwebhook.NewDelivery(webhook.Id, event, nil, now)
+		if err != nil {
+			return fmt.Errorf("NewDelivery() failed: %v", err)
+		}
+
+		webhookData := *data
+		if len(data.UserId) != 0 {
+			webhookData.UserId = UserIdForWebhook(webhook.Secret, data.UserId)
+		}
+
+		delivery.Payload, err = json.Marshal(&Payload{
+			Id:      delivery.Id,
+			Event:   event,
+			Created: now.Format(time.RFC3339),
+			Data:    &webhookData,
+		})
+		if err != nil {
+			return fmt.Errorf("json.Marshal() failed: %v", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := self.repository.StoreWebhookDeliveries(c, deliveries); err != nil {
+		return fmt.Errorf("StoreWebhookDeliveries() failed: %v", err)
+	}
+
+	select {
+	case self.wake <- struct{}{}:
+	default:
+		// Run() has already been woken.
+	}
+
+	return nil
+}
+
+// GetDeliveries returns the most recent deliveries, newest first, for the delivery log.
+func (self *Dispatcher) GetDeliveries(c context.Context, maxDeliveries int) ([]*domainwebhook.Delivery, error) {
+	return self.repository.GetWebhookDeliveries(c, maxDeliveries)
+}
+
+// Run delivers the pending deliveries that are due, once immediately, and then after each interval,
+// or sooner if there are new deliveries, until the context is cancelled.
+// The deliveries that are older than deliveryRetention are deleted once an hour.
+func (self *Dispatcher) Run(c context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastDeletedOld time.Time
+	for {
+		if _, err := self.DeliverPending(c); err != nil {
+			slog.ErrorContext(c, "DeliverPending() failed", "error", err)
+		}
+
+		if now := self.now(); now.Sub(lastDeletedOld) >= deleteOldDeliveriesInterval {
+			lastDeletedOld = now
+			if _, err := self.repository.DeleteOldWebhookDeliveries(c, now.Add(-deliveryRetention)); err != nil {
+				slog.ErrorContext(c, "DeleteOldWebhookDeliveries() failed", "error", err)
+			}
+		}
+
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		case <-self.wake:
+		}
+	}
+}
+
+// DeliverPending attempts the pending deliveries that are due, the longest overdue first,
+// returning the number of attempts.
+func (self *Dispatcher) DeliverPending(c context.Context) (int, error) {
+	deliveries, err := self.repository.GetDueWebhookDeliveries(c, self.now().UTC(), maxDueDeliveries)
+	if err != nil {
+		return 0, fmt.Errorf("GetDueWebhookDeliveries() failed: %v", err)
+	}
+
+	result := 0
+	for _, delivery := range deliveries {
+		now := self.now().UTC()
+		if !delivery.IsDue(now) {
+			continue
+		}
+
+		webhook := self.getWebhook(delivery.WebhookId)
+		if webhook == nil {
+			delivery.Fail(now, "the webhook is no longer configured")
+			if err := self.repository.StoreWebhookDeliveries(c, []*domainwebhook.Delivery{delivery}); err != nil {
+				return result, fmt.Errorf("StoreWebhookDeliveries() failed: %v", err)
+			}
+
+			continue
+		}
+
+		// Another instance of the server may have started it since we got it.
+		delivery, err = self.repository.StartWebhookDeliveryAttempt(c, delivery.Id, now, now.Add(attemptLease))
+		if err != nil {
+			return result, fmt.Errorf("StartWebhookDeliveryAttempt() failed: %v", err)
+		}
+
+		if delivery == nil {
+			continue
+		}
+
+		statusCode, err := self.send(c, webhook, delivery)
+		metrics.ObserveWebhookDeliveryAttempt(webhook.Id, delivery.Event, err)
+		if err != nil {
+			slog.WarnContext(c, "Webhook delivery attempt failed", "webhookId", webhook.Id, "deliveryId", delivery.Id, "attempts", delivery.Attempts, "error", err)
+		}
+
+		delivery.RecordAttempt(self.now().UTC(), statusCode, err)
+		if err := self.repository.StoreWebhookDeliveries(c, []*domainwebhook.Delivery{delivery}); err != nil {
+			return result, fmt.Errorf("StoreWebhookDeliveries() failed: %v", err)
+		}
+
+		result++
+	}
+
+	return result, nil
+}
+
+func (self *Dispatcher) getWebhook(webhookId string) *config.Webhook {
+	for i := range self.webhooks {
+		if self.webhooks[i].Id == webhookId {
+			return &self.webhooks[i]
+		}
+	}
+
+	return nil
+}
+
+// send posts the delivery's payload to the webhook, returning the response's status code, if any,
+// and an error if the webhook did not accept it with a 2xx status.
+func (self *Dispatcher) send(c context.Context, webhook *config.Webhook, delivery *domainwebhook.Delivery) (int, error) {
+	timestamp := strconv.FormatInt(self.now().Unix(), 10)
+
+	r, err := http.NewRequestWithContext(c, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("http.NewRequestWithContext() failed: %v", err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(HEADER_SIGNATURE, Sign(webhook.Secret, timestamp, delivery.Payload))
+	r.Header.Set(HEADER_TIMESTAMP, timestamp)
+	r.Header.Set(HEADER_EVENT, delivery.Event)
+	r.Header.Set(HEADER_DELIVERY, delivery.Id)
+
+	response, err := self.client.Do(r)
+	if err != nil {
+		return 0, fmt.Errorf("Do() failed: %v", err)
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBytes))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected status: %v", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Sign returns the value of the HEADER_SIGNATURE header for the body, sent at the HEADER_TIMESTAMP timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// UserIdForWebhook returns the user's ID as sent to the webhook with this secret.
+// It is the hex HMAC-SHA256 of the user's ID, keyed with the secret, so it changes if the secret changes.
+func UserIdForWebhook(secret string, userId string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("user:"))
+	mac.Write([]byte(userId))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns whether the signature, from the HEADER_SIGNATURE header, is valid for the body and timestamp.
+// This is for receivers, which should also check that the timestamp is recent.
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
@@ -0,0 +1,311 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/murraycu/go-bigoquiz-server/config"
+	domainwebhook "github.com/murraycu/go-bigoquiz-server/domain/webhook"
+	"github.com/murraycu/go-bigoquiz-server/repositories/db"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = strings.Repeat("s", config.MIN_WEBHOOK_SECRET_LENGTH)
+
+// memoryWebhookRepository is the queue, and the delivery log, in memory.
+type memoryWebhookRepository struct {
+	db.WebhookRepository
+
+	deliveries map[string]*domainwebhook.Delivery
+}
+
+func newMemoryWebhookRepository() *memoryWebhookRepository {
+	return &memoryWebhookRepository{deliveries: make(map[string]*domainwebhook.Delivery)}
+}
+
+func (db *memoryWebhookRepository) StoreWebhookDeliveries(c context.Context, deliveries []*domainwebhook.Delivery) error {
+	for _, delivery := range deliveries {
+		stored := *delivery
+		db.deliveries[delivery.Id] = &stored
+	}
+
+	return nil
+}
+
+// GetDueWebhookDeliveries is like the datastore's query, with the same limit.
+func (db *memoryWebhookRepository) GetDueWebhookDeliveries(c context.Context, now time.Time, maxDeliveries int) ([]*domainwebhook.Delivery, error) {
+	var result []*domainwebhook.Delivery
+	for _, delivery := range db.deliveries {
+		if delivery.Status == domainwebhook.DELIVERY_STATUS_PENDING && !delivery.NextAttempt.After(now) {
+			copied := *delivery
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].NextAttempt.Before(result[j].NextAttempt)
+	})
+
+	return result[:min(len(result), maxDeliveries)], nil
+}
+
+func (db *memoryWebhookRepository) StartWebhookDeliveryAttempt(c context.Context, deliveryId string, now time.Time, leaseUntil time.Time) (*domainwebhook.Delivery, error) {
+	delivery, ok := db.deliveries[deliveryId]
+	if !ok || !delivery.IsDue(now) {
+		return nil, nil
+	}
+
+	delivery.Attempts++
+	delivery.NextAttempt = leaseUntil
+
+	copied := *delivery
+	return &copied, nil
+}
+
+func (db *memoryWebhookRepository) GetWebhookDeliveries(c context.Context, maxDeliveries int) ([]*domainwebhook.Delivery, error) {
+	var result []*domainwebhook.Delivery
+	for _, delivery := range db.deliveries {
+		result = append(result, delivery)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+
+	return result, nil
+}
+
+// receiver is a local webhook endpoint, which checks the signatures.
+type receiver struct {
+	mutex sync.Mutex
+
+	// The status to respond with.
+	status int
+
+	payloads []Payload
+	headers  []http.Header
+}
+
+func newReceiver(t *testing.T) (*receiver, *httptest.Server) {
+	result := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.True(t, Verify(testSecret, r.Header.Get(HEADER_TIMESTAMP), body, r.Header.Get(HEADER_SIGNATURE)))
+
+		var payload Payload
+		assert.Nil(t, json.Unmarshal(body, &payload))
+
+		result.mutex.Lock()
+		defer result.mutex.Unlock()
+		result.payloads = append(result.payloads, payload)
+		result.headers = append(result.headers, r.Header.Clone())
+
+		w.WriteHeader(result.status)
+	}))
+	t.Cleanup(server.Close)
+
+	return result, server
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	chat, chatServer := newReceiver(t)
+	lms, lmsServer := newReceiver(t)
+
+	repository := newMemoryWebhookRepository()
+	dispatcher := NewDispatcher([]config.Webhook{
+		{Id: "chat", Url: chatServer.URL, Secret: testSecret, Events: []string{domainwebhook.EVENT_QUIZ_COMPLETED}},
+		{Id: "lms", Url: lmsServer.URL, Secret: testSecret},
+	}, repository)
+
+	assert.True(t, dispatcher.IsSubscribed(domainwebhook.EVENT_USER_CREATED))
+
+	c := context.Background()
+	data := &Data{UserId: "some-user", UserName: "Some User", QuizId: "bigo", QuizTitle: "Big-O", CountQuestions: 12}
+	assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_QUIZ_COMPLETED, data))
+	assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_USER_CREATED, &Data{UserId: "other-user", UserName: "Other User"}))
+	assert.Len(t, repository.deliveries, 3)
+
+	count, err := dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	// The chat only subscribes to quiz.completed.
+	assert.Len(t, chat.payloads, 1)
+	assert.Equal(t, domainwebhook.EVENT_QUIZ_COMPLETED, chat.payloads[0].Event)
+	expectedData := *data
+	expectedData.UserId = UserIdForWebhook(testSecret, "some-user")
+	assert.Equal(t, expectedData, *chat.payloads[0].Data)
+	assert.Equal(t, domainwebhook.EVENT_QUIZ_COMPLETED, chat.headers[0].Get(HEADER_EVENT))
+	assert.Equal(t, chat.payloads[0].Id, chat.headers[0].Get(HEADER_DELIVERY))
+
+	assert.Len(t, lms.payloads, 2)
+
+	for _, delivery := range repository.deliveries {
+		assert.Equal(t, domainwebhook.DELIVERY_STATUS_DELIVERED, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	}
+
+	// Nothing is delivered twice.
+	count, err = dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	chat, chatServer := newReceiver(t)
+	chat.status = http.StatusServiceUnavailable
+
+	repository := newMemoryWebhookRepository()
+	dispatcher := NewDispatcher([]config.Webhook{{Id: "chat", Url: chatServer.URL, Secret: testSecret}}, repository)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+
+	c := context.Background()
+	assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_STREAK_BROKEN, &Data{UserId: "some-user", StreakLength: 5}))
+
+	count, err := dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	deliveries, err := dispatcher.GetDeliveries(c, 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, domainwebhook.DELIVERY_STATUS_PENDING, delivery.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.LastStatusCode)
+	assert.Contains(t, delivery.LastError, "503")
+	assert.Equal(t, now.Add(domainwebhook.RetryDelay(1)), delivery.NextAttempt)
+
+	// Not retried until the delay has passed.
+	count, err = dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+
+	now = delivery.NextAttempt
+	chat.status = http.StatusNoContent
+	count, err = dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	delivery = repository.deliveries[delivery.Id]
+	assert.Equal(t, domainwebhook.DELIVERY_STATUS_DELIVERED, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+
+	// Each attempt has the same delivery ID and body.
+	assert.Len(t, chat.payloads, 2)
+	assert.Equal(t, chat.payloads[0], chat.payloads[1])
+}
+
+func TestDispatcherDeliversWhileOthersBackOff(t *testing.T) {
+	down, downServer := newReceiver(t)
+	down.status = http.StatusBadGateway
+	up, upServer := newReceiver(t)
+
+	repository := newMemoryWebhookRepository()
+	dispatcher := NewDispatcher([]config.Webhook{
+		{Id: "down", Url: downServer.URL, Secret: testSecret, Events: []string{domainwebhook.EVENT_USER_CREATED}},
+		{Id: "up", Url: upServer.URL, Secret: testSecret, Events: []string{domainwebhook.EVENT_QUIZ_COMPLETED}},
+	}, repository)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+
+	// More deliveries than one call attempts, all failing, and then waiting to be retried.
+	c := context.Background()
+	countBackedOff := maxDueDeliveries + 50
+	for i := 0; i < countBackedOff; i++ {
+		assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_USER_CREATED, &Data{UserId: "some-user"}))
+	}
+
+	for attempted := 0; attempted < countBackedOff; {
+		count, err := dispatcher.DeliverPending(c)
+		assert.Nil(t, err)
+		assert.NotZero(t, count)
+		attempted += count
+	}
+
+	assert.Len(t, down.payloads, countBackedOff)
+
+	// A new delivery, for another webhook, is not hidden by the ones waiting to be retried.
+	now = now.Add(time.Second)
+	assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_QUIZ_COMPLETED, &Data{UserId: "some-user", QuizId: "bigo"}))
+
+	count, err := dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Len(t, up.payloads, 1)
+	assert.Len(t, down.payloads, countBackedOff)
+
+	// When they are due, they are retried.
+	now = now.Add(domainwebhook.RetryDelay(1))
+	count, err = dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Equal(t, maxDueDeliveries, count)
+}
+
+func TestDispatcherFailsRemovedWebhook(t *testing.T) {
+	repository := newMemoryWebhookRepository()
+	dispatcher := NewDispatcher([]config.Webhook{{Id: "old", Url: "https://old.example.com", Secret: testSecret}}, repository)
+
+	c := context.Background()
+	assert.Nil(t, dispatcher.Enqueue(c, domainwebhook.EVENT_USER_CREATED, &Data{UserId: "some-user"}))
+
+	dispatcher = NewDispatcher([]config.Webhook{{Id: "new", Url: "https://new.example.com", Secret: testSecret}}, repository)
+	count, err := dispatcher.DeliverPending(c)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+
+	for _, delivery := range repository.deliveries {
+		assert.Equal(t, domainwebhook.DELIVERY_STATUS_FAILED, delivery.Status)
+		assert.Zero(t, delivery.Attempts)
+	}
+}
+
+func TestDispatcherNotSubscribed(t *testing.T) {
+	repository := newMemoryWebhookRepository()
+	dispatcher := NewDispatcher([]config.Webhook{{Id: "chat", Url: "https://chat.example.com", Secret: testSecret, Events: []string{domainwebhook.EVENT_QUIZ_COMPLETED}}}, repository)
+
+	assert.False(t, dispatcher.IsSubscribed(domainwebhook.EVENT_STREAK_BROKEN))
+	assert.Nil(t, dispatcher.Enqueue(context.Background(), domainwebhook.EVENT_STREAK_BROKEN, &Data{UserId: "some-user"}))
+	assert.Empty(t, repository.deliveries)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"quiz.completed"}`)
+	signature := Sign(testSecret, "1700000000", body)
+	assert.True(t, strings.HasPrefix(signature, SIGNATURE_PREFIX))
+	assert.Len(t, signature, len(SIGNATURE_PREFIX)+64)
+	assert.True(t, Verify(testSecret, "1700000000", body, signature))
+
+	assert.False(t, Verify(testSecret, "1700000001", body, signature))
+	assert.False(t, Verify(testSecret, "1700000000", []byte(`{"event":"quiz.started"}`), signature))
+	assert.False(t, Verify(strings.Repeat("t", 32), "1700000000", body, signature))
+}
+
+func TestUserIdForWebhook(t *testing.T) {
+	userId := UserIdForWebhook(testSecret, "some-user")
+	assert.Len(t, userId, 64)
+	assert.NotContains(t, userId, "some-user")
+
+	// Stable for the webhook.
+	assert.Equal(t, userId, UserIdForWebhook(testSecret, "some-user"))
+
+	assert.NotEqual(t, userId, UserIdForWebhook(testSecret, "other-user"))
+
+	// Webhooks with different secrets cannot match their users.
+	assert.NotEqual(t, userId, UserIdForWebhook(strings.Repeat("t", 32), "some-user"))
+}